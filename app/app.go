@@ -9,9 +9,11 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"time"
 
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/config/configmanager"
+	"github.com/abiosoft/colima/daemon/process/inotify"
 	"github.com/abiosoft/colima/environment"
 	"github.com/abiosoft/colima/environment/container/docker"
 	"github.com/abiosoft/colima/environment/container/kubernetes"
@@ -303,6 +305,20 @@ func (c colimaApp) Status(extended bool) error {
 		log.Println("kubernetes: enabled")
 	}
 
+	// file sync, reported by the inotify process when running
+	if s, err := inotify.ReadStatus(); err == nil {
+		if s.Probe != nil {
+			if s.Probe.Error != "" {
+				log.Warnln("inotify: file sync probe failed:", s.Probe.Error)
+			} else {
+				log.Println("inotify: file sync verified, latency:", s.Probe.Latency.Round(time.Millisecond))
+			}
+		}
+		if h := s.Health; h != nil && h.Lagging {
+			log.Warnf("inotify: file sync is lagging, average latency: %v, average backlog: %.1f event(s)", h.Latency.Round(time.Millisecond), h.Backlog)
+		}
+	}
+
 	// additional details
 	if extended {
 		if inst, err := limautil.Instance(); err == nil {
@@ -4,6 +4,7 @@ import (
 	"context"
 	"fmt"
 	"io"
+	"math/rand"
 	"time"
 
 	log "github.com/sirupsen/logrus"
@@ -140,14 +141,30 @@ func (a ActiveCommandChain) Exec() error {
 // If after `count` attempts there is an error, the command chain is terminated with the final error.
 // retryCount starts from 1.
 func (a *ActiveCommandChain) Retry(stage string, interval time.Duration, count int, f func(retryCount int) error) {
+	a.RetryWithJitter(stage, interval, 0, count, f)
+}
+
+// RetryWithJitter is like Retry but adds a random duration in the range [0, jitter)
+// to each interval. This prevents concurrent clients from retrying in lockstep.
+func (a *ActiveCommandChain) RetryWithJitter(stage string, interval, jitter time.Duration, count int, f func(retryCount int) error) {
 	a.Add(func() (err error) {
 		var i int
 		for err = f(i + 1); i < count && err != nil; i, err = i+1, f(i+1) {
 			if stage != "" {
 				a.log.Println(stage, "...")
 			}
-			time.Sleep(interval)
+			sleep(jitteredInterval(interval, jitter))
 		}
 		return err
 	})
 }
+
+// sleep is swapped in tests.
+var sleep = time.Sleep
+
+func jitteredInterval(interval, jitter time.Duration) time.Duration {
+	if jitter <= 0 {
+		return interval
+	}
+	return interval + time.Duration(rand.Int63n(int64(jitter)))
+}
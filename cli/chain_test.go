@@ -0,0 +1,63 @@
+package cli
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+)
+
+func TestActiveCommandChain_RetryWithJitter(t *testing.T) {
+	var intervals []time.Duration
+	sleep = func(d time.Duration) { intervals = append(intervals, d) }
+	defer func() { sleep = time.Sleep }()
+
+	const (
+		interval = time.Second * 5
+		jitter   = time.Second * 2
+		count    = 20
+	)
+
+	a := New("test").Init(context.Background())
+	a.RetryWithJitter("", interval, jitter, count, func(int) error {
+		return fmt.Errorf("failed")
+	})
+	if err := a.Exec(); err == nil {
+		t.Fatal("expected error after exhausting retries")
+	}
+
+	if len(intervals) == 0 {
+		t.Fatal("expected retries")
+	}
+	for i, d := range intervals {
+		if d < interval || d >= interval+jitter {
+			t.Errorf("interval %d = %v, want within [%v, %v)", i, d, interval, interval+jitter)
+		}
+	}
+}
+
+func TestActiveCommandChain_Retry(t *testing.T) {
+	var intervals []time.Duration
+	sleep = func(d time.Duration) { intervals = append(intervals, d) }
+	defer func() { sleep = time.Sleep }()
+
+	a := New("test").Init(context.Background())
+	a.Retry("", time.Second, 5, func(retryCount int) error {
+		if retryCount < 3 {
+			return fmt.Errorf("failed")
+		}
+		return nil
+	})
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if len(intervals) == 0 {
+		t.Fatal("expected retries")
+	}
+	for i, d := range intervals {
+		if d != time.Second {
+			t.Errorf("interval %d = %v, want %v", i, d, time.Second)
+		}
+	}
+}
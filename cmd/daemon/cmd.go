@@ -8,7 +8,9 @@ import (
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/daemon/process"
 	"github.com/abiosoft/colima/daemon/process/inotify"
+	"github.com/abiosoft/colima/daemon/process/k3s"
 	"github.com/abiosoft/colima/daemon/process/vmnet"
+	"github.com/abiosoft/colima/environment"
 	"github.com/abiosoft/colima/environment/host"
 	"github.com/abiosoft/colima/environment/vm/lima"
 	"github.com/spf13/cobra"
@@ -28,6 +30,7 @@ var startCmd = &cobra.Command{
 	Args:  cobra.ExactArgs(1),
 	RunE: func(cmd *cobra.Command, args []string) error {
 		config.SetProfile(args[0])
+		lima.SetMaxSessions(daemonArgs.sshMaxSessions)
 		ctx := cmd.Context()
 
 		var processes []process.Process
@@ -35,16 +38,20 @@ var startCmd = &cobra.Command{
 			processes = append(processes, vmnet.New())
 		}
 		if daemonArgs.inotify.enabled {
-			processes = append(processes, inotify.New())
-			guest := lima.New(host.New())
-			args := inotify.Args{
-				GuestActions: guest,
-				Runtime:      daemonArgs.inotify.runtime,
-				Dirs:         daemonArgs.inotify.dirs,
+			args, err := inotifyArgs(lima.New(host.New()))
+			if err != nil {
+				return err
 			}
+			processes = append(processes, inotify.New())
 			ctx = context.WithValue(ctx, inotify.CtxKeyArgs(), args)
 		}
 
+		if daemonArgs.k3s {
+			processes = append(processes, k3s.New())
+			args := k3s.Args{GuestActions: lima.New(host.New())}
+			ctx = context.WithValue(ctx, k3s.CtxKeyArgs(), args)
+		}
+
 		return start(ctx, processes)
 	},
 }
@@ -78,12 +85,44 @@ var statusCmd = &cobra.Command{
 	},
 }
 
+var suppressCmd = &cobra.Command{
+	Use:   "suppress [profile]",
+	Short: "suppress inotify events",
+	Long:  `suppress the propagation of inotify events of the daemon for a duration`,
+	Args:  cobra.ExactArgs(1),
+	RunE: func(cmd *cobra.Command, args []string) error {
+		config.SetProfile(args[0])
+
+		return suppress(daemonArgs.suppress)
+	},
+}
+
 var daemonArgs struct {
-	vmnet   bool
-	inotify struct {
-		enabled bool
-		dirs    []string
-		runtime string
+	vmnet          bool
+	k3s            bool
+	sshMaxSessions int
+	suppress       time.Duration
+	inotify        struct {
+		enabled         bool
+		dirs            []string
+		roots           []string
+		files           []string
+		events          []string
+		limit           int
+		concurrency     int
+		suppress        int
+		followSymlinks  bool
+		fifo            string
+		skipHiddenDirs  bool
+		skipHiddenFiles bool
+		strictWatch     bool
+		probe           bool
+		waitRuntime     bool
+		historySize     int
+		poll            int
+		sentinel        string
+		runtime         string
+		disabled        bool
 	}
 
 	verbose bool
@@ -95,9 +134,74 @@ func init() {
 	daemonCmd.AddCommand(startCmd)
 	daemonCmd.AddCommand(stopCmd)
 	daemonCmd.AddCommand(statusCmd)
+	daemonCmd.AddCommand(suppressCmd)
+
+	suppressCmd.Flags().DurationVar(&daemonArgs.suppress, "duration", time.Minute, "set duration to suppress events for, 0 to end the suppression")
 
 	startCmd.Flags().BoolVar(&daemonArgs.vmnet, "vmnet", false, "start vmnet")
+	startCmd.Flags().BoolVar(&daemonArgs.k3s, "k3s", false, "start k3s supervisor")
+	startCmd.Flags().IntVar(&daemonArgs.sshMaxSessions, "ssh-max-sessions", 0, "set maximum commands run concurrently in the VM")
 	startCmd.Flags().BoolVar(&daemonArgs.inotify.enabled, "inotify", false, "start inotify")
 	startCmd.Flags().StringSliceVar(&daemonArgs.inotify.dirs, "inotify-dir", nil, "set inotify directories")
+	startCmd.Flags().StringSliceVar(&daemonArgs.inotify.roots, "inotify-root", nil, "set additional inotify directories as host:guest")
+	startCmd.Flags().StringSliceVar(&daemonArgs.inotify.files, "inotify-file", nil, "set inotify files to watch directly as host[:guest]")
+	startCmd.Flags().StringSliceVar(&daemonArgs.inotify.events, "inotify-event", nil, "set inotify events to propagate")
+	startCmd.Flags().IntVar(&daemonArgs.inotify.limit, "inotify-limit", 0, "set maximum inotify events per batch, -1 for unlimited")
+	startCmd.Flags().IntVar(&daemonArgs.inotify.concurrency, "inotify-watch-concurrency", 0, "set maximum directories added to the watcher concurrently")
+	startCmd.Flags().IntVar(&daemonArgs.inotify.suppress, "inotify-suppress", 0, "set milliseconds to ignore events for a file after it is synced, -1 to disable")
+	startCmd.Flags().BoolVar(&daemonArgs.inotify.followSymlinks, "inotify-follow-symlinks", false, "watch symlinked directories")
+	startCmd.Flags().BoolVar(&daemonArgs.inotify.skipHiddenDirs, "inotify-skip-hidden-dirs", false, "skip events within hidden directories")
+	startCmd.Flags().BoolVar(&daemonArgs.inotify.skipHiddenFiles, "inotify-skip-hidden-files", false, "skip events for hidden files")
+	startCmd.Flags().BoolVar(&daemonArgs.inotify.strictWatch, "inotify-strict-watch", false, "fail if any directory cannot be watched")
+	startCmd.Flags().BoolVar(&daemonArgs.inotify.probe, "inotify-probe", false, "verify the sync on start with a probe file in a watched directory")
+	startCmd.Flags().BoolVar(&daemonArgs.inotify.waitRuntime, "inotify-wait-runtime", false, "wait for the container runtime to be ready before watching")
+	startCmd.Flags().IntVar(&daemonArgs.inotify.historySize, "inotify-history-size", inotify.DefaultHistorySize, "set number of recent events retained for diagnostics, 0 to disable")
+	startCmd.Flags().IntVar(&daemonArgs.inotify.poll, "inotify-poll-interval", 0, "set milliseconds between scans of the files for changes instead of native events")
+	startCmd.Flags().StringVar(&daemonArgs.inotify.fifo, "inotify-fifo", "", "set named pipe on the host to write propagated events to")
+	startCmd.Flags().StringVar(&daemonArgs.inotify.sentinel, "inotify-sentinel", "", "set file to touch once per batch instead of propagating each event")
 	startCmd.Flags().StringVar(&daemonArgs.inotify.runtime, "inotify-runtime", "docker", "set runtime")
+	startCmd.Flags().BoolVar(&daemonArgs.inotify.disabled, "inotify-disabled", false, "start inotify without propagating events")
+}
+
+// inotifyArgs returns the args of the inotify process for guest from the flags.
+func inotifyArgs(guest environment.GuestActions) (inotify.Args, error) {
+	var roots []inotify.Root
+	for _, r := range daemonArgs.inotify.roots {
+		root, err := inotify.ParseRoot(r)
+		if err != nil {
+			return inotify.Args{}, err
+		}
+		roots = append(roots, root)
+	}
+	var files []inotify.Root
+	for _, f := range daemonArgs.inotify.files {
+		file, err := inotify.ParseFile(f)
+		if err != nil {
+			return inotify.Args{}, err
+		}
+		files = append(files, file)
+	}
+
+	return inotify.Args{
+		GuestActions:    guest,
+		Runtime:         daemonArgs.inotify.runtime,
+		Dirs:            daemonArgs.inotify.dirs,
+		Events:          daemonArgs.inotify.events,
+		Limit:           daemonArgs.inotify.limit,
+		Sentinel:        daemonArgs.inotify.sentinel,
+		Concurrency:     daemonArgs.inotify.concurrency,
+		Suppress:        time.Duration(daemonArgs.inotify.suppress) * time.Millisecond,
+		FollowSymlinks:  daemonArgs.inotify.followSymlinks,
+		FIFO:            daemonArgs.inotify.fifo,
+		SkipHiddenDirs:  daemonArgs.inotify.skipHiddenDirs,
+		SkipHiddenFiles: daemonArgs.inotify.skipHiddenFiles,
+		StrictWatch:     daemonArgs.inotify.strictWatch,
+		Probe:           daemonArgs.inotify.probe,
+		WaitRuntime:     daemonArgs.inotify.waitRuntime,
+		HistorySize:     daemonArgs.inotify.historySize,
+		Poll:            time.Duration(daemonArgs.inotify.poll) * time.Millisecond,
+		Roots:           roots,
+		Files:           files,
+		Disabled:        daemonArgs.inotify.disabled,
+	}, nil
 }
@@ -0,0 +1,58 @@
+package daemon
+
+import (
+	"context"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/colima/daemon/process/inotify"
+	"github.com/abiosoft/colima/environment"
+)
+
+// fakeGuest records the commands run in the VM.
+type fakeGuest struct {
+	environment.GuestActions
+	sync.Mutex
+	commands []string
+}
+
+func (f *fakeGuest) run(args ...string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.commands = append(f.commands, strings.Join(args, " "))
+	return nil
+}
+
+func (f *fakeGuest) Run(args ...string) error                 { return f.run(args...) }
+func (f *fakeGuest) RunQuiet(args ...string) error            { return f.run(args...) }
+func (f *fakeGuest) RunOutput(args ...string) (string, error) { return "", f.run(args...) }
+
+func Test_inotifyArgs_disabled(t *testing.T) {
+	saved := daemonArgs
+	t.Cleanup(func() { daemonArgs = saved })
+
+	if err := startCmd.Flags().Parse([]string{"--inotify", "--inotify-dir", t.TempDir(), "--inotify-disabled"}); err != nil {
+		t.Fatal(err)
+	}
+	guest := &fakeGuest{}
+	args, err := inotifyArgs(guest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithTimeout(context.Background(), 100*time.Millisecond)
+	defer cancel()
+	if err := inotify.New().Start(context.WithValue(ctx, inotify.CtxKeyArgs(), args)); err != nil {
+		t.Fatal(err)
+	}
+
+	// the process idles until stopped without watching or syncing
+	if ctx.Err() == nil {
+		t.Error("expected the disabled process to idle until stopped")
+	}
+	if len(guest.commands) != 0 {
+		t.Errorf("expected no commands in the VM, got %+v", guest.commands)
+	}
+}
@@ -13,6 +13,7 @@ import (
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/daemon/process/inotify"
 	"github.com/abiosoft/colima/util/fsutil"
 	godaemon "github.com/sevlyar/go-daemon"
 	"github.com/sirupsen/logrus"
@@ -110,31 +111,57 @@ func stop(ctx context.Context) error {
 }
 
 func status() error {
+	pid, err := daemonPid()
+	if err != nil {
+		return err
+	}
+
+	// check if process is actually running
+	process, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("process not found: %v", err)
+	}
+
+	if err := process.Signal(syscall.Signal(0)); err != nil {
+		return fmt.Errorf("process signal(0) returned error: %w", err)
+	}
+
+	return nil
+}
+
+// daemonPid returns the pid of the daemon in the pid file.
+func daemonPid() (int, error) {
 	info := Info()
 	if _, err := os.Stat(info.PidFile); err != nil {
-		return fmt.Errorf("pid file not found: %w", err)
+		return 0, fmt.Errorf("pid file not found: %w", err)
 	}
 
-	// check if process is actually running
 	p, err := os.ReadFile(info.PidFile)
 	if err != nil {
-		return fmt.Errorf("error reading pid file: %w", err)
+		return 0, fmt.Errorf("error reading pid file: %w", err)
 	}
 	pid, _ := strconv.Atoi(string(p))
 	if pid == 0 {
-		return fmt.Errorf("invalid pid: %v", string(p))
+		return 0, fmt.Errorf("invalid pid: %v", string(p))
 	}
+	return pid, nil
+}
 
-	process, err := os.FindProcess(pid)
+// suppress suppresses the inotify events of the running daemon for d, a non-positive d ends the suppression.
+func suppress(d time.Duration) error {
+	if err := status(); err != nil {
+		return fmt.Errorf("daemon not running: %w", err)
+	}
+	pid, err := daemonPid()
 	if err != nil {
-		return fmt.Errorf("process not found: %v", err)
+		return err
 	}
 
-	if err := process.Signal(syscall.Signal(0)); err != nil {
-		return fmt.Errorf("process signal(0) returned error: %w", err)
+	var until time.Time
+	if d > 0 {
+		until = time.Now().Add(d)
 	}
-
-	return nil
+	return inotify.Suppress(pid, until)
 }
 
 const (
@@ -163,6 +190,9 @@ func RunProcesses(ctx context.Context, processes ...process.Process) error {
 	ctx, stop := context.WithCancel(ctx)
 	defer stop()
 
+	// the signals handled by the processes do not terminate the daemon when not handled
+	signal.Ignore(syscall.SIGUSR1, syscall.SIGUSR2)
+
 	var wg sync.WaitGroup
 	wg.Add(len(processes))
 
@@ -343,6 +343,16 @@ func prepareConfig(cmd *cobra.Command) {
 	startCmdArgs.Docker = current.Docker
 	// provision scripts can only be set in config file
 	startCmdArgs.Provision = current.Provision
+	// inotify settings can only be set in config file
+	startCmdArgs.INotify = current.INotify
+	// kubernetes settings without flags can only be set in config file
+	{
+		kubernetes := current.Kubernetes
+		kubernetes.Enabled = startCmdArgs.Kubernetes.Enabled
+		kubernetes.Version = startCmdArgs.Kubernetes.Version
+		kubernetes.K3sArgs = startCmdArgs.Kubernetes.K3sArgs
+		startCmdArgs.Kubernetes = kubernetes
+	}
 
 	// use current settings for unchanged configs
 	// otherwise may be reverted to their default values.
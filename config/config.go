@@ -87,6 +87,7 @@ type Config struct {
 	Mounts       []Mount `yaml:"mounts,omitempty"`
 	MountType    string  `yaml:"mountType,omitempty"`
 	MountINotify bool    `yaml:"mountInotify,omitempty"`
+	INotify      INotify `yaml:"inotify,omitempty"`
 
 	// Runtime is one of docker, containerd.
 	Runtime         string `yaml:"runtime,omitempty"`
@@ -103,6 +104,15 @@ type Config struct {
 
 	// SSH config generation
 	SSHConfig bool `yaml:"sshConfig,omitempty"`
+
+	// SSHMaxSessions is the maximum number of commands run concurrently in the VM by each colima process.
+	SSHMaxSessions int `yaml:"sshMaxSessions,omitempty"`
+
+	// MaxDownloads is the maximum number of files downloaded concurrently by each colima process.
+	MaxDownloads int `yaml:"maxDownloads,omitempty"`
+
+	// DownloadMode is where files are downloaded i.e. host or guest, host if empty.
+	DownloadMode string `yaml:"downloadMode,omitempty"`
 }
 
 // Kubernetes is kubernetes configuration
@@ -110,6 +120,262 @@ type Kubernetes struct {
 	Enabled bool     `yaml:"enabled"`
 	Version string   `yaml:"version"`
 	K3sArgs []string `yaml:"k3sArgs"`
+
+	// ExtraArgs are additional args passed to k3s without validation.
+	ExtraArgs []string `yaml:"extraArgs,omitempty"`
+
+	// Role is the k3s role, one of server or agent. Defaults to server.
+	Role string `yaml:"role,omitempty"`
+
+	// Server is the URL of the k3s server to join as an agent or as an additional server.
+	Server string `yaml:"server,omitempty"`
+
+	// Token is the token to join the k3s server.
+	Token string `yaml:"token,omitempty"`
+
+	// InstallEnv are additional environment variables for the k3s install script e.g. INSTALL_K3S_CHANNEL.
+	InstallEnv map[string]string `yaml:"installEnv,omitempty"`
+
+	// SecretInstallEnv are the names of the install env vars masked in the output.
+	SecretInstallEnv []string `yaml:"secretInstallEnv,omitempty"`
+
+	// DatastoreEndpoint is the external datastore of a k3s server, mutually exclusive with Server.
+	DatastoreEndpoint string `yaml:"datastoreEndpoint,omitempty"`
+
+	// DataDir is the k3s data directory, /var/lib/rancher/k3s if empty.
+	DataDir string `yaml:"dataDir,omitempty"`
+
+	// LocalStoragePath is the path in the VM for the volumes of the bundled local-path-provisioner.
+	LocalStoragePath string `yaml:"localStoragePath,omitempty"`
+
+	// NodeIP overrides the discovered IP address of the node.
+	NodeIP string `yaml:"nodeIP,omitempty"`
+
+	// KubeProxyMode is the kube-proxy mode, one of iptables or ipvs.
+	KubeProxyMode string `yaml:"kubeProxyMode,omitempty"`
+
+	// DNSUpstreams are the nameservers CoreDNS forwards to instead of the VM's resolvers.
+	DNSUpstreams []string `yaml:"dnsUpstreams,omitempty"`
+
+	// PullThroughCache is the endpoint of a pull-through cache registry the k3s image pulls are mirrored through.
+	PullThroughCache string `yaml:"pullThroughCache,omitempty"`
+
+	// PullThroughRegistries are the registries mirrored through the pull-through cache, docker.io if empty.
+	PullThroughRegistries []string `yaml:"pullThroughRegistries,omitempty"`
+
+	// Kubeconfig is the kubeconfig file on the host to merge the cluster into, ~/.kube/config if empty.
+	Kubeconfig string `yaml:"kubeconfig,omitempty"`
+
+	// Context is the name of the context, cluster and user in the host kubeconfig, the profile name if empty.
+	Context string `yaml:"context,omitempty"`
+
+	// VerifyDNS verifies the cluster DNS resolves from a throwaway pod after the installation.
+	VerifyDNS bool `yaml:"verifyDNS,omitempty"`
+
+	// DNSCheckImage is the image of the pod verifying the cluster DNS, busybox if empty.
+	DNSCheckImage string `yaml:"dnsCheckImage,omitempty"`
+
+	// DefaultDeny applies a NetworkPolicy denying all ingress and egress traffic to the default deny namespaces.
+	DefaultDeny bool `yaml:"defaultDeny,omitempty"`
+
+	// DefaultDenyNamespaces are the namespaces of the default deny NetworkPolicy, default if empty.
+	DefaultDenyNamespaces []string `yaml:"defaultDenyNamespaces,omitempty"`
+
+	// IngressControllers are the ingress controllers to install, each with a distinct ingress class.
+	IngressControllers []IngressController `yaml:"ingressControllers,omitempty"`
+
+	// CABundle is the PEM encoded CA bundle on the host added to the trust store of the VM.
+	CABundle string `yaml:"caBundle,omitempty"`
+
+	// Hosts are the hostname to IP address entries added to /etc/hosts in the VM.
+	Hosts map[string]string `yaml:"hosts,omitempty"`
+
+	// Rootless runs k3s as the VM user instead of root.
+	Rootless bool `yaml:"rootless,omitempty"`
+
+	// SudoCommand is the privilege escalation command for the install commands, sudo if empty.
+	SudoCommand string `yaml:"sudoCommand,omitempty"`
+
+	// Shell is the shell in the VM running the k3s install script, sh if empty.
+	Shell string `yaml:"shell,omitempty"`
+
+	// ContainerdSocket overrides the containerd socket used by k3s.
+	ContainerdSocket string `yaml:"containerdSocket,omitempty"`
+
+	// RuntimeEndpoint overrides the container runtime endpoint used by k3s for any runtime.
+	RuntimeEndpoint string `yaml:"runtimeEndpoint,omitempty"`
+
+	// KeepAssets persists downloaded k3s assets in the VM for subsequent installs.
+	KeepAssets bool `yaml:"keepAssets,omitempty"`
+
+	// NodeLabels are labels to register the node with.
+	NodeLabels map[string]string `yaml:"nodeLabels,omitempty"`
+
+	// Eviction are the kubelet eviction thresholds.
+	Eviction KubeletEviction `yaml:"eviction,omitempty"`
+
+	// SystemReserved are the resources reserved by the kubelet for the system daemons, keyed by resource.
+	SystemReserved map[string]string `yaml:"systemReserved,omitempty"`
+
+	// KubeReserved are the resources reserved by the kubelet for the Kubernetes components, keyed by resource.
+	KubeReserved map[string]string `yaml:"kubeReserved,omitempty"`
+
+	// ContainerLogMaxSize is the maximum size of a container log before it is rotated e.g. 10Mi.
+	ContainerLogMaxSize string `yaml:"containerLogMaxSize,omitempty"`
+
+	// ContainerLogMaxFiles is the maximum number of log files kept for a container.
+	ContainerLogMaxFiles int `yaml:"containerLogMaxFiles,omitempty"`
+
+	// ControllerManagerArgs are the extra args of the kube-controller-manager in the form name=value.
+	ControllerManagerArgs []string `yaml:"controllerManagerArgs,omitempty"`
+
+	// SchedulerArgs are the extra args of the kube-scheduler in the form name=value.
+	SchedulerArgs []string `yaml:"schedulerArgs,omitempty"`
+
+	// FeatureGates are the Kubernetes feature gates enabled or disabled for all the components.
+	FeatureGates map[string]bool `yaml:"featureGates,omitempty"`
+
+	// EtcdSnapshots are the periodic snapshots of the embedded etcd.
+	EtcdSnapshots EtcdSnapshots `yaml:"etcdSnapshots,omitempty"`
+
+	// PodSecurity are the cluster-wide PodSecurity admission defaults.
+	PodSecurity PodSecurity `yaml:"podSecurity,omitempty"`
+
+	// HelmVersion is the version of helm to install in the VM, helm is not installed if empty.
+	HelmVersion string `yaml:"helmVersion,omitempty"`
+
+	// ImageTars are image tars on the host to preload into the airgap images.
+	ImageTars []string `yaml:"imageTars,omitempty"`
+
+	// ImageImports is the maximum number of image tars to import concurrently.
+	ImageImports int `yaml:"imageImports,omitempty"`
+
+	// Checksums are the pinned SHA-256 checksums of the downloaded assets, keyed by asset/version/arch
+	// e.g. k3s/v1.28.3+k3s2/amd64. Pinned checksums take precedence over the published checksums.
+	Checksums map[string]string `yaml:"checksums,omitempty"`
+
+	// StrictChecksums refuses the download of assets without a pinned checksum.
+	StrictChecksums bool `yaml:"strictChecksums,omitempty"`
+
+	// UserAgent overrides the user agent for downloading the k3s assets.
+	UserAgent string `yaml:"userAgent,omitempty"`
+
+	// DownloadTimeout is the timeout in seconds for a stalled download attempt of the k3s assets.
+	DownloadTimeout int `yaml:"downloadTimeout,omitempty"`
+
+	// DownloadBufferSize is the buffer size in KiB for copying the downloaded k3s assets to the VM.
+	DownloadBufferSize int `yaml:"downloadBufferSize,omitempty"`
+
+	// DownloadRetries is the number of retries after a failed download of a k3s asset.
+	DownloadRetries int `yaml:"downloadRetries,omitempty"`
+
+	// DownloadRetryInterval is the interval in seconds between the attempts of a failed download, 2 if zero.
+	DownloadRetryInterval int `yaml:"downloadRetryInterval,omitempty"`
+
+	// AirgapImagesURL overrides the download url of the airgap images, %arch% is replaced by the architecture.
+	AirgapImagesURL string `yaml:"airgapImagesUrl,omitempty"`
+
+	// Supervise restarts k3s from the colima daemon when the API becomes unreachable.
+	Supervise bool `yaml:"supervise,omitempty"`
+
+	// CheckKernelModules verifies the kernel modules required by the flannel backend are available before installing k3s.
+	CheckKernelModules bool `yaml:"checkKernelModules,omitempty"`
+
+	// ConcurrentDownloads is the maximum number of k3s assets to download concurrently.
+	ConcurrentDownloads int `yaml:"concurrentDownloads,omitempty"`
+
+	// PrePullImages are the images pulled into the container runtime after k3s is ready.
+	PrePullImages []string `yaml:"prePullImages,omitempty"`
+
+	// PostStart are the commands to run in order after k3s is ready.
+	PostStart []PostStartCommand `yaml:"postStart,omitempty"`
+}
+
+// PostStartCommand is a command to run after k3s is ready.
+type PostStartCommand struct {
+	Command string `yaml:"command"`        // shell command
+	Host    bool   `yaml:"host,omitempty"` // run on the host instead of the VM
+
+	Retries       int  `yaml:"retries,omitempty"`       // number of retries after a failure
+	RetryInterval int  `yaml:"retryInterval,omitempty"` // seconds between retries, 2 if zero
+	IgnoreFailure bool `yaml:"ignoreFailure,omitempty"` // report the failure without failing the startup
+}
+
+// EtcdSnapshots is the configuration for the periodic snapshots of the embedded etcd of k3s.
+type EtcdSnapshots struct {
+	Schedule  string `yaml:"schedule,omitempty"`  // cron expression, k3s default if empty
+	Retention int    `yaml:"retention,omitempty"` // number of snapshots to keep, k3s default if zero
+	Dir       string `yaml:"dir,omitempty"`       // snapshot directory in the VM, k3s default if empty
+}
+
+// PodSecurity is the configuration for the cluster-wide defaults of the PodSecurity admission.
+// The levels are privileged, baseline or restricted, privileged if empty.
+type PodSecurity struct {
+	Enforce          string   `yaml:"enforce,omitempty"`
+	Audit            string   `yaml:"audit,omitempty"`
+	Warn             string   `yaml:"warn,omitempty"`
+	ExemptNamespaces []string `yaml:"exemptNamespaces,omitempty"` // kube-system is always exempt
+}
+
+// IngressController is the configuration for an ingress controller installed in the cluster.
+type IngressController struct {
+	Name      string `yaml:"name"`                // traefik or nginx
+	Class     string `yaml:"class,omitempty"`     // ingress class, the name if empty
+	HTTPPort  int    `yaml:"httpPort,omitempty"`  // 80 if zero
+	HTTPSPort int    `yaml:"httpsPort,omitempty"` // 443 if zero
+}
+
+// KubeletEviction is the configuration for the kubelet eviction thresholds, keyed by eviction signal.
+type KubeletEviction struct {
+	Hard            map[string]string `yaml:"hard,omitempty"`
+	Soft            map[string]string `yaml:"soft,omitempty"`
+	SoftGracePeriod map[string]string `yaml:"softGracePeriod,omitempty"`
+}
+
+// INotify is the configuration for propagating inotify file events to the VM.
+type INotify struct {
+	// Events are the file events to propagate i.e. write, create, remove, rename.
+	Events []string `yaml:"events,omitempty"`
+	// Limit is the maximum number of unique events propagated every 500ms, -1 for unlimited.
+	Limit int `yaml:"limit,omitempty"`
+	// Sentinel is the file touched once per 500ms with events instead of propagating each event.
+	Sentinel string `yaml:"sentinel,omitempty"`
+	// WatchConcurrency is the maximum number of directories added to the watcher concurrently.
+	WatchConcurrency int `yaml:"watchConcurrency,omitempty"`
+	// PollInterval is the interval in milliseconds to scan the files for changes instead of
+	// watching for native file events, 0 for native file events.
+	PollInterval int `yaml:"pollInterval,omitempty"`
+	// Suppress is the duration in milliseconds events for a file are ignored after it is synced, -1 to disable.
+	Suppress int `yaml:"suppress,omitempty"`
+	// FollowSymlinks watches the directories symlinked within the watched directories.
+	FollowSymlinks bool `yaml:"followSymlinks,omitempty"`
+	// SkipHiddenDirs skips the events within hidden directories e.g. .git.
+	SkipHiddenDirs bool `yaml:"skipHiddenDirs,omitempty"`
+	// SkipHiddenFiles skips the events for hidden files e.g. .env.
+	SkipHiddenFiles bool `yaml:"skipHiddenFiles,omitempty"`
+	// HistorySize is the number of recently dispatched events retained for diagnostics, 0 to disable.
+	// The default of the daemon is used if nil.
+	HistorySize *int `yaml:"historySize,omitempty"`
+	// WaitRuntime waits for the container runtime to be ready before watching.
+	WaitRuntime bool `yaml:"waitRuntime,omitempty"`
+	// StrictWatch fails the daemon if any of the directories cannot be watched.
+	StrictWatch bool `yaml:"strictWatch,omitempty"`
+	// FIFO is the named pipe on the host the propagated events are written to, one "<op> <path>" per line.
+	FIFO string `yaml:"fifo,omitempty"`
+	// Roots are additional host directories to watch that are not mounted in the VM.
+	Roots []INotifyRoot `yaml:"roots,omitempty"`
+	// Files are single host files watched directly, the guest path is the host path if empty.
+	Files []INotifyRoot `yaml:"files,omitempty"`
+	// Disabled keeps the inotify daemon process running without propagating events.
+	Disabled bool `yaml:"disabled,omitempty"`
+	// Probe verifies the sync on start with a probe file written in a watched directory.
+	Probe bool `yaml:"probe,omitempty"`
+}
+
+// INotifyRoot is a host directory watched for file events propagated to the guest directory.
+type INotifyRoot struct {
+	Host  string `yaml:"host"`
+	Guest string `yaml:"guest"`
 }
 
 // Network is VM network configuration
@@ -8,6 +8,7 @@ import (
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/util"
+	"github.com/abiosoft/colima/util/downloader"
 	"github.com/abiosoft/colima/util/yamlutil"
 	"github.com/sirupsen/logrus"
 	"gopkg.in/yaml.v3"
@@ -71,6 +72,9 @@ func ValidateConfig(c config.Config) error {
 	if _, ok := validVMTypes[c.VMType]; !ok {
 		return fmt.Errorf("invalid vmType: '%s'", c.VMType)
 	}
+	if _, err := downloader.ParseMode(c.DownloadMode); err != nil {
+		return err
+	}
 
 	return nil
 }
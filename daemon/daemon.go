@@ -3,11 +3,14 @@ package daemon
 import (
 	"context"
 	"fmt"
+	"strconv"
+	"strings"
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/daemon/process"
 	"github.com/abiosoft/colima/daemon/process/inotify"
+	"github.com/abiosoft/colima/daemon/process/k3s"
 	"github.com/abiosoft/colima/daemon/process/vmnet"
 	"github.com/abiosoft/colima/environment"
 	"github.com/abiosoft/colima/util"
@@ -90,6 +93,17 @@ func (l processManager) Start(ctx context.Context, conf config.Config) error {
 		return fmt.Errorf("error preparing network directory: %w", err)
 	}
 
+	args, err := startArgs(conf)
+	if err != nil {
+		return err
+	}
+
+	host := l.host.WithDir(util.HomeDir())
+	return host.RunQuiet(args...)
+}
+
+// startArgs returns the command to start the daemon with the processes for conf.
+func startArgs(conf config.Config) ([]string, error) {
 	args := []string{osutil.Executable(), "daemon", "start", config.CurrentProfile().ShortName}
 
 	if conf.Network.Address {
@@ -101,18 +115,95 @@ func (l processManager) Start(ctx context.Context, conf config.Config) error {
 		for _, mount := range conf.MountsOrDefault() {
 			p, err := util.CleanPath(mount.Location)
 			if err != nil {
-				return fmt.Errorf("error sanitising mount path for inotify: %w", err)
+				return nil, fmt.Errorf("error sanitising mount path for inotify: %w", err)
 			}
 			args = append(args, "--inotify-dir", p)
 		}
+		for _, event := range conf.INotify.Events {
+			args = append(args, "--inotify-event", event)
+		}
+		if conf.INotify.Limit != 0 {
+			args = append(args, "--inotify-limit", strconv.Itoa(conf.INotify.Limit))
+		}
+		for _, root := range conf.INotify.Roots {
+			p, err := util.CleanPath(root.Host)
+			if err != nil {
+				return nil, fmt.Errorf("error sanitising root path for inotify: %w", err)
+			}
+			args = append(args, "--inotify-root", inotify.Root{Host: p, Guest: root.Guest}.String())
+		}
+		for _, file := range conf.INotify.Files {
+			p, err := util.CleanPath(file.Host)
+			if err != nil {
+				return nil, fmt.Errorf("error sanitising file path for inotify: %w", err)
+			}
+			if file.Guest == "" {
+				args = append(args, "--inotify-file", p)
+				continue
+			}
+			args = append(args, "--inotify-file", inotify.Root{Host: p, Guest: file.Guest}.String())
+		}
+		if conf.INotify.Suppress != 0 {
+			args = append(args, "--inotify-suppress", strconv.Itoa(conf.INotify.Suppress))
+		}
+		if conf.INotify.FIFO != "" {
+			p, err := util.CleanPath(conf.INotify.FIFO)
+			if err != nil {
+				return nil, fmt.Errorf("error sanitising fifo path for inotify: %w", err)
+			}
+			args = append(args, "--inotify-fifo", strings.TrimSuffix(p, "/"))
+		}
+		if conf.INotify.Disabled {
+			args = append(args, "--inotify-disabled")
+		}
+		if conf.INotify.SkipHiddenDirs {
+			args = append(args, "--inotify-skip-hidden-dirs")
+		}
+		if conf.INotify.SkipHiddenFiles {
+			args = append(args, "--inotify-skip-hidden-files")
+		}
+		if n := conf.INotify.HistorySize; n != nil {
+			args = append(args, "--inotify-history-size", strconv.Itoa(*n))
+		}
+		if conf.INotify.WaitRuntime {
+			args = append(args, "--inotify-wait-runtime")
+		}
+		if conf.INotify.StrictWatch {
+			args = append(args, "--inotify-strict-watch")
+		}
+		if conf.INotify.Probe {
+			args = append(args, "--inotify-probe")
+		}
+		if conf.INotify.FollowSymlinks {
+			args = append(args, "--inotify-follow-symlinks")
+		}
+		if conf.INotify.PollInterval > 0 {
+			args = append(args, "--inotify-poll-interval", strconv.Itoa(conf.INotify.PollInterval))
+		}
+		if conf.INotify.WatchConcurrency != 0 {
+			args = append(args, "--inotify-watch-concurrency", strconv.Itoa(conf.INotify.WatchConcurrency))
+		}
+		if conf.INotify.Sentinel != "" {
+			p, err := util.CleanPath(conf.INotify.Sentinel)
+			if err != nil {
+				return nil, fmt.Errorf("error sanitising sentinel path for inotify: %w", err)
+			}
+			args = append(args, "--inotify-sentinel", strings.TrimSuffix(p, "/"))
+		}
+	}
+
+	if SupervisesK3s(conf) {
+		args = append(args, "--k3s")
+	}
+	if conf.SSHMaxSessions != 0 {
+		args = append(args, "--ssh-max-sessions", strconv.Itoa(conf.SSHMaxSessions))
 	}
 
 	if cli.Settings.Verbose {
 		args = append(args, "--very-verbose")
 	}
 
-	host := l.host.WithDir(util.HomeDir())
-	return host.RunQuiet(args...)
+	return args, nil
 }
 func (l processManager) Stop(ctx context.Context, conf config.Config) error {
 	if s, err := l.Running(ctx, conf); err != nil || !s.Running {
@@ -121,6 +212,12 @@ func (l processManager) Stop(ctx context.Context, conf config.Config) error {
 	return l.host.RunQuiet(osutil.Executable(), "daemon", "stop", config.CurrentProfile().ShortName)
 }
 
+// SupervisesK3s returns if k3s is supervised by the daemon for conf.
+func SupervisesK3s(conf config.Config) bool {
+	k := conf.Kubernetes
+	return k.Enabled && k.Supervise && !k.Rootless && k.Role != "agent"
+}
+
 func processesFromConfig(conf config.Config) []process.Process {
 	var processes []process.Process
 
@@ -130,6 +227,9 @@ func processesFromConfig(conf config.Config) []process.Process {
 	if conf.MountINotify {
 		processes = append(processes, inotify.New())
 	}
+	if SupervisesK3s(conf) {
+		processes = append(processes, k3s.New())
+	}
 
 	return processes
 }
@@ -0,0 +1,35 @@
+package daemon
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+)
+
+func Test_startArgs_inotifyDisabled(t *testing.T) {
+	tests := []struct {
+		name     string
+		disabled bool
+	}{
+		{name: "enabled"},
+		{name: "disabled", disabled: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := config.Config{MountINotify: true, INotify: config.INotify{Disabled: tt.disabled}}
+			args, err := startArgs(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			cmd := strings.Join(args, " ")
+			if !strings.Contains(cmd, " --inotify ") {
+				t.Errorf("inotify not started in %s", cmd)
+			}
+			if got := strings.Contains(cmd, "--inotify-disabled"); got != tt.disabled {
+				t.Errorf("--inotify-disabled = %v, want %v in %s", got, tt.disabled, cmd)
+			}
+		})
+	}
+}
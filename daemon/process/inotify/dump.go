@@ -0,0 +1,93 @@
+package inotify
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+)
+
+// dumpSignal is the signal for dumping the state of the process to the log.
+var dumpSignal os.Signal = syscall.SIGUSR1
+
+// DefaultHistorySize is the default number of recently dispatched events retained for the dump.
+const DefaultHistorySize = 100
+
+type eventRecord struct {
+	path string
+	op   string
+	mode fs.FileMode
+	time time.Time
+}
+
+// eventHistory is the ring buffer of the recently dispatched events.
+// A nil history is disabled.
+type eventHistory struct {
+	sync.Mutex
+	records []eventRecord
+	next    int // index of the next record
+	full    bool
+}
+
+// newEventHistory returns the history retaining the last size events, nil if size is not positive.
+func newEventHistory(size int) *eventHistory {
+	if size <= 0 {
+		return nil
+	}
+	return &eventHistory{records: make([]eventRecord, size)}
+}
+
+// add records ev dispatched at t, overwriting the oldest record when full.
+func (h *eventHistory) add(ev modEvent, t time.Time) {
+	if h == nil {
+		return
+	}
+	h.Lock()
+	defer h.Unlock()
+	h.records[h.next] = eventRecord{path: ev.path, op: ev.op, mode: ev.FileMode, time: t}
+	h.next = (h.next + 1) % len(h.records)
+	if h.next == 0 {
+		h.full = true
+	}
+}
+
+// recent returns the retained records, oldest first.
+func (h *eventHistory) recent() []eventRecord {
+	if h == nil {
+		return nil
+	}
+	h.Lock()
+	defer h.Unlock()
+	if !h.full {
+		return append([]eventRecord{}, h.records[:h.next]...)
+	}
+	return append(append([]eventRecord{}, h.records[h.next:]...), h.records[:h.next]...)
+}
+
+// dump returns the state of the process for debugging.
+// watching are the directories currently watched and batch is the current batch.
+func (f *inotifyProcess) dump(watching []string, batch *eventBatch) string {
+	var b strings.Builder
+	line := func(format string, a ...any) { fmt.Fprintf(&b, format+"\n", a...) }
+
+	line("inotify state dump")
+	line("config: runtime=%s limit=%d sentinel=%q", f.runtime, f.limit, f.sentinel)
+	line("mounted directories: %s", strings.Join(f.vmVols, ", "))
+	line("watching: %s", strings.Join(watching, ", "))
+	line("counters: %d event(s) dispatched, %d failed", f.stats.dispatched, f.stats.failed)
+	h := f.Health()
+	line("health: latency=%v backlog=%.1f lagging=%v", h.Latency, h.Backlog, h.Lagging)
+	line("current batch: %s", batch.summary())
+	if f.history == nil {
+		line("recent events: disabled")
+	} else {
+		line("recent events:")
+	}
+	for _, r := range f.history.recent() {
+		line("  %s %s %s %o", r.time.Format(time.RFC3339Nano), r.op, r.path, r.mode)
+	}
+	return strings.TrimSuffix(b.String(), "\n")
+}
@@ -0,0 +1,141 @@
+package inotify
+
+import (
+	"bytes"
+	"context"
+	"reflect"
+	"strconv"
+	"strings"
+	"sync"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+// syncBuffer is a bytes.Buffer safe for concurrent use.
+type syncBuffer struct {
+	sync.Mutex
+	buf bytes.Buffer
+}
+
+func (s *syncBuffer) Write(p []byte) (int, error) {
+	s.Lock()
+	defer s.Unlock()
+	return s.buf.Write(p)
+}
+
+func (s *syncBuffer) String() string {
+	s.Lock()
+	defer s.Unlock()
+	return s.buf.String()
+}
+
+func Test_eventHistory(t *testing.T) {
+	tests := []struct {
+		name  string
+		size  int
+		added int
+		want  []string
+	}{
+		{name: "partial", size: 5, added: 3, want: []string{"/file0", "/file1", "/file2"}},
+		{name: "full", size: 5, added: 5, want: []string{"/file0", "/file1", "/file2", "/file3", "/file4"}},
+		{name: "wrapped", size: 5, added: 12, want: []string{"/file7", "/file8", "/file9", "/file10", "/file11"}},
+		{name: "disabled", size: 0, added: 3},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			h := newEventHistory(tt.size)
+			for i := 0; i < tt.added; i++ {
+				h.add(modEvent{path: "/file" + strconv.Itoa(i), op: "write"}, time.Now())
+			}
+			var got []string
+			for _, r := range h.recent() {
+				got = append(got, r.path)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("recent = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_eventHistory_concurrent(t *testing.T) {
+	h := newEventHistory(DefaultHistorySize)
+
+	var wg sync.WaitGroup
+	for i := 0; i < 10; i++ {
+		wg.Add(2)
+		go func(i int) {
+			defer wg.Done()
+			for j := 0; j < 50; j++ {
+				h.add(modEvent{path: "/file" + strconv.Itoa(i*50+j)}, time.Now())
+			}
+		}(i)
+		go func() { defer wg.Done(); _ = h.recent() }()
+	}
+	wg.Wait()
+
+	if got := len(h.recent()); got != DefaultHistorySize {
+		t.Errorf("records = %d, want %d", got, DefaultHistorySize)
+	}
+}
+
+func Test_inotifyProcess_dump(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	dir := t.TempDir()
+	guest := &fakeGuest{outputs: map[string]string{
+		"docker ps -q":       "app",
+		"docker inspect app": `[{"Mounts": [{"Source": "` + dir + `"}]}]`,
+	}}
+
+	var out syncBuffer
+	l := logrus.New()
+	l.SetOutput(&out)
+	f := newTestProcess(guest)
+	f.log = l.WithField("context", "inotify")
+	f.runtime = "docker"
+	f.vmVols = []string{dir}
+
+	watcher := fakeWatcher{events: []modEvent{{path: dir + "/main.go", op: "write", FileMode: 0644}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, watcher) }()
+
+	// wait for the event to be dispatched
+	deadline := time.After(time.Second * 5)
+	for len(guest.synced()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for event dispatch")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	if err := syscall.Kill(syscall.Getpid(), syscall.SIGUSR1); err != nil {
+		t.Fatal(err)
+	}
+
+	for !strings.Contains(out.String(), "inotify state dump") {
+		select {
+		case <-deadline:
+			t.Fatalf("timed out waiting for dump, log: %s", out.String())
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	dump := out.String()
+	for _, want := range []string{
+		"watching: " + dir,
+		"counters: 1 event(s) dispatched, 0 failed",
+		"write " + dir + "/main.go 644",
+	} {
+		if !strings.Contains(dump, want) {
+			t.Errorf("dump does not contain %q: %s", want, dump)
+		}
+	}
+}
@@ -4,15 +4,35 @@ import (
 	"context"
 	"fmt"
 	"io/fs"
+	"os"
+	"os/signal"
+	"strings"
 	"time"
 )
 
 type modEvent struct {
 	path string // filename
+	op   string // name of the file event e.g. write
 	fs.FileMode
 }
 
-func (m modEvent) Mode() string { return fmt.Sprintf("%o", m.FileMode) }
+// chmodBits are the bits of the mode propagated with chmod.
+const chmodBits = fs.ModePerm | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky
+
+// Mode returns the octal mode of the file for chmod, including the setuid, setgid and sticky bits.
+func (m modEvent) Mode() string {
+	mode := uint32(m.FileMode.Perm())
+	if m.FileMode&fs.ModeSetuid != 0 {
+		mode |= 04000
+	}
+	if m.FileMode&fs.ModeSetgid != 0 {
+		mode |= 02000
+	}
+	if m.FileMode&fs.ModeSticky != 0 {
+		mode |= 01000
+	}
+	return fmt.Sprintf("%o", mode)
+}
 
 func (f *inotifyProcess) handleEvents(ctx context.Context, watcher dirWatcher) error {
 	log := f.log
@@ -20,16 +40,23 @@ func (f *inotifyProcess) handleEvents(ctx context.Context, watcher dirWatcher) e
 
 	mod := make(chan modEvent)
 	vols := make(chan []string)
+	// watchErr receives the watcher errors in strict mode.
+	watchErr := make(chan error, 1)
 
 	if err := f.monitorContainerVolumes(ctx, vols); err != nil {
 		return fmt.Errorf("error watching container volumes: %w", err)
 	}
 
-	var last time.Time
 	var cancelWatch context.CancelFunc
 	var currentVols []string
+	// probing is set once the startup probe is started.
+	var probing bool
 
 	volsChanged := func(vols []string) bool {
+		// explicitly watched files are watched regardless of the volumes
+		if cancelWatch == nil && len(f.files) > 0 {
+			return true
+		}
 		if len(currentVols) != len(vols) {
 			return true
 		}
@@ -41,7 +68,130 @@ func (f *inotifyProcess) handleEvents(ctx context.Context, watcher dirWatcher) e
 		return false
 	}
 
-	cache := map[string]struct{}{}
+	// the state is dumped to the log on signal for debugging
+	dump := make(chan os.Signal, 1)
+	signal.Notify(dump, dumpSignal)
+	defer signal.Stop(dump)
+
+	// the events are suppressed on signal until the deadline in the suppress file
+	suppress := make(chan os.Signal, 1)
+	signal.Notify(suppress, suppressSignal)
+	defer signal.Stop(suppress)
+
+	batch := newEventBatch(time.Now(), f.limit)
+	flush := time.NewTicker(batchWindow)
+	defer flush.Stop()
+
+	// dispatched are the events dispatched in the current batch for the callback.
+	var dispatched []Event
+	notify := func() {
+		if f.onDispatch == nil || len(dispatched) == 0 {
+			return
+		}
+		go f.onDispatch(dispatched)
+		dispatched = nil
+	}
+
+	// touch is set if the sentinel is to be touched for the current batch.
+	var touch bool
+	// probed are the paths of the current batch synced with the sentinel, for the pending probes.
+	var probed []string
+
+	dispatch := func(ev modEvent) {
+		f.history.add(ev, time.Now())
+		if f.sentinel != "" {
+			touch = true
+			if f.probes.active() {
+				probed = append(probed, ev.path)
+			}
+			if f.onDispatch != nil {
+				dispatched = append(dispatched, Event{Path: ev.path, Op: ev.op, Mode: ev.FileMode})
+			}
+			return
+		}
+		start := time.Now()
+		f.syncEvent(ev)
+		f.suppression.touch(ev.path, time.Now())
+		f.probes.synced(ev.path)
+		elapsed := time.Since(start)
+		batch.elapsed += elapsed
+		f.health.observe(elapsed)
+		if f.onDispatch != nil {
+			dispatched = append(dispatched, Event{Path: ev.path, Op: ev.op, Mode: ev.FileMode})
+		}
+	}
+
+	// lagging is the last reported health of the event propagation.
+	var lagging bool
+	// healthUpdated is the time the health was last written to the status file.
+	var healthUpdated time.Time
+
+	// finish completes the current batch.
+	finish := func(now time.Time) {
+		if touch {
+			start := time.Now()
+			f.touchSentinel()
+			batch.elapsed += time.Since(start)
+			touch = false
+			for _, path := range probed {
+				f.probes.synced(path)
+			}
+			probed = nil
+		}
+		if batch.received > 0 {
+			log.Debug(batch.summary())
+		}
+		notify()
+		f.suppression.cleanup(now)
+
+		f.health.observeBacklog(len(batch.pending))
+		h := f.Health()
+		changed := h.Lagging != lagging
+		if changed {
+			lagging = h.Lagging
+			if lagging {
+				log.Warnf("file sync is lagging, average latency: %v, average backlog: %.1f event(s)", h.Latency, h.Backlog)
+			} else {
+				log.Info("file sync caught up")
+			}
+		}
+
+		// the health is reported in `colima status`
+		if changed || now.Sub(healthUpdated) >= statusInterval {
+			healthUpdated = now
+			if err := f.status.update(func(s *Status) { s.Health = &h }); err != nil {
+				log.Trace(err)
+			}
+		}
+	}
+
+	// rotate logs the summary of an expired batch and starts a new one.
+	rotate := func(now time.Time) {
+		if !batch.expired(now) {
+			return
+		}
+		finish(now)
+		var pending []modEvent
+		batch, pending = batch.next(now)
+		for _, ev := range pending {
+			dispatch(ev)
+		}
+	}
+
+	// drain dispatches the events deferred by the current batch and starts a new one,
+	// for the events of the previous watched directories not to be lost on reconfigure.
+	drain := func(now time.Time) {
+		if n := len(batch.pending); n > 0 {
+			log.Debugf("dispatching %d deferred event(s) before reconfiguring", n)
+		}
+		for _, ev := range batch.pending {
+			batch.unique[ev.path] = struct{}{}
+			dispatch(ev)
+		}
+		batch.pending = nil
+		finish(now)
+		batch = newEventBatch(now, f.limit)
+	}
 
 	for {
 		select {
@@ -49,10 +199,16 @@ func (f *inotifyProcess) handleEvents(ctx context.Context, watcher dirWatcher) e
 		// exit signal
 		case <-ctx.Done():
 			close(mod)
+			if touch {
+				f.touchSentinel()
+			}
+			notify()
+			log.Info(f.stats.summary())
 			return ctx.Err()
 
 		// watch only container volumes
 		case vols := <-vols:
+			vols = f.watchedDirs(vols)
 			if !volsChanged(vols) {
 				continue
 			}
@@ -60,50 +216,224 @@ func (f *inotifyProcess) handleEvents(ctx context.Context, watcher dirWatcher) e
 
 			currentVols = vols
 
+			// the events of the current watch set are dispatched before swapping watchers
+			drain(time.Now())
+
 			if cancel := cancelWatch; cancel != nil {
 				// delay a bit to avoid zero downtime
 				time.AfterFunc(time.Second*1, cancel)
 			}
 
+			// the sync is verified once for `colima status` when enabled
+			if f.probeOnStart && !probing && len(vols) > 0 {
+				probing = true
+				go f.startupProbe(ctx, vols[0])
+			}
+
 			ctx, cancel := context.WithCancel(ctx)
 			cancelWatch = cancel
 
 			go func(ctx context.Context, vols []string, mod chan<- modEvent) {
-				if err := watcher.Watch(ctx, vols, mod); err != nil {
-					log.Error(fmt.Errorf("error running watcher: %w", err))
+				err := watcher.Watch(ctx, vols, mod)
+				if err == nil {
+					return
 				}
+				if f.strictWatch {
+					select {
+					case watchErr <- err:
+					default:
+					}
+					return
+				}
+				log.Error(fmt.Errorf("error running watcher: %w", err))
 			}(ctx, vols, mod)
 
-		// handle modification events
-		case ev := <-mod:
-			now := time.Now()
+		// the watch set is incomplete in strict mode
+		case err := <-watchErr:
+			if cancelWatch != nil {
+				cancelWatch()
+			}
+			return fmt.Errorf("error running watcher: %w", err)
 
-			// rate limit, handle at most 50 unique items every 500 ms
-			if now.Sub(last) < time.Millisecond*500 {
-				if _, ok := cache[ev.path]; ok {
-					continue // handled, ignore
-				}
-				if len(cache) > 50 {
-					continue
-				}
+		// debug dump
+		case <-dump:
+			for _, line := range strings.Split(f.dump(currentVols, batch), "\n") {
+				log.Info(line)
+			}
+
+		// suppression requested by another process
+		case <-suppress:
+			t, err := readSuppression()
+			if err != nil {
+				log.Warnln(err)
+				continue
+			}
+			f.SuppressUntil(t)
+			if t.IsZero() {
+				log.Info("inotify suppression ended")
 			} else {
-				last = now
-				cache = map[string]struct{}{} // >500ms, reset unique cache
+				log.Infof("inotify events suppressed until %s", t.Format(time.RFC3339))
 			}
 
-			// cache current event
-			cache[ev.path] = struct{}{}
+		// log summary of the previous batch
+		case now := <-flush.C:
+			rotate(now)
 
-			// validate that file exists
-			if err := f.guest.RunQuiet("stat", ev.path); err != nil {
-				log.Trace(fmt.Errorf("cannot stat '%s': %w", ev.path, err))
+		// handle modification events
+		case ev := <-mod:
+			// the sentinel is modified by the process
+			if f.sentinel != "" && ev.path == f.sentinel {
 				continue
 			}
-
-			log.Infof("syncing inotify event for %s ", ev.path)
-			if err := f.guest.RunQuiet("sudo", "/bin/chmod", ev.Mode(), ev.path); err != nil {
-				log.Trace(fmt.Errorf("error syncing inotify event: %w", err))
+			// explicitly watched files are not subject to the ignore rules
+			explicit := f.watchedFile(ev.path)
+			if !explicit && f.ignored(ev.path, ev.IsDir()) {
+				log.Tracef("'%s' is ignored, skipping.", ev.path)
+				continue
+			}
+			if !explicit && f.skipHidden(ev.path, ev.IsDir()) {
+				log.Tracef("'%s' is hidden, skipping.", ev.path)
+				continue
+			}
+			now := time.Now()
+			if f.suppressedAt(now) {
+				log.Tracef("events are suppressed, skipping '%s'.", ev.path)
+				continue
+			}
+			if f.suppression.suppressed(ev.path, now) {
+				log.Tracef("'%s' was just synced, skipping.", ev.path)
+				continue
 			}
+			rotate(now)
+			if !batch.add(ev) {
+				continue
+			}
+			dispatch(ev)
+		}
+	}
+}
+
+const (
+	// batchWindow is the duration of a batch of events.
+	batchWindow = time.Millisecond * 500
+	// batchLimit is the default maximum number of unique events dispatched per batch.
+	batchLimit = 50
+)
+
+// eventBatch is the rate limiter for events received within a window.
+type eventBatch struct {
+	start    time.Time
+	received int
+	unique   map[string]struct{}
+	elapsed  time.Duration // time spent dispatching
+
+	// limit is the maximum number of unique events dispatched.
+	// If negative, there is no limit and events beyond batchLimit are deferred
+	// to subsequent batches instead of being dropped.
+	limit   int
+	pending []modEvent
+	queued  map[string]struct{}
+}
+
+func newEventBatch(start time.Time, limit int) *eventBatch {
+	if limit == 0 {
+		limit = batchLimit
+	}
+	return &eventBatch{
+		start:  start,
+		unique: map[string]struct{}{},
+		limit:  limit,
+		queued: map[string]struct{}{},
+	}
+}
+
+// next returns the batch following b starting at now, and the events deferred
+// by b that are to be dispatched in the new batch.
+func (b *eventBatch) next(now time.Time) (*eventBatch, []modEvent) {
+	n := newEventBatch(now, b.limit)
+
+	var dispatch []modEvent
+	for _, ev := range b.pending {
+		if n.add(ev) {
+			dispatch = append(dispatch, ev)
+		}
+	}
+	return n, dispatch
+}
+
+// expired returns if the batch window has elapsed at now.
+func (b *eventBatch) expired(now time.Time) bool { return now.Sub(b.start) >= batchWindow }
+
+// add adds ev to the batch and returns if ev should be dispatched.
+// Duplicate events and events beyond the limit are not dispatched.
+// When unlimited, events beyond batchLimit are deferred.
+func (b *eventBatch) add(ev modEvent) bool {
+	b.received++
+
+	if _, ok := b.unique[ev.path]; ok {
+		return false // handled, ignore
+	}
+	if b.limit > 0 && len(b.unique) >= b.limit {
+		return false
+	}
+	if b.limit < 0 && len(b.unique) >= batchLimit {
+		// unlimited, dispatch in a subsequent batch
+		if _, ok := b.queued[ev.path]; !ok {
+			b.queued[ev.path] = struct{}{}
+			b.pending = append(b.pending, ev)
 		}
+		return false
+	}
+
+	b.unique[ev.path] = struct{}{}
+	return true
+}
+
+func (b *eventBatch) summary() string {
+	if len(b.pending) > 0 {
+		return fmt.Sprintf("inotify batch: %d event(s) received, %d dispatched in %v, %d deferred", b.received, len(b.unique), b.elapsed, len(b.pending))
+	}
+	return fmt.Sprintf("inotify batch: %d event(s) received, %d dispatched in %v", b.received, len(b.unique), b.elapsed)
+}
+
+// syncEvent propagates the modification event to the VM.
+func (f *inotifyProcess) syncEvent(ev modEvent) {
+	log := f.log
+	f.stats.dispatched++
+
+	path := f.guestPath(ev.path)
+
+	// validate that file exists
+	if err := f.guest.RunQuiet("stat", path); err != nil {
+		log.Trace(fmt.Errorf("cannot stat '%s': %w", path, err))
+		f.stats.failed++
+		return
+	}
+
+	log.Infof("syncing inotify event for %s ", path)
+	if err := f.guest.RunQuiet("sudo", "/bin/chmod", ev.Mode(), path); err != nil {
+		log.Trace(fmt.Errorf("error syncing inotify event: %w", err))
+		f.stats.failed++
+	}
+}
+
+// touchSentinel touches the sentinel file in the VM in place of the events of a batch.
+func (f *inotifyProcess) touchSentinel() {
+	f.stats.dispatched++
+	log := f.log
+	log.Infof("touching inotify sentinel %s", f.sentinel)
+	if err := f.guest.RunQuiet("touch", f.sentinel); err != nil {
+		log.Trace(fmt.Errorf("error touching inotify sentinel: %w", err))
+		f.stats.failed++
 	}
 }
+
+// eventStats are the counters for the events handled by the process.
+type eventStats struct {
+	dispatched int
+	failed     int
+}
+
+func (e eventStats) summary() string {
+	return fmt.Sprintf("inotify stopped, %d event(s) dispatched, %d failed", e.dispatched, e.failed)
+}
@@ -0,0 +1,713 @@
+package inotify
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/environment"
+	"github.com/sirupsen/logrus"
+)
+
+var _ environment.GuestActions = (*fakeGuest)(nil)
+
+type fakeGuest struct {
+	sync.Mutex
+	commands []string
+	// errs maps command prefixes to errors returned for the command.
+	errs map[string]error
+	// outputs maps commands to their output.
+	outputs map[string]string
+	// output returns the output of the commands not in outputs, if set.
+	output func(cmd string) string
+}
+
+func (f *fakeGuest) run(args ...string) (string, error) {
+	f.Lock()
+	defer f.Unlock()
+	cmd := strings.Join(args, " ")
+	f.commands = append(f.commands, cmd)
+	for prefix, err := range f.errs {
+		if strings.HasPrefix(cmd, prefix) {
+			return "", err
+		}
+	}
+	if out, ok := f.outputs[cmd]; ok || f.output == nil {
+		return out, nil
+	}
+	return f.output(cmd), nil
+}
+
+func (f *fakeGuest) Run(args ...string) error      { _, err := f.run(args...); return err }
+func (f *fakeGuest) RunQuiet(args ...string) error { _, err := f.run(args...); return err }
+func (f *fakeGuest) RunOutput(args ...string) (string, error) {
+	return f.run(args...)
+}
+func (f *fakeGuest) RunInteractive(args ...string) error { _, err := f.run(args...); return err }
+func (f *fakeGuest) RunWith(stdin io.Reader, stdout io.Writer, args ...string) error {
+	out, err := f.run(args...)
+	if stdout != nil {
+		_, _ = io.WriteString(stdout, out)
+	}
+	return err
+}
+func (f *fakeGuest) Read(string) (string, error)                { return "", nil }
+func (f *fakeGuest) Write(string, []byte) error                 { return nil }
+func (f *fakeGuest) Stat(string) (os.FileInfo, error)           { return nil, os.ErrNotExist }
+func (f *fakeGuest) Start(context.Context, config.Config) error { return nil }
+func (f *fakeGuest) Stop(context.Context, bool) error           { return nil }
+func (f *fakeGuest) Restart(context.Context) error              { return nil }
+func (f *fakeGuest) SSH(string, ...string) error                { return nil }
+func (f *fakeGuest) Created() bool                              { return true }
+func (f *fakeGuest) Running(context.Context) bool               { return true }
+func (f *fakeGuest) Env(string) (string, error)                 { return "", nil }
+func (f *fakeGuest) Get(string) string                          { return "" }
+func (f *fakeGuest) Set(string, string) error                   { return nil }
+func (f *fakeGuest) User() (string, error)                      { return "user", nil }
+func (f *fakeGuest) Arch() environment.Arch                     { return environment.X8664 }
+
+// synced returns the paths synced with chmod.
+func (f *fakeGuest) synced() (paths []string) {
+	f.Lock()
+	defer f.Unlock()
+	for _, cmd := range f.commands {
+		if strings.HasPrefix(cmd, "sudo /bin/chmod") {
+			fields := strings.Fields(cmd)
+			paths = append(paths, fields[len(fields)-1])
+		}
+	}
+	return
+}
+
+func newTestProcess(guest environment.GuestActions) *inotifyProcess {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	return &inotifyProcess{guest: guest, log: l.WithField("context", "inotify"), history: newEventHistory(DefaultHistorySize)}
+}
+
+func Test_inotifyProcess_stats(t *testing.T) {
+	guest := &fakeGuest{errs: map[string]error{
+		"stat /missing":                     fmt.Errorf("not found"),
+		"sudo /bin/chmod 644 /readonly.txt": fmt.Errorf("read-only"),
+	}}
+	f := newTestProcess(guest)
+
+	for _, path := range []string{"/a.txt", "/b.txt", "/missing", "/readonly.txt", "/c.txt"} {
+		f.syncEvent(modEvent{path: path, FileMode: 0644})
+	}
+
+	if f.stats.dispatched != 5 || f.stats.failed != 2 {
+		t.Errorf("stats = %+v, want 5 dispatched and 2 failed", f.stats)
+	}
+	want := "inotify stopped, 5 event(s) dispatched, 2 failed"
+	if got := f.stats.summary(); got != want {
+		t.Errorf("summary() = %s, want %s", got, want)
+	}
+}
+
+func Test_modEvent_Mode(t *testing.T) {
+	tests := []struct {
+		mode fs.FileMode
+		want string
+	}{
+		{mode: 0644, want: "644"},
+		{mode: 0755 | fs.ModeSetuid, want: "4755"},
+		{mode: 0775 | fs.ModeSetgid, want: "2775"},
+		{mode: 0777 | fs.ModeSticky, want: "1777"},
+		{mode: 0755 | fs.ModeSetuid | fs.ModeSetgid | fs.ModeSticky, want: "7755"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			if got := (modEvent{FileMode: tt.mode}).Mode(); got != tt.want {
+				t.Errorf("Mode() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_eventBatch(t *testing.T) {
+	batch := newEventBatch(time.Now(), 0)
+
+	var dispatched int
+	for i := 0; i < 80; i++ {
+		// every path is received twice
+		ev := modEvent{path: fmt.Sprintf("/file-%d", i/2)}
+		if batch.add(ev) {
+			dispatched++
+		}
+	}
+
+	if dispatched != 40 {
+		t.Errorf("dispatched = %d, want %d", dispatched, 40)
+	}
+	want := "inotify batch: 80 event(s) received, 40 dispatched in 0s"
+	if got := batch.summary(); got != want {
+		t.Errorf("summary() = %s, want %s", got, want)
+	}
+
+	// beyond the limit
+	for i := 0; i < batchLimit; i++ {
+		batch.add(modEvent{path: fmt.Sprintf("/other-%d", i)})
+	}
+	want = fmt.Sprintf("inotify batch: %d event(s) received, %d dispatched in 0s", 80+batchLimit, batchLimit)
+	if got := batch.summary(); got != want {
+		t.Errorf("summary() = %s, want %s", got, want)
+	}
+
+	if batch.expired(batch.start.Add(batchWindow / 2)) {
+		t.Error("batch should not be expired within the window")
+	}
+	if !batch.expired(batch.start.Add(batchWindow)) {
+		t.Error("batch should be expired after the window")
+	}
+}
+
+func Test_eventBatch_unlimited(t *testing.T) {
+	guest := &fakeGuest{}
+	f := newTestProcess(guest)
+
+	const count = 1000
+	start := time.Now()
+	batch := newEventBatch(start, -1)
+	for i := 0; i < count; i++ {
+		ev := modEvent{path: fmt.Sprintf("/file-%d", i), FileMode: 0644}
+		if batch.add(ev) {
+			f.syncEvent(ev)
+		}
+		// duplicates are neither dispatched nor deferred twice
+		batch.add(ev)
+	}
+	if len(batch.pending) != count-batchLimit {
+		t.Fatalf("pending = %d, want %d", len(batch.pending), count-batchLimit)
+	}
+
+	batches := 1
+	for now := start; len(batch.pending) > 0; batches++ {
+		now = now.Add(batchWindow)
+		var pending []modEvent
+		batch, pending = batch.next(now)
+		if len(pending) > batchLimit {
+			t.Fatalf("dispatched %d events in a batch, want at most %d", len(pending), batchLimit)
+		}
+		for _, ev := range pending {
+			f.syncEvent(ev)
+		}
+	}
+
+	if want := count / batchLimit; batches != want {
+		t.Errorf("batches = %d, want %d", batches, want)
+	}
+
+	synced := map[string]struct{}{}
+	for _, path := range guest.synced() {
+		synced[path] = struct{}{}
+	}
+	if len(synced) != count || len(guest.synced()) != count {
+		t.Errorf("synced %d unique of %d events, want %d", len(synced), len(guest.synced()), count)
+	}
+}
+
+// fakeWatcher sends events once watching starts.
+type fakeWatcher struct {
+	events []modEvent
+	// watched receives the watched directories, if set.
+	watched chan<- []string
+}
+
+func (w fakeWatcher) Watch(ctx context.Context, dirs []string, c chan<- modEvent) error {
+	if w.watched != nil {
+		w.watched <- dirs
+	}
+	for _, ev := range w.events {
+		c <- ev
+	}
+	return nil
+}
+
+func Test_inotifyProcess_onDispatch(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	dir := t.TempDir()
+	guest := &fakeGuest{outputs: map[string]string{
+		"docker ps -q":       "app",
+		"docker inspect app": `[{"Mounts": [{"Source": "` + dir + `"}]}]`,
+	}}
+
+	received := make(chan []Event, 1)
+	f := New(WithOnDispatch(func(events []Event) { received <- events })).(*inotifyProcess)
+	f.log = newTestProcess(guest).log
+	f.guest = guest
+	f.runtime = "docker"
+	f.vmVols = []string{dir}
+
+	watcher := fakeWatcher{events: []modEvent{
+		{path: dir + "/main.go", FileMode: 0644},
+		{path: dir + "/main.go", FileMode: 0644}, // duplicate within the batch
+		{path: dir + "/go.mod", FileMode: 0600},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, watcher) }()
+
+	select {
+	case events := <-received:
+		want := []Event{{Path: dir + "/main.go", Mode: 0644}, {Path: dir + "/go.mod", Mode: 0600}}
+		if len(events) != len(want) {
+			t.Fatalf("events = %+v, want %+v", events, want)
+		}
+		for i := range want {
+			if events[i] != want[i] {
+				t.Errorf("events = %+v, want %+v", events, want)
+			}
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for dispatched events")
+	}
+}
+
+func Test_eventHealth(t *testing.T) {
+	var h eventHealth
+	for i := 0; i < 10; i++ {
+		h.observe(time.Millisecond)
+		h.observeBacklog(0)
+	}
+	if got := h.health(); got.Lagging {
+		t.Fatalf("expected healthy propagation, got %+v", got)
+	}
+
+	// sustained slow dispatches
+	for i := 0; i < 20; i++ {
+		h.observe(time.Second)
+	}
+	got := h.health()
+	if !got.Lagging {
+		t.Fatalf("expected lagging propagation, got %+v", got)
+	}
+	if got.Latency < lagLatency {
+		t.Errorf("expected latency above %v, got %v", lagLatency, got.Latency)
+	}
+
+	// recovery
+	for i := 0; i < 50; i++ {
+		h.observe(time.Millisecond)
+	}
+	if got := h.health(); got.Lagging {
+		t.Errorf("expected recovered propagation, got %+v", got)
+	}
+
+	// sustained backlog
+	h = eventHealth{}
+	for i := 0; i < 20; i++ {
+		h.observeBacklog(batchLimit * 2)
+	}
+	if got := h.health(); !got.Lagging {
+		t.Errorf("expected lagging propagation for backlog, got %+v", got)
+	}
+}
+
+// count returns the number of commands with prefix.
+func (f *fakeGuest) count(prefix string) (n int) {
+	f.Lock()
+	defer f.Unlock()
+	for _, cmd := range f.commands {
+		if strings.HasPrefix(cmd, prefix) {
+			n++
+		}
+	}
+	return
+}
+
+func Test_inotifyProcess_sentinel(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	dir := t.TempDir()
+	guest := &fakeGuest{outputs: map[string]string{
+		"docker ps -q":       "app",
+		"docker inspect app": `[{"Mounts": [{"Source": "` + dir + `"}]}]`,
+	}}
+
+	f := newTestProcess(guest)
+	f.runtime = "docker"
+	f.vmVols = []string{dir}
+	f.sentinel = dir + "/.colima-touch"
+
+	watcher := fakeWatcher{events: []modEvent{
+		{path: dir + "/main.go", FileMode: 0644},
+		{path: dir + "/go.mod", FileMode: 0644},
+		{path: dir + "/go.sum", FileMode: 0644},
+		{path: f.sentinel, FileMode: 0644}, // touched by the process
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, watcher) }()
+
+	touch := "touch " + f.sentinel
+	deadline := time.After(time.Second * 5)
+	for guest.count(touch) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for sentinel touch")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+
+	// subsequent windows without events do not touch the sentinel
+	time.Sleep(batchWindow * 2)
+	if got := guest.count(touch); got != 1 {
+		t.Errorf("sentinel touches = %d, want 1", got)
+	}
+	if got := guest.synced(); len(got) != 0 {
+		t.Errorf("expected no synced events in sentinel mode, got %+v", got)
+	}
+}
+
+func Test_eventSuppression(t *testing.T) {
+	now := time.Now()
+	s := newEventSuppression(0)
+
+	s.touch("/a.txt", now)
+	if !s.suppressed("/a.txt", now.Add(time.Millisecond*10)) {
+		t.Error("expected rapid re-event for a just synced file to be suppressed")
+	}
+	if s.suppressed("/b.txt", now.Add(time.Millisecond*10)) {
+		t.Error("expected event for another file not to be suppressed")
+	}
+	if s.suppressed("/a.txt", now.Add(defaultSuppressWindow)) {
+		t.Error("expected event after the window not to be suppressed")
+	}
+
+	s.cleanup(now.Add(defaultSuppressWindow))
+	if len(s.touched) != 0 {
+		t.Errorf("expected expired paths to be cleaned up, got %+v", s.touched)
+	}
+
+	disabled := newEventSuppression(-1)
+	disabled.touch("/a.txt", now)
+	if disabled.suppressed("/a.txt", now) {
+		t.Error("expected no suppression when disabled")
+	}
+}
+
+func Test_inotifyProcess_suppress(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	dir := t.TempDir()
+	guest := &fakeGuest{outputs: map[string]string{
+		"docker ps -q":       "app",
+		"docker inspect app": `[{"Mounts": [{"Source": "` + dir + `"}]}]`,
+	}}
+
+	f := newTestProcess(guest)
+	f.runtime = "docker"
+	f.vmVols = []string{dir}
+	f.suppression = newEventSuppression(time.Minute)
+
+	// the rapid re-event spans batches, it is not deduplicated by the batch
+	events := make(chan modEvent)
+	watcher := chanWatcher(events)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, watcher) }()
+
+	events <- modEvent{path: dir + "/main.go", FileMode: 0644}
+	time.Sleep(batchWindow + time.Millisecond*100)
+	events <- modEvent{path: dir + "/main.go", FileMode: 0644} // echoed back by the VM
+	events <- modEvent{path: dir + "/go.mod", FileMode: 0644}
+	time.Sleep(time.Millisecond * 100)
+
+	want := []string{dir + "/main.go", dir + "/go.mod"}
+	got := guest.synced()
+	if len(got) != len(want) {
+		t.Fatalf("synced = %+v, want %+v", got, want)
+	}
+	for i := range want {
+		if got[i] != want[i] {
+			t.Errorf("synced = %+v, want %+v", got, want)
+		}
+	}
+}
+
+func Test_inotifyProcess_SuppressUntil(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	dir := t.TempDir()
+	guest := &fakeGuest{outputs: map[string]string{
+		"docker ps -q":       "app",
+		"docker inspect app": `[{"Mounts": [{"Source": "` + dir + `"}]}]`,
+	}}
+
+	f := newTestProcess(guest)
+	f.runtime = "docker"
+	f.vmVols = []string{dir}
+
+	events := make(chan modEvent)
+	watcher := chanWatcher(events)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, watcher) }()
+
+	events <- modEvent{path: dir + "/before.go", FileMode: 0644}
+	time.Sleep(time.Millisecond * 100)
+
+	// an operation copying into the mounted directory
+	const window = time.Millisecond * 200
+	var s Suppressor = f
+	s.SuppressUntil(time.Now().Add(window))
+	events <- modEvent{path: dir + "/copied1.go", FileMode: 0644}
+	events <- modEvent{path: dir + "/copied2.go", FileMode: 0644}
+
+	time.Sleep(window)
+	events <- modEvent{path: dir + "/after.go", FileMode: 0644}
+
+	// ended early
+	s.SuppressUntil(time.Now().Add(time.Minute))
+	s.SuppressUntil(time.Time{})
+	events <- modEvent{path: dir + "/resumed.go", FileMode: 0644}
+	time.Sleep(time.Millisecond * 100)
+
+	want := []string{dir + "/before.go", dir + "/after.go", dir + "/resumed.go"}
+	if got := guest.synced(); !reflect.DeepEqual(got, want) {
+		t.Errorf("synced = %+v, want %+v", got, want)
+	}
+}
+
+func Test_inotifyProcess_Suppress(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+	file := filepath.Join(t.TempDir(), "inotify.suppress")
+	suppressFile = func() string { return file }
+	t.Cleanup(func() { suppressFile = func() string { return filepath.Join(process.Dir(), "inotify.suppress") } })
+
+	dir := t.TempDir()
+	guest := &fakeGuest{outputs: map[string]string{
+		"docker ps -q":       "app",
+		"docker inspect app": `[{"Mounts": [{"Source": "` + dir + `"}]}]`,
+	}}
+	f := newTestProcess(guest)
+	f.runtime = "docker"
+	f.vmVols = []string{dir}
+
+	events := make(chan modEvent)
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, chanWatcher(events)) }()
+
+	events <- modEvent{path: dir + "/before.go", FileMode: 0644}
+	time.Sleep(time.Millisecond * 100)
+
+	// requested by another process with the signal
+	waitSuppressed := func(want bool) {
+		t.Helper()
+		deadline := time.After(time.Second * 5)
+		for f.suppressedAt(time.Now()) != want {
+			select {
+			case <-deadline:
+				t.Fatalf("timed out waiting for suppressed = %v", want)
+			case <-time.After(time.Millisecond * 10):
+			}
+		}
+	}
+	if err := Suppress(os.Getpid(), time.Now().Add(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	waitSuppressed(true)
+	events <- modEvent{path: dir + "/copied.go", FileMode: 0644}
+	time.Sleep(time.Millisecond * 100)
+
+	if err := Suppress(os.Getpid(), time.Time{}); err != nil {
+		t.Fatal(err)
+	}
+	waitSuppressed(false)
+	events <- modEvent{path: dir + "/after.go", FileMode: 0644}
+	time.Sleep(time.Millisecond * 100)
+
+	want := []string{dir + "/before.go", dir + "/after.go"}
+	if got := guest.synced(); !reflect.DeepEqual(got, want) {
+		t.Errorf("synced = %+v, want %+v", got, want)
+	}
+}
+
+// chanWatcher sends the events received on the channel to the handler.
+type chanWatcher <-chan modEvent
+
+func (w chanWatcher) Watch(ctx context.Context, _ []string, c chan<- modEvent) error {
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case ev := <-w:
+			c <- ev
+		}
+	}
+}
+
+// reconfigureWatcher sends events for the first directory and reports the synced
+// events when watching another directory starts.
+type reconfigureWatcher struct {
+	guest  *fakeGuest
+	first  string
+	events []modEvent
+	sent   chan struct{}
+	synced chan int
+}
+
+func (w reconfigureWatcher) Watch(ctx context.Context, dirs []string, c chan<- modEvent) error {
+	if dirs[0] != w.first {
+		w.synced <- len(w.guest.synced())
+		return nil
+	}
+	for _, ev := range w.events {
+		c <- ev
+	}
+	close(w.sent)
+	return nil
+}
+
+func Test_inotifyProcess_drainOnReconfigure(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	root := t.TempDir()
+	first, second := root+"/first", root+"/second"
+	for _, dir := range []string{first, second} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	guest := &fakeGuest{outputs: map[string]string{
+		"docker ps -q":       "app",
+		"docker inspect app": `[{"Mounts": [{"Source": "` + first + `"}]}]`,
+	}}
+
+	f := newTestProcess(guest)
+	f.runtime = "docker"
+	f.vmVols = []string{root}
+	f.limit = -1 // unlimited, events beyond the batch limit are deferred
+
+	const count = batchLimit + 10
+	var events []modEvent
+	for i := 0; i < count; i++ {
+		events = append(events, modEvent{path: fmt.Sprintf("%s/file%d.go", first, i), FileMode: 0644})
+	}
+	watcher := reconfigureWatcher{guest: guest, first: first, events: events, sent: make(chan struct{}), synced: make(chan int, 1)}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, watcher) }()
+
+	select {
+	case <-watcher.sent:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for events")
+	}
+
+	// reconfigure within the batch window with the deferred events pending
+	guest.Lock()
+	guest.outputs["docker inspect app"] = `[{"Mounts": [{"Source": "` + second + `"}]}]`
+	guest.Unlock()
+
+	select {
+	case synced := <-watcher.synced:
+		if synced != count {
+			t.Errorf("expected %d events dispatched before reconfiguring, got %d", count, synced)
+		}
+	case <-time.After(batchWindow / 2):
+		t.Fatal("timed out waiting for reconfigure")
+	}
+}
+
+// hostGuest is a guest running the commands on the host without sudo,
+// with the output of Run written to the stdout and stderr of the test.
+type hostGuest struct {
+	*fakeGuest
+}
+
+func hostCmd(args ...string) *exec.Cmd {
+	if args[0] == "sudo" {
+		args = args[1:]
+	}
+	return exec.Command(args[0], args[1:]...)
+}
+
+func (g hostGuest) Run(args ...string) error {
+	_, _ = g.run(args...)
+	cmd := hostCmd(args...)
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	return cmd.Run()
+}
+
+func (g hostGuest) RunQuiet(args ...string) error {
+	_, _ = g.run(args...)
+	return hostCmd(args...).Run()
+}
+
+// captureOutput returns the output written to the stdout and stderr while running fn.
+func captureOutput(t *testing.T, fn func()) string {
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout, stderr := os.Stdout, os.Stderr
+	os.Stdout, os.Stderr = w, w
+	defer func() { os.Stdout, os.Stderr = stdout, stderr }()
+
+	var out bytes.Buffer
+	done := make(chan struct{})
+	go func() {
+		_, _ = io.Copy(&out, r)
+		close(done)
+	}()
+	fn()
+	_ = w.Close()
+	<-done
+	return out.String()
+}
+
+func Test_inotifyProcess_syncEvent_quiet(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "file.txt")
+	if err := os.WriteFile(file, nil, 0600); err != nil {
+		t.Fatal(err)
+	}
+	guest := hostGuest{&fakeGuest{}}
+	f := newTestProcess(guest)
+
+	out := captureOutput(t, func() {
+		f.syncEvent(modEvent{path: file, FileMode: 0644})
+		f.syncEvent(modEvent{path: file + ".missing", FileMode: 0644})
+	})
+	if out != "" {
+		t.Errorf("expected no output from the synced events, got %q", out)
+	}
+
+	info, err := os.Stat(file)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0644 {
+		t.Errorf("mode = %v, want %v", info.Mode().Perm(), fs.FileMode(0644))
+	}
+	if f.stats.dispatched != 2 || f.stats.failed != 1 {
+		t.Errorf("stats = %+v, want 2 dispatched and 1 failed", f.stats)
+	}
+}
@@ -0,0 +1,116 @@
+package inotify
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"os"
+	"syscall"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+const (
+	// fifoBuffer is the number of event batches queued for the FIFO reader.
+	fifoBuffer = 64
+	// fifoWriteTimeout is the maximum duration to wait for a slow FIFO reader.
+	fifoWriteTimeout = time.Second
+)
+
+// fifoWriter writes the dispatched events to a named pipe on the host for external
+// consumers, one event per line in the form "<op> <path>" e.g. "write /path/to/file".
+//
+// Events are dropped while there is no reader or the reader is too slow,
+// a closed reader is replaced by the next reader that opens the pipe.
+type fifoWriter struct {
+	path   string
+	file   *os.File
+	events chan []Event
+	log    *logrus.Entry
+}
+
+// newFIFOWriter returns the writer for the named pipe at path, the pipe is created if missing.
+func newFIFOWriter(path string, log *logrus.Entry) (*fifoWriter, error) {
+	info, err := os.Stat(path)
+	switch {
+	case errors.Is(err, fs.ErrNotExist):
+		if err := syscall.Mkfifo(path, 0600); err != nil {
+			return nil, fmt.Errorf("error creating fifo '%s': %w", path, err)
+		}
+	case err != nil:
+		return nil, fmt.Errorf("error checking fifo '%s': %w", path, err)
+	case info.Mode()&fs.ModeNamedPipe == 0:
+		return nil, fmt.Errorf("'%s' is not a fifo", path)
+	}
+
+	return &fifoWriter{
+		path:   path,
+		events: make(chan []Event, fifoBuffer),
+		log:    log,
+	}, nil
+}
+
+// send queues the events for the reader without blocking.
+func (w *fifoWriter) send(events []Event) {
+	select {
+	case w.events <- events:
+	default:
+		w.log.Tracef("fifo reader is too slow, dropping %d event(s)", len(events))
+	}
+}
+
+// run writes the queued events to the pipe until ctx is done.
+func (w *fifoWriter) run(ctx context.Context) {
+	defer w.close()
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case events := <-w.events:
+			w.write(events)
+		}
+	}
+}
+
+// write writes the events to the pipe, the events are dropped if there is no reader.
+func (w *fifoWriter) write(events []Event) {
+	if w.file == nil {
+		// a non-blocking open fails if there is no reader
+		file, err := os.OpenFile(w.path, os.O_WRONLY|syscall.O_NONBLOCK, 0)
+		if err != nil {
+			w.log.Trace(fmt.Errorf("no fifo reader, dropping %d event(s): %w", len(events), err))
+			return
+		}
+		w.file = file
+	}
+
+	var buf bytes.Buffer
+	for _, ev := range events {
+		op := ev.Op
+		if op == "" {
+			op = "write"
+		}
+		fmt.Fprintf(&buf, "%s %s\n", op, ev.Path)
+	}
+
+	_ = w.file.SetWriteDeadline(time.Now().Add(fifoWriteTimeout))
+	if _, err := w.file.Write(buf.Bytes()); err != nil {
+		if errors.Is(err, os.ErrDeadlineExceeded) {
+			w.log.Tracef("fifo reader is too slow, dropping %d event(s)", len(events))
+			return
+		}
+		// the reader is closed, the pipe is reopened for the next reader
+		w.log.Trace(fmt.Errorf("error writing to fifo: %w", err))
+		w.close()
+	}
+}
+
+func (w *fifoWriter) close() {
+	if w.file != nil {
+		_ = w.file.Close()
+		w.file = nil
+	}
+}
@@ -0,0 +1,85 @@
+package inotify
+
+import (
+	"bufio"
+	"io"
+	"os"
+	"path/filepath"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func newTestFIFOWriter(t *testing.T) *fifoWriter {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	w, err := newFIFOWriter(filepath.Join(t.TempDir(), "events"), l.WithField("context", "inotify"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(w.close)
+	return w
+}
+
+func openFIFOReader(t *testing.T, path string) (*os.File, *bufio.Reader) {
+	// a non-blocking open does not wait for a writer
+	r, err := os.OpenFile(path, os.O_RDONLY|syscall.O_NONBLOCK, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return r, bufio.NewReader(r)
+}
+
+func readLine(t *testing.T, r *os.File, br *bufio.Reader) string {
+	_ = r.SetReadDeadline(time.Now().Add(time.Second * 5))
+	line, err := br.ReadString('\n')
+	if err != nil {
+		t.Fatalf("error reading from fifo: %v", err)
+	}
+	return line
+}
+
+func Test_fifoWriter(t *testing.T) {
+	w := newTestFIFOWriter(t)
+
+	if info, err := os.Stat(w.path); err != nil || info.Mode()&os.ModeNamedPipe == 0 {
+		t.Fatalf("expected fifo to be created at %s: %v", w.path, err)
+	}
+
+	// no reader, events are dropped
+	w.write([]Event{{Path: "/dropped.go", Op: "write"}})
+
+	r, br := openFIFOReader(t, w.path)
+	w.write([]Event{{Path: "/a/main.go", Op: "write"}, {Path: "/a", Op: "remove"}, {Path: "/a/go.mod"}})
+	for _, want := range []string{"write /a/main.go\n", "remove /a\n", "write /a/go.mod\n"} {
+		if got := readLine(t, r, br); got != want {
+			t.Errorf("line = %q, want %q", got, want)
+		}
+	}
+
+	// the closed reader is handled and replaced by the next
+	_ = r.Close()
+	w.write([]Event{{Path: "/closed.go", Op: "write"}})
+	if w.file != nil {
+		t.Error("expected the pipe to be closed after the reader is closed")
+	}
+
+	r, br = openFIFOReader(t, w.path)
+	defer r.Close()
+	w.write([]Event{{Path: "/b/main.go", Op: "create"}})
+	if got, want := readLine(t, r, br), "create /b/main.go\n"; got != want {
+		t.Errorf("line = %q, want %q", got, want)
+	}
+}
+
+func Test_newFIFOWriter_notFIFO(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "events")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := newFIFOWriter(file, logrus.NewEntry(logrus.New())); err == nil {
+		t.Error("expected error for a regular file")
+	}
+}
@@ -0,0 +1,80 @@
+package inotify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"github.com/abiosoft/colima/util"
+)
+
+// ParseFile parses a watched file in the form host[:guest].
+// The guest path is the host path if omitted.
+func ParseFile(s string) (Root, error) {
+	host, guest, ok := strings.Cut(s, ":")
+	if !ok {
+		guest = host
+	}
+	if host == "" || guest == "" {
+		return Root{}, fmt.Errorf("invalid inotify file '%s', expected host[:guest]", s)
+	}
+	if ok && !filepath.IsAbs(guest) {
+		return Root{}, fmt.Errorf("invalid inotify file '%s', guest path must be absolute", s)
+	}
+	return Root{Host: host, Guest: guest}, nil
+}
+
+// normalizeFiles expands the host paths of files to absolute paths.
+// Files that do not exist or are not regular files are skipped.
+func (f *inotifyProcess) normalizeFiles(files []Root) []Root {
+	var normalized []Root
+	for _, file := range files {
+		host, err := util.CleanPath(file.Host)
+		if err == nil && !filepath.IsAbs(host) {
+			host, err = filepath.Abs(host)
+		}
+		if err != nil {
+			f.log.Warnln(fmt.Errorf("skipping inotify file '%s': %w", file.Host, err))
+			continue
+		}
+		host = strings.TrimSuffix(host, "/")
+
+		stat, err := os.Stat(host)
+		if err != nil {
+			f.log.Warnf("skipping inotify file '%s', it does not exist on the host", file.Host)
+			continue
+		}
+		if !stat.Mode().IsRegular() {
+			f.log.Warnf("skipping inotify file '%s', it is not a regular file", file.Host)
+			continue
+		}
+
+		guest := file.Guest
+		if guest == file.Host {
+			// unmapped, the expanded host path
+			guest = host
+		}
+		normalized = append(normalized, Root{Host: host, Guest: filepath.Clean(guest)})
+	}
+	return normalized
+}
+
+// watchedFile returns if path is an explicitly watched file.
+func (f *inotifyProcess) watchedFile(path string) bool {
+	for _, file := range f.files {
+		if file.Host == path {
+			return true
+		}
+	}
+	return false
+}
+
+// hostPaths returns the host paths of roots.
+func hostPaths(roots []Root) []string {
+	paths := make([]string, 0, len(roots))
+	for _, root := range roots {
+		paths = append(paths, root.Host)
+	}
+	return paths
+}
@@ -0,0 +1,128 @@
+package inotify
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/sirupsen/logrus"
+)
+
+func Test_ParseFile(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Root
+		wantErr bool
+	}{
+		{s: "/Users/user/.env", want: Root{Host: "/Users/user/.env", Guest: "/Users/user/.env"}},
+		{s: "~/settings.json:/etc/app/settings.json", want: Root{Host: "~/settings.json", Guest: "/etc/app/settings.json"}},
+		{s: "~/settings.json:etc/app/settings.json", wantErr: true},
+		{s: "", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseFile(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseFile() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseFile() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_defaultWatcher_files(t *testing.T) {
+	// resolve symlinks as the events are reported for the resolved paths
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(dir, "settings.json")
+	sibling := filepath.Join(dir, "other.json")
+	for _, f := range []string{file, sibling} {
+		if err := os.WriteFile(f, nil, 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	events, err := parseEvents(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	w := &defaultWatcher{log: l.WithField("context", "inotify"), events: events, files: []string{file}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	mod := make(chan modEvent)
+	if err := w.Watch(ctx, nil, mod); err != nil {
+		t.Skipf("watcher not supported: %v", err)
+	}
+
+	// only the watched file is reported, not its directory
+	if err := os.WriteFile(sibling, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("{}"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	select {
+	case <-ctx.Done():
+		t.Fatal("event not dispatched for the watched file")
+	case ev := <-mod:
+		if ev.path != file {
+			t.Errorf("expected event for %s, got %s", file, ev.path)
+		}
+	}
+}
+
+func Test_inotifyProcess_files(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	file := filepath.Join(t.TempDir(), ".env")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// no running containers, only the file is watched
+	guest := &fakeGuest{}
+	f := newTestProcess(guest)
+	f.runtime = "docker"
+	f.files = f.normalizeFiles([]Root{{Host: file, Guest: "/srv/app/.env"}})
+	// explicitly watched files are not skipped for being hidden
+	f.skipHiddenFiles = true
+
+	watched := make(chan []string, 1)
+	watcher := fakeWatcher{watched: watched, events: []modEvent{{path: file, FileMode: 0644}}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, watcher) }()
+
+	select {
+	case <-watched:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for watch")
+	}
+
+	deadline := time.After(time.Second * 5)
+	for len(guest.synced()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for event dispatch")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	if got, want := guest.synced(), []string{"/srv/app/.env"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("synced = %v, want %v", got, want)
+	}
+}
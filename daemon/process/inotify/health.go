@@ -0,0 +1,71 @@
+package inotify
+
+import (
+	"sync"
+	"time"
+)
+
+const (
+	// healthSmoothing is the weight of the latest sample in the moving averages.
+	healthSmoothing = 0.2
+	// lagLatency is the average dispatch latency at which event propagation is lagging.
+	lagLatency = time.Millisecond * 200
+	// lagBacklog is the average number of deferred events at which event propagation is lagging.
+	lagBacklog = batchLimit
+)
+
+// Health is the derived health of the event propagation to the VM.
+type Health struct {
+	// Latency is the moving average of the latency of an event dispatch.
+	Latency time.Duration `json:"latency"`
+	// Backlog is the moving average of the events deferred per batch.
+	Backlog float64 `json:"backlog"`
+	// Lagging is true if the propagation is not keeping up with the events.
+	Lagging bool `json:"lagging"`
+}
+
+// eventHealth tracks the exponential moving averages of the dispatch latency
+// and the backlog depth.
+type eventHealth struct {
+	sync.Mutex
+	latency float64 // nanoseconds
+	backlog float64
+	sampled bool
+}
+
+func ema(avg, sample float64) float64 {
+	return healthSmoothing*sample + (1-healthSmoothing)*avg
+}
+
+// observe records the latency of a dispatch.
+func (h *eventHealth) observe(latency time.Duration) {
+	h.Lock()
+	defer h.Unlock()
+	if !h.sampled {
+		h.latency = float64(latency)
+		h.sampled = true
+		return
+	}
+	h.latency = ema(h.latency, float64(latency))
+}
+
+// observeBacklog records the number of events deferred by a batch.
+func (h *eventHealth) observeBacklog(deferred int) {
+	h.Lock()
+	defer h.Unlock()
+	h.backlog = ema(h.backlog, float64(deferred))
+}
+
+func (h *eventHealth) health() Health {
+	h.Lock()
+	defer h.Unlock()
+	latency := time.Duration(h.latency)
+	return Health{
+		Latency: latency,
+		Backlog: h.backlog,
+		Lagging: latency >= lagLatency || h.backlog >= lagBacklog,
+	}
+}
+
+// Health returns the health of the event propagation to the VM.
+func (f *inotifyProcess) Health() Health { return f.health.health() }
@@ -0,0 +1,57 @@
+package inotify
+
+import "strings"
+
+// isHidden returns if the file or directory name is hidden.
+func isHidden(name string) bool { return strings.HasPrefix(name, ".") && name != "." && name != ".." }
+
+// relPath returns path relative to the watched directory it is within.
+// The base name is returned if path is not within a watched directory.
+func (f *inotifyProcess) relPath(path string) string {
+	var base string
+	check := func(dir string) {
+		dir = strings.TrimSuffix(dir, "/") + "/"
+		if strings.HasPrefix(path, dir) && len(dir) > len(base) {
+			base = dir
+		}
+	}
+	for _, dir := range f.vmVols {
+		check(dir)
+	}
+	for _, root := range f.roots {
+		check(root.Host)
+	}
+	for _, link := range f.links {
+		check(link.Host)
+	}
+
+	if base == "" {
+		return path[strings.LastIndex(path, "/")+1:]
+	}
+	return strings.TrimPrefix(path, base)
+}
+
+// skipHidden returns if the event for path is skipped for being a hidden file
+// or within a hidden directory of the watched directory.
+func (f *inotifyProcess) skipHidden(path string, isDir bool) bool {
+	if !f.skipHiddenDirs && !f.skipHiddenFiles {
+		return false
+	}
+
+	parts := strings.Split(f.relPath(path), "/")
+	dirs := parts[:len(parts)-1]
+	if isDir {
+		dirs = parts
+	} else if f.skipHiddenFiles && isHidden(parts[len(parts)-1]) {
+		return true
+	}
+
+	if f.skipHiddenDirs {
+		for _, dir := range dirs {
+			if isHidden(dir) {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,38 @@
+package inotify
+
+import "testing"
+
+func Test_inotifyProcess_skipHidden(t *testing.T) {
+	const dir = "/Users/user/projects/app"
+
+	tests := []struct {
+		path  string
+		isDir bool
+		dirs  bool
+		files bool
+		want  bool
+	}{
+		{path: dir + "/.env"},
+		{path: dir + "/.git/index"},
+		{path: dir + "/.env", files: true, want: true},
+		{path: dir + "/config/.env.local", files: true, want: true},
+		{path: dir + "/.env", dirs: true},
+		{path: dir + "/.git/index", dirs: true, want: true},
+		{path: dir + "/.git/index", files: true},
+		{path: dir + "/.git", isDir: true, dirs: true, want: true},
+		{path: dir + "/.git", isDir: true, files: true},
+		{path: dir + "/main.go", dirs: true, files: true},
+		// hidden directories above the watched directory are not considered
+		{path: "/Users/user/.config/app/settings.json", dirs: true},
+	}
+	for _, tt := range tests {
+		f := newTestProcess(&fakeGuest{})
+		f.vmVols = []string{dir, "/Users/user/.config/app"}
+		f.skipHiddenDirs = tt.dirs
+		f.skipHiddenFiles = tt.files
+
+		if got := f.skipHidden(tt.path, tt.isDir); got != tt.want {
+			t.Errorf("skipHidden(%s) with dirs=%v files=%v = %v, want %v", tt.path, tt.dirs, tt.files, got, tt.want)
+		}
+	}
+}
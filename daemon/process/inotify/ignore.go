@@ -0,0 +1,220 @@
+package inotify
+
+import (
+	"bufio"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"strings"
+)
+
+// ignoreFile is the file at the root of a mounted directory with the patterns of files
+// to not propagate inotify events for. The patterns follow the gitignore syntax.
+const ignoreFile = ".colimaignore"
+
+type ignoreRule struct {
+	re      *regexp.Regexp
+	negate  bool
+	dirOnly bool
+}
+
+// ignoreMatcher matches paths relative to a mounted directory against ignore rules.
+type ignoreMatcher struct {
+	rules []ignoreRule
+}
+
+// parseIgnore parses the patterns in gitignore syntax.
+func parseIgnore(content string) (*ignoreMatcher, error) {
+	var m ignoreMatcher
+
+	scanner := bufio.NewScanner(strings.NewReader(content))
+	for scanner.Scan() {
+		line := strings.TrimRight(scanner.Text(), " \t\r")
+		if line == "" || strings.HasPrefix(line, "#") {
+			continue
+		}
+
+		var rule ignoreRule
+		if strings.HasPrefix(line, "!") {
+			rule.negate = true
+			line = line[1:]
+		} else if strings.HasPrefix(line, `\`) {
+			// escaped leading '#' or '!'
+			line = line[1:]
+		}
+		if strings.HasSuffix(line, "/") {
+			rule.dirOnly = true
+			line = strings.TrimSuffix(line, "/")
+		}
+		if line == "" {
+			continue
+		}
+
+		re, err := regexp.Compile(patternRegex(line))
+		if err != nil {
+			return nil, fmt.Errorf("invalid ignore pattern '%s': %w", scanner.Text(), err)
+		}
+		rule.re = re
+		m.rules = append(m.rules, rule)
+	}
+
+	return &m, scanner.Err()
+}
+
+// patternRegex converts the gitignore pattern to a regular expression.
+func patternRegex(pattern string) string {
+	var b strings.Builder
+
+	// patterns with a separator are relative to the root, others match at any level
+	if strings.Contains(pattern, "/") {
+		b.WriteString("^")
+		pattern = strings.TrimPrefix(pattern, "/")
+	} else {
+		b.WriteString("^(?:.*/)?")
+	}
+
+	for i := 0; i < len(pattern); i++ {
+		switch c := pattern[i]; c {
+		case '*':
+			if i+1 < len(pattern) && pattern[i+1] == '*' {
+				i++
+				if i+1 < len(pattern) && pattern[i+1] == '/' {
+					// zero or more directories
+					i++
+					b.WriteString("(?:.*/)?")
+				} else {
+					b.WriteString(".*")
+				}
+				continue
+			}
+			b.WriteString("[^/]*")
+		case '?':
+			b.WriteString("[^/]")
+		case '[':
+			end := strings.IndexByte(pattern[i+1:], ']')
+			if end < 0 {
+				b.WriteString(`\[`)
+				continue
+			}
+			class := pattern[i+1 : i+1+end]
+			if strings.HasPrefix(class, "!") {
+				class = "^" + class[1:]
+			}
+			b.WriteString("[" + strings.ReplaceAll(class, `\`, `\\`) + "]")
+			i += end + 1
+		case '\\':
+			if i+1 < len(pattern) {
+				i++
+				b.WriteString(regexp.QuoteMeta(string(pattern[i])))
+			}
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+
+	b.WriteString("$")
+	return b.String()
+}
+
+// ignored returns if the slash separated path relative to the mounted directory is ignored.
+// As with gitignore, files cannot be re-included if a parent directory is ignored.
+func (m *ignoreMatcher) ignored(path string, isDir bool) bool {
+	parts := strings.Split(path, "/")
+	for i := 1; i < len(parts); i++ {
+		if m.match(strings.Join(parts[:i], "/"), true) {
+			return true
+		}
+	}
+	return m.match(path, isDir)
+}
+
+func (m *ignoreMatcher) match(path string, isDir bool) (ignored bool) {
+	for _, rule := range m.rules {
+		if rule.dirOnly && !isDir {
+			continue
+		}
+		if rule.re.MatchString(path) {
+			ignored = !rule.negate
+		}
+	}
+	return ignored
+}
+
+// ignoreCacheSize is the maximum number of cached ignore decisions.
+const ignoreCacheSize = 4096
+
+type ignoreCacheKey struct {
+	path  string
+	isDir bool
+}
+
+// ignored returns if the event for path should not be propagated as specified by the
+// ignore file of the mounted directory.
+//
+// The ignore files are read on first use and re-read when modified. The decisions are
+// cached to avoid matching repeated events for the same path, the cache is invalidated
+// when an ignore file is modified.
+func (f *inotifyProcess) ignored(path string, isDir bool) bool {
+	key := ignoreCacheKey{path: path, isDir: isDir}
+	if ignored, ok := f.ignoreCache[key]; ok {
+		return ignored
+	}
+
+	for _, vol := range f.vmVols {
+		root := strings.TrimSuffix(vol, "/") + "/"
+		if !strings.HasPrefix(path, root) {
+			continue
+		}
+		rel := strings.TrimPrefix(path, root)
+
+		if rel == ignoreFile {
+			delete(f.ignores, root)
+			f.ignoreCache = nil
+			return false
+		}
+
+		m, ok := f.ignores[root]
+		if !ok {
+			m = f.readIgnore(root)
+			if f.ignores == nil {
+				f.ignores = map[string]*ignoreMatcher{}
+			}
+			f.ignores[root] = m
+		}
+
+		ignored := m.ignored(rel, isDir)
+		f.cacheIgnored(key, ignored)
+		return ignored
+	}
+
+	f.cacheIgnored(key, false)
+	return false
+}
+
+func (f *inotifyProcess) cacheIgnored(key ignoreCacheKey, ignored bool) {
+	// the cache is only an optimisation, start afresh when full
+	if f.ignoreCache == nil || len(f.ignoreCache) >= ignoreCacheSize {
+		f.ignoreCache = make(map[ignoreCacheKey]bool)
+	}
+	f.ignoreCache[key] = ignored
+}
+
+// readIgnore reads the ignore file in the root directory.
+// An empty matcher is returned if the file does not exist or is invalid.
+func (f *inotifyProcess) readIgnore(root string) *ignoreMatcher {
+	b, err := os.ReadFile(filepath.Join(root, ignoreFile))
+	if err != nil {
+		if !os.IsNotExist(err) {
+			f.log.Warnln(fmt.Errorf("error reading %s: %w", ignoreFile, err))
+		}
+		return &ignoreMatcher{}
+	}
+
+	m, err := parseIgnore(string(b))
+	if err != nil {
+		f.log.Warnln(fmt.Errorf("error parsing %s in '%s': %w", ignoreFile, root, err))
+		return &ignoreMatcher{}
+	}
+	return m
+}
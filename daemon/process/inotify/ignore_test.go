@@ -0,0 +1,133 @@
+package inotify
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+const testIgnore = `
+# build output is not synced
+dist/
+*.log
+!important.log
+
+/tmp
+docs/**/*.draft
+node_modules
+\#notes
+`
+
+func Test_parseIgnore(t *testing.T) {
+	m, err := parseIgnore(testIgnore)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		path  string
+		isDir bool
+		want  bool
+	}{
+		{path: "main.go"},
+		{path: "dist", isDir: true, want: true},
+		{path: "dist/app.js", want: true},
+		{path: "web/dist/app.js", want: true},
+		{path: "dist", want: false}, // dir only
+		{path: "server.log", want: true},
+		{path: "logs/server.log", want: true},
+		{path: "important.log"},
+		{path: "dist/important.log", want: true}, // parent is ignored
+		{path: "tmp/cache", want: true},
+		{path: "src/tmp/cache"}, // anchored to the root
+		{path: "docs/intro.draft", want: true},
+		{path: "docs/guide/setup.draft", want: true},
+		{path: "docs/guide/setup.md"},
+		{path: "web/node_modules/react/index.js", want: true},
+		{path: "#notes", want: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := m.ignored(tt.path, tt.isDir); got != tt.want {
+				t.Errorf("ignored(%s) = %v, want %v", tt.path, got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_inotifyProcess_ignored(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ignoreFile), []byte("dist/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newTestProcess(&fakeGuest{})
+	f.vmVols = []string{root + "/"}
+
+	if !f.ignored(filepath.Join(root, "dist", "app.js"), false) {
+		t.Error("expected file in ignored directory to be ignored")
+	}
+	if f.ignored(filepath.Join(root, "src", "app.js"), false) {
+		t.Error("expected file not to be ignored")
+	}
+	if f.ignored("/elsewhere/dist/app.js", false) {
+		t.Error("expected file outside mounted directories not to be ignored")
+	}
+
+	// modifying the ignore file reloads it
+	if err := os.WriteFile(filepath.Join(root, ignoreFile), []byte("src/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f.ignored(filepath.Join(root, ignoreFile), false) {
+		t.Error("expected ignore file not to be ignored")
+	}
+	if !f.ignored(filepath.Join(root, "src", "app.js"), false) {
+		t.Error("expected modified ignore file to be applied")
+	}
+}
+
+func Test_inotifyProcess_ignoredCache(t *testing.T) {
+	root := t.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ignoreFile), []byte("dist/\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	f := newTestProcess(&fakeGuest{})
+	f.vmVols = []string{root}
+
+	path := filepath.Join(root, "dist", "app.js")
+	if !f.ignored(path, false) {
+		t.Fatal("expected file in ignored directory to be ignored")
+	}
+
+	// repeated events use the cached decision without matching
+	f.ignores[root+"/"] = &ignoreMatcher{}
+	if !f.ignored(path, false) {
+		t.Error("expected cached decision for repeated event")
+	}
+
+	// modifying the ignore file invalidates the cache
+	f.ignored(filepath.Join(root, ignoreFile), false)
+	if err := os.WriteFile(filepath.Join(root, ignoreFile), nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+	if f.ignored(path, false) {
+		t.Error("expected decision to be recomputed after the ignore file changed")
+	}
+}
+
+func Benchmark_inotifyProcess_ignored(b *testing.B) {
+	root := b.TempDir()
+	if err := os.WriteFile(filepath.Join(root, ignoreFile), []byte(testIgnore), 0644); err != nil {
+		b.Fatal(err)
+	}
+
+	f := newTestProcess(&fakeGuest{})
+	f.vmVols = []string{root}
+	path := filepath.Join(root, "web", "src", "components", "app.js")
+
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		f.ignored(path, false)
+	}
+}
@@ -2,39 +2,142 @@ package inotify
 
 import (
 	"context"
+	"errors"
 	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
 	"time"
 
+	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/daemon/process"
 	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
 	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util"
 	"github.com/sirupsen/logrus"
 )
 
+// Name is the name of the inotify process, qualified by the profile with ProcessName.
 const Name = "inotify"
-const volumesInterval = 5 * time.Second
+
+// ProcessName returns the name of the inotify process for the profile, to tell apart
+// the processes of multiple profiles e.g. inotify[default].
+func ProcessName(profile string) string { return Name + "[" + profile + "]" }
+
+var (
+	// volumesInterval is the interval for fetching container volumes, swapped in tests.
+	volumesInterval = 5 * time.Second
+	// runtimeInterval is the interval for checking the readiness of the container runtime, swapped in tests.
+	runtimeInterval = 2 * time.Second
+)
 
 type Args struct {
 	environment.GuestActions
 	Dirs    []string
+	Events  []string
 	Runtime string
+	// Limit is the maximum number of unique events propagated per batch, -1 for unlimited.
+	Limit int
+	// Sentinel is the file touched once per batch with events instead of propagating each event.
+	Sentinel string
+	// Concurrency is the maximum number of directories added to the watcher concurrently.
+	Concurrency int
+	// Roots are additional host directories to watch outside the mounted directories.
+	Roots []Root
+	// Files are single host files watched directly, with the events propagated to the guest path.
+	Files []Root
+	// Suppress is the duration events for a file are ignored after it is synced, negative to disable.
+	Suppress time.Duration
+	// FollowSymlinks watches the directories symlinked within the watched directories.
+	FollowSymlinks bool
+	// SkipHiddenDirs skips the events within hidden directories of the watched directories.
+	SkipHiddenDirs bool
+	// SkipHiddenFiles skips the events for hidden files e.g. .env.
+	SkipHiddenFiles bool
+	// FIFO is the named pipe on the host the propagated events are written to for external consumers.
+	FIFO string
+	// Disabled disables the propagation of events for the profile, the process idles until stopped.
+	Disabled bool
+	// HistorySize is the number of recently dispatched events retained for the dump, 0 to disable.
+	HistorySize int
+	// WaitRuntime waits for the container runtime to be ready in addition to the VM before watching.
+	WaitRuntime bool
+	// StrictWatch fails the process if any of the directories cannot be watched,
+	// instead of logging the error.
+	StrictWatch bool
+	// Probe verifies the sync once watching with a probe file written in the first watched
+	// directory, reported in the status. The user volumes are not written to if false.
+	Probe bool
+	// Poll is the interval the files are scanned for changes at, instead of watching for
+	// native file events. Native file events are used if zero.
+	Poll time.Duration
 }
 
 func CtxKeyArgs() any { return struct{ name string }{name: "inotify_args"} }
 
-// New returns inotify process.
-func New() process.Process {
-	return &inotifyProcess{
-		log: logrus.WithField("context", "inotify"),
+// New returns inotify process for the current profile.
+func New(opts ...Option) process.Process {
+	name := ProcessName(config.CurrentProfile().ShortName)
+	f := &inotifyProcess{
+		name: name,
+		log:  logrus.WithField("context", name),
+	}
+	for _, opt := range opts {
+		opt(f)
 	}
+	return f
+}
+
+// Event is a file event propagated to the VM.
+type Event struct {
+	Path string
+	Op   string // name of the file event e.g. write
+	Mode fs.FileMode
+}
+
+// Option is an option for the inotify process.
+type Option func(*inotifyProcess)
+
+// WithOnDispatch sets the callback for the events propagated to the VM.
+// The callback is called in a separate goroutine with the events of each batch.
+func WithOnDispatch(f func([]Event)) Option {
+	return func(p *inotifyProcess) { p.onDispatch = f }
 }
 
 var _ process.Process = (*inotifyProcess)(nil)
 
 type inotifyProcess struct {
-	vmVols  []string
-	guest   environment.GuestActions
-	runtime string
+	name            string // see ProcessName
+	vmVols          []string
+	roots           []Root
+	files           []Root   // explicitly watched files
+	links           []Root   // followed symlinks
+	linkDirs        []string // the directories links are resolved for
+	guest           environment.GuestActions
+	runtime         string
+	limit           int
+	sentinel        string
+	followSymlinks  bool
+	skipHiddenDirs  bool // see skipHidden
+	skipHiddenFiles bool
+	strictWatch     bool
+	probeOnStart    bool // see Args.Probe
+	stats           eventStats
+	health          eventHealth
+	history         *eventHistory
+	suppression     eventSuppression
+	suppressMu      sync.Mutex
+	suppressedUntil time.Time                 // see SuppressUntil
+	ignores         map[string]*ignoreMatcher // mounted directory -> ignore file
+	ignoreCache     map[ignoreCacheKey]bool
+
+	onDispatch func([]Event)
+	probes     eventProbes
+	status     processStatus
 
 	log *logrus.Entry
 }
@@ -56,8 +159,11 @@ func (*inotifyProcess) Dependencies() (deps []process.Dependency, root bool) {
 }
 
 // Name implements process.Process
-func (*inotifyProcess) Name() string {
-	return Name
+func (f *inotifyProcess) Name() string {
+	if f.name == "" {
+		return Name
+	}
+	return f.name
 }
 
 // Start implements process.Process
@@ -66,21 +172,134 @@ func (f *inotifyProcess) Start(ctx context.Context) error {
 	if !ok {
 		return fmt.Errorf("args missing in context")
 	}
-	f.vmVols = omitChildrenDirectories(args.Dirs)
+	log := f.log
+
+	// remain alive without watching, for the daemon to not restart the process
+	if args.Disabled {
+		log.Info("inotify is disabled for the profile")
+		<-ctx.Done()
+		return nil
+	}
+
+	// the status of a previous run is not reported
+	removeStatus()
+	defer removeStatus()
+
+	f.vmVols = omitChildrenDirectories(f.normalizeDirs(args.Dirs))
+	f.roots = f.normalizeRoots(args.Roots)
+	f.files = f.normalizeFiles(args.Files)
+
+	events, err := parseEvents(args.Events)
+	if err != nil {
+		return err
+	}
 
 	f.guest = args.GuestActions
 	f.runtime = args.Runtime
-	log := f.log
+	f.limit = args.Limit
+	f.sentinel = args.Sentinel
+	f.suppression = newEventSuppression(args.Suppress)
+	f.followSymlinks = args.FollowSymlinks
+	f.skipHiddenDirs = args.SkipHiddenDirs
+	f.skipHiddenFiles = args.SkipHiddenFiles
+	f.strictWatch = args.StrictWatch
+	f.probeOnStart = args.Probe
+	f.history = newEventHistory(args.HistorySize)
+
+	if args.FIFO != "" {
+		w, err := newFIFOWriter(args.FIFO, log)
+		if err != nil {
+			return err
+		}
+		go w.run(ctx)
+
+		onDispatch := f.onDispatch
+		f.onDispatch = func(events []Event) {
+			if onDispatch != nil {
+				onDispatch(events)
+			}
+			w.send(events)
+		}
+	}
 
 	log.Info("waiting for VM to start")
 	f.waitForLima(ctx)
 	log.Info("VM started")
 
-	watcher := &defaultWatcher{log: log}
+	// the mounts of the containers are not ready until the runtime is
+	if args.WaitRuntime {
+		log.Infof("waiting for %s to be ready", f.runtime)
+		f.waitForRuntime(ctx)
+		log.Infof("%s ready", f.runtime)
+	}
+
+	var watcher dirWatcher = &defaultWatcher{log: log, events: events, concurrency: args.Concurrency, files: hostPaths(f.files), strict: args.StrictWatch}
+	if args.Poll > 0 {
+		watcher = &pollWatcher{log: log, events: events, interval: args.Poll, files: hostPaths(f.files)}
+	}
 
 	return f.handleEvents(ctx, watcher)
 }
 
+// normalizeDirs normalizes dirs with normalizeDir.
+// Directories that cannot be resolved are skipped, as well as empty directories that
+// would resolve to the working directory and the root directory.
+func (f *inotifyProcess) normalizeDirs(dirs []string) []string {
+	var normalized []string
+	for _, dir := range dirs {
+		if strings.TrimSpace(dir) == "" {
+			f.log.Warnln("skipping empty inotify directory")
+			continue
+		}
+		d, err := normalizeDir(dir)
+		if errors.Is(err, fs.ErrNotExist) {
+			f.log.Warnf("skipping inotify directory '%s', it does not exist on the host", dir)
+			continue
+		}
+		if err != nil {
+			f.log.Warnln(fmt.Errorf("skipping inotify directory: %w", err))
+			continue
+		}
+		if d == "/" {
+			f.log.Warnf("skipping inotify directory '%s', watching the root directory is not supported", dir)
+			continue
+		}
+		normalized = append(normalized, d)
+	}
+	return normalized
+}
+
+// normalizeDir expands the home directory and converts dir to an absolute path.
+//
+// Symlinks are resolved to validate that dir exists, but the unresolved path is returned
+// as that is the path the directory is mounted at in the VM.
+func normalizeDir(dir string) (string, error) {
+	if !strings.HasPrefix(dir, "~") && !filepath.IsAbs(dir) {
+		abs, err := filepath.Abs(dir)
+		if err != nil {
+			return "", fmt.Errorf("error resolving absolute path for '%s': %w", dir, err)
+		}
+		dir = abs
+	}
+
+	dir, err := util.CleanPath(dir)
+	if err != nil {
+		return "", err
+	}
+
+	resolved, err := filepath.EvalSymlinks(dir)
+	if err != nil {
+		return "", fmt.Errorf("error resolving '%s': %w", dir, err)
+	}
+	if stat, err := os.Stat(resolved); err != nil {
+		return "", fmt.Errorf("error resolving '%s': %w", dir, err)
+	} else if !stat.IsDir() {
+		return "", fmt.Errorf("'%s' is not a directory", dir)
+	}
+
+	return dir, nil
+}
+
 // waitForLima waits until lima starts and sets the directory to watch.
 func (f *inotifyProcess) waitForLima(ctx context.Context) {
 	log := f.log
@@ -106,3 +325,28 @@ func (f *inotifyProcess) waitForLima(ctx context.Context) {
 		}
 	}
 }
+
+// runtimeReadyCmd returns the command that succeeds when the container runtime is ready.
+func (f *inotifyProcess) runtimeReadyCmd() []string {
+	if f.runtime == containerd.Name {
+		return []string{"sudo", "nerdctl", "info"}
+	}
+	return []string{docker.Name, "info"}
+}
+
+// waitForRuntime waits until the container runtime in the VM is ready.
+func (f *inotifyProcess) waitForRuntime(ctx context.Context) {
+	cmd := f.runtimeReadyCmd()
+	for {
+		if err := f.guest.RunQuiet(cmd...); err == nil {
+			return
+		}
+		f.log.Tracef("%s not ready, retrying in %v", f.runtime, runtimeInterval)
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(runtimeInterval):
+		}
+	}
+}
@@ -0,0 +1,98 @@
+package inotify
+
+import (
+	"context"
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+)
+
+func Test_inotifyProcess_Start_disabled(t *testing.T) {
+	guest := &fakeGuest{}
+	f := newTestProcess(guest)
+
+	ctx, cancel := context.WithTimeout(context.Background(), 50*time.Millisecond)
+	defer cancel()
+	ctx = context.WithValue(ctx, CtxKeyArgs(), Args{
+		GuestActions: guest,
+		Dirs:         []string{t.TempDir()},
+		Disabled:     true,
+	})
+
+	if err := f.Start(ctx); err != nil {
+		t.Fatal(err)
+	}
+	if ctx.Err() == nil {
+		t.Error("expected the disabled process to idle until stopped")
+	}
+	if len(f.vmVols) != 0 {
+		t.Errorf("expected no watched directories, got %+v", f.vmVols)
+	}
+	if n := len(guest.commands); n != 0 {
+		t.Errorf("expected no commands in the VM, got %+v", guest.commands)
+	}
+}
+
+func Test_inotifyProcess_waitForRuntime(t *testing.T) {
+	runtimeInterval = time.Millisecond * 10
+	t.Cleanup(func() { runtimeInterval = time.Second * 2 })
+
+	tests := []struct {
+		runtime string
+		cmd     string
+	}{
+		{runtime: "docker", cmd: "docker info"},
+		{runtime: "containerd", cmd: "sudo nerdctl info"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.runtime, func(t *testing.T) {
+			guest := &fakeGuest{errs: map[string]error{tt.cmd: fmt.Errorf("runtime not ready")}}
+			f := newTestProcess(guest)
+			f.runtime = tt.runtime
+
+			// the runtime becomes ready after a delay
+			const delay = time.Millisecond * 100
+			time.AfterFunc(delay, func() {
+				guest.Lock()
+				defer guest.Unlock()
+				delete(guest.errs, tt.cmd)
+			})
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+			defer cancel()
+
+			start := time.Now()
+			f.waitForRuntime(ctx)
+			if ctx.Err() != nil {
+				t.Fatal("timed out waiting for the runtime")
+			}
+			if elapsed := time.Since(start); elapsed < delay {
+				t.Errorf("expected to wait for the runtime for at least %v, waited %v", delay, elapsed)
+			}
+			if n := guest.count(tt.cmd); n < 2 {
+				t.Errorf("expected the readiness of the runtime to be retried, got %d check(s)", n)
+			}
+		})
+	}
+}
+
+func TestNew_profileName(t *testing.T) {
+	t.Cleanup(func() { config.SetProfile("") })
+
+	config.SetProfile("default")
+	first := New()
+	config.SetProfile("work")
+	second := New()
+
+	if first.Name() != "inotify[default]" || second.Name() != "inotify[work]" {
+		t.Errorf("unexpected process names %s and %s", first.Name(), second.Name())
+	}
+	if first.Name() == second.Name() {
+		t.Errorf("expected distinct process names for distinct profiles, got %s", first.Name())
+	}
+	if want := ProcessName("work"); second.Name() != want {
+		t.Errorf("Name() = %s, want %s", second.Name(), want)
+	}
+}
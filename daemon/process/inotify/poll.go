@@ -0,0 +1,144 @@
+package inotify
+
+import (
+	"context"
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"sort"
+	"time"
+
+	"github.com/abiosoft/colima/util"
+	"github.com/rjeczalik/notify"
+	"github.com/sirupsen/logrus"
+)
+
+// pollWatcher is a dirWatcher scanning the modification times of the files at an interval,
+// for mounts where native file events are not reported. It trades CPU for reliability.
+// Renames are reported as a remove and a create.
+type pollWatcher struct {
+	log      *logrus.Entry
+	events   notify.Event
+	interval time.Duration
+	// files are watched directly in addition to the directories.
+	files []string
+}
+
+// pollState is the state of a file compared between scans.
+type pollState struct {
+	modTime time.Time
+	size    int64
+	mode    fs.FileMode
+}
+
+// scan returns the state of the files within dirs recursively, and of the watched files.
+// Entries that cannot be read are skipped.
+func (p *pollWatcher) scan(dirs []string) map[string]pollState {
+	files := map[string]pollState{}
+	add := func(path string, info fs.FileInfo) {
+		files[path] = pollState{modTime: info.ModTime(), size: info.Size(), mode: info.Mode()}
+	}
+
+	for _, dir := range dirs {
+		_ = filepath.WalkDir(dir, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				p.log.Trace(fmt.Errorf("error scanning '%s': %w", path, err))
+				return nil
+			}
+			if d.IsDir() {
+				return nil
+			}
+			info, err := d.Info()
+			if err != nil {
+				return nil
+			}
+			add(path, info)
+			return nil
+		})
+	}
+	for _, file := range p.files {
+		if info, err := os.Stat(file); err == nil && !info.IsDir() {
+			add(file, info)
+		}
+	}
+	return files
+}
+
+// diff returns the events for the changes from prev to cur, sorted by path.
+func (p *pollWatcher) diff(prev, cur map[string]pollState) []modEvent {
+	var events []modEvent
+	for path, state := range cur {
+		old, ok := prev[path]
+		switch {
+		case !ok && p.events&notify.Create != 0:
+			events = append(events, modEvent{path: path, op: "create", FileMode: state.mode})
+		// writing a new file is also a write
+		case !ok && p.events&notify.Write != 0:
+			events = append(events, modEvent{path: path, op: "write", FileMode: state.mode})
+		case ok && p.events&notify.Write != 0 && (!old.modTime.Equal(state.modTime) || old.size != state.size):
+			events = append(events, modEvent{path: path, op: "write", FileMode: state.mode})
+		}
+	}
+	if p.events&notify.Remove != 0 {
+		for path := range prev {
+			if _, ok := cur[path]; ok {
+				continue
+			}
+			// the file no longer exists, propagate to the parent directory instead
+			dir := filepath.Dir(path)
+			if stat, err := os.Stat(dir); err == nil {
+				events = append(events, modEvent{path: dir, op: "remove", FileMode: stat.Mode() & chmodBits})
+			}
+		}
+	}
+	sort.Slice(events, func(i, j int) bool { return events[i].path < events[j].path })
+	return events
+}
+
+// Watch implements dirWatcher
+func (p *pollWatcher) Watch(ctx context.Context, dirs []string, mod chan<- modEvent) error {
+	log := p.log
+
+	cleaned := make([]string, 0, len(dirs))
+	for _, dir := range dirs {
+		dir, err := util.CleanPath(dir)
+		if err != nil {
+			return fmt.Errorf("invalid directory: %w", err)
+		}
+		if _, err := os.Stat(dir); err != nil {
+			return fmt.Errorf("error watching directory '%s': %w", dir, err)
+		}
+		cleaned = append(cleaned, dir)
+	}
+
+	prev := p.scan(cleaned)
+	log.Infof("polling %d file(s) every %v", len(prev), p.interval)
+
+	go func() {
+		ticker := time.NewTicker(p.interval)
+		defer ticker.Stop()
+		for {
+			select {
+			case <-ctx.Done():
+				log.Trace("stopping watcher")
+				return
+			case <-ticker.C:
+				cur := p.scan(cleaned)
+				for _, ev := range p.diff(prev, cur) {
+					log.Tracef("polled event %s for %s", ev.op, ev.path)
+					select {
+					case <-ctx.Done():
+						return
+					case mod <- ev:
+					}
+				}
+				prev = cur
+			}
+		}
+	}()
+
+	return nil
+}
+
+var _ dirWatcher = (*pollWatcher)(nil)
@@ -0,0 +1,163 @@
+package inotify
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+
+	"github.com/rjeczalik/notify"
+	"github.com/sirupsen/logrus"
+)
+
+func newTestPollWatcher(events notify.Event) *pollWatcher {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	return &pollWatcher{log: l.WithField("context", "inotify"), events: events, interval: time.Millisecond * 10}
+}
+
+// receive returns the next event from mod.
+func receive(t *testing.T, mod <-chan modEvent) modEvent {
+	t.Helper()
+	select {
+	case ev := <-mod:
+		return ev
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for polled event")
+	}
+	return modEvent{}
+}
+
+func Test_pollWatcher_mtime(t *testing.T) {
+	dir := t.TempDir()
+	file := filepath.Join(dir, "src", "main.go")
+	if err := os.MkdirAll(filepath.Dir(file), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := os.WriteFile(file, []byte("package main"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	mod := make(chan modEvent)
+	if err := newTestPollWatcher(notify.Write).Watch(ctx, []string{dir}, mod); err != nil {
+		t.Fatal(err)
+	}
+
+	// only the modification time changes, the content is identical
+	mtime := time.Now().Add(time.Minute)
+	if err := os.Chtimes(file, mtime, mtime); err != nil {
+		t.Fatal(err)
+	}
+	if ev := receive(t, mod); ev.path != file || ev.op != "write" || ev.FileMode != 0644 {
+		t.Errorf("unexpected event %+v for %s", ev, file)
+	}
+
+	// an unchanged file is not reported again
+	select {
+	case ev := <-mod:
+		t.Errorf("unexpected event %+v for unchanged file", ev)
+	case <-time.After(time.Millisecond * 100):
+	}
+}
+
+func Test_pollWatcher_diff(t *testing.T) {
+	dir := t.TempDir()
+	// the special bits of the parent directory are retained
+	if err := os.Chmod(dir, 0775|os.ModeSetgid); err != nil {
+		t.Fatal(err)
+	}
+	now := time.Now()
+	prev := map[string]pollState{
+		dir + "/a.go":     {modTime: now, size: 1, mode: 0644},
+		dir + "/b.go":     {modTime: now, size: 1, mode: 0644},
+		dir + "/stale.go": {modTime: now, size: 1, mode: 0644},
+	}
+	cur := map[string]pollState{
+		dir + "/a.go":   {modTime: now, size: 1, mode: 0644},
+		dir + "/b.go":   {modTime: now, size: 2, mode: 0644},
+		dir + "/new.go": {modTime: now, size: 1, mode: 0600},
+	}
+
+	tests := []struct {
+		name   string
+		events notify.Event
+		want   []modEvent
+	}{
+		{
+			name:   "write",
+			events: notify.Write,
+			want: []modEvent{
+				{path: dir + "/b.go", op: "write", FileMode: 0644},
+				{path: dir + "/new.go", op: "write", FileMode: 0600},
+			},
+		},
+		{
+			name:   "create and remove",
+			events: notify.Create | notify.Remove,
+			want: []modEvent{
+				{path: dir, op: "remove", FileMode: 0775 | os.ModeSetgid},
+				{path: dir + "/new.go", op: "create", FileMode: 0600},
+			},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := newTestPollWatcher(tt.events).diff(prev, cur); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("diff() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_pollWatcher_missingDir(t *testing.T) {
+	mod := make(chan modEvent)
+	dir := filepath.Join(t.TempDir(), "missing")
+	if err := newTestPollWatcher(notify.Write).Watch(context.Background(), []string{dir}, mod); err == nil {
+		t.Fatal("expected an error for a missing directory")
+	}
+}
+
+func Test_inotifyProcess_poll(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	root := t.TempDir()
+	file := filepath.Join(root, "main.go")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	guest := &fakeGuest{outputs: map[string]string{
+		"docker ps -q":       "app",
+		"docker inspect app": `[{"Mounts": [{"Source": "` + root + `"}]}]`,
+	}}
+	f := newTestProcess(guest)
+	f.runtime = "docker"
+	f.vmVols = f.normalizeDirs([]string{root})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, newTestPollWatcher(notify.Write)) }()
+
+	// the polled events take the same dispatch path as native events
+	deadline := time.After(time.Second * 5)
+	for i := 1; len(guest.synced()) == 0; i++ {
+		mtime := time.Now().Add(time.Duration(i) * time.Minute)
+		if err := os.Chtimes(file, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("polled event not dispatched: %+v", guest.commands)
+		case <-time.After(time.Millisecond * 50):
+		}
+	}
+	if got := guest.synced(); got[0] != file {
+		t.Errorf("synced = %v, want %v", got, []string{file})
+	}
+}
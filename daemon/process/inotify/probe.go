@@ -0,0 +1,124 @@
+package inotify
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+// probePrefix is the name prefix of the probe files, not hidden to not be skipped as a hidden file.
+const probePrefix = "colima-inotify-probe-"
+
+// ProbeResult is the result of a successful probe.
+type ProbeResult struct {
+	// File is the host path of the probe file.
+	File string
+	// Latency is the duration from the write on the host to the sync in the VM.
+	Latency time.Duration
+	// MTime is the modification time of the probe file, identical on the host and in the VM.
+	MTime time.Time
+}
+
+// Prober verifies the propagation of events to the VM, implemented by the inotify process.
+// It validates the sync is working end to end e.g. as a diagnostic check.
+type Prober interface {
+	// Probe writes a probe file in the watched host directory dir, waits for its event
+	// to be synced to the VM and verifies the modification time of the file in the VM.
+	// An error is returned if the event is not synced before ctx is done.
+	Probe(ctx context.Context, dir string) (ProbeResult, error)
+}
+
+var _ Prober = (*inotifyProcess)(nil)
+
+// eventProbes are the pending probes, notified when the event for the probe file is synced.
+type eventProbes struct {
+	sync.Mutex
+	pending map[string]chan struct{} // host path -> synced notification
+}
+
+func (p *eventProbes) register(path string) <-chan struct{} {
+	p.Lock()
+	defer p.Unlock()
+	if p.pending == nil {
+		p.pending = map[string]chan struct{}{}
+	}
+	ch := make(chan struct{})
+	p.pending[path] = ch
+	return ch
+}
+
+func (p *eventProbes) unregister(path string) {
+	p.Lock()
+	defer p.Unlock()
+	delete(p.pending, path)
+}
+
+// active returns if there are pending probes.
+func (p *eventProbes) active() bool {
+	p.Lock()
+	defer p.Unlock()
+	return len(p.pending) > 0
+}
+
+// synced notifies the probe for path, if any.
+func (p *eventProbes) synced(path string) {
+	p.Lock()
+	defer p.Unlock()
+	if ch, ok := p.pending[path]; ok {
+		close(ch)
+		delete(p.pending, path)
+	}
+}
+
+// Probe implements Prober.
+func (f *inotifyProcess) Probe(ctx context.Context, dir string) (ProbeResult, error) {
+	var result ProbeResult
+	if f.guest == nil {
+		return result, fmt.Errorf("inotify not running")
+	}
+
+	path := filepath.Join(dir, probePrefix+strconv.FormatInt(time.Now().UnixNano(), 10))
+	synced := f.probes.register(path)
+	defer f.probes.unregister(path)
+
+	start := time.Now()
+	if err := os.WriteFile(path, []byte(start.String()), 0644); err != nil {
+		return result, fmt.Errorf("error writing probe file: %w", err)
+	}
+	defer func() { _ = os.Remove(path) }()
+
+	select {
+	case <-synced:
+	case <-ctx.Done():
+		return result, fmt.Errorf("probe file '%s' not synced to the VM, the directory may not be watched: %w", path, ctx.Err())
+	}
+	result.File = path
+	result.Latency = time.Since(start)
+
+	info, err := os.Stat(path)
+	if err != nil {
+		return result, fmt.Errorf("error reading probe file: %w", err)
+	}
+	result.MTime = info.ModTime()
+
+	guestPath := f.guestPath(path)
+	out, err := f.guest.RunOutput("stat", "-c", "%Y", guestPath)
+	if err != nil {
+		return result, fmt.Errorf("error reading probe file in the VM: %w", err)
+	}
+	mtime, err := strconv.ParseInt(strings.TrimSpace(out), 10, 64)
+	if err != nil {
+		return result, fmt.Errorf("invalid mtime '%s' of probe file in the VM: %w", out, err)
+	}
+	if mtime != result.MTime.Unix() {
+		return result, fmt.Errorf("mtime of probe file in the VM %s differs from the host %s, the mount is not in sync",
+			time.Unix(mtime, 0).Format(time.RFC3339), result.MTime.Format(time.RFC3339))
+	}
+
+	return result, nil
+}
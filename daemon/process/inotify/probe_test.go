@@ -0,0 +1,136 @@
+package inotify
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/rjeczalik/notify"
+	"github.com/sirupsen/logrus"
+)
+
+// startProbeTest starts the event handler for a container mounting a temporary directory
+// if mounted, and returns the directory once watched. The options are applied to the process before starting.
+func startProbeTest(t *testing.T, guest *fakeGuest, mounted bool, opts ...Option) (*inotifyProcess, string) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	// resolve symlinks as the events are reported for the resolved paths
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if mounted {
+		guest.outputs = map[string]string{
+			"docker ps -q":       "app",
+			"docker inspect app": `[{"Mounts": [{"Source": "` + dir + `"}]}]`,
+		}
+	}
+
+	f := newTestProcess(guest)
+	f.runtime = "docker"
+	f.vmVols = f.normalizeDirs([]string{dir})
+	for _, opt := range opts {
+		opt(f)
+	}
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	watcher := &defaultWatcher{log: l.WithField("context", "inotify"), events: notify.Write}
+	watched := make(chan struct{})
+	var once sync.Once
+	watcher.progress = func(watchProgress) { once.Do(func() { close(watched) }) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	t.Cleanup(cancel)
+	go func() { _ = f.handleEvents(ctx, watcher) }()
+
+	if mounted {
+		select {
+		case <-watched:
+		case <-time.After(time.Second * 5):
+			t.Fatal("timed out waiting for watch")
+		}
+	}
+	return f, dir
+}
+
+// statOutput returns the output of stat for the mtime of the host file, offset by skew.
+func statOutput(skew time.Duration) func(cmd string) string {
+	return func(cmd string) string {
+		path, ok := strings.CutPrefix(cmd, "stat -c %Y ")
+		if !ok {
+			return ""
+		}
+		info, err := os.Stat(path)
+		if err != nil {
+			return ""
+		}
+		return strconv.FormatInt(info.ModTime().Add(skew).Unix(), 10)
+	}
+}
+
+func Test_inotifyProcess_Probe(t *testing.T) {
+	guest := &fakeGuest{output: statOutput(0)}
+	f, dir := startProbeTest(t, guest, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	result, err := f.Probe(ctx, dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if filepath.Dir(result.File) != dir || !strings.HasPrefix(filepath.Base(result.File), probePrefix) {
+		t.Errorf("unexpected probe file %s", result.File)
+	}
+	if result.Latency <= 0 {
+		t.Errorf("expected the latency to be reported, got %v", result.Latency)
+	}
+	if got := guest.synced(); len(got) == 0 || got[0] != result.File {
+		t.Errorf("expected the probe file to be synced, got %v", got)
+	}
+	if _, err := os.Stat(result.File); !os.IsNotExist(err) {
+		t.Errorf("expected the probe file to be removed, got %v", err)
+	}
+}
+
+func Test_inotifyProcess_Probe_notSynced(t *testing.T) {
+	// the container volumes are not mounted, the directory is not watched
+	guest := &fakeGuest{output: statOutput(0)}
+	f, dir := startProbeTest(t, guest, false)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*300)
+	defer cancel()
+	if _, err := f.Probe(ctx, dir); err == nil {
+		t.Fatal("expected an error for a probe not synced")
+	}
+	if got := guest.synced(); len(got) > 0 {
+		t.Errorf("unexpected sync %v", got)
+	}
+}
+
+func Test_inotifyProcess_Probe_mtimeMismatch(t *testing.T) {
+	// the mount in the VM is serving a stale file
+	guest := &fakeGuest{output: statOutput(-time.Hour)}
+	f, dir := startProbeTest(t, guest, true)
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+	if _, err := f.Probe(ctx, dir); err == nil || !strings.Contains(err.Error(), "not in sync") {
+		t.Fatalf("expected an error for a mismatched mtime, got %v", err)
+	}
+}
+
+func Test_inotifyProcess_Probe_notRunning(t *testing.T) {
+	f := &inotifyProcess{}
+	if _, err := f.Probe(context.Background(), t.TempDir()); err == nil {
+		t.Fatal("expected an error for a process not running")
+	}
+}
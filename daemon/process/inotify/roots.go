@@ -0,0 +1,112 @@
+package inotify
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+)
+
+// Root is a host directory outside the mounted directories that is watched,
+// with the events propagated to the corresponding directory in the VM.
+type Root struct {
+	Host  string
+	Guest string
+}
+
+// ParseRoot parses a root in the form host:guest.
+func ParseRoot(s string) (Root, error) {
+	host, guest, ok := strings.Cut(s, ":")
+	if !ok || host == "" || guest == "" {
+		return Root{}, fmt.Errorf("invalid inotify root '%s', expected host:guest", s)
+	}
+	if !filepath.IsAbs(guest) {
+		return Root{}, fmt.Errorf("invalid inotify root '%s', guest path must be absolute", s)
+	}
+	return Root{Host: host, Guest: guest}, nil
+}
+
+// String returns the root in the form host:guest.
+func (r Root) String() string { return r.Host + ":" + r.Guest }
+
+// normalizeRoots normalizes the host directories of roots with normalizeDir.
+// Roots that cannot be resolved are skipped.
+func (f *inotifyProcess) normalizeRoots(roots []Root) []Root {
+	var normalized []Root
+	for _, root := range roots {
+		host := f.normalizeDirs([]string{root.Host})
+		if len(host) == 0 {
+			continue
+		}
+		guest := strings.TrimSuffix(filepath.Clean(root.Guest), "/") + "/"
+		normalized = append(normalized, Root{Host: host[0], Guest: guest})
+	}
+	return normalized
+}
+
+// watchedDirs returns the directories to watch for the container volumes vols,
+// the additional roots and the followed symlinks.
+//
+// Symlinks are only resolved when vols change, symlinks created afterwards are
+// followed on the next change.
+func (f *inotifyProcess) watchedDirs(vols []string) []string {
+	dirs := append([]string{}, vols...)
+	for _, root := range f.roots {
+		dirs = append(dirs, root.Host)
+	}
+
+	if f.followSymlinks {
+		if !sameDirs(f.linkDirs, dirs) {
+			f.linkDirs = dirs
+			f.links = f.symlinkRoots(dirs)
+		}
+		for _, link := range f.links {
+			dirs = append(dirs, link.Host)
+		}
+	}
+
+	if len(dirs) == len(vols) {
+		return vols
+	}
+	return omitChildrenDirectories(dirs)
+}
+
+// sameDirs returns if a and b are the same directories in the same order.
+func sameDirs(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return a != nil
+}
+
+// guestPath returns the path in the VM for the host path.
+// The path is translated for the watched files, the followed symlinks and the additional
+// roots, mounted directories have the same path in the VM.
+func (f *inotifyProcess) guestPath(path string) string {
+	for _, file := range f.files {
+		if file.Host == path {
+			return file.Guest
+		}
+	}
+	if len(f.links) > 0 {
+		return translatePath(path, append(append([]Root{}, f.links...), f.roots...))
+	}
+	return translatePath(path, f.roots)
+}
+
+// translatePath returns the path in the VM for the host path with the first matching root.
+func translatePath(path string, roots []Root) string {
+	for _, root := range roots {
+		if path == strings.TrimSuffix(root.Host, "/") {
+			return strings.TrimSuffix(root.Guest, "/")
+		}
+		if strings.HasPrefix(path, root.Host) {
+			return root.Guest + strings.TrimPrefix(path, root.Host)
+		}
+	}
+	return path
+}
@@ -0,0 +1,100 @@
+package inotify
+
+import (
+	"context"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func Test_ParseRoot(t *testing.T) {
+	tests := []struct {
+		s       string
+		want    Root
+		wantErr bool
+	}{
+		{s: "/Users/user/generated:/srv/generated", want: Root{Host: "/Users/user/generated", Guest: "/srv/generated"}},
+		{s: "/Users/user/generated", wantErr: true},
+		{s: "/Users/user/generated:srv/generated", wantErr: true},
+		{s: ":/srv/generated", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.s, func(t *testing.T) {
+			got, err := ParseRoot(tt.s)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseRoot() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseRoot() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_inotifyProcess_roots(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	mounted := t.TempDir()
+	generated := t.TempDir()
+
+	// no running containers
+	guest := &fakeGuest{}
+	f := newTestProcess(guest)
+	f.runtime = "docker"
+	f.vmVols = f.normalizeDirs([]string{mounted})
+	f.roots = f.normalizeRoots([]Root{{Host: generated, Guest: "/srv/generated"}})
+
+	watched := make(chan []string, 1)
+	watcher := fakeWatcher{watched: watched, events: []modEvent{
+		{path: generated + "/api/types.go", FileMode: 0644},
+	}}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, watcher) }()
+
+	select {
+	case dirs := <-watched:
+		if want := []string{generated + "/"}; !reflect.DeepEqual(dirs, want) {
+			t.Errorf("watched = %v, want %v", dirs, want)
+		}
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for watch")
+	}
+
+	deadline := time.After(time.Second * 5)
+	for len(guest.synced()) == 0 {
+		select {
+		case <-deadline:
+			t.Fatal("timed out waiting for event dispatch")
+		case <-time.After(time.Millisecond * 10):
+		}
+	}
+	if got, want := guest.synced(), []string{"/srv/generated/api/types.go"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("synced = %v, want %v", got, want)
+	}
+	if got := guest.count("stat /srv/generated/api/types.go"); got != 1 {
+		t.Errorf("expected stat of the guest path, got %+v", guest.commands)
+	}
+}
+
+func Test_inotifyProcess_guestPath(t *testing.T) {
+	f := &inotifyProcess{roots: []Root{{Host: "/Users/user/generated/", Guest: "/srv/generated/"}}}
+	tests := []struct {
+		path string
+		want string
+	}{
+		{path: "/Users/user/generated/main.go", want: "/srv/generated/main.go"},
+		{path: "/Users/user/generated", want: "/srv/generated"},
+		{path: "/Users/user/generated-other/main.go", want: "/Users/user/generated-other/main.go"},
+		{path: "/Users/user/projects/main.go", want: "/Users/user/projects/main.go"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.path, func(t *testing.T) {
+			if got := f.guestPath(tt.path); got != tt.want {
+				t.Errorf("guestPath() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,109 @@
+package inotify
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+	"time"
+
+	"github.com/abiosoft/colima/daemon/process"
+)
+
+var (
+	// probeDelay is the delay of the startup probe after the watcher is started, swapped in tests.
+	probeDelay = time.Second * 10
+	// probeTimeout is the duration the startup probe waits for the sync, swapped in tests.
+	probeTimeout = time.Second * 30
+	// statusInterval is the interval the health is written to the status file, unless changed.
+	statusInterval = time.Second * 5
+)
+
+// Status is the state of the inotify process reported by `colima status`.
+type Status struct {
+	// Probe is the result of the startup probe, nil until the probe completes or if not enabled.
+	Probe *ProbeStatus `json:"probe,omitempty"`
+	// Health is the health of the event propagation, nil until the first batch completes.
+	Health *Health `json:"health,omitempty"`
+}
+
+// ProbeStatus is the result of a probe.
+type ProbeStatus struct {
+	// Latency is the sync latency of a successful probe.
+	Latency time.Duration `json:"latency,omitempty"`
+	// Error is the error of a failed probe.
+	Error string `json:"error,omitempty"`
+	// Time is the time the probe completed.
+	Time time.Time `json:"time"`
+}
+
+// statusFile returns the file the status is written to, swapped in tests.
+var statusFile = func() string { return filepath.Join(process.Dir(), "inotify.status") }
+
+// ReadStatus returns the status written by the running inotify process.
+// An error is returned if the process is not running or has not written a status.
+func ReadStatus() (Status, error) {
+	var s Status
+	b, err := os.ReadFile(statusFile())
+	if err != nil {
+		return s, fmt.Errorf("error reading inotify status: %w", err)
+	}
+	if err := json.Unmarshal(b, &s); err != nil {
+		return s, fmt.Errorf("invalid inotify status: %w", err)
+	}
+	return s, nil
+}
+
+// processStatus is the status of the process, written to the status file on update.
+type processStatus struct {
+	sync.Mutex
+	Status
+}
+
+// update applies fn to the status and writes it to the status file.
+func (s *processStatus) update(fn func(*Status)) error {
+	s.Lock()
+	defer s.Unlock()
+	fn(&s.Status)
+	b, err := json.Marshal(s.Status)
+	if err != nil {
+		return fmt.Errorf("error encoding inotify status: %w", err)
+	}
+	if err := os.WriteFile(statusFile(), b, 0644); err != nil {
+		return fmt.Errorf("error writing inotify status: %w", err)
+	}
+	return nil
+}
+
+// removeStatus removes the status file, for a stopped process to not report a stale status.
+func removeStatus() { _ = os.Remove(statusFile()) }
+
+// startupProbe probes the sync in the watched directory dir once the watcher is started,
+// and records the result in the status file.
+func (f *inotifyProcess) startupProbe(ctx context.Context, dir string) {
+	select {
+	case <-ctx.Done():
+		return
+	case <-time.After(probeDelay):
+	}
+
+	probeCtx, cancel := context.WithTimeout(ctx, probeTimeout)
+	defer cancel()
+	result, err := f.Probe(probeCtx, dir)
+	if ctx.Err() != nil {
+		return // stopped
+	}
+
+	probe := ProbeStatus{Latency: result.Latency, Time: time.Now()}
+	if err != nil {
+		probe = ProbeStatus{Error: err.Error(), Time: probe.Time}
+		f.log.Warnln(fmt.Errorf("inotify probe failed: %w", err))
+	} else {
+		f.log.Infof("inotify probe synced in %v", result.Latency)
+	}
+	if err := f.status.update(func(s *Status) { s.Probe = &probe }); err != nil {
+		f.log.Warnln(err)
+	}
+}
@@ -0,0 +1,131 @@
+package inotify
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMain(m *testing.M) {
+	// the tests do not write the status of the colima profile
+	dir, err := os.MkdirTemp("", "inotify-status")
+	if err != nil {
+		panic(err)
+	}
+	file := filepath.Join(dir, "inotify.status")
+	statusFile = func() string { return file }
+	code := m.Run()
+	_ = os.RemoveAll(dir)
+	os.Exit(code)
+}
+
+// swapStatus swaps the status file and the startup probe timings for the test.
+func swapStatus(t *testing.T) {
+	file := filepath.Join(t.TempDir(), "inotify.status")
+	saved := statusFile
+	statusFile = func() string { return file }
+	probeDelay, probeTimeout = time.Millisecond*100, time.Second*5
+	t.Cleanup(func() {
+		statusFile = saved
+		probeDelay, probeTimeout = time.Second*10, time.Second*30
+	})
+}
+
+// withProbe enables the startup probe.
+func withProbe(f *inotifyProcess) { f.probeOnStart = true }
+
+// waitProbeStatus waits for the startup probe to be recorded in the status file.
+func waitProbeStatus(t *testing.T) ProbeStatus {
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		if s, err := ReadStatus(); err == nil && s.Probe != nil {
+			return *s.Probe
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timed out waiting for the probe status")
+	return ProbeStatus{}
+}
+
+func Test_inotifyProcess_startupProbe(t *testing.T) {
+	swapStatus(t)
+
+	guest := &fakeGuest{output: statOutput(0)}
+	startProbeTest(t, guest, true, withProbe)
+
+	probe := waitProbeStatus(t)
+	if probe.Error != "" {
+		t.Fatalf("unexpected probe error: %s", probe.Error)
+	}
+	if probe.Latency <= 0 {
+		t.Errorf("expected the latency to be reported, got %v", probe.Latency)
+	}
+}
+
+func Test_inotifyProcess_startupProbe_failed(t *testing.T) {
+	swapStatus(t)
+
+	// the mount in the VM is serving a stale file
+	guest := &fakeGuest{output: statOutput(-time.Hour)}
+	startProbeTest(t, guest, true, withProbe)
+
+	probe := waitProbeStatus(t)
+	if !strings.Contains(probe.Error, "not in sync") {
+		t.Errorf("expected the probe error to be reported, got %q", probe.Error)
+	}
+}
+
+func Test_inotifyProcess_startupProbe_disabled(t *testing.T) {
+	swapStatus(t)
+
+	guest := &fakeGuest{output: statOutput(0)}
+	_, dir := startProbeTest(t, guest, true)
+
+	// no probe file is written in the watched directory by default
+	time.Sleep(probeDelay * 3)
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(entries) > 0 {
+		t.Errorf("unexpected files in the watched directory: %v", entries)
+	}
+	if got := guest.synced(); len(got) > 0 {
+		t.Errorf("unexpected sync %v", got)
+	}
+	if s, err := ReadStatus(); err == nil && s.Probe != nil {
+		t.Errorf("unexpected probe status %+v", *s.Probe)
+	}
+}
+
+func TestReadStatus_notRunning(t *testing.T) {
+	swapStatus(t)
+
+	if _, err := ReadStatus(); err == nil {
+		t.Error("expected an error without a status file")
+	}
+}
+
+func Test_inotifyProcess_healthStatus(t *testing.T) {
+	swapStatus(t)
+
+	guest := &fakeGuest{output: statOutput(0)}
+	f, _ := startProbeTest(t, guest, true)
+	for i := 0; i < 10; i++ {
+		f.health.observe(time.Second)
+	}
+
+	deadline := time.Now().Add(time.Second * 5)
+	for time.Now().Before(deadline) {
+		if s, err := ReadStatus(); err == nil && s.Health != nil && s.Health.Lagging {
+			if s.Health.Latency < lagLatency {
+				t.Errorf("expected the lagging latency to be reported, got %v", s.Health.Latency)
+			}
+			return
+		}
+		time.Sleep(time.Millisecond * 10)
+	}
+	t.Fatal("timed out waiting for the lagging health status")
+}
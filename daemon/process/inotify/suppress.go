@@ -0,0 +1,130 @@
+package inotify
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+	"time"
+
+	"github.com/abiosoft/colima/daemon/process"
+)
+
+// defaultSuppressWindow is the default duration events for a file are ignored after it is synced.
+const defaultSuppressWindow = 300 * time.Millisecond
+
+// eventSuppression ignores events for files recently synced to the VM.
+// Tools in the VM may write back to a synced file, which would otherwise be echoed
+// back as an event on a bidirectional mount and propagated again in a loop.
+// The zero value suppresses no events.
+type eventSuppression struct {
+	// window is the duration events are ignored after a sync.
+	window  time.Duration
+	touched map[string]time.Time // path -> time of the last sync
+}
+
+// newEventSuppression returns the suppression for window, defaultSuppressWindow if zero.
+// Suppression is disabled if window is negative.
+func newEventSuppression(window time.Duration) eventSuppression {
+	if window == 0 {
+		window = defaultSuppressWindow
+	}
+	return eventSuppression{window: window, touched: map[string]time.Time{}}
+}
+
+// touch records path as synced at now.
+func (s *eventSuppression) touch(path string, now time.Time) {
+	if s.window <= 0 {
+		return
+	}
+	s.touched[path] = now
+}
+
+// suppressed returns if events for path are ignored at now.
+func (s *eventSuppression) suppressed(path string, now time.Time) bool {
+	t, ok := s.touched[path]
+	return ok && now.Sub(t) < s.window
+}
+
+// cleanup removes the paths with an expired window at now.
+func (s *eventSuppression) cleanup(now time.Time) {
+	for path, t := range s.touched {
+		if now.Sub(t) >= s.window {
+			delete(s.touched, path)
+		}
+	}
+}
+
+// Suppressor suppresses the propagation of events, implemented by the inotify process.
+// Subsystems that mutate the mounted files themselves e.g. an install copying into a mounted
+// directory suppress the events for the duration of the operation with Suppress,
+// or with `colima daemon suppress` from outside colima.
+type Suppressor interface {
+	// SuppressUntil ignores all events until t. A zero t ends the suppression.
+	SuppressUntil(t time.Time)
+}
+
+var _ Suppressor = (*inotifyProcess)(nil)
+
+// SuppressUntil implements Suppressor.
+func (f *inotifyProcess) SuppressUntil(t time.Time) {
+	f.suppressMu.Lock()
+	defer f.suppressMu.Unlock()
+	f.suppressedUntil = t
+}
+
+// suppressedAt returns if all events are suppressed at now.
+func (f *inotifyProcess) suppressedAt(now time.Time) bool {
+	f.suppressMu.Lock()
+	defer f.suppressMu.Unlock()
+	return now.Before(f.suppressedUntil)
+}
+
+// suppressSignal is the signal for reading the suppression deadline from the suppress file.
+var suppressSignal os.Signal = syscall.SIGUSR2
+
+// suppressFile returns the file the suppression deadline is written to, swapped in tests.
+var suppressFile = func() string { return filepath.Join(process.Dir(), "inotify.suppress") }
+
+// Suppress suppresses all events of the daemon with pid until t. A zero t ends the suppression.
+// The deadline is written to the suppress file, read by the daemon on suppressSignal.
+func Suppress(pid int, t time.Time) error {
+	var deadline string
+	if !t.IsZero() {
+		deadline = t.Format(time.RFC3339Nano)
+	}
+	if err := os.WriteFile(suppressFile(), []byte(deadline), 0644); err != nil {
+		return fmt.Errorf("error writing inotify suppression: %w", err)
+	}
+
+	p, err := os.FindProcess(pid)
+	if err != nil {
+		return fmt.Errorf("daemon process not found: %w", err)
+	}
+	if err := p.Signal(suppressSignal); err != nil {
+		return fmt.Errorf("error signalling daemon: %w", err)
+	}
+	return nil
+}
+
+// readSuppression returns the suppression deadline in the suppress file.
+// It is zero if the file is missing, the suppression ends.
+func readSuppression() (time.Time, error) {
+	b, err := os.ReadFile(suppressFile())
+	if err != nil {
+		if os.IsNotExist(err) {
+			return time.Time{}, nil
+		}
+		return time.Time{}, fmt.Errorf("error reading inotify suppression: %w", err)
+	}
+	deadline := strings.TrimSpace(string(b))
+	if deadline == "" {
+		return time.Time{}, nil
+	}
+	t, err := time.Parse(time.RFC3339Nano, deadline)
+	if err != nil {
+		return time.Time{}, fmt.Errorf("invalid inotify suppression '%s': %w", deadline, err)
+	}
+	return t, nil
+}
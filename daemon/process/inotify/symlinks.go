@@ -0,0 +1,97 @@
+package inotify
+
+import (
+	"fmt"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+	"syscall"
+)
+
+// fileID identifies a directory on the host independently of the path it is reached by.
+type fileID struct {
+	dev, ino uint64
+}
+
+// dirID returns the identity of the directory with info.
+// The path is used if the device and inode are not available.
+func dirID(path string, info fs.FileInfo) any {
+	if st, ok := info.Sys().(*syscall.Stat_t); ok {
+		return fileID{dev: uint64(st.Dev), ino: uint64(st.Ino)}
+	}
+	return path
+}
+
+// symlinkRoots returns the roots for the symlinked directories within dirs.
+// Symlinks within the symlinked directories are followed recursively and the
+// directories are translated to the path of the symlink in the VM.
+//
+// Directories are visited once to guard against cycles, a symlink to a directory
+// that is already watched is not followed.
+func (f *inotifyProcess) symlinkRoots(dirs []string) []Root {
+	log := f.log
+	visited := map[any]bool{}
+	var roots []Root
+
+	var walk func(host, guest string)
+	walk = func(host, guest string) {
+		err := filepath.WalkDir(host, func(path string, d fs.DirEntry, err error) error {
+			if err != nil {
+				log.Trace(fmt.Errorf("error walking '%s': %w", path, err))
+				return nil
+			}
+
+			if d.IsDir() {
+				info, err := d.Info()
+				if err != nil {
+					return nil
+				}
+				id := dirID(path, info)
+				if visited[id] {
+					return filepath.SkipDir
+				}
+				visited[id] = true
+				if path != host && (f.ignored(path, true) || (f.skipHiddenDirs && isHidden(d.Name()))) {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+
+			if d.Type()&fs.ModeSymlink == 0 {
+				return nil
+			}
+
+			target, err := filepath.EvalSymlinks(path)
+			if err != nil {
+				log.Trace(fmt.Errorf("error resolving symlink '%s': %w", path, err))
+				return nil
+			}
+			info, err := os.Stat(target)
+			if err != nil || !info.IsDir() || visited[dirID(target, info)] {
+				return nil
+			}
+
+			linkGuest := guest + strings.TrimPrefix(path, host)
+			log.Tracef("following symlink '%s' to '%s'", path, target)
+			roots = append(roots, Root{Host: target + "/", Guest: linkGuest + "/"})
+			walk(target, linkGuest)
+			return nil
+		})
+		if err != nil {
+			log.Trace(fmt.Errorf("error walking '%s': %w", host, err))
+		}
+	}
+
+	for _, dir := range dirs {
+		dir = strings.TrimSuffix(dir, "/")
+		// the directory itself may be a symlink, which is not walked
+		resolved, err := filepath.EvalSymlinks(dir)
+		if err != nil {
+			log.Trace(fmt.Errorf("error resolving '%s': %w", dir, err))
+			continue
+		}
+		walk(resolved, translatePath(dir, f.roots))
+	}
+	return roots
+}
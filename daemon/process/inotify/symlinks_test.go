@@ -0,0 +1,57 @@
+package inotify
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+)
+
+func Test_inotifyProcess_symlinkRoots(t *testing.T) {
+	tmp, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	mount := filepath.Join(tmp, "project")
+	shared := filepath.Join(tmp, "shared")
+	for _, dir := range []string{mount + "/src", shared + "/pkg"} {
+		if err := os.MkdirAll(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+	links := map[string]string{
+		mount + "/lib":        shared,         // symlinked subtree outside the mount
+		mount + "/self":       mount,          // cycle to the mount
+		mount + "/src/alias":  mount + "/src", // cycle to the parent
+		shared + "/pkg/loop":  shared,         // cycle within the symlinked subtree
+		mount + "/README.txt": "/dev/null",    // not a directory
+	}
+	for link, target := range links {
+		if err := os.Symlink(target, link); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	f := newTestProcess(&fakeGuest{})
+	f.vmVols = []string{mount}
+	f.followSymlinks = true
+
+	want := []Root{{Host: shared + "/", Guest: mount + "/lib/"}}
+	if got := f.symlinkRoots([]string{mount}); !reflect.DeepEqual(got, want) {
+		t.Fatalf("symlinkRoots() = %+v, want %+v", got, want)
+	}
+
+	dirs := f.watchedDirs([]string{mount})
+	if want := []string{mount, shared + "/"}; !reflect.DeepEqual(dirs, want) {
+		t.Errorf("watchedDirs() = %+v, want %+v", dirs, want)
+	}
+	if got, want := f.guestPath(shared+"/pkg/main.go"), mount+"/lib/pkg/main.go"; got != want {
+		t.Errorf("guestPath() = %s, want %s", got, want)
+	}
+
+	// symlinks are not followed by default
+	f = newTestProcess(&fakeGuest{})
+	if dirs := f.watchedDirs([]string{mount}); !reflect.DeepEqual(dirs, []string{mount}) {
+		t.Errorf("watchedDirs() = %+v, want %+v", dirs, []string{mount})
+	}
+}
@@ -55,6 +55,7 @@ func (f *inotifyProcess) monitorContainerVolumes(ctx context.Context, c chan<- [
 		return vols, nil
 	}
 
+	interval := volumesInterval
 	go func() {
 		for {
 			select {
@@ -64,7 +65,8 @@ func (f *inotifyProcess) monitorContainerVolumes(ctx context.Context, c chan<- [
 				if err != nil {
 					log.Trace(fmt.Errorf("error during stop: %w", err))
 				}
-			case <-time.After(volumesInterval):
+				return
+			case <-time.After(interval):
 				if vols, err := fetch(); err != nil {
 					log.Error(err)
 				} else {
@@ -124,7 +126,7 @@ func (f *inotifyProcess) fetchVolumes(cmdArgs ...string) ([]string, error) {
 			// ignore all invalid directories.
 			// i.e. directories not within the mounted VM directories
 			for _, parent := range f.vmVols {
-				if strings.HasPrefix(child, parent) {
+				if withinDir(child, parent) {
 					return true
 				}
 			}
@@ -146,6 +148,14 @@ func (f *inotifyProcess) fetchVolumes(cmdArgs ...string) ([]string, error) {
 	return vols, nil
 }
 
+// withinDir returns if path is dir itself or within dir.
+// The mounted directories are normalized with a trailing slash, the volume of a
+// container mounting the root of a mounted directory is reported without it.
+func withinDir(path, dir string) bool {
+	dir = strings.TrimSuffix(dir, "/")
+	return path == dir || strings.HasPrefix(path, dir+"/")
+}
+
 func omitChildrenDirectories(dirs []string) []string {
 	sort.Strings(dirs) // sort to put the parent directories first
 
@@ -1,9 +1,18 @@
 package inotify
 
 import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
 	"reflect"
 	"strconv"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/rjeczalik/notify"
+	"github.com/sirupsen/logrus"
 )
 
 func Test_omitChildrenDirectories(t *testing.T) {
@@ -40,3 +49,155 @@ func Test_omitChildrenDirectories(t *testing.T) {
 		})
 	}
 }
+
+func Test_normalizeDir(t *testing.T) {
+	dir := t.TempDir()
+	target := filepath.Join(dir, "target")
+	if err := os.Mkdir(target, 0755); err != nil {
+		t.Fatal(err)
+	}
+	link := filepath.Join(dir, "link")
+	if err := os.Symlink(target, link); err != nil {
+		t.Fatal(err)
+	}
+	dangling := filepath.Join(dir, "dangling")
+	if err := os.Symlink(filepath.Join(dir, "none"), dangling); err != nil {
+		t.Fatal(err)
+	}
+
+	home := t.TempDir()
+	t.Setenv("HOME", home)
+	if err := os.Mkdir(filepath.Join(home, "projects"), 0755); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		dir     string
+		want    string
+		wantErr bool
+	}{
+		{dir: "~", want: home + "/"},
+		{dir: "~/projects", want: filepath.Join(home, "projects") + "/"},
+		{dir: "~/missing", wantErr: true},
+		{dir: target, want: target + "/"},
+		{dir: link + "/", want: link + "/"},
+		{dir: dangling, wantErr: true},
+		{dir: filepath.Join(dir, "missing"), wantErr: true},
+	}
+	for i, tt := range tests {
+		t.Run(strconv.Itoa(i), func(t *testing.T) {
+			got, err := normalizeDir(tt.dir)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("normalizeDir() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("normalizeDir() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_inotifyProcess_normalizeDirs(t *testing.T) {
+	valid := t.TempDir()
+	missing := filepath.Join(t.TempDir(), "missing")
+
+	f := newTestProcess(&fakeGuest{})
+	got := f.normalizeDirs([]string{valid, missing})
+	want := []string{valid + "/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeDirs() = %v, want %v", got, want)
+	}
+}
+
+func Test_inotifyProcess_normalizeDirs_root(t *testing.T) {
+	valid := t.TempDir()
+
+	// an empty directory must not resolve to the working directory
+	f := newTestProcess(&fakeGuest{})
+	got := f.normalizeDirs([]string{"/", "", "//", "/.", valid})
+	want := []string{valid + "/"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("normalizeDirs() = %v, want %v", got, want)
+	}
+}
+
+func Test_inotifyProcess_fetchVolumes(t *testing.T) {
+	guest := &fakeGuest{outputs: map[string]string{
+		"docker ps -q": "root child sibling outside",
+		"docker inspect root child sibling outside": `[
+			{"Mounts": [{"Source": "/Users/user/project"}]},
+			{"Mounts": [{"Source": "/Users/user/other/src"}]},
+			{"Mounts": [{"Source": "/Users/user/project2"}]},
+			{"Mounts": [{"Source": "/var/lib/data"}]}
+		]`,
+	}}
+	f := newTestProcess(guest)
+	// normalized with a trailing slash
+	f.vmVols = []string{"/Users/user/project/", "/Users/user/other/"}
+
+	got, err := f.fetchVolumes("docker")
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []string{"/Users/user/other/src", "/Users/user/project"}
+	if !reflect.DeepEqual(got, want) {
+		t.Errorf("fetchVolumes() = %v, want %v", got, want)
+	}
+}
+
+func Test_inotifyProcess_mountRootWrite(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	// resolve symlinks as the events are reported for the resolved paths
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	file := filepath.Join(root, "main.go")
+	if err := os.WriteFile(file, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	// the container mounts the root of the mounted directory
+	guest := &fakeGuest{outputs: map[string]string{
+		"docker ps -q":       "app",
+		"docker inspect app": `[{"Mounts": [{"Source": "` + root + `"}]}]`,
+	}}
+	f := newTestProcess(guest)
+	f.runtime = "docker"
+	f.vmVols = f.normalizeDirs([]string{root})
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	watcher := &defaultWatcher{log: l.WithField("context", "inotify"), events: notify.Write}
+	watched := make(chan struct{})
+	var once sync.Once
+	watcher.progress = func(watchProgress) { once.Do(func() { close(watched) }) }
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	go func() { _ = f.handleEvents(ctx, watcher) }()
+
+	select {
+	case <-watched:
+	case <-time.After(time.Second * 5):
+		t.Fatal("timed out waiting for watch")
+	}
+
+	// the file is directly in the mount root, not in a subdirectory
+	deadline := time.After(time.Second * 5)
+	for len(guest.synced()) == 0 {
+		if err := os.WriteFile(file, []byte("package main"), 0644); err != nil {
+			t.Fatal(err)
+		}
+		select {
+		case <-deadline:
+			t.Fatalf("write in the mount root not dispatched: %+v", guest.commands)
+		case <-time.After(time.Millisecond * 50):
+		}
+	}
+	if got := guest.synced(); got[0] != file {
+		t.Errorf("synced = %v, want %v", got, []string{file})
+	}
+}
@@ -2,8 +2,14 @@ package inotify
 
 import (
 	"context"
+	"errors"
 	"fmt"
 	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
 
 	"github.com/abiosoft/colima/util"
 	"github.com/rjeczalik/notify"
@@ -22,7 +28,125 @@ type dirWatcher interface {
 }
 
 type defaultWatcher struct {
-	log *logrus.Entry
+	log    *logrus.Entry
+	events notify.Event
+
+	// concurrency is the maximum number of directories added to the watcher concurrently.
+	concurrency int
+	// files are watched directly in addition to the directories.
+	files []string
+	// progress is called periodically while the directories are added to the watcher.
+	// The progress is logged if nil.
+	progress func(watchProgress)
+	// strict fails the watch if any of the directories cannot be watched.
+	// Otherwise, the directories that cannot be watched are logged and skipped.
+	strict bool
+}
+
+// defaultWatchConcurrency is the default maximum number of directories added to the watcher concurrently.
+const defaultWatchConcurrency = 4
+
+var (
+	// progressInterval is the interval for reporting the progress of adding directories, swapped in tests.
+	progressInterval = 5 * time.Second
+	// watchDir adds a directory to the watcher, swapped in tests.
+	watchDir = notify.Watch
+)
+
+// watchProgress is the progress of adding the directories to the watcher.
+type watchProgress struct {
+	Added int
+	Total int
+}
+
+func (d *defaultWatcher) report(p watchProgress) {
+	if d.progress != nil {
+		d.progress(p)
+		return
+	}
+	d.log.Infof("watching directories: %d of %d added", p.Added, p.Total)
+}
+
+// add adds the directories to the watcher recursively, reporting the progress periodically.
+// It returns the number of directories added and the errors of the others.
+func (d *defaultWatcher) add(dirs []string, c chan notify.EventInfo) (int, error) {
+	concurrency := d.concurrency
+	if concurrency <= 0 {
+		concurrency = defaultWatchConcurrency
+	}
+
+	var added atomic.Int32
+	done := make(chan struct{})
+	ticker := time.NewTicker(progressInterval)
+	go func() {
+		defer ticker.Stop()
+		for {
+			select {
+			case <-done:
+				return
+			case <-ticker.C:
+				d.report(watchProgress{Added: int(added.Load()), Total: len(dirs)})
+			}
+		}
+	}()
+
+	errs := make([]error, len(dirs))
+	sem := make(chan struct{}, concurrency)
+	var wg sync.WaitGroup
+	for i, dir := range dirs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, dir string) {
+			defer wg.Done()
+			defer func() { <-sem }()
+			if err := watchDir(dir+"...", c, d.events); err != nil {
+				errs[i] = fmt.Errorf("error watching directory recursively '%s': %w", dir, err)
+				return
+			}
+			added.Add(1)
+		}(i, dir)
+	}
+	wg.Wait()
+	close(done)
+
+	d.report(watchProgress{Added: int(added.Load()), Total: len(dirs)})
+	return int(added.Load()), errors.Join(errs...)
+}
+
+// eventNames maps the configurable event names to events.
+var eventNames = map[string]notify.Event{
+	"write":  notify.Write,
+	"create": notify.Create,
+	"remove": notify.Remove,
+	"rename": notify.Rename,
+}
+
+// eventName returns the configurable name of the event.
+func eventName(event notify.Event) string {
+	for _, name := range []string{"write", "create", "remove", "rename"} {
+		if event&eventNames[name] != 0 {
+			return name
+		}
+	}
+	return event.String()
+}
+
+// parseEvents parses the event names to the events to propagate.
+// Write is returned if names is empty.
+func parseEvents(names []string) (notify.Event, error) {
+	if len(names) == 0 {
+		return notify.Write, nil
+	}
+
+	var events notify.Event
+	for _, name := range names {
+		event, ok := eventNames[strings.ToLower(name)]
+		if !ok {
+			return 0, fmt.Errorf("invalid inotify event '%s'", name)
+		}
+		events |= event
+	}
+	return events, nil
 }
 
 // Watch implements dirWatcher
@@ -30,14 +154,25 @@ func (d *defaultWatcher) Watch(ctx context.Context, dirs []string, mod chan<- mo
 	log := d.log
 	c := make(chan notify.EventInfo, 1)
 
+	cleaned := make([]string, 0, len(dirs))
 	for _, dir := range dirs {
 		dir, err := util.CleanPath(dir)
 		if err != nil {
 			return fmt.Errorf("invalid directory: %w", err)
 		}
-		err = notify.Watch(dir+"...", c, notify.Write)
-		if err != nil {
-			return fmt.Errorf("error watching directory recursively '%s': %w", dir, err)
+		cleaned = append(cleaned, dir)
+	}
+	if added, err := d.add(cleaned, c); err != nil {
+		if d.strict || added == 0 {
+			notify.Stop(c)
+			return err
+		}
+		log.Warnln(fmt.Errorf("skipping the directories that cannot be watched: %w", err))
+	}
+	for _, file := range d.files {
+		if err := watchDir(file, c, d.events); err != nil {
+			notify.Stop(c)
+			return fmt.Errorf("error watching file '%s': %w", file, err)
 		}
 	}
 
@@ -59,6 +194,14 @@ func (d *defaultWatcher) Watch(ctx context.Context, dirs []string, mod chan<- mo
 				log.Tracef("received event %s for %s", e.Event().String(), path)
 
 				stat, err := os.Stat(path)
+				if err != nil && e.Event()&(notify.Remove|notify.Rename) != 0 {
+					// the file no longer exists, propagate to the parent directory instead
+					path = filepath.Dir(path)
+					if stat, err = os.Stat(path); err == nil {
+						mod <- modEvent{path: path, op: eventName(e.Event()), FileMode: stat.Mode() & chmodBits}
+						continue
+					}
+				}
 				if err != nil {
 					log.Trace(fmt.Errorf("unable to stat inotify file '%s': %w", path, err))
 					continue
@@ -70,7 +213,7 @@ func (d *defaultWatcher) Watch(ctx context.Context, dirs []string, mod chan<- mo
 				}
 
 				// send modification event
-				mod <- modEvent{path: path, FileMode: stat.Mode()}
+				mod <- modEvent{path: path, op: eventName(e.Event()), FileMode: stat.Mode()}
 			}
 		}
 	}(ctx, c, mod)
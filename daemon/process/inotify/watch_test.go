@@ -0,0 +1,269 @@
+package inotify
+
+import (
+	"context"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"syscall"
+	"testing"
+	"time"
+
+	"github.com/rjeczalik/notify"
+	"github.com/sirupsen/logrus"
+)
+
+func Test_parseEvents(t *testing.T) {
+	tests := []struct {
+		names   []string
+		want    notify.Event
+		wantErr bool
+	}{
+		{names: nil, want: notify.Write},
+		{names: []string{"write"}, want: notify.Write},
+		{names: []string{"write", "create"}, want: notify.Write | notify.Create},
+		{names: []string{"Remove", "rename"}, want: notify.Remove | notify.Rename},
+		{names: []string{"write", "chmod"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.names, ","), func(t *testing.T) {
+			got, err := parseEvents(tt.names)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseEvents() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseEvents() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_defaultWatcher_events(t *testing.T) {
+	// resolve symlinks as the events are reported for the resolved paths
+	dir, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	existing := filepath.Join(dir, "existing.txt")
+	if err := os.WriteFile(existing, nil, 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := parseEvents([]string{"write", "create"})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	w := &defaultWatcher{log: l.WithField("context", "inotify"), events: events}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	mod := make(chan modEvent)
+	if err := w.Watch(ctx, []string{dir}, mod); err != nil {
+		t.Skipf("watcher not supported: %v", err)
+	}
+
+	created := filepath.Join(dir, "created.txt")
+	if file, err := os.Create(created); err != nil {
+		t.Fatal(err)
+	} else {
+		_ = file.Close()
+	}
+	if err := os.WriteFile(existing, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	want := map[string]bool{created: false, existing: false}
+	for remaining := len(want); remaining > 0; {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("events not dispatched: %+v", want)
+		case ev := <-mod:
+			if dispatched, ok := want[ev.path]; ok && !dispatched {
+				want[ev.path] = true
+				remaining--
+			}
+		}
+	}
+}
+
+func Test_defaultWatcher_skipUnwatched(t *testing.T) {
+	watchDir = func(path string, c chan<- notify.EventInfo, events ...notify.Event) error {
+		if strings.Contains(path, "broken") {
+			return syscall.ENOSPC // inotify watch limit reached
+		}
+		return notify.Watch(path, c, events...)
+	}
+	t.Cleanup(func() { watchDir = notify.Watch })
+
+	// resolve symlinks as the events are reported for the resolved paths
+	root, err := filepath.EvalSymlinks(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	working, broken := root+"/working", root+"/broken"
+	for _, dir := range []string{working, broken} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	w := &defaultWatcher{log: l.WithField("context", "inotify"), events: notify.Write, progress: func(watchProgress) {}}
+
+	ctx, cancel := context.WithTimeout(context.Background(), time.Second*5)
+	defer cancel()
+
+	mod := make(chan modEvent)
+	if err := w.Watch(ctx, []string{broken, working}, mod); errors.Is(err, syscall.ENOSPC) {
+		t.Fatalf("expected the directory that cannot be watched to be skipped, got %v", err)
+	} else if err != nil {
+		t.Skipf("watcher not supported: %v", err)
+	}
+
+	// the events of the watched directory are still received
+	file := filepath.Join(working, "file.txt")
+	if err := os.WriteFile(file, []byte("modified"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	for {
+		select {
+		case <-ctx.Done():
+			t.Fatalf("event not received for %s", file)
+		case ev := <-mod:
+			if ev.path == file {
+				return
+			}
+		}
+	}
+}
+
+func Test_defaultWatcher_noneWatched(t *testing.T) {
+	watchDir = func(string, chan<- notify.EventInfo, ...notify.Event) error { return syscall.ENOSPC }
+	t.Cleanup(func() { watchDir = notify.Watch })
+
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	w := &defaultWatcher{log: l.WithField("context", "inotify"), events: notify.Write, progress: func(watchProgress) {}}
+
+	if err := w.Watch(context.Background(), []string{t.TempDir()}, make(chan modEvent)); !errors.Is(err, syscall.ENOSPC) {
+		t.Errorf("expected the watch error without any directory watched, got %v", err)
+	}
+}
+
+func Test_defaultWatcher_progress(t *testing.T) {
+	progressInterval = time.Millisecond * 10
+	t.Cleanup(func() { progressInterval = time.Second * 5 })
+
+	var active, maxActive atomic.Int32
+	watchDir = func(path string, c chan<- notify.EventInfo, events ...notify.Event) error {
+		n := active.Add(1)
+		for {
+			max := maxActive.Load()
+			if n <= max || maxActive.CompareAndSwap(max, n) {
+				break
+			}
+		}
+		time.Sleep(time.Millisecond * 20) // large directory
+		active.Add(-1)
+		return nil
+	}
+	t.Cleanup(func() { watchDir = notify.Watch })
+
+	var mu sync.Mutex
+	var reports []watchProgress
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	w := &defaultWatcher{
+		log:         l.WithField("context", "inotify"),
+		concurrency: 2,
+		progress: func(p watchProgress) {
+			mu.Lock()
+			defer mu.Unlock()
+			reports = append(reports, p)
+		},
+	}
+
+	dirs := make([]string, 10)
+	for i := range dirs {
+		dirs[i] = "/dir" + strconv.Itoa(i)
+	}
+	if _, err := w.add(dirs, make(chan notify.EventInfo)); err != nil {
+		t.Fatal(err)
+	}
+
+	mu.Lock()
+	defer mu.Unlock()
+	if len(reports) < 3 {
+		t.Fatalf("expected periodic progress reports, got %+v", reports)
+	}
+	if last := reports[len(reports)-1]; last != (watchProgress{Added: 10, Total: 10}) {
+		t.Errorf("final progress = %+v, want all directories added", last)
+	}
+	for i := 1; i < len(reports); i++ {
+		if reports[i].Added < reports[i-1].Added {
+			t.Errorf("progress decreased: %+v", reports)
+		}
+	}
+	if got := maxActive.Load(); got > 2 {
+		t.Errorf("concurrent watches = %d, want at most 2", got)
+	}
+}
+
+func Test_inotifyProcess_strictWatch(t *testing.T) {
+	volumesInterval = time.Millisecond * 10
+	t.Cleanup(func() { volumesInterval = time.Second * 5 })
+
+	watchDir = func(path string, c chan<- notify.EventInfo, events ...notify.Event) error {
+		if strings.Contains(path, "broken") {
+			return syscall.ENOSPC // inotify watch limit reached
+		}
+		return nil
+	}
+	t.Cleanup(func() { watchDir = notify.Watch })
+
+	root := t.TempDir()
+	working, broken := root+"/working", root+"/broken"
+	for _, dir := range []string{working, broken} {
+		if err := os.Mkdir(dir, 0755); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	for _, strict := range []bool{false, true} {
+		t.Run(strconv.FormatBool(strict), func(t *testing.T) {
+			// no running containers, only the roots are watched
+			f := newTestProcess(&fakeGuest{})
+			f.runtime = "docker"
+			f.strictWatch = strict
+			f.roots = f.normalizeRoots([]Root{
+				{Host: working, Guest: "/srv/working"},
+				{Host: broken, Guest: "/srv/broken"},
+			})
+			watcher := &defaultWatcher{log: f.log, events: notify.Write, progress: func(watchProgress) {}, strict: strict}
+
+			ctx, cancel := context.WithTimeout(context.Background(), time.Millisecond*200)
+			defer cancel()
+
+			err := f.handleEvents(ctx, watcher)
+			if strict {
+				if !errors.Is(err, syscall.ENOSPC) {
+					t.Errorf("expected the watch error in strict mode, got %v", err)
+				}
+				return
+			}
+			if !errors.Is(err, context.DeadlineExceeded) {
+				t.Errorf("expected the watch error to be logged, got %v", err)
+			}
+		})
+	}
+}
@@ -0,0 +1,140 @@
+package k3s
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/daemon/process"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/kubernetes"
+	"github.com/abiosoft/colima/environment/host"
+	"github.com/sirupsen/logrus"
+)
+
+const Name = "k3s"
+
+// superviseInterval is the interval for checking the k3s API, swapped in tests.
+var superviseInterval = 10 * time.Second
+
+// maxFailures is the number of consecutive failed checks before k3s is restarted.
+const maxFailures = 3
+
+type Args struct {
+	environment.GuestActions
+}
+
+func CtxKeyArgs() any { return struct{ name string }{name: "k3s_args"} }
+
+// New returns the k3s supervisor process.
+// k3s is restarted in the VM when the API is unreachable from within the VM.
+func New() process.Process {
+	return &k3sProcess{
+		host: host.New(),
+		log:  logrus.WithField("context", "k3s"),
+	}
+}
+
+var _ process.Process = (*k3sProcess)(nil)
+
+type k3sProcess struct {
+	host  environment.HostActions
+	guest environment.GuestActions
+
+	log *logrus.Entry
+}
+
+// Alive implements process.Process.
+// The API is checked from within the VM once the process is started, from the host otherwise.
+func (k *k3sProcess) Alive(ctx context.Context) error {
+	if k.guest == nil {
+		if err := k.host.RunQuiet(kubernetes.HostKubectl(k.host, k.config(), "cluster-info")...); err != nil {
+			return fmt.Errorf("k3s api not reachable: %w", err)
+		}
+		return nil
+	}
+	if err := kubernetes.Ready(k.guest, k.config()); err != nil {
+		return fmt.Errorf("k3s api not reachable: %w", err)
+	}
+	return nil
+}
+
+// config returns the kubernetes config persisted in the VM.
+func (k *k3sProcess) config() config.Kubernetes {
+	var conf config.Kubernetes
+	if k.guest == nil {
+		return conf
+	}
+	if b := k.guest.Get(kubernetes.ConfigKey); b != "" {
+		_ = json.Unmarshal([]byte(b), &conf)
+	}
+	return conf
+}
+
+// Dependencies implements process.Process
+func (*k3sProcess) Dependencies() (deps []process.Dependency, root bool) {
+	return nil, false
+}
+
+// Name implements process.Process
+func (*k3sProcess) Name() string {
+	return Name
+}
+
+// Start implements process.Process
+func (k *k3sProcess) Start(ctx context.Context) error {
+	args, ok := ctx.Value(CtxKeyArgs()).(Args)
+	if !ok {
+		return fmt.Errorf("args missing in context")
+	}
+	k.guest = args.GuestActions
+
+	return k.supervise(ctx)
+}
+
+// supervise restarts k3s after consecutive failed API checks until ctx is done.
+// k3s is not restarted if it has been stopped by colima or is being provisioned,
+// supervision starts once the API has been reachable after k3s is started.
+func (k *k3sProcess) supervise(ctx context.Context) error {
+	log := k.log
+	ticker := time.NewTicker(superviseInterval)
+	defer ticker.Stop()
+
+	started := false
+	failures := 0
+	for {
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+			if k.guest.Get(kubernetes.StoppedKey) == "true" {
+				started = false
+				failures = 0
+				continue
+			}
+			err := k.Alive(ctx)
+			if err == nil {
+				started = true
+				failures = 0
+				continue
+			}
+			if !started {
+				continue
+			}
+
+			failures++
+			log.Trace(fmt.Errorf("k3s check %d of %d failed: %w", failures, maxFailures, err))
+			if failures < maxFailures {
+				continue
+			}
+
+			log.Warnln("k3s is not responding, restarting")
+			if err := k.guest.RunQuiet("sudo", "service", "k3s", "restart"); err != nil {
+				log.Error(fmt.Errorf("error restarting k3s: %w", err))
+			}
+			failures = 0
+		}
+	}
+}
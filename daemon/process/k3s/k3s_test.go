@@ -0,0 +1,217 @@
+package k3s
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/kubernetes"
+	"github.com/sirupsen/logrus"
+)
+
+// fakeRunner records commands and fails them while err is set.
+type fakeRunner struct {
+	sync.Mutex
+	commands []string
+	err      error
+}
+
+func (f *fakeRunner) run(args ...string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.commands = append(f.commands, strings.Join(args, " "))
+	return f.err
+}
+
+func (f *fakeRunner) setErr(err error) {
+	f.Lock()
+	defer f.Unlock()
+	f.err = err
+}
+
+func (f *fakeRunner) count(cmd string) (n int) {
+	f.Lock()
+	defer f.Unlock()
+	for _, c := range f.commands {
+		if c == cmd {
+			n++
+		}
+	}
+	return
+}
+
+func (f *fakeRunner) Run(args ...string) error                 { return f.run(args...) }
+func (f *fakeRunner) RunQuiet(args ...string) error            { return f.run(args...) }
+func (f *fakeRunner) RunOutput(args ...string) (string, error) { return "", f.run(args...) }
+func (f *fakeRunner) RunInteractive(args ...string) error      { return f.run(args...) }
+func (f *fakeRunner) RunWith(_ io.Reader, _ io.Writer, args ...string) error {
+	return f.run(args...)
+}
+func (f *fakeRunner) Read(string) (string, error)      { return "", nil }
+func (f *fakeRunner) Write(string, []byte) error       { return nil }
+func (f *fakeRunner) Stat(string) (os.FileInfo, error) { return nil, os.ErrNotExist }
+
+var _ environment.HostActions = (*fakeHost)(nil)
+
+type fakeHost struct{ fakeRunner }
+
+func (f *fakeHost) WithEnv(...string) environment.HostActions { return f }
+func (f *fakeHost) WithDir(string) environment.HostActions    { return f }
+func (f *fakeHost) Env(string) string                         { return "" }
+
+var _ environment.GuestActions = (*fakeGuest)(nil)
+
+type fakeGuest struct {
+	fakeRunner
+	config map[string]string
+}
+
+func (f *fakeGuest) Start(context.Context, config.Config) error { return nil }
+func (f *fakeGuest) Stop(context.Context, bool) error           { return nil }
+func (f *fakeGuest) Restart(context.Context) error              { return nil }
+func (f *fakeGuest) SSH(string, ...string) error                { return nil }
+func (f *fakeGuest) Created() bool                              { return true }
+func (f *fakeGuest) Running(context.Context) bool               { return true }
+func (f *fakeGuest) Env(string) (string, error)                 { return "", nil }
+func (f *fakeGuest) User() (string, error)                      { return "user", nil }
+func (f *fakeGuest) Arch() environment.Arch                     { return environment.X8664 }
+func (f *fakeGuest) Get(key string) string {
+	f.Lock()
+	defer f.Unlock()
+	return f.config[key]
+}
+func (f *fakeGuest) Set(key, value string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.config[key] = value
+	return nil
+}
+
+func newTestProcess(host environment.HostActions, guest environment.GuestActions) *k3sProcess {
+	l := logrus.New()
+	l.SetOutput(io.Discard)
+	return &k3sProcess{host: host, guest: guest, log: l.WithField("context", "k3s")}
+}
+
+const restartCmd = "sudo service k3s restart"
+
+const checkCmd = "kubectl cluster-info"
+
+func Test_k3sProcess_Alive(t *testing.T) {
+	host := &fakeHost{}
+	k := newTestProcess(host, nil)
+
+	// the status is checked from the host without the VM
+	if err := k.Alive(context.Background()); err != nil {
+		t.Errorf("expected k3s to be alive, got %v", err)
+	}
+	want := "kubectl --context " + config.CurrentProfile().ID + " cluster-info"
+	if n := host.count(want); n != 1 {
+		t.Errorf("expected %d runs of %q, got %d", 1, want, n)
+	}
+
+	// the started process checks the API from within the VM
+	guest := &fakeGuest{config: map[string]string{}}
+	k.guest = guest
+	if err := k.Alive(context.Background()); err != nil {
+		t.Errorf("expected k3s to be alive, got %v", err)
+	}
+	guest.setErr(fmt.Errorf("connection refused"))
+	if err := k.Alive(context.Background()); err == nil {
+		t.Error("expected error when the api is unreachable")
+	}
+	if n := guest.count(checkCmd); n != 2 {
+		t.Errorf("expected %d runs of %q, got %d", 2, checkCmd, n)
+	}
+	if n := host.count(want); n != 1 {
+		t.Errorf("unexpected host checks of the started process, got %d", n)
+	}
+}
+
+func Test_k3sProcess_supervise(t *testing.T) {
+	interval := superviseInterval
+	superviseInterval = 5 * time.Millisecond
+	defer func() { superviseInterval = interval }()
+
+	tests := []struct {
+		name string
+		// reachable is if the API is reachable before it fails
+		reachable bool
+		stopped   string
+		restart   bool
+	}{
+		{name: "unreachable", reachable: true, restart: true},
+		{name: "bootstrapping", restart: false},
+		{name: "stopped by colima", reachable: true, stopped: "true", restart: false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &fakeGuest{config: map[string]string{}}
+			if !tt.reachable {
+				guest.setErr(fmt.Errorf("connection refused"))
+			}
+			k := newTestProcess(&fakeHost{}, guest)
+
+			ctx, cancel := context.WithTimeout(context.Background(), superviseInterval*(maxFailures+50))
+			defer cancel()
+			go func() {
+				for guest.count(checkCmd) == 0 {
+					time.Sleep(time.Millisecond)
+				}
+				_ = guest.Set(kubernetes.StoppedKey, tt.stopped)
+				guest.setErr(fmt.Errorf("connection refused"))
+			}()
+			_ = k.supervise(ctx)
+
+			if restarted := guest.count(restartCmd) > 0; restarted != tt.restart {
+				t.Errorf("expected restart %v, got %v", tt.restart, restarted)
+			}
+		})
+	}
+}
+
+func Test_k3sProcess_supervise_provisioning(t *testing.T) {
+	interval := superviseInterval
+	superviseInterval = 5 * time.Millisecond
+	defer func() { superviseInterval = interval }()
+
+	// k3s is not checked while it is provisioned
+	guest := &fakeGuest{fakeRunner: fakeRunner{err: fmt.Errorf("connection refused")}, config: map[string]string{kubernetes.StoppedKey: "true"}}
+	k := newTestProcess(&fakeHost{}, guest)
+
+	ctx, cancel := context.WithTimeout(context.Background(), superviseInterval*(maxFailures+50))
+	defer cancel()
+	_ = k.supervise(ctx)
+
+	if n := guest.count(checkCmd); n != 0 {
+		t.Errorf("expected no checks while provisioned, got %d", n)
+	}
+	if n := guest.count(restartCmd); n != 0 {
+		t.Errorf("expected no restart, got %d", n)
+	}
+}
+
+func Test_k3sProcess_supervise_recovers(t *testing.T) {
+	interval := superviseInterval
+	superviseInterval = 5 * time.Millisecond
+	defer func() { superviseInterval = interval }()
+
+	// the api is reachable, failures never accumulate
+	guest := &fakeGuest{config: map[string]string{}}
+	k := newTestProcess(&fakeHost{}, guest)
+
+	ctx, cancel := context.WithTimeout(context.Background(), superviseInterval*(maxFailures+50))
+	defer cancel()
+	_ = k.supervise(ctx)
+
+	if n := guest.count(restartCmd); n != 0 {
+		t.Errorf("expected no restart, got %d", n)
+	}
+}
@@ -21,6 +21,12 @@ var buildKitConf []byte
 
 const buildKitConfFile = "/etc/buildkit/buildkitd.toml"
 
+// ConfigFile is the containerd config file in the VM.
+const ConfigFile = "/etc/containerd/config.toml"
+
+// DefaultSocket is the default containerd socket in the VM.
+const DefaultSocket = "/run/containerd/containerd.sock"
+
 func newRuntime(host environment.HostActions, guest environment.GuestActions) environment.Container {
 	return &containerdRuntime{
 		host:         host,
@@ -47,7 +53,7 @@ func (c containerdRuntime) Name() string {
 
 func (c containerdRuntime) Provision(context.Context) error {
 	if err := c.guest.RunQuiet("sh", "-c",
-		`sudo sed -i '/disabled_plugins =/c\disabled_plugins = []' /etc/containerd/config.toml`,
+		`sudo sed -i '/disabled_plugins =/c\disabled_plugins = []' `+ConfigFile,
 	); err != nil {
 		return err
 	}
@@ -0,0 +1,90 @@
+package kubernetes
+
+import (
+	"encoding/pem"
+	"fmt"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/util"
+)
+
+// caBundleFile is the CA bundle in the trust store of the guest, must have a .crt extension
+// to be picked up by update-ca-certificates.
+const caBundleFile = "/usr/local/share/ca-certificates/colima.crt"
+
+// caBundle returns the content of the CA bundle at the host path file.
+// An error is returned if it does not contain a PEM encoded certificate.
+func caBundle(host environment.HostActions, file string) (string, error) {
+	location, err := util.CleanPath(file)
+	if err != nil {
+		return "", fmt.Errorf("invalid CA bundle '%s': %w", file, err)
+	}
+	content, err := host.Read(strings.TrimSuffix(location, "/"))
+	if err != nil {
+		return "", fmt.Errorf("error reading CA bundle '%s': %w", file, err)
+	}
+
+	for rest := []byte(content); ; {
+		var block *pem.Block
+		block, rest = pem.Decode(rest)
+		if block == nil {
+			return "", fmt.Errorf("invalid CA bundle '%s': no PEM encoded certificate found", file)
+		}
+		if block.Type == "CERTIFICATE" {
+			break
+		}
+	}
+	return content, nil
+}
+
+// installCABundle adds the configured CA bundle to the trust store of the guest.
+// The container runtime is restarted to trust the CA for image pulls, k3s is started afterwards.
+func installCABundle(
+	host environment.HostActions,
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	containerRuntime string,
+	conf config.Kubernetes,
+) {
+	if conf.CABundle == "" {
+		return
+	}
+
+	// the trust store is system-wide, root is required regardless of rootless k3s
+	root := conf
+	root.Rootless = false
+
+	a.Add(func() error {
+		content, err := caBundle(host, conf.CABundle)
+		if err != nil {
+			return err
+		}
+		if current, err := guest.Read(caBundleFile); err == nil && current == content {
+			return nil
+		}
+
+		if err := guest.Write(caBundleFile, []byte(content)); err != nil {
+			return fmt.Errorf("error writing CA bundle: %w", err)
+		}
+		if err := guest.Run(sudo(root, "update-ca-certificates")...); err != nil {
+			return fmt.Errorf("error updating CA certificates: %w", err)
+		}
+
+		// the embedded containerd of rootless k3s is not running yet
+		if conf.Rootless {
+			return nil
+		}
+		service := "containerd"
+		if containerRuntime == docker.Name {
+			service = "docker"
+		}
+		if err := guest.Run(sudo(root, "service", service, "restart")...); err != nil {
+			return fmt.Errorf("error restarting %s to trust the CA bundle: %w", service, err)
+		}
+		return nil
+	})
+}
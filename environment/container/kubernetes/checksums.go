@@ -0,0 +1,58 @@
+package kubernetes
+
+import (
+	"fmt"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/downloader"
+)
+
+// assets with checksums that can be pinned.
+const (
+	assetK3s           = "k3s"
+	assetAirgapImages  = "airgap-images"
+	assetInstallScript = "install-script"
+	assetHelm          = "helm"
+)
+
+// checksumKey returns the key of the asset in the pinned checksums e.g. k3s/v1.28.3+k3s2/amd64.
+// The arch is omitted for assets that are not specific to an architecture.
+func checksumKey(asset, version, arch string) string {
+	if arch == "" {
+		return asset + "/" + version
+	}
+	return asset + "/" + version + "/" + arch
+}
+
+// assetSHA returns the checksum to verify the download of the asset with.
+//
+// The pinned checksum takes precedence over published, which may be nil for assets
+// without published checksums. The download is refused in strict mode if the
+// checksum of the asset is not pinned.
+func assetSHA(conf config.Kubernetes, key string, published *downloader.SHA) (*downloader.SHA, error) {
+	if sum, ok := conf.Checksums[key]; ok {
+		return &downloader.SHA{Size: 256, Sum: sum}, nil
+	}
+	if conf.StrictChecksums {
+		return nil, fmt.Errorf("checksum for '%s' is not pinned, download refused in strict mode", key)
+	}
+	return published, nil
+}
+
+// validateChecksums validates that the checksums of all assets downloaded for conf
+// in a VM with arch are pinned in strict mode.
+func validateChecksums(conf config.Kubernetes, arch environment.Arch) error {
+	if !conf.StrictChecksums {
+		return nil
+	}
+	for _, d := range DownloadPlan(conf, arch) {
+		if d.Checksum == "" {
+			continue
+		}
+		if _, err := assetSHA(conf, d.Checksum, nil); err != nil {
+			return err
+		}
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_installK3s_checksums(t *testing.T) {
+	arch := environment.X8664.GoArch()
+	pinned := map[string]string{
+		checksumKey(assetK3s, DefaultVersion, arch):          "aaa",
+		checksumKey(assetAirgapImages, DefaultVersion, arch): "bbb",
+		checksumKey(assetInstallScript, DefaultVersion, ""):  "ccc",
+	}
+
+	tests := []struct {
+		name      string
+		conf      config.Kubernetes
+		wantErr   bool
+		wantShaDl bool
+	}{
+		{name: "lenient unlisted", conf: config.Kubernetes{Version: DefaultVersion}, wantShaDl: true},
+		{name: "strict unlisted", conf: config.Kubernetes{Version: DefaultVersion, StrictChecksums: true}, wantErr: true},
+		{name: "strict pinned", conf: config.Kubernetes{Version: DefaultVersion, StrictChecksums: true, Checksums: pinned}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+			host := &fakeHost{}
+			a := newTestChain()
+			installK3s(host, &fakeGuest{}, a, a.Logger(), containerd.Name, tt.conf)
+			err := a.Exec()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("installK3s() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			var downloaded, shaDownloaded bool
+			for _, cmd := range host.commands {
+				if strings.HasPrefix(cmd, "curl") {
+					downloaded = true
+				}
+				if strings.Contains(cmd, k3sShaURL(DefaultVersion, environment.X8664)) {
+					shaDownloaded = true
+				}
+			}
+			if downloaded == tt.wantErr {
+				t.Errorf("downloaded = %v, want %v", downloaded, !tt.wantErr)
+			}
+			if shaDownloaded != tt.wantShaDl {
+				t.Errorf("sha sums downloaded = %v, want %v", shaDownloaded, tt.wantShaDl)
+			}
+		})
+	}
+}
+
+func Test_assetSHA(t *testing.T) {
+	key := checksumKey(assetHelm, "v3.13.1", "arm64")
+	if key != "helm/v3.13.1/arm64" {
+		t.Errorf("checksumKey() = %s", key)
+	}
+
+	conf := config.Kubernetes{StrictChecksums: true, Checksums: map[string]string{key: "sum"}}
+	if sha, err := assetSHA(conf, key, nil); err != nil || sha.Sum != "sum" || sha.URL != "" {
+		t.Errorf("assetSHA() = %+v, %v; want pinned sum", sha, err)
+	}
+	if _, err := assetSHA(conf, checksumKey(assetHelm, "v3.13.2", "arm64"), nil); err == nil {
+		t.Error("expected unlisted asset to be refused in strict mode")
+	}
+}
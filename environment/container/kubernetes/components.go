@@ -0,0 +1,47 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// componentArgNameRegex matches the flag name of a Kubernetes component e.g. node-monitor-grace-period.
+var componentArgNameRegex = regexp.MustCompile(`^[a-z0-9][a-z0-9-]*$`)
+
+// componentFlags returns the k3s flag for the component args in conf, in order.
+func componentFlags(conf config.Kubernetes) []struct {
+	flag string
+	args []string
+} {
+	return []struct {
+		flag string
+		args []string
+	}{
+		{flag: "--kube-controller-manager-arg", args: conf.ControllerManagerArgs},
+		{flag: "--kube-scheduler-arg", args: conf.SchedulerArgs},
+	}
+}
+
+// componentArgs returns the k3s args passing the extra args of the kube-controller-manager
+// and the kube-scheduler in conf. The args are in the form name=value, or name for a boolean flag.
+// An error is returned if any of the args is invalid.
+func componentArgs(conf config.Kubernetes) ([]string, error) {
+	var args []string
+	for _, c := range componentFlags(conf) {
+		if len(c.args) > 0 && isAgent(conf) {
+			return nil, fmt.Errorf("%s is only supported for a k3s server", strings.TrimPrefix(c.flag, "--"))
+		}
+		for _, arg := range c.args {
+			arg = strings.TrimLeft(arg, "-")
+			name, _, _ := strings.Cut(arg, "=")
+			if !componentArgNameRegex.MatchString(name) {
+				return nil, fmt.Errorf("invalid %s '%s', expected name=value", strings.TrimPrefix(c.flag, "--"), arg)
+			}
+			args = append(args, c.flag, arg)
+		}
+	}
+	return args, nil
+}
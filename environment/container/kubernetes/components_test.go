@@ -0,0 +1,85 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/util"
+)
+
+func Test_componentArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name: "controller manager",
+			conf: config.Kubernetes{ControllerManagerArgs: []string{"node-monitor-grace-period=20s", "feature-gates=A=true,B=false"}},
+			want: []string{
+				"--kube-controller-manager-arg", "node-monitor-grace-period=20s",
+				"--kube-controller-manager-arg", "feature-gates=A=true,B=false",
+			},
+		},
+		{
+			name: "scheduler",
+			conf: config.Kubernetes{SchedulerArgs: []string{"v=2", "--profiling"}},
+			want: []string{"--kube-scheduler-arg", "v=2", "--kube-scheduler-arg", "profiling"},
+		},
+		{
+			name: "both",
+			conf: config.Kubernetes{ControllerManagerArgs: []string{"terminated-pod-gc-threshold=10"}, SchedulerArgs: []string{"v=4"}},
+			want: []string{
+				"--kube-controller-manager-arg", "terminated-pod-gc-threshold=10",
+				"--kube-scheduler-arg", "v=4",
+			},
+		},
+		{name: "empty name", conf: config.Kubernetes{SchedulerArgs: []string{"=2"}}, wantErr: true},
+		{name: "invalid name", conf: config.Kubernetes{ControllerManagerArgs: []string{"node monitor=20s"}}, wantErr: true},
+		{
+			name: "single quote",
+			conf: config.Kubernetes{SchedulerArgs: []string{"config='x'"}},
+			want: []string{"--kube-scheduler-arg", "config='x'"},
+		},
+		{name: "agent", conf: config.Kubernetes{Role: "agent", Server: "https://10.0.0.2:6443", Token: "t", SchedulerArgs: []string{"v=2"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := componentArgs(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("componentArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("componentArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_installK3s_componentArgs(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{
+		Version:               DefaultVersion,
+		ControllerManagerArgs: []string{"node-monitor-grace-period=20s"},
+		SchedulerArgs:         []string{"v=2", "config='x'"},
+	}
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true",
+		"'--kube-controller-manager-arg' 'node-monitor-grace-period=20s'",
+		"'--kube-scheduler-arg' 'v=2'",
+		"'--kube-scheduler-arg' "+util.ShellQuote("config='x'"),
+	); !ok {
+		t.Errorf("component args not found in %+v", guest.commands)
+	}
+}
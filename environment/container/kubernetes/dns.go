@@ -0,0 +1,116 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/embedded"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util"
+)
+
+// corednsCustomFile is the auto-deployed manifest of the coredns-custom ConfigMap,
+// relative to the k3s data directory. The server blocks of the ConfigMap are imported
+// by the CoreDNS packaged with k3s.
+// https://docs.k3s.io/installation/packaged-components#coredns
+const corednsCustomFile = ingressManifestsDir + "/colima-coredns-custom.yaml"
+
+// maxDNSUpstreams is the maximum number of upstreams supported by the CoreDNS forward plugin.
+const maxDNSUpstreams = 15
+
+func validateDNSUpstreams(conf config.Kubernetes) error {
+	if len(conf.DNSUpstreams) == 0 {
+		return nil
+	}
+	// CoreDNS runs on the server
+	if isAgent(conf) {
+		return fmt.Errorf("dns upstreams are only supported for a k3s server")
+	}
+	if len(conf.DNSUpstreams) > maxDNSUpstreams {
+		return fmt.Errorf("too many DNS upstreams, a maximum of %d is supported", maxDNSUpstreams)
+	}
+	for _, upstream := range conf.DNSUpstreams {
+		if net.ParseIP(upstream) == nil {
+			return fmt.Errorf("invalid DNS upstream '%s': must be an IP address", upstream)
+		}
+	}
+	return nil
+}
+
+// corednsCustomYAML renders the coredns-custom ConfigMap forwarding to the DNS upstreams of conf.
+func corednsCustomYAML(conf config.Kubernetes) ([]byte, error) {
+	if err := validateDNSUpstreams(conf); err != nil {
+		return nil, err
+	}
+	tpl, err := embedded.ReadString("k3s/coredns-custom.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("error reading embedded coredns-custom manifest: %w", err)
+	}
+	values := struct{ Upstreams string }{Upstreams: strings.Join(conf.DNSUpstreams, " ")}
+	return util.ParseTemplate(tpl, values)
+}
+
+// corednsCustomManifestFile returns the path to the coredns-custom manifest in the guest for conf.
+func corednsCustomManifestFile(guest environment.GuestActions, conf config.Kubernetes) string {
+	return dataDir(guest, conf) + corednsCustomFile
+}
+
+// defaultDNSCheckImage is the image of the pod resolving the cluster DNS, overridable for airgap.
+const defaultDNSCheckImage = "busybox:1.36"
+
+// dnsCheckPod is the name of the throwaway pod resolving the cluster DNS.
+const dnsCheckPod = "colima-dns-check"
+
+// dnsCheckInterval is the interval between attempts of the DNS check, swapped in tests.
+var dnsCheckInterval = 5 * time.Second
+
+// dnsCheckRetries is the number of attempts of the DNS check, as CoreDNS may not be ready yet.
+const dnsCheckRetries = 12
+
+// verifyDNS verifies that the cluster DNS resolves kubernetes.default from a throwaway pod.
+// A failure is only reported, it does not fail the startup.
+func verifyDNS(guest environment.GuestActions, a *cli.ActiveCommandChain, conf config.Kubernetes) {
+	// the agent has no api server
+	if !conf.VerifyDNS || isAgent(conf) {
+		return
+	}
+
+	image := conf.DNSCheckImage
+	if image == "" {
+		image = defaultDNSCheckImage
+	}
+
+	log := a.Logger()
+	a.Stage("verifying cluster dns")
+	a.Add(func() (err error) {
+		for i := 0; i < dnsCheckRetries; i++ {
+			if i > 0 {
+				time.Sleep(dnsCheckInterval)
+			}
+			// a pod left behind by a previous attempt would fail the run
+			_ = guest.RunQuiet(guestKubectl(guest, conf, "delete", "pod", dnsCheckPod, "--ignore-not-found")...)
+			err = guest.RunQuiet(guestKubectl(guest, conf,
+				"run", dnsCheckPod, "--rm", "-i", "--restart=Never", "--image="+image,
+				"--command", "--", "nslookup", "kubernetes.default",
+			)...)
+			if err == nil {
+				return nil
+			}
+		}
+		log.Warnln(fmt.Errorf("cluster dns is not resolving kubernetes.default: %w", err))
+		log.Warnln("pods may be unable to resolve services, check the coredns pods in the kube-system namespace")
+		return nil
+	})
+}
+
+// guestKubectl returns the kubectl command with args in the guest for conf.
+func guestKubectl(guest environment.GuestActions, conf config.Kubernetes, args ...string) []string {
+	if conf.Rootless {
+		return append([]string{userHome(guest) + rootlessBinDir + "/k3s", "kubectl", "--kubeconfig", kubeconfigFile(guest, conf)}, args...)
+	}
+	return append([]string{"kubectl"}, args...)
+}
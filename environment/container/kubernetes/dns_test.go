@@ -0,0 +1,128 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_corednsCustomYAML(t *testing.T) {
+	tests := []struct {
+		name      string
+		conf      config.Kubernetes
+		upstreams string
+		wantErr   bool
+	}{
+		{name: "single", conf: config.Kubernetes{DNSUpstreams: []string{"10.0.0.53"}}, upstreams: "10.0.0.53"},
+		{name: "multiple", conf: config.Kubernetes{DNSUpstreams: []string{"10.0.0.53", "fd00::53"}}, upstreams: "10.0.0.53 fd00::53"},
+		{name: "invalid", conf: config.Kubernetes{DNSUpstreams: []string{"dns.internal"}}, wantErr: true},
+		{name: "too many", conf: config.Kubernetes{DNSUpstreams: strings.Split(strings.Repeat("10.0.0.1,", maxDNSUpstreams)+"10.0.0.2", ",")}, wantErr: true},
+		{name: "agent", conf: config.Kubernetes{Role: roleAgent, DNSUpstreams: []string{"10.0.0.53"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := corednsCustomYAML(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("corednsCustomYAML() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			var cm struct {
+				Kind     string `yaml:"kind"`
+				Metadata struct {
+					Name      string `yaml:"name"`
+					Namespace string `yaml:"namespace"`
+				} `yaml:"metadata"`
+				Data map[string]string `yaml:"data"`
+			}
+			if err := yaml.Unmarshal(b, &cm); err != nil {
+				t.Fatalf("invalid manifest: %v\n%s", err, b)
+			}
+			if cm.Kind != "ConfigMap" || cm.Metadata.Name != "coredns-custom" || cm.Metadata.Namespace != "kube-system" {
+				t.Errorf("unexpected ConfigMap %+v", cm)
+			}
+			block := cm.Data["colima-upstreams.server"]
+			if want := "forward . " + tt.upstreams + "\n"; !strings.Contains(block, want) {
+				t.Errorf("server block %q does not contain %q", block, want)
+			}
+		})
+	}
+}
+
+func Test_installK3sCluster_dnsUpstreams(t *testing.T) {
+	conf := config.Kubernetes{DNSUpstreams: []string{"10.0.0.53"}}
+
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3sCluster(&fakeHost{}, guest, a, nil, containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	file := defaultDataDir + corednsCustomFile
+	if got := guest.files[file]; !strings.Contains(got, "forward . 10.0.0.53\n") {
+		t.Errorf("coredns-custom manifest %s = %q, want the upstream forwarded", file, got)
+	}
+	// the node resolvers are unchanged
+	if _, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true", "--resolv-conf"); ok {
+		t.Errorf("unexpected resolv.conf in %+v", guest.commands)
+	}
+}
+
+func Test_verifyDNS(t *testing.T) {
+	interval := dnsCheckInterval
+	dnsCheckInterval = time.Millisecond
+	defer func() { dnsCheckInterval = interval }()
+
+	const run = "kubectl run " + dnsCheckPod
+
+	tests := []struct {
+		name      string
+		conf      config.Kubernetes
+		errs      map[string]error
+		wantImage string
+		wantRuns  int
+	}{
+		{name: "disabled", conf: config.Kubernetes{}},
+		{name: "default image", conf: config.Kubernetes{VerifyDNS: true}, wantImage: defaultDNSCheckImage, wantRuns: 1},
+		{name: "airgap image", conf: config.Kubernetes{VerifyDNS: true, DNSCheckImage: "registry.internal/busybox:1.36"}, wantImage: "registry.internal/busybox:1.36", wantRuns: 1},
+		{
+			name:      "broken dns",
+			conf:      config.Kubernetes{VerifyDNS: true},
+			errs:      map[string]error{run: fmt.Errorf("server can't find kubernetes.default")},
+			wantImage: defaultDNSCheckImage,
+			wantRuns:  dnsCheckRetries,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &fakeGuest{errs: tt.errs}
+			a := newTestChain()
+			verifyDNS(guest, a, tt.conf)
+			// a broken dns is reported without failing
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			runs := 0
+			for _, cmd := range guest.commands {
+				if strings.HasPrefix(cmd, run) {
+					runs++
+					if !strings.Contains(cmd, "--image="+tt.wantImage) || !strings.HasSuffix(cmd, "nslookup kubernetes.default") {
+						t.Errorf("unexpected dns check command: %s", cmd)
+					}
+				}
+			}
+			if runs != tt.wantRuns {
+				t.Errorf("expected %d dns checks, got %d: %+v", tt.wantRuns, runs, guest.commands)
+			}
+		})
+	}
+}
@@ -0,0 +1,104 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/downloader"
+)
+
+// downloadGroup is a group of independent downloads that are run concurrently,
+// bounded by limit, ahead of the install steps that depend on them.
+type downloadGroup struct {
+	limit int
+	funcs []func() error
+	// kept are the downloaded files persisted in the guest cache after the install.
+	kept []string
+}
+
+// keep adds filename to the files persisted in the guest cache by saveGuestCache.
+// It is a no-op if the group is nil.
+func (d *downloadGroup) keep(filename string) {
+	if d == nil {
+		return
+	}
+	d.kept = append(d.kept, filename)
+}
+
+// add adds the download f to the group.
+// f is added to the command chain instead if the group is nil.
+func (d *downloadGroup) add(a *cli.ActiveCommandChain, f func() error) {
+	if d == nil {
+		a.Add(f)
+		return
+	}
+	d.funcs = append(d.funcs, f)
+}
+
+// run runs all downloads in the group and returns the errors.
+func (d *downloadGroup) run() error {
+	limit := d.limit
+	if limit < 1 {
+		limit = 1
+	}
+
+	sem := make(chan struct{}, limit)
+	errs := make([]error, len(d.funcs))
+
+	var wg sync.WaitGroup
+	for i, f := range d.funcs {
+		wg.Add(1)
+		sem <- struct{}{}
+		go func(i int, f func() error) {
+			defer func() { <-sem; wg.Done() }()
+			errs[i] = f()
+		}(i, f)
+	}
+	wg.Wait()
+
+	return errors.Join(errs...)
+}
+
+// downloadRetryInterval is the default interval between the attempts of a failed download.
+var downloadRetryInterval = 2 * time.Second
+
+// maxDownloadRetries is the maximum number of retries of a failed download.
+const maxDownloadRetries = 10
+
+// downloadAsset downloads the k3s asset with r, retried as configured in conf after a failure.
+// The downloads run concurrently in a downloadGroup, the attempts are retried in place.
+func downloadAsset(
+	a *cli.ActiveCommandChain,
+	host environment.HostActions,
+	guest environment.GuestActions,
+	conf config.Kubernetes,
+	asset string,
+	r downloader.Request,
+) (err error) {
+	interval := downloadRetryInterval
+	if conf.DownloadRetryInterval > 0 {
+		interval = time.Duration(conf.DownloadRetryInterval) * time.Second
+	}
+
+	// OCI artifacts are pulled with the credentials of the images
+	if strings.HasPrefix(r.URL, "oci://") {
+		r.Registries = registryCredentials(guest, conf)
+	}
+
+	for i := 0; i <= conf.DownloadRetries; i++ {
+		if i > 0 {
+			a.Logger().Warnln(fmt.Errorf("error downloading %s, retrying in %v: %w", asset, interval, err))
+			time.Sleep(interval)
+		}
+		if err = downloader.Download(host, guest, r); err == nil {
+			return nil
+		}
+	}
+	return downloadErr(asset, err)
+}
@@ -0,0 +1,222 @@
+package kubernetes
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_installK3s_concurrentDownloads(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	// the k3s binary, airgap images and install script
+	const downloads = 3
+
+	tests := []struct {
+		name       string
+		limit      int
+		concurrent int
+	}{
+		{name: "sequential", concurrent: 1},
+		{name: "bounded", limit: 2, concurrent: 2},
+		{name: "concurrent", limit: downloads, concurrent: downloads},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var active, concurrent int
+			host := &fakeHost{}
+			host.onTransfer = func() {
+				mu.Lock()
+				active++
+				if active > concurrent {
+					concurrent = active
+				}
+				mu.Unlock()
+
+				// hold the transfer to allow the others to start
+				time.Sleep(time.Millisecond * 50)
+
+				mu.Lock()
+				active--
+				mu.Unlock()
+			}
+
+			conf := config.Kubernetes{Version: DefaultVersion, ConcurrentDownloads: tt.limit}
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3s(host, guest, a, a.Logger(), containerd.Name, conf)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			if concurrent != tt.concurrent {
+				t.Errorf("concurrent downloads = %d, want %d", concurrent, tt.concurrent)
+			}
+			// install steps must run after the downloads
+			if _, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true"); !ok {
+				t.Errorf("install command not found in %+v", guest.commands)
+			}
+		})
+	}
+}
+
+func Test_installK3s_downloadBufferSize(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{Version: DefaultVersion, DownloadBufferSize: 1024}
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the k3s binary, airgap images and install script
+	var copies int
+	for _, cmd := range guest.commands {
+		if strings.HasPrefix(cmd, "dd if=") && strings.HasSuffix(cmd, " bs=1048576 status=none") {
+			copies++
+		}
+	}
+	if copies != 3 {
+		t.Errorf("expected 3 copies with the configured buffer size, got %d in %+v", copies, guest.commands)
+	}
+}
+
+func Test_installImageTars_concurrentImports(t *testing.T) {
+	tars := []string{"/Users/user/images/a.tar", "/Users/user/images/b.tar", "/Users/user/images/c.tar", "/Users/user/images/d.tar"}
+
+	tests := []struct {
+		name       string
+		limit      int
+		concurrent int
+	}{
+		{name: "sequential", concurrent: 1},
+		{name: "bounded", limit: 2, concurrent: 2},
+		{name: "concurrent", limit: len(tars), concurrent: len(tars)},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var mu sync.Mutex
+			var active, concurrent int
+			guest := &fakeGuest{}
+			guest.onRun = func(cmd string) {
+				if !strings.Contains(cmd, "nerdctl -n k8s.io load") {
+					return
+				}
+				mu.Lock()
+				active++
+				if active > concurrent {
+					concurrent = active
+				}
+				mu.Unlock()
+
+				// hold the import to allow the others to start
+				time.Sleep(time.Millisecond * 50)
+
+				mu.Lock()
+				active--
+				mu.Unlock()
+			}
+
+			conf := config.Kubernetes{ImageTars: tars, ImageImports: tt.limit}
+			a := newTestChain()
+			installImageTars(&fakeHost{}, guest, a, nil, a.Logger(), containerd.Name, conf)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			if concurrent != tt.concurrent {
+				t.Errorf("concurrent imports = %d, want %d", concurrent, tt.concurrent)
+			}
+			for _, tar := range tars {
+				if _, ok := guest.hasCommand("nerdctl -n k8s.io load -i /tmp/" + filepath.Base(tar)); !ok {
+					t.Errorf("image tar %s not imported: %+v", tar, guest.commands)
+				}
+			}
+		})
+	}
+}
+
+func Test_installImageTars_importErrors(t *testing.T) {
+	tars := []string{"/Users/user/images/a.tar", "/Users/user/images/b.tar", "/Users/user/images/c.tar"}
+	guest := &fakeGuest{errs: map[string]error{
+		"sudo cp /tmp/a.tar": fmt.Errorf("no space left on device"),
+		"sudo cp /tmp/c.tar": fmt.Errorf("no space left on device"),
+	}}
+
+	conf := config.Kubernetes{ImageTars: tars, ImageImports: 2}
+	a := newTestChain()
+	installImageTars(&fakeHost{}, guest, a, nil, a.Logger(), containerd.Name, conf)
+	err := a.Exec()
+	if err == nil {
+		t.Fatal("expected import error")
+	}
+	for _, tar := range []string{tars[0], tars[2]} {
+		if !strings.Contains(err.Error(), tar) {
+			t.Errorf("expected error for %s in %v", tar, err)
+		}
+	}
+	if _, ok := guest.hasCommand("nerdctl -n k8s.io load -i /tmp/b.tar"); !ok {
+		t.Errorf("expected b.tar to be imported: %+v", guest.commands)
+	}
+}
+
+func Test_installK3s_downloadRetries(t *testing.T) {
+	interval := downloadRetryInterval
+	downloadRetryInterval = time.Millisecond
+	defer func() { downloadRetryInterval = interval }()
+
+	tests := []struct {
+		name     string
+		retries  int
+		failures int
+		wantErr  bool
+	}{
+		{name: "no retries", failures: 1, wantErr: true},
+		{name: "transient failure", retries: 2, failures: 2},
+		{name: "persistent failure", retries: 1, failures: 2, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+			host := &fakeHost{failures: tt.failures}
+			conf := config.Kubernetes{Version: DefaultVersion, DownloadRetries: tt.retries}
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3s(host, guest, a, a.Logger(), containerd.Name, conf)
+			err := a.Exec()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				if !strings.Contains(err.Error(), "connection reset by peer") {
+					t.Errorf("expected the download error, got %v", err)
+				}
+				return
+			}
+
+			// the k3s binary is downloaded first, failed and retried
+			var attempts int
+			for _, cmd := range host.commands {
+				if strings.HasPrefix(cmd, "curl") && strings.HasSuffix(cmd, k3sBinaryURL(DefaultVersion, guest.Arch())) {
+					attempts++
+				}
+			}
+			if attempts < tt.failures+1 {
+				t.Errorf("expected at least %d requests for the k3s binary, got %d: %+v", tt.failures+1, attempts, host.commands)
+			}
+			if _, ok := guest.hasCommand("install /tmp/k3s /usr/local/bin/k3s"); !ok {
+				t.Errorf("k3s binary not installed after the retries: %+v", guest.commands)
+			}
+		})
+	}
+}
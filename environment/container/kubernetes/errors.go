@@ -0,0 +1,47 @@
+package kubernetes
+
+import "fmt"
+
+// ErrDownload is the error for a failed download of a k3s asset.
+type ErrDownload struct {
+	Asset string
+	Err   error
+}
+
+func (e ErrDownload) Error() string { return fmt.Sprintf("error downloading %s: %v", e.Asset, e.Err) }
+func (e ErrDownload) Unwrap() error { return e.Err }
+
+// ErrInstall is the error for a failed installation of a downloaded k3s asset.
+type ErrInstall struct {
+	Asset string
+	Err   error
+}
+
+func (e ErrInstall) Error() string { return fmt.Sprintf("error installing %s: %v", e.Asset, e.Err) }
+func (e ErrInstall) Unwrap() error { return e.Err }
+
+// ErrClusterBootstrap is the error for a failed bootstrap of the k3s cluster.
+type ErrClusterBootstrap struct {
+	Err error
+}
+
+func (e ErrClusterBootstrap) Error() string {
+	return fmt.Sprintf("error bootstrapping cluster: %v", e.Err)
+}
+func (e ErrClusterBootstrap) Unwrap() error { return e.Err }
+
+// downloadErr wraps err as ErrDownload for asset. nil is returned if err is nil.
+func downloadErr(asset string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return ErrDownload{Asset: asset, Err: err}
+}
+
+// installErr wraps err as ErrInstall for asset. nil is returned if err is nil.
+func installErr(asset string, err error) error {
+	if err == nil {
+		return nil
+	}
+	return ErrInstall{Asset: asset, Err: err}
+}
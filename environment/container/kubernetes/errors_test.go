@@ -0,0 +1,55 @@
+package kubernetes
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_installK3s_errors(t *testing.T) {
+	errFailed := fmt.Errorf("failed")
+	conf := config.Kubernetes{Version: DefaultVersion, KeepAssets: true}
+
+	tests := []struct {
+		name   string
+		errs   map[string]error
+		target any
+	}{
+		{
+			name:   "download",
+			errs:   map[string]error{"cp " + guestCacheFile(conf, "/tmp/k3s"): errFailed, "cp ": errFailed},
+			target: &ErrDownload{},
+		},
+		{
+			name:   "install",
+			errs:   map[string]error{"sudo install /tmp/k3s ": errFailed},
+			target: &ErrInstall{},
+		},
+		{
+			name:   "cluster bootstrap",
+			errs:   map[string]error{"sh -c INSTALL_K3S_SKIP_DOWNLOAD=true": errFailed},
+			target: &ErrClusterBootstrap{},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+			a := newTestChain()
+			installK3s(&fakeHost{}, &fakeGuest{errs: tt.errs}, a, a.Logger(), containerd.Name, conf)
+			err := a.Exec()
+			if err == nil {
+				t.Fatal("expected error")
+			}
+			if !errors.As(err, tt.target) {
+				t.Errorf("error %v is not %T", err, tt.target)
+			}
+			if !errors.Is(err, errFailed) {
+				t.Errorf("error %v does not wrap the cause", err)
+			}
+		})
+	}
+}
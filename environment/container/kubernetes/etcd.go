@@ -0,0 +1,56 @@
+package kubernetes
+
+import (
+	"fmt"
+	"path/filepath"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// embeddedEtcd returns if k3s uses the embedded etcd datastore for conf.
+// A server uses the embedded etcd when initialising a cluster or joining an existing server,
+// sqlite is used otherwise.
+func embeddedEtcd(conf config.Kubernetes) bool {
+	if isAgent(conf) || conf.DatastoreEndpoint != "" {
+		return false
+	}
+	return conf.Server != "" || hasK3sArg(conf, "--cluster-init")
+}
+
+func validateEtcdSnapshots(s config.EtcdSnapshots) error {
+	if s.Schedule != "" {
+		if fields := strings.Fields(s.Schedule); len(fields) != 5 || strings.Contains(s.Schedule, "'") {
+			return fmt.Errorf("invalid etcd snapshot schedule '%s', expected a cron expression e.g. '0 */12 * * *'", s.Schedule)
+		}
+	}
+	if s.Retention < 0 {
+		return fmt.Errorf("invalid etcd snapshot retention %d, must not be negative", s.Retention)
+	}
+	if s.Dir != "" && !filepath.IsAbs(s.Dir) {
+		return fmt.Errorf("invalid etcd snapshot dir '%s', must be an absolute path", s.Dir)
+	}
+	return nil
+}
+
+// etcdSnapshotArgs returns the k3s args for the etcd snapshots of conf.
+// The snapshots only apply to the embedded etcd and are ignored otherwise.
+func etcdSnapshotArgs(conf config.Kubernetes) []string {
+	if !embeddedEtcd(conf) {
+		return nil
+	}
+
+	var args []string
+	s := conf.EtcdSnapshots
+	if s.Schedule != "" {
+		args = append(args, "--etcd-snapshot-schedule-cron", s.Schedule)
+	}
+	if s.Retention > 0 {
+		args = append(args, "--etcd-snapshot-retention", strconv.Itoa(s.Retention))
+	}
+	if s.Dir != "" {
+		args = append(args, "--etcd-snapshot-dir", s.Dir)
+	}
+	return args
+}
@@ -0,0 +1,76 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_installK3s_etcdSnapshots(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	snapshots := config.EtcdSnapshots{Schedule: "0 */6 * * *", Retention: 10, Dir: "/Users/user/k3s-snapshots"}
+	flags := []string{
+		quoted("--etcd-snapshot-schedule-cron", "0 */6 * * *"),
+		quoted("--etcd-snapshot-retention", "10"),
+		quoted("--etcd-snapshot-dir", "/Users/user/k3s-snapshots"),
+	}
+
+	tests := []struct {
+		name     string
+		conf     config.Kubernetes
+		wantArgs bool
+	}{
+		{name: "cluster init", conf: config.Kubernetes{K3sArgs: []string{"--cluster-init"}}, wantArgs: true},
+		{name: "join server", conf: config.Kubernetes{Server: "https://192.168.106.2:6443", Token: "secret"}, wantArgs: true},
+		{name: "sqlite", conf: config.Kubernetes{}},
+		{name: "external datastore", conf: config.Kubernetes{DatastoreEndpoint: "postgres://user:pass@db:5432/k3s"}},
+		{name: "agent", conf: config.Kubernetes{Role: roleAgent, Server: "https://192.168.106.2:6443", Token: "secret"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.Version = DefaultVersion
+			conf.EtcdSnapshots = snapshots
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			install, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true")
+			if !ok {
+				t.Fatalf("install command not found in %+v", guest.commands)
+			}
+			for _, flag := range flags {
+				if emitted := strings.Contains(install, flag); emitted != tt.wantArgs {
+					t.Errorf("%s emitted = %v, want %v: %s", flag, emitted, tt.wantArgs, install)
+				}
+			}
+		})
+	}
+}
+
+func Test_validateEtcdSnapshots(t *testing.T) {
+	tests := []struct {
+		name      string
+		snapshots config.EtcdSnapshots
+		wantErr   bool
+	}{
+		{name: "empty"},
+		{name: "valid", snapshots: config.EtcdSnapshots{Schedule: "0 */12 * * *", Retention: 5, Dir: "/data/snapshots"}},
+		{name: "invalid schedule", snapshots: config.EtcdSnapshots{Schedule: "every hour"}, wantErr: true},
+		{name: "negative retention", snapshots: config.EtcdSnapshots{Retention: -1}, wantErr: true},
+		{name: "relative dir", snapshots: config.EtcdSnapshots{Dir: "snapshots"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateEtcdSnapshots(tt.snapshots); (err != nil) != tt.wantErr {
+				t.Errorf("validateEtcdSnapshots() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
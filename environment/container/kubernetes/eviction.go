@@ -0,0 +1,98 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// evictionSignals are the eviction signals supported by the kubelet.
+// https://kubernetes.io/docs/concepts/scheduling-eviction/node-pressure-eviction/#eviction-signals
+var evictionSignals = map[string]struct{}{
+	"memory.available":       {},
+	"nodefs.available":       {},
+	"nodefs.inodesFree":      {},
+	"imagefs.available":      {},
+	"imagefs.inodesFree":     {},
+	"containerfs.available":  {},
+	"containerfs.inodesFree": {},
+	"pid.available":          {},
+}
+
+// evictionThresholdRegex matches a quantity e.g. 100Mi or a percentage e.g. 10%.
+var evictionThresholdRegex = regexp.MustCompile(`^([0-9]+(\.[0-9]+)?(Ki|Mi|Gi|Ti|Pi|Ei|k|M|G|T|P|E)?|[0-9]+(\.[0-9]+)?%)$`)
+
+// evictionThresholds returns the kubelet flag value for the thresholds
+// e.g. memory.available<100Mi,nodefs.available<10%.
+func evictionThresholds(thresholds map[string]string) (string, error) {
+	var values []string
+	for _, signal := range sortedKeys(thresholds) {
+		if _, ok := evictionSignals[signal]; !ok {
+			return "", fmt.Errorf("invalid eviction signal '%s'", signal)
+		}
+		threshold := thresholds[signal]
+		if !evictionThresholdRegex.MatchString(threshold) {
+			return "", fmt.Errorf("invalid eviction threshold '%s' for '%s': must be a quantity e.g. 100Mi or a percentage e.g. 10%%", threshold, signal)
+		}
+		values = append(values, signal+"<"+threshold)
+	}
+	return strings.Join(values, ","), nil
+}
+
+// evictionArgs returns the k3s args for the kubelet eviction thresholds.
+// An error is returned if any of the thresholds is invalid.
+func evictionArgs(e config.KubeletEviction) ([]string, error) {
+	for signal := range e.Soft {
+		if _, ok := e.SoftGracePeriod[signal]; !ok {
+			return nil, fmt.Errorf("grace period is required for soft eviction threshold '%s'", signal)
+		}
+	}
+
+	var args []string
+	kubeletArg := func(name, value string) {
+		args = append(args, "--kubelet-arg", name+"="+value)
+	}
+
+	if hard, err := evictionThresholds(e.Hard); err != nil {
+		return nil, err
+	} else if hard != "" {
+		kubeletArg("eviction-hard", hard)
+	}
+
+	if soft, err := evictionThresholds(e.Soft); err != nil {
+		return nil, err
+	} else if soft != "" {
+		kubeletArg("eviction-soft", soft)
+	}
+
+	var periods []string
+	for _, signal := range sortedKeys(e.SoftGracePeriod) {
+		if _, ok := e.Soft[signal]; !ok {
+			return nil, fmt.Errorf("grace period for '%s' without a soft eviction threshold", signal)
+		}
+		period := e.SoftGracePeriod[signal]
+		if _, err := time.ParseDuration(period); err != nil {
+			return nil, fmt.Errorf("invalid grace period '%s' for '%s': %w", period, signal, err)
+		}
+		periods = append(periods, signal+"="+period)
+	}
+	if len(periods) > 0 {
+		kubeletArg("eviction-soft-grace-period", strings.Join(periods, ","))
+	}
+
+	return args, nil
+}
+
+func sortedKeys[V any](m map[string]V) []string {
+	keys := make([]string, 0, len(m))
+	for key := range m {
+		keys = append(keys, key)
+	}
+	// sort for a predictable order of args
+	sort.Strings(keys)
+	return keys
+}
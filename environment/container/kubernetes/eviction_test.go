@@ -0,0 +1,97 @@
+package kubernetes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_evictionArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		e       config.KubeletEviction
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name: "hard",
+			e:    config.KubeletEviction{Hard: map[string]string{"nodefs.available": "5%", "memory.available": "100Mi"}},
+			want: []string{"--kubelet-arg", "eviction-hard=memory.available<100Mi,nodefs.available<5%"},
+		},
+		{
+			name: "soft",
+			e: config.KubeletEviction{
+				Soft:            map[string]string{"memory.available": "300Mi"},
+				SoftGracePeriod: map[string]string{"memory.available": "1m30s"},
+			},
+			want: []string{
+				"--kubelet-arg", "eviction-soft=memory.available<300Mi",
+				"--kubelet-arg", "eviction-soft-grace-period=memory.available=1m30s",
+			},
+		},
+		{name: "invalid signal", e: config.KubeletEviction{Hard: map[string]string{"memory.free": "100Mi"}}, wantErr: true},
+		{name: "invalid quantity", e: config.KubeletEviction{Hard: map[string]string{"memory.available": "100MB"}}, wantErr: true},
+		{name: "invalid percentage", e: config.KubeletEviction{Hard: map[string]string{"memory.available": "%10"}}, wantErr: true},
+		{name: "soft without grace period", e: config.KubeletEviction{Soft: map[string]string{"memory.available": "300Mi"}}, wantErr: true},
+		{name: "grace period without soft", e: config.KubeletEviction{SoftGracePeriod: map[string]string{"memory.available": "1m"}}, wantErr: true},
+		{
+			name: "invalid grace period",
+			e: config.KubeletEviction{
+				Soft:            map[string]string{"memory.available": "300Mi"},
+				SoftGracePeriod: map[string]string{"memory.available": "90"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := evictionArgs(tt.e)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("evictionArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("evictionArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_installK3s_eviction(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	conf := config.Kubernetes{
+		Version:  DefaultVersion,
+		Eviction: config.KubeletEviction{Hard: map[string]string{"memory.available": "100Mi"}},
+	}
+
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	install, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true")
+	if !ok {
+		t.Fatalf("install command not found in %+v", guest.commands)
+	}
+	if want := quoted("--kubelet-arg", "eviction-hard=memory.available<100Mi"); !strings.Contains(install, want) {
+		t.Errorf("install command %s does not contain %s", install, want)
+	}
+}
+
+func TestK3sArgs_eviction(t *testing.T) {
+	conf := config.Kubernetes{Eviction: config.KubeletEviction{Hard: map[string]string{"memory.available": "100Mi"}}}
+	args, err := K3sArgs(conf, containerd.Name, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// the rendered args are not quoted for the shell
+	if want := "eviction-hard=memory.available<100Mi"; !strings.Contains(strings.Join(args, " "), " "+want+" ") {
+		t.Errorf("%s not found in %v", want, args)
+	}
+}
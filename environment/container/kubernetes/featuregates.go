@@ -0,0 +1,150 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// featureGateRegex matches the name of a Kubernetes feature gate e.g. InPlacePodVerticalScaling.
+var featureGateRegex = regexp.MustCompile(`^[A-Z][A-Za-z0-9]*$`)
+
+// knownFeatureGates are the alpha and beta feature gates of the Kubernetes versions supported by k3s.
+// Gates not in the list are passed through with a warning, the list may lag behind new releases.
+// https://kubernetes.io/docs/reference/command-line-tools-reference/feature-gates/
+var knownFeatureGates = map[string]struct{}{
+	"APIListChunking":                                {},
+	"APIPriorityAndFairness":                         {},
+	"APIResponseCompression":                         {},
+	"AdmissionWebhookMatchConditions":                {},
+	"AggregatedDiscoveryEndpoint":                    {},
+	"AllAlpha":                                       {},
+	"AllBeta":                                        {},
+	"AnyVolumeDataSource":                            {},
+	"CPUManagerPolicyAlphaOptions":                   {},
+	"CPUManagerPolicyBetaOptions":                    {},
+	"CRDValidationRatcheting":                        {},
+	"CloudDualStackNodeIPs":                          {},
+	"ConsistentListFromCache":                        {},
+	"ContainerCheckpoint":                            {},
+	"CronJobsScheduledAnnotation":                    {},
+	"DevicePluginCDIDevices":                         {},
+	"DisableCloudProviders":                          {},
+	"DynamicResourceAllocation":                      {},
+	"GracefulNodeShutdown":                           {},
+	"GracefulNodeShutdownBasedOnPodPriority":         {},
+	"HPAContainerMetrics":                            {},
+	"InPlacePodVerticalScaling":                      {},
+	"JobBackoffLimitPerIndex":                        {},
+	"JobPodFailurePolicy":                            {},
+	"JobPodReplacementPolicy":                        {},
+	"KubeletInUserNamespace":                         {},
+	"KubeletPodResourcesDynamicResources":            {},
+	"KubeletPodResourcesGet":                         {},
+	"KubeletTracing":                                 {},
+	"LoadBalancerIPMode":                             {},
+	"LocalStorageCapacityIsolationFSQuotaMonitoring": {},
+	"MatchLabelKeysInPodTopologySpread":              {},
+	"MemoryManager":                                  {},
+	"MemoryQoS":                                      {},
+	"MinDomainsInPodTopologySpread":                  {},
+	"NodeInclusionPolicyInPodTopologySpread":         {},
+	"NodeLogQuery":                                   {},
+	"NodeSwap":                                       {},
+	"PodAndContainerStatsFromCRI":                    {},
+	"PodDisruptionConditions":                        {},
+	"PodHostIPs":                                     {},
+	"PodIndexLabel":                                  {},
+	"PodLifecycleSleepAction":                        {},
+	"PodReadyToStartContainersCondition":             {},
+	"PodSchedulingReadiness":                         {},
+	"ProcMountType":                                  {},
+	"RecursiveReadOnlyMounts":                        {},
+	"SELinuxMountReadWriteOncePod":                   {},
+	"SchedulerQueueingHints":                         {},
+	"SidecarContainers":                              {},
+	"StatefulSetAutoDeletePVC":                       {},
+	"StatefulSetStartOrdinal":                        {},
+	"StructuredAuthenticationConfiguration":          {},
+	"StructuredAuthorizationConfiguration":           {},
+	"TopologyManagerPolicyAlphaOptions":              {},
+	"TopologyManagerPolicyBetaOptions":               {},
+	"TranslateStreamCloseWebsocketRequests":          {},
+	"UnknownVersionInteroperabilityProxy":            {},
+	"UserNamespacesSupport":                          {},
+	"ValidatingAdmissionPolicy":                      {},
+	"VolumeAttributesClass":                          {},
+	"WatchList":                                      {},
+	"WinDSR":                                         {},
+	"WinOverlay":                                     {},
+	"WindowsHostNetwork":                             {},
+}
+
+// featureGateFlags are the k3s flags of the components the feature gates are passed to.
+// The agent components of a k3s server run in the same process, an agent only runs those.
+var featureGateFlags = []struct {
+	flag       string
+	serverOnly bool
+}{
+	{flag: "--kube-apiserver-arg", serverOnly: true},
+	{flag: "--kube-controller-manager-arg", serverOnly: true},
+	{flag: "--kube-scheduler-arg", serverOnly: true},
+	{flag: "--kubelet-arg"},
+	{flag: "--kube-proxy-arg"},
+}
+
+// featureGatesValue returns the value of the feature-gates flag for gates, sorted by name.
+// An error is returned if any of the gate names is invalid.
+func featureGatesValue(gates map[string]bool) (string, error) {
+	var values []string
+	for _, name := range sortedKeys(gates) {
+		if !featureGateRegex.MatchString(name) {
+			return "", fmt.Errorf("invalid feature gate '%s'", name)
+		}
+		values = append(values, name+"="+strconv.FormatBool(gates[name]))
+	}
+	return strings.Join(values, ","), nil
+}
+
+// featureGateArgs returns the k3s args passing the feature gates in conf to the components
+// of the node. An error is returned if the gates are invalid or also specified with component args.
+func featureGateArgs(conf config.Kubernetes) ([]string, error) {
+	if len(conf.FeatureGates) == 0 {
+		return nil, nil
+	}
+	value, err := featureGatesValue(conf.FeatureGates)
+	if err != nil {
+		return nil, err
+	}
+
+	// the components only accept a single feature-gates flag
+	for _, c := range componentFlags(conf) {
+		for _, arg := range c.args {
+			if name, _, _ := strings.Cut(strings.TrimLeft(arg, "-"), "="); name == "feature-gates" {
+				return nil, fmt.Errorf("feature gates are configured and also specified with %s", strings.TrimPrefix(c.flag, "--"))
+			}
+		}
+	}
+
+	var args []string
+	for _, c := range featureGateFlags {
+		if c.serverOnly && isAgent(conf) {
+			continue
+		}
+		args = append(args, c.flag, "feature-gates="+value)
+	}
+	return args, nil
+}
+
+// unknownFeatureGates returns the names of the gates not in knownFeatureGates, sorted.
+func unknownFeatureGates(gates map[string]bool) (unknown []string) {
+	for _, name := range sortedKeys(gates) {
+		if _, ok := knownFeatureGates[name]; !ok {
+			unknown = append(unknown, name)
+		}
+	}
+	return unknown
+}
@@ -0,0 +1,96 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_featureGateArgs(t *testing.T) {
+	const gates = "feature-gates=InPlacePodVerticalScaling=true,SidecarContainers=false"
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name: "server",
+			conf: config.Kubernetes{FeatureGates: map[string]bool{"SidecarContainers": false, "InPlacePodVerticalScaling": true}},
+			want: []string{
+				"--kube-apiserver-arg", gates,
+				"--kube-controller-manager-arg", gates,
+				"--kube-scheduler-arg", gates,
+				"--kubelet-arg", gates,
+				"--kube-proxy-arg", gates,
+			},
+		},
+		{
+			name: "agent",
+			conf: config.Kubernetes{
+				Role: "agent", Server: "https://10.0.0.2:6443", Token: "t",
+				FeatureGates: map[string]bool{"SidecarContainers": false, "InPlacePodVerticalScaling": true},
+			},
+			want: []string{"--kubelet-arg", gates, "--kube-proxy-arg", gates},
+		},
+		{name: "invalid name", conf: config.Kubernetes{FeatureGates: map[string]bool{"in-place": true}}, wantErr: true},
+		{
+			name: "component arg",
+			conf: config.Kubernetes{
+				FeatureGates:  map[string]bool{"SidecarContainers": true},
+				SchedulerArgs: []string{"feature-gates=SchedulerQueueingHints=true"},
+			},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := featureGateArgs(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("featureGateArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("featureGateArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_unknownFeatureGates(t *testing.T) {
+	gates := map[string]bool{"SidecarContainers": true, "FutureGate": true, "AnotherGate": false}
+	if got, want := unknownFeatureGates(gates), []string{"AnotherGate", "FutureGate"}; !reflect.DeepEqual(got, want) {
+		t.Errorf("unknownFeatureGates() = %v, want %v", got, want)
+	}
+}
+
+func Test_installK3s_featureGates(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{
+		Version:      DefaultVersion,
+		FeatureGates: map[string]bool{"InPlacePodVerticalScaling": true, "FutureGate": true},
+	}
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	// unknown gates are passed through
+	const gates = "feature-gates=FutureGate=true,InPlacePodVerticalScaling=true"
+	for _, flag := range []string{
+		"--kube-apiserver-arg",
+		"--kube-controller-manager-arg",
+		"--kube-scheduler-arg",
+		"--kubelet-arg",
+		"--kube-proxy-arg",
+	} {
+		if _, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true", quoted(flag, gates)); !ok {
+			t.Errorf("feature gates not passed with %s: %+v", flag, guest.commands)
+		}
+	}
+}
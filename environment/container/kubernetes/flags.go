@@ -0,0 +1,134 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// k3sServerFlags are the known k3s server flags.
+// https://docs.k3s.io/cli/server
+var k3sServerFlags = map[string]struct{}{}
+
+func init() {
+	for _, flag := range []string{
+		// logging
+		"debug", "v", "vmodule", "log", "alsologtostderr",
+
+		// listener
+		"bind-address", "https-listen-port", "advertise-address", "advertise-port", "tls-san", "tls-san-security",
+
+		// data
+		"data-dir", "d", "config", "c",
+
+		// networking
+		"cluster-cidr", "service-cidr", "service-node-port-range", "cluster-dns", "cluster-domain",
+		"flannel-backend", "flannel-ipv6-masq", "flannel-external-ip", "flannel-iface", "flannel-conf",
+		"flannel-cni-conf", "egress-selector-mode", "servicelb-namespace",
+
+		// client
+		"write-kubeconfig", "write-kubeconfig-mode", "write-kubeconfig-group", "write-kubeconfig-user",
+
+		// cluster
+		"token", "token-file", "agent-token", "agent-token-file", "server", "cluster-init", "cluster-reset",
+		"cluster-reset-restore-path",
+
+		// flags
+		"kube-apiserver-arg", "etcd-arg", "kube-controller-manager-arg", "kube-scheduler-arg",
+		"kube-cloud-controller-manager-arg",
+
+		// database
+		"datastore-endpoint", "datastore-cafile", "datastore-certfile", "datastore-keyfile",
+		"etcd-expose-metrics", "etcd-disable-snapshots", "etcd-snapshot-name", "etcd-snapshot-schedule-cron",
+		"etcd-snapshot-retention", "etcd-snapshot-dir", "etcd-snapshot-compress", "etcd-s3",
+
+		// storage class
+		"default-local-storage-path",
+
+		// kubernetes components
+		"disable", "disable-scheduler", "disable-cloud-controller", "disable-kube-proxy",
+		"disable-network-policy", "disable-helm-controller", "disable-apiserver", "disable-controller-manager",
+		"disable-etcd",
+
+		// agent
+		"node-name", "with-node-id", "node-label", "node-taint", "image-credential-provider-bin-dir",
+		"image-credential-provider-config", "selinux", "lb-server-port", "protect-kernel-defaults",
+		"secrets-encryption", "enable-pprof", "rootless", "prefer-bundled-bin", "node-ip", "node-external-ip",
+		"resolv-conf", "kubelet-arg", "kube-proxy-arg",
+
+		// agent runtime
+		"docker", "container-runtime-endpoint", "pause-image", "snapshotter", "private-registry",
+		"system-default-registry", "airgap-extra-registry",
+
+		// experimental
+		"embedded-registry", "supervisor-metrics",
+	} {
+		k3sServerFlags[flag] = struct{}{}
+	}
+}
+
+// k3sAgentFlags are the known k3s agent flags.
+// https://docs.k3s.io/cli/agent
+var k3sAgentFlags = map[string]struct{}{}
+
+func init() {
+	for _, flag := range []string{
+		// logging
+		"debug", "v", "vmodule", "log", "alsologtostderr",
+
+		// cluster
+		"token", "t", "token-file", "server", "s",
+
+		// data
+		"data-dir", "d", "config", "c",
+
+		// node
+		"node-name", "with-node-id", "node-label", "node-taint", "image-credential-provider-bin-dir",
+		"image-credential-provider-config", "selinux", "lb-server-port", "protect-kernel-defaults",
+		"enable-pprof", "rootless", "prefer-bundled-bin",
+
+		// runtime
+		"docker", "container-runtime-endpoint", "pause-image", "snapshotter", "private-registry",
+		"system-default-registry", "airgap-extra-registry", "disable-default-registry-endpoint",
+
+		// networking
+		"node-ip", "node-external-ip", "resolv-conf", "flannel-iface", "flannel-conf", "flannel-cni-conf",
+		"vpn-auth", "vpn-auth-file", "disable-apiserver-lb",
+
+		// flags
+		"kubelet-arg", "kube-proxy-arg",
+	} {
+		k3sAgentFlags[flag] = struct{}{}
+	}
+}
+
+// validateK3sArgs validates that the k3s args of conf only contain known flags for the role
+// of the node, server or agent. The server flags are also known for an agent, the flags
+// only valid for a server are dropped from the agent args.
+// Unknown flags can be passed with the kubernetes extraArgs config.
+func validateK3sArgs(conf config.Kubernetes) error {
+	var unknown []string
+	for _, arg := range conf.K3sArgs {
+		if !strings.HasPrefix(arg, "-") {
+			// value of the previous flag
+			continue
+		}
+		name := strings.TrimLeft(arg, "-")
+		name, _, _ = strings.Cut(name, "=")
+		_, server := k3sServerFlags[name]
+		_, agent := k3sAgentFlags[name]
+		if !server && !(agent && isAgent(conf)) {
+			unknown = append(unknown, arg)
+		}
+	}
+
+	if len(unknown) > 0 {
+		role := roleServer
+		if isAgent(conf) {
+			role = roleAgent
+		}
+		return fmt.Errorf("unknown k3s %s flag(s) %s, use kubernetes 'extraArgs' config to pass them anyway", role, strings.Join(unknown, ", "))
+	}
+	return nil
+}
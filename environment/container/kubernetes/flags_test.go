@@ -0,0 +1,93 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_validateK3sArgs(t *testing.T) {
+	agent := func(args ...string) config.Kubernetes { return config.Kubernetes{Role: roleAgent, K3sArgs: args} }
+	server := func(args ...string) config.Kubernetes { return config.Kubernetes{K3sArgs: args} }
+
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		wantErr bool
+	}{
+		{name: "empty"},
+		{name: "default", conf: server("--disable=traefik")},
+		{name: "separate value", conf: server("--flannel-iface", "eth0", "--write-kubeconfig-mode", "644")},
+		{name: "single dash", conf: server("-v=2")},
+		{name: "boolean", conf: server("--disable-network-policy", "--cluster-init")},
+		{name: "unknown", conf: server("--disable=traefik", "--not-a-k3s-flag"), wantErr: true},
+		{name: "unknown with value", conf: server("--flanel-iface=eth0"), wantErr: true},
+		{name: "agent only flag for server", conf: server("--vpn-auth=name=tailscale"), wantErr: true},
+		{name: "agent", conf: agent("-s", "https://192.168.106.2:6443", "-t", "secret", "--vpn-auth=name=tailscale", "--disable-apiserver-lb")},
+		// dropped from the agent args
+		{name: "server flag for agent", conf: agent("--disable=traefik")},
+		{name: "unknown for agent", conf: agent("--not-a-k3s-flag"), wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateK3sArgs(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("validateK3sArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_installK3sCluster_extraArgs(t *testing.T) {
+	conf := config.Kubernetes{
+		Version:   DefaultVersion,
+		K3sArgs:   []string{"--disable=traefik"},
+		ExtraArgs: []string{"--not-a-k3s-flag"},
+	}
+
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3sCluster(&fakeHost{}, guest, a, nil, containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := guest.hasCommand("k3s-install.sh", "--disable=traefik", "--not-a-k3s-flag"); !ok {
+		t.Errorf("install command with extra args not found in %+v", guest.commands)
+	}
+
+	// unknown flags are rejected in k3s args for a new install
+	conf.K3sArgs = conf.ExtraArgs
+	conf.ExtraArgs = nil
+	a = newTestChain()
+	installK3s(&fakeHost{}, &fakeGuest{}, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err == nil {
+		t.Error("expected error for unknown k3s flag")
+	}
+}
+
+func TestProvision_installedUnknownFlag(t *testing.T) {
+	conf := config.Kubernetes{Version: DefaultVersion, K3sArgs: []string{"--flag-unknown-since"}}
+	b, err := json.Marshal(conf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	guest := &fakeGuest{
+		store:   map[string]string{ConfigKey: string(b), environment.ContainerRuntimeKey: containerd.Name},
+		outputs: map[string]string{"k3s --version": "k3s version " + DefaultVersion},
+		errs:    map[string]error{"sudo service k3s status": errors.New("stopped")},
+	}
+	c := &kubernetesRuntime{host: &fakeHost{}, guest: guest, CommandChain: cli.New(Name)}
+
+	// an installed k3s is not failed for flags accepted when installed
+	if err := c.Provision(context.WithValue(context.Background(), cli.CtxKeyQuiet, true)); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := guest.hasCommand("k3s-install.sh", "--flag-unknown-since"); !ok {
+		t.Errorf("install command with the flag not found in %+v", guest.commands)
+	}
+}
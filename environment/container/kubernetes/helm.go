@@ -0,0 +1,84 @@
+package kubernetes
+
+import (
+	"sort"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/downloader"
+)
+
+const (
+	helmBinary = "/usr/local/bin/helm"
+	kubeconfig = "/etc/rancher/k3s/k3s.yaml"
+)
+
+// helmURL returns the download url for the helm release archive.
+func helmURL(version string, arch environment.Arch) string {
+	return "https://get.helm.sh/helm-" + version + "-linux-" + arch.GoArch() + ".tar.gz"
+}
+
+func installHelm(
+	host environment.HostActions,
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	conf config.Kubernetes,
+) {
+	helmVersion := conf.HelmVersion
+
+	// skip if the version is already installed
+	if out, err := guest.RunOutput(helmBinary, "version", "--short"); err == nil && strings.HasPrefix(out, helmVersion) {
+		return
+	}
+
+	downloadPath := "/tmp/helm.tar.gz"
+	url := helmURL(helmVersion, guest.Arch())
+	a.Add(func() error {
+		sha, err := assetSHA(conf, checksumKey(assetHelm, helmVersion, guest.Arch().GoArch()), &downloader.SHA{Size: 256, URL: url + ".sha256sum"})
+		if err != nil {
+			return err
+		}
+		r := downloader.Request{
+			URL:        url,
+			Filename:   downloadPath,
+			SHA:        sha,
+			UserAgent:  conf.UserAgent,
+			Timeout:    downloadTimeout(conf),
+			BufferSize: downloadBufferSize(conf),
+		}
+		return downloader.Download(host, guest, r)
+	})
+
+	// the archive contains the binary in a directory named after the platform e.g. linux-amd64/helm
+	platform := "linux-" + guest.Arch().GoArch()
+	a.Add(func() error {
+		return guest.Run("tar", "-xzf", downloadPath, "-C", "/tmp", platform+"/helm")
+	})
+	a.Add(func() error {
+		return guest.Run(sudo(conf, "install", "/tmp/"+platform+"/helm", helmBinary)...)
+	})
+}
+
+// HelmInstall installs or upgrades the helm chart as release with values in the guest.
+// It requires helm to be installed in the guest.
+func HelmInstall(guest environment.GuestActions, release, chart string, values map[string]string) error {
+	return guest.Run(helmInstallArgs(release, chart, values)...)
+}
+
+func helmInstallArgs(release, chart string, values map[string]string) []string {
+	args := []string{helmBinary, "upgrade", "--install", release, chart, "--kubeconfig", kubeconfig}
+
+	keys := make([]string, 0, len(values))
+	for key := range values {
+		keys = append(keys, key)
+	}
+	// sort for a predictable order of args
+	sort.Strings(keys)
+
+	for _, key := range keys {
+		args = append(args, "--set", key+"="+values[key])
+	}
+	return args
+}
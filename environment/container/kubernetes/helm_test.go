@@ -0,0 +1,91 @@
+package kubernetes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+)
+
+func Test_helmURL(t *testing.T) {
+	tests := []struct {
+		arch environment.Arch
+		want string
+	}{
+		{arch: environment.X8664, want: "https://get.helm.sh/helm-v3.13.2-linux-amd64.tar.gz"},
+		{arch: environment.AARCH64, want: "https://get.helm.sh/helm-v3.13.2-linux-arm64.tar.gz"},
+	}
+	for _, tt := range tests {
+		t.Run(string(tt.arch), func(t *testing.T) {
+			if got := helmURL("v3.13.2", tt.arch); got != tt.want {
+				t.Errorf("helmURL() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_installHelm(t *testing.T) {
+	host := &fakeHost{}
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installHelm(host, guest, a, config.Kubernetes{HelmVersion: "v3.13.2"})
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	url := "https://get.helm.sh/helm-v3.13.2-linux-amd64.tar.gz"
+	var downloaded, verified bool
+	for _, cmd := range host.commands {
+		if strings.HasPrefix(cmd, "curl") && strings.HasSuffix(cmd, url) {
+			downloaded = true
+		}
+		if strings.Contains(cmd, url+".sha256sum") {
+			verified = true
+		}
+	}
+	if !downloaded || !verified {
+		t.Errorf("helm not downloaded and verified from %s: %+v", url, host.commands)
+	}
+	if _, ok := guest.hasCommand("sudo install /tmp/linux-amd64/helm " + helmBinary); !ok {
+		t.Errorf("helm not installed: %+v", guest.commands)
+	}
+
+	// already installed
+	guest = &fakeGuest{outputs: map[string]string{helmBinary + " version": "v3.13.2+g2a2fb3b"}}
+	a = newTestChain()
+	installHelm(&fakeHost{}, guest, a, config.Kubernetes{HelmVersion: "v3.13.2"})
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := guest.hasCommand("sudo install"); ok {
+		t.Errorf("helm should not be reinstalled: %+v", guest.commands)
+	}
+}
+
+func Test_helmInstallArgs(t *testing.T) {
+	tests := []struct {
+		name   string
+		values map[string]string
+		want   []string
+	}{
+		{
+			name: "no values",
+			want: []string{helmBinary, "upgrade", "--install", "ingress", "ingress-nginx/ingress-nginx", "--kubeconfig", kubeconfig},
+		},
+		{
+			name:   "values",
+			values: map[string]string{"installCRDs": "true", "controller.replicaCount": "2"},
+			want: []string{helmBinary, "upgrade", "--install", "ingress", "ingress-nginx/ingress-nginx", "--kubeconfig", kubeconfig,
+				"--set", "controller.replicaCount=2", "--set", "installCRDs=true"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := helmInstallArgs("ingress", "ingress-nginx/ingress-nginx", tt.values); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("helmInstallArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,94 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net"
+	"strings"
+
+	"github.com/abiosoft/colima/environment"
+)
+
+// hostsFile is the hosts file in the guest.
+const hostsFile = "/etc/hosts"
+
+// hostsMarker is the comment marking the hosts file entries managed by colima.
+const hostsMarker = "# colima"
+
+// validateHosts validates the hostname to IP address entries for the hosts file.
+func validateHosts(hosts map[string]string) error {
+	for hostname, ip := range hosts {
+		if hostname == "" || strings.ContainsAny(hostname, " \t#") {
+			return fmt.Errorf("invalid hostname '%s' in hosts", hostname)
+		}
+		if net.ParseIP(ip) == nil {
+			return fmt.Errorf("invalid IP address '%s' for host '%s'", ip, hostname)
+		}
+	}
+	return nil
+}
+
+// hostsFileContent returns current with the entries for hosts added and whether it changed.
+// Existing entries are not duplicated, and previous entries by colima for a hostname
+// with a different IP address are replaced.
+func hostsFileContent(current string, hosts map[string]string) (string, bool) {
+	lines := strings.Split(strings.TrimSuffix(current, "\n"), "\n")
+	if current == "" {
+		lines = nil
+	}
+
+	// mapped returns if the line maps hostname to ip.
+	mapped := func(line, hostname, ip string) bool {
+		fields := strings.Fields(strings.SplitN(line, "#", 2)[0])
+		if len(fields) < 2 || fields[0] != ip {
+			return false
+		}
+		for _, name := range fields[1:] {
+			if name == hostname {
+				return true
+			}
+		}
+		return false
+	}
+
+	changed := false
+	for _, hostname := range sortedKeys(hosts) {
+		ip := hosts[hostname]
+
+		exists := false
+		var kept []string
+		for _, line := range lines {
+			if mapped(line, hostname, ip) {
+				exists = true
+			} else if strings.HasSuffix(line, hostsMarker) && mapped(line, hostname, strings.Fields(line)[0]) {
+				// stale entry by colima
+				changed = true
+				continue
+			}
+			kept = append(kept, line)
+		}
+		lines = kept
+
+		if !exists {
+			lines = append(lines, ip+" "+hostname+" "+hostsMarker)
+			changed = true
+		}
+	}
+
+	return strings.Join(lines, "\n") + "\n", changed
+}
+
+// writeHosts adds the entries for hosts to the hosts file in the guest.
+func writeHosts(guest environment.GuestActions, hosts map[string]string) error {
+	current, err := guest.Read(hostsFile)
+	if err != nil {
+		return fmt.Errorf("error reading hosts file: %w", err)
+	}
+	content, changed := hostsFileContent(current, hosts)
+	if !changed {
+		return nil
+	}
+	if err := guest.Write(hostsFile, []byte(content)); err != nil {
+		return fmt.Errorf("error writing hosts file: %w", err)
+	}
+	return nil
+}
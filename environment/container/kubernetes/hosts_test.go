@@ -0,0 +1,85 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_hostsFileContent(t *testing.T) {
+	const current = "127.0.0.1 localhost\n10.0.0.20 registry.internal\n"
+
+	tests := []struct {
+		name    string
+		current string
+		hosts   map[string]string
+		want    string
+		changed bool
+	}{
+		{
+			name:    "added",
+			current: "127.0.0.1 localhost\n",
+			hosts:   map[string]string{"registry.internal": "10.0.0.20", "git.internal": "10.0.0.21"},
+			want:    "127.0.0.1 localhost\n10.0.0.21 git.internal # colima\n10.0.0.20 registry.internal # colima\n",
+			changed: true,
+		},
+		{
+			name:    "existing",
+			current: current,
+			hosts:   map[string]string{"registry.internal": "10.0.0.20"},
+			want:    current,
+		},
+		{
+			name:    "changed ip",
+			current: "127.0.0.1 localhost\n10.0.0.19 registry.internal # colima\n",
+			hosts:   map[string]string{"registry.internal": "10.0.0.20"},
+			want:    "127.0.0.1 localhost\n10.0.0.20 registry.internal # colima\n",
+			changed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, changed := hostsFileContent(tt.current, tt.hosts)
+			if got != tt.want {
+				t.Errorf("hostsFileContent() = %q, want %q", got, tt.want)
+			}
+			if changed != tt.changed {
+				t.Errorf("hostsFileContent() changed = %v, want %v", changed, tt.changed)
+			}
+
+			// idempotent
+			if again, changed := hostsFileContent(got, tt.hosts); changed || again != got {
+				t.Errorf("expected no change on reapply, got %q", again)
+			}
+		})
+	}
+}
+
+func Test_installK3s_hosts(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{Version: DefaultVersion, Hosts: map[string]string{"registry.internal": "10.0.0.20"}}
+	guest := &fakeGuest{files: map[string]string{hostsFile: "127.0.0.1 localhost\n"}}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if got := guest.files[hostsFile]; strings.Count(got, "registry.internal") != 1 {
+		t.Errorf("expected a single hosts entry, got %q", got)
+	}
+
+	// invalid addresses fail before any step
+	conf.Hosts = map[string]string{"registry.internal": "registry"}
+	guest = &fakeGuest{}
+	a = newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err == nil {
+		t.Error("expected error for invalid IP address")
+	}
+	if len(guest.commands) > 0 {
+		t.Errorf("expected no commands before validation, got %+v", guest.commands)
+	}
+}
@@ -0,0 +1,84 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+)
+
+// prePullRetries is the number of retries after a failed image pull.
+const prePullRetries = 2
+
+// prePullInterval is the interval between attempts of an image pull.
+var prePullInterval = 2 * time.Second
+
+func validatePrePullImages(conf config.Kubernetes) error {
+	if len(conf.PrePullImages) == 0 {
+		return nil
+	}
+	if conf.Rootless {
+		return fmt.Errorf("pre-pulled images are not supported for rootless k3s")
+	}
+	for _, image := range conf.PrePullImages {
+		if image == "" || strings.ContainsAny(image, " \t") {
+			return fmt.Errorf("invalid pre-pulled image '%s'", image)
+		}
+	}
+	return nil
+}
+
+// prePullCmd returns the command pulling image into the container runtime used by k3s.
+// A configured runtime endpoint takes precedence, the image is pulled over CRI.
+func prePullCmd(containerRuntime, image string, conf config.Kubernetes) []string {
+	if conf.RuntimeEndpoint != "" {
+		return sudo(conf, "k3s", "crictl", "--runtime-endpoint", conf.RuntimeEndpoint, "pull", image)
+	}
+	switch containerRuntime {
+	case containerd.Name:
+		return sudo(conf, "nerdctl", "-n", "k8s.io", "pull", "--quiet", image)
+	case docker.Name:
+		return sudo(conf, "docker", "pull", "--quiet", image)
+	}
+	return nil
+}
+
+// prePullImages pulls the configured images into the container runtime once k3s is ready.
+// A failed pull is only reported, the image is pulled when a pod is scheduled.
+func prePullImages(guest environment.GuestActions, a *cli.ActiveCommandChain, containerRuntime string, conf config.Kubernetes) {
+	if len(conf.PrePullImages) == 0 {
+		return
+	}
+
+	log := a.Logger()
+
+	// readiness gate
+	a.RetryWithJitter("", prePullInterval, time.Second, 10, func(int) error {
+		return Ready(guest, conf)
+	})
+
+	for _, image := range conf.PrePullImages {
+		cmd := prePullCmd(containerRuntime, image, conf)
+		if cmd == nil {
+			continue
+		}
+		image := image
+		a.Add(func() (err error) {
+			for i := 0; i <= prePullRetries; i++ {
+				if i > 0 {
+					time.Sleep(prePullInterval)
+				}
+				if err = guest.RunQuiet(cmd...); err == nil {
+					return nil
+				}
+			}
+			log.Warnln(fmt.Errorf("error pre-pulling image %s: %w", image, err))
+			return nil
+		})
+	}
+}
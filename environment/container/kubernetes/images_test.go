@@ -0,0 +1,104 @@
+package kubernetes
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+)
+
+func Test_prePullImages(t *testing.T) {
+	interval := prePullInterval
+	prePullInterval = time.Millisecond
+	defer func() { prePullInterval = interval }()
+
+	tests := []struct {
+		name    string
+		runtime string
+		conf    config.Kubernetes
+		want    string
+	}{
+		{name: "containerd", runtime: containerd.Name, want: "sudo nerdctl -n k8s.io pull --quiet docker.io/library/postgres:16"},
+		{name: "docker", runtime: docker.Name, want: "sudo docker pull --quiet docker.io/library/postgres:16"},
+		{
+			name:    "runtime endpoint",
+			runtime: containerd.Name,
+			conf:    config.Kubernetes{RuntimeEndpoint: "unix:///run/crio/crio.sock"},
+			want:    "sudo k3s crictl --runtime-endpoint unix:///run/crio/crio.sock pull docker.io/library/postgres:16",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.PrePullImages = []string{"docker.io/library/postgres:16"}
+			guest := &fakeGuest{}
+			a := newTestChain()
+			prePullImages(guest, a, tt.runtime, conf)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			want := []string{"kubectl cluster-info", tt.want}
+			if len(guest.commands) != len(want) {
+				t.Fatalf("expected commands %+v, got %+v", want, guest.commands)
+			}
+			for i := range want {
+				if guest.commands[i] != want[i] {
+					t.Errorf("expected command %d to be %q, got %q", i, want[i], guest.commands[i])
+				}
+			}
+		})
+	}
+}
+
+func Test_prePullImages_failure(t *testing.T) {
+	interval := prePullInterval
+	prePullInterval = time.Millisecond
+	defer func() { prePullInterval = interval }()
+
+	const failing = "sudo docker pull --quiet registry.internal/missing:1"
+	guest := &fakeGuest{errs: map[string]error{failing: fmt.Errorf("not found")}}
+	conf := config.Kubernetes{PrePullImages: []string{"registry.internal/missing:1", "docker.io/library/redis:7"}}
+	a := newTestChain()
+	prePullImages(guest, a, docker.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatalf("expected a failed pull to be ignored, got %v", err)
+	}
+
+	var attempts int
+	for _, cmd := range guest.commands {
+		if cmd == failing {
+			attempts++
+		}
+	}
+	if attempts != prePullRetries+1 {
+		t.Errorf("expected %d attempts, got %d", prePullRetries+1, attempts)
+	}
+	if _, ok := guest.hasCommand("sudo docker pull --quiet docker.io/library/redis:7"); !ok {
+		t.Errorf("expected the remaining images to be pulled: %+v", guest.commands)
+	}
+}
+
+func Test_validatePrePullImages(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "images", conf: config.Kubernetes{PrePullImages: []string{"nginx", "ghcr.io/org/app:1"}}},
+		{name: "empty", conf: config.Kubernetes{PrePullImages: []string{""}}, wantErr: true},
+		{name: "whitespace", conf: config.Kubernetes{PrePullImages: []string{"nginx --all"}}, wantErr: true},
+		{name: "rootless", conf: config.Kubernetes{Rootless: true, PrePullImages: []string{"nginx"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePrePullImages(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("validatePrePullImages() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,147 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/embedded"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util"
+)
+
+// ingressManifestsDir is the directory of the manifests auto-deployed by k3s relative to the k3s data directory.
+// https://docs.k3s.io/installation/packaged-components#auto-deploying-manifests-addons
+const ingressManifestsDir = "/server/manifests"
+
+// ingressManifests are the embedded manifests of the supported ingress controllers.
+// traefik is packaged with k3s and only customized, nginx is installed with the k3s helm controller.
+var ingressManifests = map[string]struct{ template, file string }{
+	"traefik": {template: "k3s/traefik-config.yaml", file: "traefik-config.yaml"},
+	"nginx":   {template: "k3s/ingress-nginx.yaml", file: "colima-ingress-nginx.yaml"},
+}
+
+// ingressController returns c with the defaults applied.
+func ingressController(c config.IngressController) config.IngressController {
+	if c.Class == "" {
+		c.Class = c.Name
+	}
+	if c.HTTPPort == 0 {
+		c.HTTPPort = 80
+	}
+	if c.HTTPSPort == 0 {
+		c.HTTPSPort = 443
+	}
+	return c
+}
+
+func validateIngressControllers(conf config.Kubernetes) error {
+	if len(conf.IngressControllers) == 0 {
+		return nil
+	}
+	if isAgent(conf) {
+		return fmt.Errorf("ingress controllers are only supported for a k3s server")
+	}
+	if conf.Rootless {
+		return fmt.Errorf("ingress controllers are not supported for rootless k3s")
+	}
+
+	names := map[string]struct{}{}
+	classes := map[string]string{}
+	ports := map[int]string{}
+	for _, c := range conf.IngressControllers {
+		if _, ok := ingressManifests[c.Name]; !ok {
+			return fmt.Errorf("invalid ingress controller '%s', must be one of traefik or nginx", c.Name)
+		}
+		if _, ok := names[c.Name]; ok {
+			return fmt.Errorf("ingress controller '%s' is specified more than once", c.Name)
+		}
+		names[c.Name] = struct{}{}
+
+		c = ingressController(c)
+		if other, ok := classes[c.Class]; ok {
+			return fmt.Errorf("ingress class '%s' of %s is also the ingress class of %s", c.Class, c.Name, other)
+		}
+		classes[c.Class] = c.Name
+
+		// the controllers are exposed by the k3s service load balancer on the node ports
+		for _, port := range []int{c.HTTPPort, c.HTTPSPort} {
+			if port < 1 || port > 65535 {
+				return fmt.Errorf("invalid port %d for ingress controller %s", port, c.Name)
+			}
+			if other, ok := ports[port]; ok {
+				return fmt.Errorf("port %d of ingress controller %s is also used by %s", port, c.Name, other)
+			}
+			ports[port] = c.Name
+		}
+	}
+	return nil
+}
+
+// ingressControllerEnabled returns if the ingress controller with name is requested in conf.
+func ingressControllerEnabled(conf config.Kubernetes, name string) bool {
+	for _, c := range conf.IngressControllers {
+		if c.Name == name {
+			return true
+		}
+	}
+	return false
+}
+
+// enableTraefik returns args without traefik in the disabled components of k3s.
+// traefik is disabled by default and must be kept when it is a requested ingress controller.
+func enableTraefik(args []string) []string {
+	// without traefik, returns the disabled components or an empty value if none remain
+	without := func(components string) string {
+		var kept []string
+		for _, c := range strings.Split(components, ",") {
+			if c != "traefik" {
+				kept = append(kept, c)
+			}
+		}
+		return strings.Join(kept, ",")
+	}
+
+	var filtered []string
+	for i := 0; i < len(args); i++ {
+		arg := args[i]
+		if arg == "--disable" && i+1 < len(args) {
+			i++
+			if v := without(args[i]); v != "" {
+				filtered = append(filtered, arg, v)
+			}
+			continue
+		}
+		if v, ok := strings.CutPrefix(arg, "--disable="); ok {
+			if v := without(v); v != "" {
+				filtered = append(filtered, "--disable="+v)
+			}
+			continue
+		}
+		filtered = append(filtered, arg)
+	}
+	return filtered
+}
+
+// ingressManifestYAML renders the manifest of the ingress controller c.
+// The first controller provides the default ingress class.
+func ingressManifestYAML(c config.IngressController, isDefault bool) ([]byte, error) {
+	m, ok := ingressManifests[c.Name]
+	if !ok {
+		return nil, fmt.Errorf("invalid ingress controller '%s'", c.Name)
+	}
+	tpl, err := embedded.ReadString(m.template)
+	if err != nil {
+		return nil, fmt.Errorf("error reading embedded %s ingress manifest: %w", c.Name, err)
+	}
+	values := struct {
+		config.IngressController
+		Default bool
+	}{IngressController: ingressController(c), Default: isDefault}
+	return util.ParseTemplate(tpl, values)
+}
+
+// ingressManifestFile returns the path to the manifest of the ingress controller with name in the guest for conf.
+func ingressManifestFile(guest environment.GuestActions, conf config.Kubernetes, name string) string {
+	return dataDir(guest, conf) + ingressManifestsDir + "/" + ingressManifests[name].file
+}
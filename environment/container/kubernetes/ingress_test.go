@@ -0,0 +1,143 @@
+package kubernetes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_installK3s_ingressControllers(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{
+		Version: DefaultVersion,
+		K3sArgs: []string{"--disable=traefik"},
+		IngressControllers: []config.IngressController{
+			{Name: "traefik", Class: "public"},
+			{Name: "nginx", Class: "internal", HTTPPort: 8080, HTTPSPort: 8443},
+		},
+	}
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	install, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true")
+	if !ok {
+		t.Fatalf("install command not found in %+v", guest.commands)
+	}
+	if strings.Contains(install, "traefik") {
+		t.Errorf("expected traefik to stay enabled, got %s", install)
+	}
+
+	tests := []struct {
+		file string
+		want []string
+	}{
+		{
+			file: defaultDataDir + ingressManifestsDir + "/traefik-config.yaml",
+			want: []string{"kind: HelmChartConfig", "name: public", "isDefaultClass: true", "exposedPort: 80"},
+		},
+		{
+			file: defaultDataDir + ingressManifestsDir + "/colima-ingress-nginx.yaml",
+			want: []string{"kind: HelmChart", "ingressClass: internal", "default: false", "http: 8080", "https: 8443"},
+		},
+	}
+	for _, tt := range tests {
+		content, ok := guest.files[tt.file]
+		if !ok {
+			t.Errorf("manifest not written to %s: %+v", tt.file, guest.files)
+			continue
+		}
+		for _, want := range tt.want {
+			if !strings.Contains(content, want) {
+				t.Errorf("expected %q in %s: %s", want, tt.file, content)
+			}
+		}
+	}
+}
+
+func Test_installK3s_ingressControllers_traefikDisabled(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{
+		Version:            DefaultVersion,
+		K3sArgs:            []string{"--disable=traefik"},
+		IngressControllers: []config.IngressController{{Name: "nginx"}},
+	}
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true", "--disable=traefik"); !ok {
+		t.Errorf("expected traefik to stay disabled: %+v", guest.commands)
+	}
+	if _, ok := guest.files[defaultDataDir+ingressManifestsDir+"/traefik-config.yaml"]; ok {
+		t.Errorf("unexpected traefik config: %+v", guest.files)
+	}
+}
+
+func Test_enableTraefik(t *testing.T) {
+	tests := []struct {
+		args []string
+		want []string
+	}{
+		{args: []string{"--disable=traefik"}},
+		{args: []string{"--disable", "traefik", "--node-name", "colima"}, want: []string{"--node-name", "colima"}},
+		{args: []string{"--disable=traefik,servicelb"}, want: []string{"--disable=servicelb"}},
+		{args: []string{"--disable", "metrics-server,traefik"}, want: []string{"--disable", "metrics-server"}},
+		{args: []string{"--disable=servicelb"}, want: []string{"--disable=servicelb"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Join(tt.args, " "), func(t *testing.T) {
+			if got := enableTraefik(tt.args); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("enableTraefik() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_validateIngressControllers(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		wantErr bool
+	}{
+		{name: "none"},
+		{name: "traefik", conf: config.Kubernetes{IngressControllers: []config.IngressController{{Name: "traefik"}}}},
+		{name: "distinct", conf: config.Kubernetes{IngressControllers: []config.IngressController{
+			{Name: "traefik"},
+			{Name: "nginx", HTTPPort: 8080, HTTPSPort: 8443},
+		}}},
+		{name: "invalid name", conf: config.Kubernetes{IngressControllers: []config.IngressController{{Name: "haproxy"}}}, wantErr: true},
+		{name: "duplicate name", conf: config.Kubernetes{IngressControllers: []config.IngressController{
+			{Name: "nginx", Class: "a"},
+			{Name: "nginx", Class: "b", HTTPPort: 8080, HTTPSPort: 8443},
+		}}, wantErr: true},
+		{name: "duplicate class", conf: config.Kubernetes{IngressControllers: []config.IngressController{
+			{Name: "traefik", Class: "web"},
+			{Name: "nginx", Class: "web", HTTPPort: 8080, HTTPSPort: 8443},
+		}}, wantErr: true},
+		{name: "duplicate ports", conf: config.Kubernetes{IngressControllers: []config.IngressController{
+			{Name: "traefik"},
+			{Name: "nginx"},
+		}}, wantErr: true},
+		{name: "invalid port", conf: config.Kubernetes{IngressControllers: []config.IngressController{{Name: "nginx", HTTPPort: 70000}}}, wantErr: true},
+		{name: "rootless", conf: config.Kubernetes{Rootless: true, IngressControllers: []config.IngressController{{Name: "traefik"}}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateIngressControllers(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("validateIngressControllers() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
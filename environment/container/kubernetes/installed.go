@@ -0,0 +1,38 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/shautil"
+)
+
+// installRecordFile is the checksum of the command k3s was last installed with by the install script.
+// The token is in the command, the checksum is recorded instead.
+const installRecordFile = "/etc/colima/k3s/install.sha256"
+
+// k3sConfigured returns if k3s is installed in the guest with the install command cmd.
+func k3sConfigured(guest environment.GuestActions, conf config.Kubernetes, cmd string) bool {
+	// the install script creates the uninstall script
+	script := "k3s-uninstall.sh"
+	if isAgent(conf) {
+		script = "k3s-agent-uninstall.sh"
+	}
+	if guest.RunQuiet("command", "-v", script) != nil {
+		return false
+	}
+	recorded, err := guest.Read(installRecordFile)
+	return err == nil && strings.TrimSpace(recorded) == shautil.SHA256(cmd).String()
+}
+
+// recordInstall records cmd as the command k3s is installed with.
+// A failure only results in the install script being run on the next start.
+func recordInstall(guest environment.GuestActions, cmd string) error {
+	if err := guest.Write(installRecordFile, []byte(shautil.SHA256(cmd).String()+"\n")); err != nil {
+		return cli.ErrNonFatal(fmt.Errorf("error recording k3s install: %w", err))
+	}
+	return nil
+}
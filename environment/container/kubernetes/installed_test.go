@@ -0,0 +1,132 @@
+package kubernetes
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_installK3sCluster_reconfigure(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{Version: DefaultVersion, DNSUpstreams: []string{"10.0.0.53"}}
+	guest := &fakeGuest{}
+	install := func(conf config.Kubernetes) {
+		t.Helper()
+		guest.commands = nil
+		delete(guest.files, defaultDataDir+corednsCustomFile)
+		a := newTestChain()
+		installK3sCluster(&fakeHost{}, guest, a, nil, containerd.Name, conf)
+		if err := a.Exec(); err != nil {
+			t.Fatal(err)
+		}
+	}
+	ran := func() bool {
+		_, ok := guest.hasCommand("k3s-install.sh " + quoted("--write-kubeconfig-mode"))
+		return ok
+	}
+
+	install(conf)
+	if !ran() {
+		t.Fatalf("expected the install script to run on the first install: %+v", guest.commands)
+	}
+	if _, ok := guest.files[installRecordFile]; !ok {
+		t.Fatal("expected the install to be recorded")
+	}
+
+	// reconfigured with the same config
+	install(conf)
+	if ran() {
+		t.Errorf("expected the install script to be skipped: %+v", guest.commands)
+	}
+	if _, ok := guest.hasCommand("install /tmp/k3s-install.sh"); ok {
+		t.Errorf("expected the install script not to be installed: %+v", guest.commands)
+	}
+	if _, ok := guest.files[defaultDataDir+corednsCustomFile]; !ok {
+		t.Error("expected the config files to be rewritten")
+	}
+
+	// the k3s args changed
+	changed := conf
+	changed.NodeIP = "192.168.106.2"
+	install(changed)
+	if !ran() {
+		t.Errorf("expected the install script to run for the changed config: %+v", guest.commands)
+	}
+
+	// k3s was uninstalled
+	guest.errs = map[string]error{"command -v k3s-uninstall.sh": fmt.Errorf("not found")}
+	install(changed)
+	if !ran() {
+		t.Errorf("expected the install script to run when k3s is not installed: %+v", guest.commands)
+	}
+}
+
+func TestProvision_installedChecks(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.Kubernetes
+		errs map[string]error
+		want string
+	}{
+		{
+			name: "kernel modules",
+			conf: config.Kubernetes{CheckKernelModules: true},
+			errs: map[string]error{"sh -c test -d /sys/module/vxlan": errors.New("exit status 1")},
+			want: "vxlan",
+		},
+		{
+			name: "shell",
+			conf: config.Kubernetes{Shell: "zsh"},
+			errs: map[string]error{"command -v zsh": errors.New("not found")},
+			want: "shell 'zsh'",
+		},
+		{
+			name: "checksums",
+			conf: config.Kubernetes{StrictChecksums: true},
+			want: "checksum",
+		},
+		{
+			name: "ca bundle",
+			conf: config.Kubernetes{CABundle: "/missing/ca.pem"},
+			want: "CA bundle",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.Version = DefaultVersion
+			b, err := json.Marshal(conf)
+			if err != nil {
+				t.Fatal(err)
+			}
+			errs := map[string]error{"sudo service k3s status": errors.New("stopped")}
+			for k, v := range tt.errs {
+				errs[k] = v
+			}
+			guest := &fakeGuest{
+				store:   map[string]string{ConfigKey: string(b), environment.ContainerRuntimeKey: containerd.Name},
+				outputs: map[string]string{"k3s --version": "k3s version " + DefaultVersion},
+				errs:    errs,
+			}
+			c := &kubernetesRuntime{host: &fakeHost{}, guest: guest, CommandChain: cli.New(Name)}
+
+			// the checks of a new install also run on the start of an installed k3s
+			err = c.Provision(context.WithValue(context.Background(), cli.CtxKeyQuiet, true))
+			if err == nil || !strings.Contains(err.Error(), tt.want) {
+				t.Fatalf("Provision() error = %v, want %q", err, tt.want)
+			}
+			if _, ok := guest.hasCommand("k3s-install.sh"); ok {
+				t.Errorf("k3s must not be reconfigured when a check fails: %+v", guest.commands)
+			}
+		})
+	}
+}
@@ -0,0 +1,90 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+	"sort"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/util"
+)
+
+var installEnvNameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// managedInstallEnv are the install script env vars set by colima.
+var managedInstallEnv = []string{"INSTALL_K3S_SKIP_DOWNLOAD", "INSTALL_K3S_SKIP_ENABLE", "INSTALL_K3S_EXEC", "K3S_URL", "K3S_TOKEN"}
+
+// maskedValue replaces the secret values in the install command output.
+const maskedValue = "******"
+
+func validateInstallEnv(conf config.Kubernetes) error {
+	if len(conf.InstallEnv) > 0 && conf.Rootless {
+		return fmt.Errorf("install env is not supported for rootless k3s, the install script is not used")
+	}
+	for name := range conf.InstallEnv {
+		if !installEnvNameRegex.MatchString(name) {
+			return fmt.Errorf("invalid install env name '%s'", name)
+		}
+		for _, managed := range managedInstallEnv {
+			if name == managed {
+				return fmt.Errorf("install env '%s' is set by colima and cannot be overridden", name)
+			}
+		}
+	}
+	for _, name := range conf.SecretInstallEnv {
+		if _, ok := conf.InstallEnv[name]; !ok {
+			return fmt.Errorf("secret install env '%s' is not in the install env", name)
+		}
+	}
+	return nil
+}
+
+// installEnv returns the configured install script env vars of conf as a shell env prefix,
+// sorted by name. The values are quoted, they are not expanded by the shell.
+func installEnv(conf config.Kubernetes) string {
+	names := make([]string, 0, len(conf.InstallEnv))
+	for name := range conf.InstallEnv {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var env []string
+	for _, name := range names {
+		env = append(env, name+"="+util.ShellQuote(conf.InstallEnv[name]))
+	}
+	return strings.Join(env, " ")
+}
+
+// installSecrets returns the values of conf masked in the output of the install script.
+func installSecrets(conf config.Kubernetes) []string {
+	var secrets []string
+	if conf.Token != "" {
+		secrets = append(secrets, conf.Token)
+	}
+	for _, name := range conf.SecretInstallEnv {
+		if v := conf.InstallEnv[name]; v != "" {
+			secrets = append(secrets, v)
+		}
+	}
+	return secrets
+}
+
+// mask replaces the occurrences of secrets in s.
+func mask(s string, secrets []string) string {
+	for _, secret := range secrets {
+		// the values are quoted for the shell in the command
+		s = strings.ReplaceAll(s, util.ShellQuote(secret), util.ShellQuote(maskedValue))
+		s = strings.ReplaceAll(s, secret, maskedValue)
+	}
+	return s
+}
+
+// maskedErr is an error with the secrets masked in the message.
+type maskedErr struct {
+	err     error
+	secrets []string
+}
+
+func (e maskedErr) Error() string { return mask(e.err.Error(), e.secrets) }
+func (e maskedErr) Unwrap() error { return e.err }
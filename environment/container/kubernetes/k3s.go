@@ -2,7 +2,13 @@ package kubernetes
 
 import (
 	"fmt"
+	"net"
+	"path"
+	"path/filepath"
+	"regexp"
 	"strings"
+	"sync"
+	"time"
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
@@ -11,6 +17,7 @@ import (
 	"github.com/abiosoft/colima/environment/container/containerd"
 	"github.com/abiosoft/colima/environment/container/docker"
 	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"github.com/abiosoft/colima/util"
 	"github.com/abiosoft/colima/util/downloader"
 	"github.com/sirupsen/logrus"
 )
@@ -20,143 +27,877 @@ func installK3s(host environment.HostActions,
 	a *cli.ActiveCommandChain,
 	log *logrus.Entry,
 	containerRuntime string,
-	k3sVersion string,
-	disable []string,
+	conf config.Kubernetes,
 ) {
-	installK3sBinary(host, guest, a, k3sVersion)
-	installK3sCache(host, guest, a, log, containerRuntime, k3sVersion)
-	installK3sCluster(host, guest, a, containerRuntime, k3sVersion, disable)
+	// unknown flags are rejected for a new install, an installed k3s only warns
+	if err := validateK3sArgs(conf); err != nil {
+		a.Add(func() error { return err })
+		return
+	}
+	if !installK3sPrerequisites(host, guest, a, containerRuntime, conf) {
+		return
+	}
+
+	// the downloads are independent and run before the install steps that depend on them
+	downloads := &downloadGroup{limit: conf.ConcurrentDownloads}
+	a.Add(downloads.run)
+
+	installK3sBinary(host, guest, a, downloads, conf)
+	installK3sCache(host, guest, a, downloads, log, containerRuntime, conf)
+	installImageTars(host, guest, a, downloads, log, containerRuntime, conf)
+	installK3sCluster(host, guest, a, downloads, containerRuntime, conf)
+	saveGuestCache(guest, a, conf, downloads)
 }
 
-func installK3sBinary(
-	host environment.HostActions,
+// installK3sPrerequisites validates conf and adds the checks and setup required before
+// any download or install step, for both a new and an installed k3s.
+// It returns false if conf is invalid, the error is then added to the chain.
+func installK3sPrerequisites(host environment.HostActions,
 	guest environment.GuestActions,
 	a *cli.ActiveCommandChain,
-	k3sVersion string,
-) {
-	downloadPath := "/tmp/k3s"
+	containerRuntime string,
+	conf config.Kubernetes,
+) bool {
+	// validate early to fail before any download
+	if err := validateK3sConfig(conf); err != nil {
+		a.Add(func() error { return err })
+		return false
+	}
+	if err := validateChecksums(conf, guest.Arch()); err != nil {
+		a.Add(func() error { return err })
+		return false
+	}
 
-	baseURL := "https://github.com/k3s-io/k3s/releases/download/" + k3sVersion + "/"
-	shaSumTxt := "sha256sum-" + guest.Arch().GoArch() + ".txt"
+	// fail fast before any download if the VM cannot run the pod network
+	if conf.CheckKernelModules {
+		a.Add(func() error { return checkKernelModules(guest, conf) })
+	}
+	if conf.Shell != "" {
+		a.Add(func() error {
+			if err := guest.RunQuiet("command", "-v", conf.Shell); err != nil {
+				return fmt.Errorf("shell '%s' for the k3s install script not found in the VM: %w", conf.Shell, err)
+			}
+			return nil
+		})
+	}
+
+	// the CA is trusted before any download or image pull from the internal registries
+	installCABundle(host, guest, a, containerRuntime, conf)
+	return true
+}
 
-	url := baseURL + "k3s"
-	shaURL := baseURL + shaSumTxt
-	if guest.Arch().GoArch() == "arm64" {
-		url += "-arm64"
+// uninstallK3s stops k3s and removes its data, network and mounts from the guest.
+// It is a no-op if k3s is not installed.
+func uninstallK3s(guest environment.GuestActions, a *cli.ActiveCommandChain) {
+	for _, script := range []string{"k3s-uninstall.sh", "k3s-agent-uninstall.sh"} {
+		script := script
+		a.Add(func() error {
+			// it is installed if uninstall script is present.
+			if guest.RunQuiet("command", "-v", script) != nil {
+				return nil
+			}
+			// the uninstall script also kills k3s processes, similar to k3s-killall.sh
+			if err := guest.Run(script); err != nil {
+				return fmt.Errorf("error uninstalling k3s: %w", err)
+			}
+			return guest.RunQuiet("sudo", "rm", "-f", installRecordFile)
+		})
 	}
+
+	// rootless k3s
 	a.Add(func() error {
+		home := userHome(guest)
+		if home == "" || guest.RunQuiet("test", "-f", home+rootlessUnitFile) != nil {
+			return nil
+		}
+		if err := guest.Run("systemctl", "--user", "disable", "--now", rootlessService); err != nil {
+			return fmt.Errorf("error stopping rootless k3s: %w", err)
+		}
+		return guest.Run("rm", "-rf", home+rootlessUnitFile, home+rootlessDataDir, home+rootlessBinDir+"/k3s")
+	})
+}
+
+// defaultDataDir is the default k3s data directory.
+const defaultDataDir = "/var/lib/rancher/k3s"
+
+// dataDir returns the k3s data directory configured in conf or specified with the --data-dir flag.
+func dataDir(guest environment.GuestActions, conf config.Kubernetes) string {
+	if conf.DataDir != "" {
+		return conf.DataDir
+	}
+	if dir := dataDirArg(conf); dir != "" {
+		return dir
+	}
+	if conf.Rootless {
+		return userHome(guest) + rootlessDataDir
+	}
+	return defaultDataDir
+}
+
+// dataDirArg returns the data directory specified with the --data-dir flag in the k3s args of conf.
+func dataDirArg(conf config.Kubernetes) string {
+	return k3sArgValue(conf, "--data-dir", "-d")
+}
+
+// k3sArgValue returns the value of the last occurrence of any of the flag names in the k3s args.
+func k3sArgValue(conf config.Kubernetes, names ...string) string {
+	values := k3sArgValues(conf, names...)
+	if len(values) == 0 {
+		return ""
+	}
+	return values[len(values)-1]
+}
+
+// k3sArgValues returns the values of all occurrences of any of the flag names in the k3s args.
+func k3sArgValues(conf config.Kubernetes, names ...string) (values []string) {
+	args := append(append([]string{}, conf.K3sArgs...), conf.ExtraArgs...)
+	for i, arg := range args {
+		for _, name := range names {
+			switch {
+			case arg == name:
+				if i+1 < len(args) {
+					values = append(values, args[i+1])
+				}
+			case strings.HasPrefix(arg, name+"="):
+				values = append(values, strings.TrimPrefix(arg, name+"="))
+			}
+		}
+	}
+	return values
+}
+
+// hasK3sArg returns if the flag name is present in the k3s args.
+func hasK3sArg(conf config.Kubernetes, name string) bool {
+	for _, arg := range append(append([]string{}, conf.K3sArgs...), conf.ExtraArgs...) {
+		if arg == name || strings.HasPrefix(arg, name+"=") {
+			return true
+		}
+	}
+	return false
+}
+
+// downloadTimeout returns the timeout for a stalled download attempt of the k3s assets.
+func downloadTimeout(conf config.Kubernetes) time.Duration {
+	return time.Duration(conf.DownloadTimeout) * time.Second
+}
+
+// maxDownloadBufferSize is the maximum buffer size in KiB for copying the k3s assets to the VM.
+const maxDownloadBufferSize = 64 * 1024
+
+// downloadBufferSize returns the buffer size in bytes for copying the k3s assets to the VM.
+func downloadBufferSize(conf config.Kubernetes) int {
+	return conf.DownloadBufferSize * 1024
+}
+
+// k3sBinDir returns the directory of the k3s binary in the guest for conf.
+func k3sBinDir(guest environment.GuestActions, conf config.Kubernetes) string {
+	if conf.Rootless {
+		return userHome(guest) + rootlessBinDir
+	}
+	return "/usr/local/bin"
+}
+
+// airGapDir returns the directory for the k3s airgap images.
+func airGapDir(guest environment.GuestActions, conf config.Kubernetes) string {
+	return strings.TrimSuffix(dataDir(guest, conf), "/") + "/agent/images/"
+}
+
+func installK3sBinary(
+	host environment.HostActions,
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	downloads *downloadGroup,
+	conf config.Kubernetes,
+) {
+	downloadPath := "/tmp/k3s"
+	url := k3sBinaryURL(conf.Version, guest.Arch())
+	shaURL := k3sShaURL(conf.Version, guest.Arch())
+	downloads.add(a, func() error {
+		sha, err := assetSHA(conf, checksumKey(assetK3s, conf.Version, guest.Arch().GoArch()), &downloader.SHA{Size: 256, URL: shaURL})
+		if err != nil {
+			return downloadErr("k3s", err)
+		}
 		r := downloader.Request{
-			URL:      url,
-			Filename: downloadPath,
-			SHA:      &downloader.SHA{Size: 256, URL: shaURL},
+			URL:        url,
+			Filename:   downloadPath,
+			SHA:        sha,
+			UserAgent:  conf.UserAgent,
+			Timeout:    downloadTimeout(conf),
+			BufferSize: downloadBufferSize(conf),
+		}
+		if restoreGuestCache(a, guest, conf, r) {
+			return nil
 		}
-		return downloader.Download(host, guest, r)
+		return downloadAsset(a, host, guest, conf, "k3s", r)
 	})
+	if conf.Rootless {
+		a.Add(func() error {
+			return installErr("k3s", guest.Run("mkdir", "-p", k3sBinDir(guest, conf)))
+		})
+	}
 	a.Add(func() error {
-		return guest.Run("sudo", "install", downloadPath, "/usr/local/bin/k3s")
+		return installErr("k3s", guest.Run(sudo(conf, "install", downloadPath, k3sBinDir(guest, conf)+"/k3s")...))
 	})
+	downloads.keep(downloadPath)
 }
 
 func installK3sCache(
 	host environment.HostActions,
 	guest environment.GuestActions,
 	a *cli.ActiveCommandChain,
+	downloads *downloadGroup,
 	log *logrus.Entry,
 	containerRuntime string,
-	k3sVersion string,
+	conf config.Kubernetes,
 ) {
-	baseURL := "https://github.com/k3s-io/k3s/releases/download/" + k3sVersion + "/"
-	imageTar := "k3s-airgap-images-" + guest.Arch().GoArch() + ".tar"
-	shaSumTxt := "sha256sum-" + guest.Arch().GoArch() + ".txt"
-	imageTarGz := imageTar + ".gz"
-	downloadPathTar := "/tmp/" + imageTar
-	downloadPathTarGz := "/tmp/" + imageTarGz
-	url := baseURL + imageTarGz
-	shaURL := baseURL + shaSumTxt
+	url := airgapImagesURL(conf, guest.Arch())
+	shaKey := checksumKey(assetAirgapImages, conf.Version, guest.Arch().GoArch())
+	published := &downloader.SHA{Size: 256, URL: k3sShaURL(conf.Version, guest.Arch())}
+	// the published sha sums are looked up by the name of the release asset
+	releaseURL := k3sAirgapImagesURL(conf.Version, guest.Arch())
+	if path.Base(url) != path.Base(releaseURL) {
+		published = nil
+	}
+	// the name of the release asset regardless of the url, the images are a compressed tar
+	downloadPathTarGz := "/tmp/" + path.Base(releaseURL)
+	downloadPathTar := strings.TrimSuffix(downloadPathTarGz, ".gz")
+
+	// containerd imports the images streamed from the compressed tar without
+	// decompressing it to disk, k3s also imports compressed tars in the airgap dir.
+	if containerRuntime == containerd.Name && !conf.Rootless {
+		downloads.add(a, func() error {
+			sha, err := assetSHA(conf, shaKey, published)
+			if err != nil {
+				return downloadErr("airgap images", err)
+			}
+			r := downloader.Request{
+				URL:        url,
+				Filename:   downloadPathTarGz,
+				SHA:        sha,
+				UserAgent:  conf.UserAgent,
+				Timeout:    downloadTimeout(conf),
+				BufferSize: downloadBufferSize(conf),
+			}
+			if restoreGuestCache(a, guest, conf, r) {
+				return nil
+			}
+			return downloadAsset(a, host, guest, conf, "airgap images", r)
+		})
+		downloads.keep(downloadPathTarGz)
+		downloadPathTar = downloadPathTarGz
+	} else {
+		installK3sCacheTar(host, guest, a, downloads, conf, url, shaKey, published, downloadPathTarGz)
+	}
+
 	a.Add(func() error {
-		r := downloader.Request{
-			URL:      url,
-			Filename: downloadPathTarGz,
-			SHA:      &downloader.SHA{Size: 256, URL: shaURL},
-		}
-		return downloader.Download(host, guest, r)
+		return installErr("airgap images", guest.Run(sudo(conf, "mkdir", "-p", airGapDir(guest, conf))...))
 	})
 	a.Add(func() error {
-		return guest.Run("gzip", "-f", "-d", downloadPathTarGz)
+		return installErr("airgap images", guest.Run(sudo(conf, "cp", downloadPathTar, airGapDir(guest, conf))...))
 	})
 
-	airGapDir := "/var/lib/rancher/k3s/agent/images/"
+	loadImages(guest, a, log, containerRuntime, downloadPathTar, conf)
+}
+
+// installK3sCacheTar downloads the compressed airgap images to tarGz and decompresses it.
+func installK3sCacheTar(
+	host environment.HostActions,
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	downloads *downloadGroup,
+	conf config.Kubernetes,
+	url, shaKey string,
+	published *downloader.SHA,
+	tarGz string,
+) {
+	downloadPathTarGz := tarGz
+
+	downloads.add(a, func() error {
+		sha, err := assetSHA(conf, shaKey, published)
+		if err != nil {
+			return downloadErr("airgap images", err)
+		}
+		r := downloader.Request{
+			URL:        url,
+			Filename:   downloadPathTarGz,
+			SHA:        sha,
+			UserAgent:  conf.UserAgent,
+			Timeout:    downloadTimeout(conf),
+			BufferSize: downloadBufferSize(conf),
+		}
+		if restoreGuestCache(a, guest, conf, r) {
+			return nil
+		}
+		return downloadAsset(a, host, guest, conf, "airgap images", r)
+	})
+	// the compressed tar is kept for the guest cache, it is verified against its sha sum on restore
 	a.Add(func() error {
-		return guest.Run("sudo", "mkdir", "-p", airGapDir)
+		return installErr("airgap images", guest.Run("gzip", "-f", "-d", "-k", downloadPathTarGz))
 	})
+	downloads.keep(downloadPathTarGz)
+}
+
+// installImageTars copies the image tars on the host to the airgap images directory
+// and loads them in the container runtime.
+func installImageTars(
+	host environment.HostActions,
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	downloads *downloadGroup,
+	log *logrus.Entry,
+	containerRuntime string,
+	conf config.Kubernetes,
+) {
+	if len(conf.ImageTars) == 0 {
+		return
+	}
+
 	a.Add(func() error {
-		return guest.Run("sudo", "cp", downloadPathTar, airGapDir)
+		return installErr("image tars", guest.Run(sudo(conf, "mkdir", "-p", airGapDir(guest, conf))...))
 	})
 
-	// load OCI images for K3s
-	// this can be safely ignored if failed as the images would be pulled afterwards.
-	switch containerRuntime {
-	case containerd.Name:
-		a.Stage("loading oci images")
-		a.Add(func() error {
-			if err := guest.Run("sudo", "nerdctl", "-n", "k8s.io", "load", "-i", downloadPathTar, "--all-platforms"); err != nil {
-				log.Warnln(fmt.Errorf("error loading oci images: %w", err))
-				log.Warnln("startup may delay a bit as images will be pulled from oci registry")
+	// the imports are independent of each other, bounded to not overwhelm the runtime
+	imports := &downloadGroup{limit: conf.ImageImports}
+	for _, tar := range conf.ImageTars {
+		tar := tar
+		downloadPath := "/tmp/" + filepath.Base(tar)
+		downloads.add(a, func() error {
+			location, err := util.CleanPath(tar)
+			if err != nil {
+				return fmt.Errorf("invalid image tar '%s': %w", tar, err)
+			}
+			r := downloader.Request{URL: strings.TrimSuffix(location, "/"), Filename: downloadPath, BufferSize: downloadBufferSize(conf)}
+			if err := downloader.Download(host, guest, r); err != nil {
+				return downloadErr("image tar "+tar, fmt.Errorf("it must be within a mounted directory: %w", err))
 			}
 			return nil
 		})
-	case docker.Name:
-		a.Stage("loading oci images")
-		a.Add(func() error {
-			if err := guest.Run("sudo", "docker", "load", "-i", downloadPathTar); err != nil {
-				log.Warnln(fmt.Errorf("error loading oci images: %w", err))
-				log.Warnln("startup may delay a bit as images will be pulled from oci registry")
+		imports.add(a, func() error {
+			if err := guest.Run(sudo(conf, "cp", downloadPath, airGapDir(guest, conf))...); err != nil {
+				return installErr("image tar "+tar, err)
+			}
+			if cmd := loadImagesCmd(containerRuntime, downloadPath, conf); cmd != nil {
+				if err := guest.Run(cmd...); err != nil {
+					log.Warnln(fmt.Errorf("error loading oci images from %s: %w", tar, err))
+					log.Warnln("startup may delay a bit as images will be pulled from oci registry")
+				}
 			}
 			return nil
 		})
 	}
+
+	a.Stage("importing image tars")
+	a.Add(imports.run)
 }
 
-func installK3sCluster(
-	host environment.HostActions,
+// loadImages loads the OCI images in tarPath for k3s.
+// This can be safely ignored if failed as the images would be pulled afterwards.
+func loadImages(
 	guest environment.GuestActions,
 	a *cli.ActiveCommandChain,
+	log *logrus.Entry,
 	containerRuntime string,
-	k3sVersion string,
-	k3sArgs []string,
+	tarPath string,
+	conf config.Kubernetes,
 ) {
-	// install k3s last to ensure it is the last step
-	downloadPath := "/tmp/k3s-install.sh"
-	url := "https://raw.githubusercontent.com/k3s-io/k3s/" + k3sVersion + "/install.sh"
-	a.Add(func() error {
-		r := downloader.Request{URL: url, Filename: downloadPath}
-		return downloader.Download(host, guest, r)
-	})
+	cmd := loadImagesCmd(containerRuntime, tarPath, conf)
+	if cmd == nil {
+		return
+	}
+
+	a.Stage("loading oci images")
 	a.Add(func() error {
-		return guest.Run("sudo", "install", downloadPath, "/usr/local/bin/k3s-install.sh")
+		if err := guest.Run(cmd...); err != nil {
+			log.Warnln(fmt.Errorf("error loading oci images: %w", err))
+			log.Warnln("startup may delay a bit as images will be pulled from oci registry")
+		}
+		return nil
 	})
+}
 
-	args := append([]string{
-		"--write-kubeconfig-mode", "644",
-	}, k3sArgs...)
+// loadImagesCmd returns the command to load the OCI images in tarPath for k3s,
+// or nil if the images are not loaded for the runtime.
+func loadImagesCmd(containerRuntime, tarPath string, conf config.Kubernetes) []string {
+	// the airgap images are imported by the embedded containerd of rootless k3s
+	if conf.Rootless {
+		return nil
+	}
+
+	switch containerRuntime {
+	case containerd.Name:
+		cmd := []string{"nerdctl", "-n", "k8s.io", "load", "-i", tarPath, "--all-platforms"}
+		if strings.HasSuffix(tarPath, ".gz") {
+			// stream the decompressed tar
+			cmd = []string{"sh", "-c", "gzip -dc " + tarPath + " | nerdctl -n k8s.io load --all-platforms"}
+		}
+		return sudo(conf, cmd...)
+	case docker.Name:
+		return sudo(conf, "docker", "load", "-i", tarPath)
+	}
+	return nil
+}
+
+// k3sArgsEnv are the values of the k3s args resolved from the VM.
+type k3sArgsEnv struct {
+	ipAddress        string // reachable address of the VM, 127.0.0.1 if none
+	dataDir          string // k3s data directory
+	containerdSocket string // containerd socket, only used by the containerd runtime
+}
+
+// k3sArgs returns the args k3s is installed with for conf and the container runtime.
+// It has no side effects, the VM specific values are resolved in env.
+func k3sArgs(conf config.Kubernetes, containerRuntime string, env k3sArgsEnv) []string {
+	labelArgs, _ := nodeLabelArgs(conf.NodeLabels)
+	evictionArgs, _ := evictionArgs(conf.Eviction)
+	logArgs, _ := containerLogArgs(conf)
+	reservedArgs, _ := reservedArgs(conf)
+	componentArgs, _ := componentArgs(conf)
+	featureGateArgs, _ := featureGateArgs(conf)
+
+	var args []string
+	if isAgent(conf) {
+		// server only flags are not valid for an agent
+		args = agentArgs(conf.K3sArgs)
+	} else {
+		args = append([]string{"--write-kubeconfig-mode", "644"}, conf.K3sArgs...)
+	}
+	if ingressControllerEnabled(conf, "traefik") {
+		args = enableTraefik(args)
+	}
+	args = append(args, conf.ExtraArgs...)
+	if conf.DataDir != "" {
+		args = append(args, "--data-dir", conf.DataDir)
+	}
+	args = append(args, serverArgs(conf)...)
+	if conf.LocalStoragePath != "" {
+		args = append(args, "--default-local-storage-path", conf.LocalStoragePath)
+	}
+	args = append(args, etcdSnapshotArgs(conf)...)
+	args = append(args, labelArgs...)
+	args = append(args, evictionArgs...)
+	args = append(args, reservedArgs...)
+	args = append(args, logArgs...)
+	args = append(args, componentArgs...)
+	args = append(args, featureGateArgs...)
 
 	// replace ip address if networking is enabled
-	ipAddress := limautil.IPAddress(config.CurrentProfile().ID)
+	ipAddress := env.ipAddress
 	if ipAddress == "127.0.0.1" {
 		args = append(args, "--flannel-iface", "eth0")
 	} else {
+		args = append(args, "--flannel-iface", vmnet.NetInterface)
+	}
+
+	// the configured node ip takes precedence over the discovered address
+	if conf.NodeIP != "" {
+		args = append(args, "--node-ip", conf.NodeIP)
+		ipAddress = conf.NodeIP
+	}
+	if ipAddress != "127.0.0.1" && !isAgent(conf) {
 		args = append(args, "--bind-address", ipAddress)
 		args = append(args, "--advertise-address", ipAddress)
-		args = append(args, "--flannel-iface", vmnet.NetInterface)
 	}
 
-	switch containerRuntime {
-	case docker.Name:
+	if conf.KubeProxyMode != "" {
+		args = append(args, "--kube-proxy-arg", "proxy-mode="+conf.KubeProxyMode)
+	}
+	if podSecurityEnabled(conf) {
+		args = append(args, "--kube-apiserver-arg", "admission-control-config-file="+env.dataDir+podSecurityFile)
+	}
+
+	// rootless k3s uses the embedded containerd
+	if conf.Rootless {
+		return args
+	}
+
+	// the configured endpoint takes precedence over the default of the runtime
+	switch {
+	case conf.RuntimeEndpoint != "":
+		args = append(args, "--container-runtime-endpoint", conf.RuntimeEndpoint)
+	case containerRuntime == docker.Name:
 		args = append(args, "--docker")
-	case containerd.Name:
-		args = append(args, "--container-runtime-endpoint", "unix:///run/containerd/containerd.sock")
+	case containerRuntime == containerd.Name:
+		args = append(args, "--container-runtime-endpoint", "unix://"+env.containerdSocket)
+	}
+	return args
+}
+
+func installK3sCluster(
+	host environment.HostActions,
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	downloads *downloadGroup,
+	containerRuntime string,
+	conf config.Kubernetes,
+) {
+	// the VM specific values are resolved when the steps run, after the preceding steps
+	var argsOnce sync.Once
+	var args []string
+	resolveArgs := func() []string {
+		argsOnce.Do(func() {
+			env := k3sArgsEnv{
+				ipAddress: limautil.IPAddress(config.CurrentProfile().ID),
+				dataDir:   dataDir(guest, conf),
+			}
+			if conf.RuntimeEndpoint == "" && containerRuntime == containerd.Name && !conf.Rootless {
+				env.containerdSocket = containerdSocket(guest, conf)
+			}
+			args = k3sArgs(conf, containerRuntime, env)
+		})
+		return args
+	}
+
+	if conf.KubeProxyMode == "ipvs" {
+		a.Add(func() error {
+			if err := guest.Run(sudo(conf, append([]string{"modprobe", "-a"}, ipvsModules...)...)...); err != nil {
+				return fmt.Errorf("error loading ipvs kernel modules: %w", err)
+			}
+			return nil
+		})
+	}
+
+	// custom upstreams for CoreDNS, the manifest is auto-deployed by k3s on startup
+	if len(conf.DNSUpstreams) > 0 {
+		a.Add(func() error {
+			b, err := corednsCustomYAML(conf)
+			if err != nil {
+				return err
+			}
+			return guest.Write(corednsCustomManifestFile(guest, conf), b)
+		})
+	}
+
+	// hostnames not resolvable by DNS e.g. a registry mirror, required before images are pulled
+	if len(conf.Hosts) > 0 {
+		a.Add(func() error { return writeHosts(guest, conf.Hosts) })
+	}
+
+	// unknown gates may be valid for the k3s version, k3s fails to start otherwise
+	if unknown := unknownFeatureGates(conf.FeatureGates); len(unknown) > 0 {
+		a.Logger().Warnf("unknown feature gate(s) %s, k3s fails to start if not supported by %s", strings.Join(unknown, ", "), conf.Version)
+	}
+
+	// the images pulled by the containerd of k3s are mirrored through the pull-through cache
+	if conf.PullThroughCache != "" {
+		if !conf.Rootless {
+			a.Logger().Warnf("the pull-through cache applies to the containerd embedded in k3s, the %s runtime requires its own mirror config", containerRuntime)
+		}
+		a.Add(func() error {
+			b, err := registriesYAML(conf.PullThroughCache, conf.PullThroughRegistries)
+			if err != nil {
+				return err
+			}
+			return guest.Write(registriesK3sFile(guest, conf), b)
+		})
+	}
+
+	// the admission config is read by the apiserver on startup
+	if podSecurityEnabled(conf) {
+		a.Add(func() error {
+			b, err := podSecurityYAML(conf)
+			if err != nil {
+				return err
+			}
+			return guest.Write(podSecurityK3sFile(guest, conf), b)
+		})
+	}
+
+	// the manifests are auto-deployed by k3s on startup
+	for i, c := range conf.IngressControllers {
+		c, isDefault := c, i == 0
+		a.Add(func() error {
+			b, err := ingressManifestYAML(c, isDefault)
+			if err != nil {
+				return err
+			}
+			return guest.Write(ingressManifestFile(guest, conf, c.Name), b)
+		})
+	}
+
+	// rootless k3s uses the embedded containerd
+	if conf.Rootless {
+		installK3sRootlessCluster(guest, a, conf, resolveArgs)
+		return
+	}
+
+	env := "INSTALL_K3S_SKIP_DOWNLOAD=true INSTALL_K3S_SKIP_ENABLE=true"
+	if isAgent(conf) {
+		env += " INSTALL_K3S_EXEC=agent K3S_URL=" + util.ShellQuote(conf.Server) + " K3S_TOKEN=" + util.ShellQuote(conf.Token)
+	} else if conf.Token != "" {
+		env += " K3S_TOKEN=" + util.ShellQuote(conf.Token)
+	}
+	if extra := installEnv(conf); extra != "" {
+		env += " " + extra
+	}
+	installCmd := func() string { return env + " k3s-install.sh " + shellJoin(resolveArgs()) }
+
+	// the install script is skipped if k3s is installed with the same command,
+	// the config files written above are picked up when k3s is started.
+	var once sync.Once
+	var configured bool
+	isConfigured := func() bool {
+		once.Do(func() { configured = k3sConfigured(guest, conf, installCmd()) })
+		return configured
+	}
+
+	// install k3s last to ensure it is the last step
+	downloadPath := "/tmp/k3s-install.sh"
+	url := k3sInstallScriptURL(conf.Version)
+	downloads.add(a, func() error {
+		if isConfigured() {
+			return nil
+		}
+		// the install script has no published checksum
+		sha, err := assetSHA(conf, checksumKey(assetInstallScript, conf.Version, ""), nil)
+		if err != nil {
+			return downloadErr("k3s install script", err)
+		}
+		r := downloader.Request{URL: url, Filename: downloadPath, SHA: sha, UserAgent: conf.UserAgent, Timeout: downloadTimeout(conf), BufferSize: downloadBufferSize(conf)}
+		if restoreGuestCache(a, guest, conf, r) {
+			return nil
+		}
+		return downloadAsset(a, host, guest, conf, "k3s install script", r)
+	})
+	a.Add(func() error {
+		if isConfigured() {
+			return nil
+		}
+		return installErr("k3s install script", guest.Run(sudo(conf, "install", downloadPath, "/usr/local/bin/k3s-install.sh")...))
+	})
+	downloads.keep(downloadPath)
+
+	a.Add(func() error {
+		if isConfigured() {
+			a.Logger().Println("k3s is installed with the same config, skipping the install script")
+			return nil
+		}
+		cmd := []string{installShell(conf), "-c", installCmd()}
+		// the install script escalates with sudo unless run as root
+		if conf.SudoCommand != "" {
+			cmd = sudo(conf, cmd...)
+		}
+		if err := guest.Run(cmd...); err != nil {
+			// the command is included in the error
+			return ErrClusterBootstrap{Err: maskedErr{err: err, secrets: installSecrets(conf)}}
+		}
+		return recordInstall(guest, installCmd())
+	})
+}
+
+// shellJoin returns args as the words of a shell command line, each quoted with util.ShellQuote.
+// The args are stored unquoted and only quoted here, as values may contain characters special to the shell.
+func shellJoin(args []string) string {
+	quoted := make([]string, len(args))
+	for i, arg := range args {
+		quoted[i] = util.ShellQuote(arg)
+	}
+	return strings.Join(quoted, " ")
+}
+
+// sudo returns args prefixed with the privilege escalation command in conf.
+// sudo is used if none is configured, args are returned as-is for rootless k3s.
+func sudo(conf config.Kubernetes, args ...string) []string {
+	if conf.Rootless {
+		return args
+	}
+	cmd := strings.Fields(conf.SudoCommand)
+	if len(cmd) == 0 {
+		cmd = []string{"sudo"}
+	}
+	return append(cmd, args...)
+}
+
+// installShell returns the shell running the k3s install script in conf, sh if none is configured.
+func installShell(conf config.Kubernetes) string {
+	if conf.Shell == "" {
+		return "sh"
+	}
+	return conf.Shell
+}
+
+// shellRegex matches a shell name or path without arguments e.g. bash or /bin/bash.
+var shellRegex = regexp.MustCompile(`^[A-Za-z0-9_./-]+$`)
+
+// maxImageImports is the maximum number of image tars imported concurrently.
+const maxImageImports = 8
+
+// ipvsModules are the kernel modules required by kube-proxy in ipvs mode.
+var ipvsModules = []string{"ip_vs", "ip_vs_rr", "ip_vs_wrr", "ip_vs_sh", "nf_conntrack"}
+
+// validateK3sConfig validates the user specified k3s settings in conf.
+func validateK3sConfig(conf config.Kubernetes) error {
+	if err := validateRole(conf); err != nil {
+		return err
+	}
+	if conf.DataDir != "" {
+		if !filepath.IsAbs(conf.DataDir) {
+			return fmt.Errorf("invalid data dir '%s', must be an absolute path", conf.DataDir)
+		}
+		if dir := dataDirArg(conf); dir != "" {
+			return fmt.Errorf("data dir is configured and also specified with k3s args as '%s'", dir)
+		}
+	}
+	if conf.NodeIP != "" && net.ParseIP(conf.NodeIP) == nil {
+		return fmt.Errorf("invalid node ip '%s'", conf.NodeIP)
+	}
+	if err := validateDNSUpstreams(conf); err != nil {
+		return err
+	}
+	switch conf.KubeProxyMode {
+	case "", "iptables", "ipvs":
+	default:
+		return fmt.Errorf("invalid kube-proxy mode '%s', must be one of iptables or ipvs", conf.KubeProxyMode)
+	}
+	if conf.Rootless && conf.KubeProxyMode == "ipvs" {
+		return fmt.Errorf("ipvs kube-proxy mode is not supported for rootless k3s")
+	}
+	if conf.RuntimeEndpoint != "" {
+		if path := strings.TrimPrefix(conf.RuntimeEndpoint, "unix://"); path == conf.RuntimeEndpoint || !strings.HasPrefix(path, "/") {
+			return fmt.Errorf("invalid runtime endpoint '%s', expected unix:///path/to/socket", conf.RuntimeEndpoint)
+		}
+		if conf.Rootless {
+			return fmt.Errorf("runtime endpoint is not supported for rootless k3s")
+		}
+	}
+	if err := validateHosts(conf.Hosts); err != nil {
+		return err
+	}
+	if err := validateLocalStoragePath(conf); err != nil {
+		return err
+	}
+	if err := validatePullThroughCache(conf); err != nil {
+		return err
+	}
+	if conf.Shell != "" {
+		if !shellRegex.MatchString(conf.Shell) {
+			return fmt.Errorf("invalid shell '%s', must be a shell name or path without arguments", conf.Shell)
+		}
+		if conf.Rootless {
+			return fmt.Errorf("shell is not supported for rootless k3s, the install script is not used")
+		}
+	}
+	if conf.Supervise && (conf.Rootless || isAgent(conf)) {
+		return fmt.Errorf("k3s supervision is only supported for a rootful k3s server")
+	}
+	if _, err := componentArgs(conf); err != nil {
+		return err
+	}
+	if _, err := featureGateArgs(conf); err != nil {
+		return err
+	}
+	if err := validateAirgapImagesURL(conf); err != nil {
+		return err
+	}
+	if err := validateEtcdSnapshots(conf.EtcdSnapshots); err != nil {
+		return err
+	}
+	if err := validatePodSecurity(conf); err != nil {
+		return err
+	}
+	if err := validateInstallEnv(conf); err != nil {
+		return err
+	}
+	if err := validateDefaultDeny(conf); err != nil {
+		return err
+	}
+	if err := validateIngressControllers(conf); err != nil {
+		return err
+	}
+	if err := validatePrePullImages(conf); err != nil {
+		return err
+	}
+	if err := validatePostStart(conf.PostStart); err != nil {
+		return err
+	}
+	if err := validateKubeconfig(conf); err != nil {
+		return err
+	}
+	if conf.DownloadBufferSize < 0 || conf.DownloadBufferSize > maxDownloadBufferSize {
+		return fmt.Errorf("invalid download buffer size %d, must be between 1 and %d KiB", conf.DownloadBufferSize, maxDownloadBufferSize)
+	}
+	if conf.DownloadRetries < 0 || conf.DownloadRetries > maxDownloadRetries {
+		return fmt.Errorf("invalid download retries %d, must be between 0 and %d", conf.DownloadRetries, maxDownloadRetries)
+	}
+	if conf.DownloadRetryInterval < 0 {
+		return fmt.Errorf("invalid download retry interval %d, must not be negative", conf.DownloadRetryInterval)
+	}
+	if conf.ImageImports < 0 || conf.ImageImports > maxImageImports {
+		return fmt.Errorf("invalid image imports %d, must be between 1 and %d", conf.ImageImports, maxImageImports)
+	}
+	if _, err := evictionArgs(conf.Eviction); err != nil {
+		return err
+	}
+	if _, err := containerLogArgs(conf); err != nil {
+		return err
+	}
+	if _, err := reservedArgs(conf); err != nil {
+		return err
+	}
+	_, err := nodeLabelArgs(conf.NodeLabels)
+	return err
+}
+
+// containerdSocket returns the path to the containerd socket in the guest.
+// The configured socket takes precedence over the grpc address in the containerd config.
+func containerdSocket(guest environment.GuestActions, conf config.Kubernetes) string {
+	if conf.ContainerdSocket != "" {
+		return strings.TrimPrefix(conf.ContainerdSocket, "unix://")
+	}
+
+	script := `awk '/^\[grpc\]/{f=1;next} /^\[/{f=0} f && $1=="address"{gsub(/"/,"",$3); print $3; exit}' ` + containerd.ConfigFile
+	if socket, err := guest.RunOutput(sudo(conf, "sh", "-c", script)...); err == nil && socket != "" {
+		return socket
+	}
+
+	return containerd.DefaultSocket
+}
+
+// guestCacheDir is the persistent directory in the guest for downloaded k3s assets.
+const guestCacheDir = "/var/cache/colima/k3s"
+
+func guestCacheFile(conf config.Kubernetes, filename string) string {
+	return filepath.Join(guestCacheDir, conf.Version, filepath.Base(filename))
+}
+
+// restoreGuestCache copies the cached asset of r in the guest to r.Filename.
+// The cached asset is verified against r.SHA, an invalid asset is downloaded again.
+// It returns true if the asset was restored and the download can be skipped.
+func restoreGuestCache(a *cli.ActiveCommandChain, guest environment.GuestActions, conf config.Kubernetes, r downloader.Request) bool {
+	if !conf.KeepAssets {
+		return false
+	}
+	cached := r
+	cached.Filename = guestCacheFile(conf, r.Filename)
+	if guest.RunQuiet("test", "-f", cached.Filename) != nil {
+		return false
+	}
+	if err := downloader.Verify(guest, cached); err != nil {
+		a.Logger().Warnln(fmt.Errorf("cached k3s asset '%s' is invalid, downloading again: %w", filepath.Base(r.Filename), err))
+		return false
+	}
+	return guest.RunQuiet("cp", cached.Filename, r.Filename) == nil
+}
+
+// saveGuestCache adds a step to a to persist the assets kept in downloads in the guest cache.
+// It is added after the install steps, the assets are only cached for a completed install.
+func saveGuestCache(guest environment.GuestActions, a *cli.ActiveCommandChain, conf config.Kubernetes, downloads *downloadGroup) {
+	if !conf.KeepAssets || downloads == nil {
+		return
 	}
 	a.Add(func() error {
-		return guest.Run("sh", "-c", "INSTALL_K3S_SKIP_DOWNLOAD=true INSTALL_K3S_SKIP_ENABLE=true k3s-install.sh "+strings.Join(args, " "))
+		for _, filename := range downloads.kept {
+			// the asset is not downloaded if its install is skipped
+			if guest.RunQuiet("test", "-f", filename) != nil {
+				continue
+			}
+			dir := filepath.Dir(guestCacheFile(conf, filename))
+			if err := guest.RunQuiet(sudo(conf, "mkdir", "-p", dir)...); err != nil {
+				return cli.ErrNonFatal(fmt.Errorf("error creating k3s asset cache dir: %w", err))
+			}
+			if err := guest.RunQuiet(sudo(conf, "cp", filename, dir)...); err != nil {
+				return cli.ErrNonFatal(fmt.Errorf("error caching k3s asset '%s': %w", filename, err))
+			}
+		}
+		return nil
 	})
 }
@@ -0,0 +1,774 @@
+package kubernetes
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+	"github.com/abiosoft/colima/util/fsutil"
+)
+
+var _ environment.HostActions = (*fakeHost)(nil)
+
+type fakeHost struct {
+	sync.Mutex
+	commands []string
+	// onTransfer is called for each file transfer by curl.
+	onTransfer func()
+	env        map[string]string
+	files      map[string]string
+	// failures is the number of curl requests that fail with a transient error.
+	failures int
+}
+
+func (f *fakeHost) run(args ...string) error {
+	f.Lock()
+	defer f.Unlock()
+	f.commands = append(f.commands, strings.Join(args, " "))
+	return nil
+}
+
+func (f *fakeHost) Run(args ...string) error      { return f.run(args...) }
+func (f *fakeHost) RunQuiet(args ...string) error { return f.run(args...) }
+func (f *fakeHost) RunOutput(args ...string) (string, error) {
+	if args[0] == "curl" {
+		f.Lock()
+		failed := f.failures > 0
+		if failed {
+			f.failures--
+		}
+		f.Unlock()
+		if failed {
+			return "", errors.Join(f.run(args...), fmt.Errorf("connection reset by peer"))
+		}
+		if url := args[len(args)-1]; strings.Contains(url, "sha256sum") {
+			return fakeShaSums(url), f.run(args...)
+		}
+		// successful response for the download url
+		return "200 " + args[len(args)-1], f.run(args...)
+	}
+	return "", f.run(args...)
+}
+
+// fakeShaSums returns the contents of the shasum file at url, with a sum for the assets
+// listed in the file.
+func fakeShaSums(url string) string {
+	var files []string
+	if strings.HasSuffix(url, ".sha256sum") {
+		files = []string{path.Base(strings.TrimSuffix(url, ".sha256sum"))}
+	} else {
+		for _, arch := range []string{"amd64", "arm64"} {
+			files = append(files, "k3s-"+arch, "k3s-airgap-images-"+arch+".tar.gz", "k3s-airgap-images-"+arch+".tar.zst")
+		}
+		files = append(files, "k3s")
+	}
+	var sums string
+	for _, file := range files {
+		sums += "abc  " + file + "\n"
+	}
+	return sums
+}
+
+func (f *fakeHost) RunInteractive(args ...string) error {
+	if args[0] == "curl" && f.onTransfer != nil {
+		f.onTransfer()
+	}
+	return f.run(args...)
+}
+func (f *fakeHost) RunWith(stdin io.Reader, stdout io.Writer, args ...string) error {
+	return f.run(args...)
+}
+func (f *fakeHost) Read(fileName string) (string, error)      { return f.files[fileName], nil }
+func (f *fakeHost) Write(string, []byte) error                { return nil }
+func (f *fakeHost) Stat(string) (os.FileInfo, error)          { return nil, os.ErrNotExist }
+func (f *fakeHost) WithEnv(...string) environment.HostActions { return f }
+func (f *fakeHost) WithDir(string) environment.HostActions    { return f }
+func (f *fakeHost) Env(s string) string                       { return f.env[s] }
+
+var _ environment.GuestActions = (*fakeGuest)(nil)
+
+type fakeGuest struct {
+	sync.Mutex
+	commands []string
+	// outputs maps command prefixes to the output of RunOutput.
+	outputs map[string]string
+	// errs maps command prefixes to errors returned for the command.
+	errs  map[string]error
+	files map[string]string
+	// onRun is called for each command before it is recorded.
+	onRun func(cmd string)
+	// store is the state of Get and Set.
+	store map[string]string
+}
+
+func (f *fakeGuest) run(args ...string) (string, error) {
+	cmd := strings.Join(args, " ")
+	if f.onRun != nil {
+		f.onRun(cmd)
+	}
+	f.Lock()
+	defer f.Unlock()
+	f.commands = append(f.commands, cmd)
+	for prefix, err := range f.errs {
+		if strings.HasPrefix(cmd, prefix) {
+			return "", err
+		}
+	}
+	// the sha sums of the cached assets verified in the guest
+	if url := args[len(args)-1]; args[0] == "curl" && strings.Contains(url, "sha256sum") {
+		return fakeShaSums(url), nil
+	}
+	for prefix, out := range f.outputs {
+		if strings.HasPrefix(cmd, prefix) {
+			return out, nil
+		}
+	}
+	return "", nil
+}
+
+func (f *fakeGuest) Run(args ...string) error      { _, err := f.run(args...); return err }
+func (f *fakeGuest) RunQuiet(args ...string) error { _, err := f.run(args...); return err }
+func (f *fakeGuest) RunOutput(args ...string) (string, error) {
+	return f.run(args...)
+}
+func (f *fakeGuest) RunInteractive(args ...string) error { _, err := f.run(args...); return err }
+func (f *fakeGuest) RunWith(stdin io.Reader, stdout io.Writer, args ...string) error {
+	_, err := f.run(args...)
+	return err
+}
+func (f *fakeGuest) Read(fileName string) (string, error) { return f.files[fileName], nil }
+func (f *fakeGuest) Write(fileName string, body []byte) error {
+	if f.files == nil {
+		f.files = map[string]string{}
+	}
+	f.files[fileName] = string(body)
+	return nil
+}
+func (f *fakeGuest) Stat(string) (os.FileInfo, error)           { return nil, os.ErrNotExist }
+func (f *fakeGuest) Start(context.Context, config.Config) error { return nil }
+func (f *fakeGuest) Stop(context.Context, bool) error           { return nil }
+func (f *fakeGuest) Restart(context.Context) error              { return nil }
+func (f *fakeGuest) SSH(string, ...string) error                { return nil }
+func (f *fakeGuest) Created() bool                              { return true }
+func (f *fakeGuest) Running(context.Context) bool               { return true }
+func (f *fakeGuest) Env(s string) (string, error) {
+	if s == "HOME" {
+		return "/home/user.linux", nil
+	}
+	return "", nil
+}
+func (f *fakeGuest) Get(key string) string {
+	f.Lock()
+	defer f.Unlock()
+	return f.store[key]
+}
+func (f *fakeGuest) Set(key, value string) error {
+	f.Lock()
+	defer f.Unlock()
+	if f.store == nil {
+		f.store = map[string]string{}
+	}
+	f.store[key] = value
+	return nil
+}
+func (f *fakeGuest) User() (string, error)  { return "user", nil }
+func (f *fakeGuest) Arch() environment.Arch { return environment.X8664 }
+
+// hasCommand returns the first command that contains all of substrs.
+// quoted returns args as quoted by the install command, for args without single quotes.
+func quoted(args ...string) string { return "'" + strings.Join(args, "' '") + "'" }
+
+func (f *fakeGuest) hasCommand(substrs ...string) (string, bool) {
+	for _, cmd := range f.commands {
+		found := true
+		for _, s := range substrs {
+			if !strings.Contains(cmd, s) {
+				found = false
+				break
+			}
+		}
+		if found {
+			return cmd, true
+		}
+	}
+	return "", false
+}
+
+// installInstalledK3s adds the steps for an installed k3s as in Provision, validation included.
+func installInstalledK3s(host environment.HostActions, guest environment.GuestActions, a *cli.ActiveCommandChain, containerRuntime string, conf config.Kubernetes) {
+	if installK3sPrerequisites(host, guest, a, containerRuntime, conf) {
+		installK3sCluster(host, guest, a, nil, containerRuntime, conf)
+	}
+}
+
+func newTestChain() *cli.ActiveCommandChain {
+	fsutil.FS = fsutil.FakeFS
+	return cli.New("test").Init(context.WithValue(context.Background(), cli.CtxKeyQuiet, true))
+}
+
+func Test_installK3sCluster_containerdSocket(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		outputs map[string]string
+		want    string
+	}{
+		{name: "default", want: "unix://" + containerd.DefaultSocket},
+		{
+			name:    "containerd config",
+			outputs: map[string]string{"sudo sh -c awk": "/run/containerd/colima.sock"},
+			want:    "unix:///run/containerd/colima.sock",
+		},
+		{
+			name:    "override",
+			conf:    config.Kubernetes{ContainerdSocket: "/run/custom/containerd.sock"},
+			outputs: map[string]string{"sudo sh -c awk": "/run/containerd/colima.sock"},
+			want:    "unix:///run/custom/containerd.sock",
+		},
+		{
+			name: "override with scheme",
+			conf: config.Kubernetes{ContainerdSocket: "unix:///run/custom/containerd.sock"},
+			want: "unix:///run/custom/containerd.sock",
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &fakeGuest{outputs: tt.outputs}
+			a := newTestChain()
+			installK3sCluster(&fakeHost{}, guest, a, nil, containerd.Name, tt.conf)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := guest.hasCommand("k3s-install.sh", quoted("--container-runtime-endpoint", tt.want)); !ok {
+				t.Errorf("install command with runtime endpoint %s not found in %+v", tt.want, guest.commands)
+			}
+		})
+	}
+}
+
+func Test_installK3sCluster_resolvedOnExec(t *testing.T) {
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3sCluster(&fakeHost{}, guest, a, nil, containerd.Name, config.Kubernetes{})
+
+	// the containerd socket is looked up when the steps run, after containerd is provisioned
+	if len(guest.commands) != 0 {
+		t.Fatalf("unexpected guest commands before exec %+v", guest.commands)
+	}
+	guest.outputs = map[string]string{"sudo sh -c awk": "/run/containerd/colima.sock"}
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := guest.hasCommand("k3s-install.sh", quoted("--container-runtime-endpoint", "unix:///run/containerd/colima.sock")); !ok {
+		t.Errorf("install command with the resolved socket not found in %+v", guest.commands)
+	}
+}
+
+func Test_installK3sCluster_runtimeEndpoint(t *testing.T) {
+	const endpoint = "unix:///run/cri-dockerd/cri-dockerd.sock"
+	tests := []struct {
+		name     string
+		runtime  string
+		endpoint string
+		want     string
+		wantErr  bool
+	}{
+		{name: "docker default", runtime: docker.Name, want: quoted("--docker")},
+		{name: "docker override", runtime: docker.Name, endpoint: endpoint, want: quoted("--container-runtime-endpoint", endpoint)},
+		{name: "containerd override", runtime: containerd.Name, endpoint: endpoint, want: quoted("--container-runtime-endpoint", endpoint)},
+		{name: "no scheme", runtime: docker.Name, endpoint: "/run/cri-dockerd/cri-dockerd.sock", wantErr: true},
+		{name: "tcp", runtime: docker.Name, endpoint: "tcp://127.0.0.1:2375", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installInstalledK3s(&fakeHost{}, guest, a, tt.runtime, config.Kubernetes{RuntimeEndpoint: tt.endpoint})
+			err := a.Exec()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("installK3sCluster() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			install, ok := guest.hasCommand("k3s-install.sh", tt.want)
+			if !ok {
+				t.Fatalf("install command with %s not found in %+v", tt.want, guest.commands)
+			}
+			if tt.endpoint != "" && (strings.Contains(install, "--docker") || strings.Count(install, "--container-runtime-endpoint") != 1) {
+				t.Errorf("default runtime endpoint not overridden: %s", install)
+			}
+		})
+	}
+}
+
+func Test_installK3sBinary_guestCache(t *testing.T) {
+	conf := config.Kubernetes{Version: DefaultVersion, KeepAssets: true}
+	cachedBinary := guestCacheFile(conf, "/tmp/k3s")
+
+	tests := []struct {
+		name         string
+		errs         map[string]error
+		wantDownload bool
+	}{
+		{name: "hit"},
+		{name: "miss", errs: map[string]error{"test -f " + cachedBinary: os.ErrNotExist}, wantDownload: true},
+		{name: "invalid", errs: map[string]error{"sh -c cd '" + filepath.Dir(cachedBinary) + "/'": errors.New("checksum mismatch")}, wantDownload: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			host := &fakeHost{}
+			guest := &fakeGuest{errs: tt.errs}
+			a := newTestChain()
+			downloads := &downloadGroup{}
+			a.Add(downloads.run)
+			installK3sBinary(host, guest, a, downloads, conf)
+			saveGuestCache(guest, a, conf, downloads)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			downloaded := false
+			for _, cmd := range host.commands {
+				if strings.HasPrefix(cmd, "curl -L --fail") {
+					downloaded = true
+				}
+			}
+			if downloaded != tt.wantDownload {
+				t.Errorf("downloaded = %v, want %v", downloaded, tt.wantDownload)
+			}
+			if _, ok := guest.hasCommand("cp "+cachedBinary, "/tmp/k3s"); ok == tt.wantDownload {
+				t.Errorf("restored = %v, want %v: %+v", ok, !tt.wantDownload, guest.commands)
+			}
+			// the cache is saved once the install completed
+			indexOf := func(prefix string) int {
+				for i, cmd := range guest.commands {
+					if strings.HasPrefix(cmd, prefix) {
+						return i
+					}
+				}
+				return -1
+			}
+			install := indexOf("sudo install /tmp/k3s")
+			save := indexOf("sudo cp /tmp/k3s " + filepath.Dir(cachedBinary))
+			if install < 0 || save < install {
+				t.Errorf("k3s binary not saved to guest cache after the install: %+v", guest.commands)
+			}
+		})
+	}
+}
+
+func Test_installK3s_guestCacheFailedInstall(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	conf := config.Kubernetes{Version: DefaultVersion, KeepAssets: true}
+
+	guest := &fakeGuest{errs: map[string]error{
+		"test -f " + guestCacheDir:             os.ErrNotExist,
+		"sh -c INSTALL_K3S_SKIP_DOWNLOAD=true": errors.New("failed"),
+	}}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err == nil {
+		t.Fatal("expected the install to fail")
+	}
+
+	// the assets of a failed install are not cached
+	if cmd, ok := guest.hasCommand("sudo cp", guestCacheDir); ok {
+		t.Errorf("unexpected cache of a failed install: %s", cmd)
+	}
+}
+
+func Test_installK3s_imageTars(t *testing.T) {
+	tars := []string{"/Users/user/images/metallb.tar", "/Users/user/images/app.tar"}
+	conf := config.Kubernetes{Version: DefaultVersion, ImageTars: tars}
+
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	index := func(substrs ...string) int {
+		cmd, ok := guest.hasCommand(substrs...)
+		if !ok {
+			t.Fatalf("command with %v not found in %+v", substrs, guest.commands)
+		}
+		for i, c := range guest.commands {
+			if c == cmd {
+				return i
+			}
+		}
+		return -1
+	}
+
+	install := index("INSTALL_K3S_SKIP_DOWNLOAD=true")
+	for _, tar := range tars {
+		copied := index("cp "+tar, "/tmp/")
+		loaded := index("nerdctl -n k8s.io load -i /tmp/" + filepath.Base(tar))
+		if copied > loaded || loaded > install {
+			t.Errorf("image tar %s must be copied and loaded before install", tar)
+		}
+	}
+}
+
+func Test_installK3sCluster_nodeIP(t *testing.T) {
+	tests := []struct {
+		name    string
+		nodeIP  string
+		want    []string
+		wantErr bool
+	}{
+		// limautil falls back to the loopback address without a running instance
+		{name: "discovered", want: []string{quoted("--flannel-iface", "eth0")}},
+		{
+			name:   "override",
+			nodeIP: "192.168.106.2",
+			want: []string{
+				quoted("--node-ip", "192.168.106.2"),
+				quoted("--bind-address", "192.168.106.2"),
+				quoted("--advertise-address", "192.168.106.2"),
+			},
+		},
+		{name: "invalid", nodeIP: "192.168.106", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installInstalledK3s(&fakeHost{}, guest, a, containerd.Name, config.Kubernetes{NodeIP: tt.nodeIP})
+			err := a.Exec()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if _, ok := guest.hasCommand(append([]string{"INSTALL_K3S_SKIP_DOWNLOAD=true"}, tt.want...)...); !ok {
+				t.Errorf("install command with %v not found in %+v", tt.want, guest.commands)
+			}
+			if tt.nodeIP == "" {
+				if _, ok := guest.hasCommand("--node-ip"); ok {
+					t.Errorf("unexpected --node-ip in %+v", guest.commands)
+				}
+			}
+		})
+	}
+}
+
+func Test_airGapDir(t *testing.T) {
+	tests := []struct {
+		name string
+		conf config.Kubernetes
+		want string
+	}{
+		{name: "default", conf: config.Kubernetes{K3sArgs: []string{"--disable=traefik"}}, want: "/var/lib/rancher/k3s/agent/images/"},
+		{name: "flag with value", conf: config.Kubernetes{K3sArgs: []string{"--data-dir=/data/k3s"}}, want: "/data/k3s/agent/images/"},
+		{name: "separate value", conf: config.Kubernetes{K3sArgs: []string{"--data-dir", "/data/k3s/"}}, want: "/data/k3s/agent/images/"},
+		{name: "short flag", conf: config.Kubernetes{K3sArgs: []string{"-d", "/data/k3s"}}, want: "/data/k3s/agent/images/"},
+		{name: "extra args", conf: config.Kubernetes{ExtraArgs: []string{"--data-dir=/data/k3s"}}, want: "/data/k3s/agent/images/"},
+		{name: "config", conf: config.Kubernetes{DataDir: "/mnt/disk/k3s"}, want: "/mnt/disk/k3s/agent/images/"},
+		{name: "rootless", conf: config.Kubernetes{Rootless: true}, want: "/home/user.linux/.rancher/k3s/agent/images/"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := airGapDir(&fakeGuest{}, tt.conf); got != tt.want {
+				t.Errorf("airGapDir() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_installImageTars_dataDir(t *testing.T) {
+	conf := config.Kubernetes{
+		Version:   DefaultVersion,
+		K3sArgs:   []string{"--data-dir=/data/k3s"},
+		ImageTars: []string{"/Users/user/images/app.tar"},
+	}
+
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installImageTars(&fakeHost{}, guest, a, nil, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := guest.hasCommand("sudo cp /tmp/app.tar /data/k3s/agent/images/"); !ok {
+		t.Errorf("image tar not copied to custom data dir: %+v", guest.commands)
+	}
+}
+
+func Test_installK3sCache_stream(t *testing.T) {
+	tests := []struct {
+		runtime string
+		want    []string
+		unwant  []string
+	}{
+		{
+			runtime: containerd.Name,
+			want: []string{
+				"sudo sh -c gzip -dc /tmp/k3s-airgap-images-amd64.tar.gz | nerdctl -n k8s.io load --all-platforms",
+				"sudo cp /tmp/k3s-airgap-images-amd64.tar.gz /var/lib/rancher/k3s/agent/images/",
+			},
+			unwant: []string{"gzip -f -d"},
+		},
+		{
+			runtime: docker.Name,
+			want: []string{
+				"gzip -f -d -k /tmp/k3s-airgap-images-amd64.tar.gz",
+				"sudo docker load -i /tmp/k3s-airgap-images-amd64.tar",
+				"sudo cp /tmp/k3s-airgap-images-amd64.tar /var/lib/rancher/k3s/agent/images/",
+			},
+			unwant: []string{"gzip -dc"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.runtime, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3sCache(&fakeHost{}, guest, a, nil, a.Logger(), tt.runtime, config.Kubernetes{Version: DefaultVersion})
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+			for _, want := range tt.want {
+				if _, ok := guest.hasCommand(want); !ok {
+					t.Errorf("command %s not found in %+v", want, guest.commands)
+				}
+			}
+			for _, unwant := range tt.unwant {
+				if cmd, ok := guest.hasCommand(unwant); ok {
+					t.Errorf("unexpected command %s", cmd)
+				}
+			}
+		})
+	}
+}
+
+func Test_installK3s_dataDir(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		wantErr bool
+	}{
+		{name: "absolute", conf: config.Kubernetes{DataDir: "/mnt/disk/k3s"}},
+		{name: "shell characters", conf: config.Kubernetes{DataDir: "/mnt/my disk/k3s;touch /tmp/x"}},
+		{name: "relative", conf: config.Kubernetes{DataDir: "mnt/disk/k3s"}, wantErr: true},
+		{name: "also in args", conf: config.Kubernetes{DataDir: "/mnt/disk/k3s", K3sArgs: []string{"--data-dir=/data/k3s"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.Version = DefaultVersion
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+			err := a.Exec()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("installK3s() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			if _, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true", quoted("--data-dir", conf.DataDir)); !ok {
+				t.Errorf("install command with data dir not found in %+v", guest.commands)
+			}
+			if _, ok := guest.hasCommand("sudo cp /tmp/k3s-airgap-images-amd64.tar.gz " + conf.DataDir + "/agent/images/"); !ok {
+				t.Errorf("airgap images not copied to data dir: %+v", guest.commands)
+			}
+		})
+	}
+}
+
+func Test_installK3sCluster_kubeProxyMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		modules bool
+		wantErr bool
+	}{
+		{mode: ""},
+		{mode: "iptables"},
+		{mode: "ipvs", modules: true},
+		{mode: "nftables", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installInstalledK3s(&fakeHost{}, guest, a, containerd.Name, config.Kubernetes{KubeProxyMode: tt.mode})
+			err := a.Exec()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Exec() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			_, proxyArg := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true", quoted("--kube-proxy-arg", "proxy-mode="+tt.mode))
+			if proxyArg != (tt.mode != "") {
+				t.Errorf("kube-proxy arg = %v, want %v: %+v", proxyArg, tt.mode != "", guest.commands)
+			}
+			if _, modules := guest.hasCommand("sudo modprobe -a ip_vs"); modules != tt.modules {
+				t.Errorf("ipvs modules loaded = %v, want %v", modules, tt.modules)
+			}
+		})
+	}
+}
+
+func Test_uninstallK3s(t *testing.T) {
+	tests := []struct {
+		name      string
+		errs      map[string]error
+		uninstall string
+	}{
+		{name: "installed", errs: map[string]error{"command -v k3s-agent-uninstall.sh": os.ErrNotExist}, uninstall: "k3s-uninstall.sh"},
+		{name: "agent installed", errs: map[string]error{"command -v k3s-uninstall.sh": os.ErrNotExist}, uninstall: "k3s-agent-uninstall.sh"},
+		{name: "not installed", errs: map[string]error{"command -v": os.ErrNotExist, "test -f": os.ErrNotExist}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &fakeGuest{errs: tt.errs}
+			a := newTestChain()
+			uninstallK3s(guest, a)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			var invoked string
+			for _, cmd := range guest.commands {
+				if strings.HasSuffix(cmd, "uninstall.sh") && !strings.HasPrefix(cmd, "command") {
+					invoked = cmd
+				}
+			}
+			if invoked != tt.uninstall {
+				t.Errorf("uninstall invoked = %v, want %v", invoked, tt.uninstall)
+			}
+		})
+	}
+}
+
+func Test_installK3s_sudoCommand(t *testing.T) {
+	tests := []struct {
+		name    string
+		command string
+		want    string
+	}{
+		{name: "default", want: "sudo install /tmp/k3s /usr/local/bin/k3s"},
+		{name: "doas", command: "doas", want: "doas install /tmp/k3s /usr/local/bin/k3s"},
+		{name: "wrapper with args", command: "/usr/local/bin/escalate -n", want: "/usr/local/bin/escalate -n install /tmp/k3s /usr/local/bin/k3s"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			conf := config.Kubernetes{Version: DefaultVersion, SudoCommand: tt.command}
+
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			if _, ok := guest.hasCommand(tt.want); !ok {
+				t.Errorf("command %s not found in %+v", tt.want, guest.commands)
+			}
+			if tt.command != "" {
+				for _, cmd := range guest.commands {
+					if strings.HasPrefix(cmd, "sudo ") {
+						t.Errorf("unexpected sudo command: %s", cmd)
+					}
+				}
+				if _, ok := guest.hasCommand(tt.command + " sh -c INSTALL_K3S_SKIP_DOWNLOAD=true"); !ok {
+					t.Errorf("install script not run with %s: %+v", tt.command, guest.commands)
+				}
+			}
+		})
+	}
+}
+
+func Test_installK3s_shell(t *testing.T) {
+	tests := []struct {
+		name  string
+		shell string
+		want  string
+	}{
+		{name: "default", want: "sh -c INSTALL_K3S_SKIP_DOWNLOAD=true"},
+		{name: "bash", shell: "bash", want: "bash -c INSTALL_K3S_SKIP_DOWNLOAD=true"},
+		{name: "path", shell: "/bin/bash", want: "/bin/bash -c INSTALL_K3S_SKIP_DOWNLOAD=true"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			t.Setenv("XDG_CACHE_HOME", t.TempDir())
+			conf := config.Kubernetes{Version: DefaultVersion, Shell: tt.shell}
+
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			if cmd, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true"); !ok || !strings.HasPrefix(cmd, tt.want) {
+				t.Errorf("expected the install script run with %q, got %+v", tt.want, guest.commands)
+			}
+			if tt.shell != "" {
+				if _, ok := guest.hasCommand("command -v " + tt.shell); !ok {
+					t.Errorf("expected the shell to be checked in %+v", guest.commands)
+				}
+			}
+		})
+	}
+}
+
+func Test_installK3s_shellMissing(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	conf := config.Kubernetes{Version: DefaultVersion, Shell: "zsh"}
+
+	guest := &fakeGuest{errs: map[string]error{"command -v zsh": fmt.Errorf("exit status 1")}}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err == nil || !strings.Contains(err.Error(), "shell 'zsh'") {
+		t.Fatalf("expected a missing shell error, got %v", err)
+	}
+	if _, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true"); ok {
+		t.Errorf("unexpected install with a missing shell: %+v", guest.commands)
+	}
+}
+
+func Test_validateK3sConfig_shell(t *testing.T) {
+	tests := []struct {
+		conf    config.Kubernetes
+		wantErr bool
+	}{
+		{conf: config.Kubernetes{Shell: "bash"}},
+		{conf: config.Kubernetes{Shell: "/usr/bin/bash"}},
+		{conf: config.Kubernetes{Shell: "bash -e"}, wantErr: true},
+		{conf: config.Kubernetes{Shell: "sh;reboot"}, wantErr: true},
+		{conf: config.Kubernetes{Shell: "bash", Rootless: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.conf.Shell, func(t *testing.T) {
+			if err := validateK3sConfig(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("validateK3sConfig() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
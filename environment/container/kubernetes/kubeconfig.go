@@ -9,7 +9,9 @@ import (
 
 	"github.com/abiosoft/colima/cli"
 	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
 	"github.com/abiosoft/colima/environment/vm/lima/limautil"
+	"gopkg.in/yaml.v3"
 )
 
 const masterAddressKey = "master_address"
@@ -25,65 +27,51 @@ func (c kubernetesRuntime) provisionKubeconfig(ctx context.Context) error {
 
 	a.Stage("updating config")
 
-	// remove existing configs (if any)
-	// this is safe as the profile name is unique to colima
-	c.unsetKubeconfig(a)
-
-	// ensure host kube directory exists
-	hostHome := c.host.Env("HOME")
-	if hostHome == "" {
-		return fmt.Errorf("error retrieving home directory on host")
+	kconf := c.config()
+	name := kubeconfigContext(kconf)
+	kubeconfFile, err := hostKubeconfigFile(c.host, kconf)
+	if err != nil {
+		return err
 	}
 
+	// ensure host kube directory exists
 	profile := config.CurrentProfile().ID
-	hostKubeDir := filepath.Join(hostHome, ".kube")
+	backupDir := filepath.Join(filepath.Dir(kubeconfFile), "."+profile)
 	a.Add(func() error {
-		return c.host.Run("mkdir", "-p", filepath.Join(hostKubeDir, "."+profile))
+		return c.host.Run("mkdir", "-p", backupDir)
 	})
 
-	kubeconfFile := filepath.Join(hostKubeDir, "config")
-	tmpkubeconfFile := filepath.Join(hostKubeDir, "."+profile, "colima-temp")
-
-	// manipulate in VM and save to host
+	// merge on host, existing entries of the context are replaced
+	var merged []byte
 	a.Add(func() error {
-		kubeconfig, err := c.guest.Read("/etc/rancher/k3s/k3s.yaml")
+		kubeconfig, err := c.guest.Read(kubeconfigFile(c.guest, kconf))
 		if err != nil {
 			return fmt.Errorf("error fetching kubeconfig on guest: %w", err)
 		}
-		// replace name
-		kubeconfig = strings.ReplaceAll(kubeconfig, ": default", ": "+profile)
-
-		// save on the host
-		return c.host.Write(tmpkubeconfFile, []byte(kubeconfig))
-	})
-
-	// merge on host
-	a.Add(func() (err error) {
-		// prepare new host with right env var.
-		envVar := fmt.Sprintf("KUBECONFIG=%s:%s", kubeconfFile, tmpkubeconfFile)
-		host := c.host.WithEnv(envVar)
-
-		// get merged config
-		kubeconfig, err := host.RunOutput("kubectl", "config", "view", "--raw")
+		existing, err := c.host.Read(kubeconfFile)
 		if err != nil {
-			return err
+			// no existing kubeconfig
+			existing = ""
 		}
 
-		// save
-		return host.Write(tmpkubeconfFile, []byte(kubeconfig))
+		merged, err = mergeKubeconfig([]byte(existing), []byte(kubeconfig), name)
+		if err != nil {
+			return fmt.Errorf("error merging kubeconfig: %w", err)
+		}
+		return nil
 	})
 
 	// backup current settings and save new config
 	a.Add(func() error {
 		// backup existing file if exists
 		if stat, err := c.host.Stat(kubeconfFile); err == nil && !stat.IsDir() {
-			backup := filepath.Join(filepath.Dir(tmpkubeconfFile), fmt.Sprintf("config-bak-%d", time.Now().Unix()))
+			backup := filepath.Join(backupDir, fmt.Sprintf("config-bak-%d", time.Now().Unix()))
 			if err := c.host.Run("cp", kubeconfFile, backup); err != nil {
 				return fmt.Errorf("error backing up kubeconfig: %w", err)
 			}
 		}
 		// save new config
-		if err := c.host.Run("cp", tmpkubeconfFile, kubeconfFile); err != nil {
+		if err := c.host.Write(kubeconfFile, merged); err != nil {
 			return fmt.Errorf("error updating kubeconfig: %w", err)
 		}
 
@@ -94,7 +82,7 @@ func (c kubernetesRuntime) provisionKubeconfig(ctx context.Context) error {
 	conf, _ := ctx.Value(config.CtxKey()).(config.Config)
 	if conf.AutoActivate() {
 		a.Add(func() error {
-			out, err := c.host.RunOutput("kubectl", "config", "use-context", profile)
+			out, err := c.host.RunOutput("kubectl", "--kubeconfig", kubeconfFile, "config", "use-context", name)
 			if err != nil {
 				return err
 			}
@@ -112,22 +100,35 @@ func (c kubernetesRuntime) provisionKubeconfig(ctx context.Context) error {
 }
 
 func (c kubernetesRuntime) unsetKubeconfig(a *cli.ActiveCommandChain) {
-	profile := config.CurrentProfile().ID
+	kconf := c.config()
+	name := kubeconfigContext(kconf)
+	kubectl := func(args ...string) []string {
+		// the default kubeconfig is left to kubectl to respect $KUBECONFIG
+		if kconf.Kubeconfig == "" {
+			return append([]string{"kubectl"}, args...)
+		}
+		kubeconfFile, err := hostKubeconfigFile(c.host, kconf)
+		if err != nil {
+			return append([]string{"kubectl"}, args...)
+		}
+		return append([]string{"kubectl", "--kubeconfig", kubeconfFile}, args...)
+	}
+
 	a.Add(func() error {
-		return c.host.Run("kubectl", "config", "unset", "users."+profile)
+		return c.host.Run(kubectl("config", "unset", "users."+name)...)
 	})
 	a.Add(func() error {
-		return c.host.Run("kubectl", "config", "unset", "contexts."+profile)
+		return c.host.Run(kubectl("config", "unset", "contexts."+name)...)
 	})
 	a.Add(func() error {
-		return c.host.Run("kubectl", "config", "unset", "clusters."+profile)
+		return c.host.Run(kubectl("config", "unset", "clusters."+name)...)
 	})
 	// kubectl config unset current-context
 	a.Add(func() error {
-		if c, _ := c.host.RunOutput("kubectl", "config", "current-context"); c != config.CurrentProfile().ID {
+		if c, _ := c.host.RunOutput(kubectl("config", "current-context")...); c != name {
 			return nil
 		}
-		return c.host.Run("kubectl", "config", "unset", "current-context")
+		return c.host.Run(kubectl("config", "unset", "current-context")...)
 	})
 }
 
@@ -138,3 +139,110 @@ func (c kubernetesRuntime) teardownKubeconfig(a *cli.ActiveCommandChain) {
 		return c.guest.Set(masterAddressKey, "")
 	})
 }
+
+func validateKubeconfig(conf config.Kubernetes) error {
+	if file := conf.Kubeconfig; file != "" && !filepath.IsAbs(file) && !strings.HasPrefix(file, "~/") {
+		return fmt.Errorf("invalid kubeconfig '%s', must be an absolute path", file)
+	}
+	// the name is a path segment for kubectl config unset
+	if strings.ContainsAny(conf.Context, ". \t") {
+		return fmt.Errorf("invalid kubeconfig context '%s', must not contain dots or whitespace", conf.Context)
+	}
+	return nil
+}
+
+// kubeconfigContext returns the name of the context, cluster and user in the host kubeconfig for conf.
+func kubeconfigContext(conf config.Kubernetes) string {
+	if conf.Context != "" {
+		return conf.Context
+	}
+	return config.CurrentProfile().ID
+}
+
+// hostKubeconfigFile returns the kubeconfig file on the host to merge the k3s kubeconfig into.
+func hostKubeconfigFile(host environment.HostActions, conf config.Kubernetes) (string, error) {
+	home := host.Env("HOME")
+	if home == "" {
+		return "", fmt.Errorf("error retrieving home directory on host")
+	}
+
+	switch file := conf.Kubeconfig; {
+	case file == "":
+		return filepath.Join(home, ".kube", "config"), nil
+	case strings.HasPrefix(file, "~/"):
+		return filepath.Join(home, strings.TrimPrefix(file, "~/")), nil
+	default:
+		return file, nil
+	}
+}
+
+// HostKubectl returns the kubectl command with args for the cluster of conf on the host.
+func HostKubectl(host environment.HostActions, conf config.Kubernetes, args ...string) []string {
+	cmd := []string{"kubectl"}
+	if conf.Kubeconfig != "" {
+		if file, err := hostKubeconfigFile(host, conf); err == nil {
+			cmd = append(cmd, "--kubeconfig", file)
+		}
+	}
+	cmd = append(cmd, "--context", kubeconfigContext(conf))
+	return append(cmd, args...)
+}
+
+// kubeconfigEntries are the named lists of a kubeconfig.
+var kubeconfigEntries = []string{"clusters", "contexts", "users"}
+
+// mergeKubeconfig merges the single cluster, context and user of the k3s kubeconfig into
+// existing, renamed to name. Existing entries with the same name are replaced and other
+// entries are preserved.
+func mergeKubeconfig(existing, k3s []byte, name string) ([]byte, error) {
+	var dst, src map[string]any
+	if err := yaml.Unmarshal(existing, &dst); err != nil {
+		return nil, fmt.Errorf("error decoding existing kubeconfig: %w", err)
+	}
+	if err := yaml.Unmarshal(k3s, &src); err != nil {
+		return nil, fmt.Errorf("error decoding k3s kubeconfig: %w", err)
+	}
+
+	if dst == nil {
+		dst = map[string]any{}
+		for _, key := range []string{"apiVersion", "kind", "preferences"} {
+			if v, ok := src[key]; ok {
+				dst[key] = v
+			}
+		}
+	}
+
+	for _, key := range kubeconfigEntries {
+		var entries []any
+		for _, e := range kubeconfigList(dst, key) {
+			if entry, ok := e.(map[string]any); ok && entry["name"] == name {
+				continue
+			}
+			entries = append(entries, e)
+		}
+		for _, e := range kubeconfigList(src, key) {
+			entry, ok := e.(map[string]any)
+			if !ok {
+				continue
+			}
+			entry["name"] = name
+			if ctx, ok := entry["context"].(map[string]any); ok {
+				ctx["cluster"] = name
+				ctx["user"] = name
+			}
+			entries = append(entries, entry)
+		}
+		dst[key] = entries
+	}
+
+	if current, _ := dst["current-context"].(string); current == "" {
+		dst["current-context"] = name
+	}
+
+	return yaml.Marshal(dst)
+}
+
+func kubeconfigList(kubeconfig map[string]any, key string) []any {
+	list, _ := kubeconfig[key].([]any)
+	return list
+}
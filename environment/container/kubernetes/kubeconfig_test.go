@@ -0,0 +1,149 @@
+package kubernetes
+
+import (
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"gopkg.in/yaml.v3"
+)
+
+const k3sKubeconfig = `apiVersion: v1
+kind: Config
+preferences: {}
+clusters:
+- cluster:
+    certificate-authority-data: new-ca
+    server: https://127.0.0.1:6443
+  name: default
+contexts:
+- context:
+    cluster: default
+    user: default
+  name: default
+current-context: default
+users:
+- name: default
+  user:
+    client-certificate-data: new-cert
+`
+
+const existingKubeconfig = `apiVersion: v1
+kind: Config
+clusters:
+- cluster:
+    server: https://prod.example.com
+  name: prod
+- cluster:
+    server: https://127.0.0.1:6443
+    certificate-authority-data: stale-ca
+  name: dev
+contexts:
+- context:
+    cluster: prod
+    user: prod
+  name: prod
+- context:
+    cluster: dev
+    user: dev
+  name: dev
+current-context: prod
+users:
+- name: prod
+  user:
+    token: prod-token
+- name: dev
+  user:
+    client-certificate-data: stale-cert
+`
+
+type testKubeconfig struct {
+	CurrentContext string `yaml:"current-context"`
+	Clusters       []struct {
+		Name    string `yaml:"name"`
+		Cluster struct {
+			Server string `yaml:"server"`
+			CA     string `yaml:"certificate-authority-data"`
+		} `yaml:"cluster"`
+	} `yaml:"clusters"`
+	Contexts []struct {
+		Name    string `yaml:"name"`
+		Context struct {
+			Cluster string `yaml:"cluster"`
+			User    string `yaml:"user"`
+		} `yaml:"context"`
+	} `yaml:"contexts"`
+	Users []struct {
+		Name string `yaml:"name"`
+	} `yaml:"users"`
+}
+
+func Test_mergeKubeconfig(t *testing.T) {
+	b, err := mergeKubeconfig([]byte(existingKubeconfig), []byte(k3sKubeconfig), "dev")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var merged testKubeconfig
+	if err := yaml.Unmarshal(b, &merged); err != nil {
+		t.Fatal(err)
+	}
+
+	if merged.CurrentContext != "prod" {
+		t.Errorf("expected current context to be preserved, got %s", merged.CurrentContext)
+	}
+	if len(merged.Contexts) != 2 || merged.Contexts[0].Name != "prod" || merged.Contexts[1].Name != "dev" {
+		t.Fatalf("expected contexts prod and dev, got %+v", merged.Contexts)
+	}
+	if ctx := merged.Contexts[1].Context; ctx.Cluster != "dev" || ctx.User != "dev" {
+		t.Errorf("expected dev context to reference dev cluster and user, got %+v", ctx)
+	}
+	if len(merged.Clusters) != 2 || merged.Clusters[0].Cluster.Server != "https://prod.example.com" {
+		t.Fatalf("expected prod cluster to be preserved, got %+v", merged.Clusters)
+	}
+	if ca := merged.Clusters[1].Cluster.CA; ca != "new-ca" {
+		t.Errorf("expected stale dev cluster to be replaced, got ca %s", ca)
+	}
+	if len(merged.Users) != 2 || merged.Users[0].Name != "prod" || merged.Users[1].Name != "dev" {
+		t.Errorf("expected users prod and dev, got %+v", merged.Users)
+	}
+}
+
+func Test_mergeKubeconfig_empty(t *testing.T) {
+	b, err := mergeKubeconfig(nil, []byte(k3sKubeconfig), "colima")
+	if err != nil {
+		t.Fatal(err)
+	}
+	var merged testKubeconfig
+	if err := yaml.Unmarshal(b, &merged); err != nil {
+		t.Fatal(err)
+	}
+
+	if merged.CurrentContext != "colima" {
+		t.Errorf("expected current context colima, got %s", merged.CurrentContext)
+	}
+	if len(merged.Contexts) != 1 || merged.Contexts[0].Name != "colima" || merged.Contexts[0].Context.Cluster != "colima" {
+		t.Errorf("expected renamed colima context, got %+v", merged.Contexts)
+	}
+}
+
+func Test_hostKubeconfigFile(t *testing.T) {
+	host := &fakeHost{env: map[string]string{"HOME": "/Users/user"}}
+	tests := []struct {
+		kubeconfig string
+		want       string
+	}{
+		{kubeconfig: "", want: "/Users/user/.kube/config"},
+		{kubeconfig: "~/.kube/colima.yaml", want: "/Users/user/.kube/colima.yaml"},
+		{kubeconfig: "/etc/kube/config", want: "/etc/kube/config"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.want, func(t *testing.T) {
+			got, err := hostKubeconfigFile(host, config.Kubernetes{Kubeconfig: tt.kubeconfig})
+			if err != nil {
+				t.Fatal(err)
+			}
+			if got != tt.want {
+				t.Errorf("hostKubeconfigFile() = %s, want %s", got, tt.want)
+			}
+		})
+	}
+}
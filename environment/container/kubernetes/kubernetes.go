@@ -21,6 +21,9 @@ const (
 	DefaultVersion = "v1.28.3+k3s2"
 
 	ConfigKey = "kubernetes_config"
+	// StoppedKey is set when kubernetes is stopped or being provisioned, for the k3s supervisor
+	// not to restart it. It is cleared when kubernetes is started.
+	StoppedKey = "kubernetes_stopped"
 )
 
 func newRuntime(host environment.HostActions, guest environment.GuestActions) environment.Container {
@@ -48,21 +51,35 @@ func (c kubernetesRuntime) Name() string {
 }
 
 func (c kubernetesRuntime) isInstalled() bool {
-	// it is installed if uninstall script is present.
-	return c.guest.RunQuiet("command", "-v", "k3s-uninstall.sh") == nil
+	// it is installed if an uninstall script or rootless unit is present.
+	return c.guest.RunQuiet("command", "-v", "k3s-uninstall.sh") == nil ||
+		c.guest.RunQuiet("command", "-v", "k3s-agent-uninstall.sh") == nil ||
+		c.guest.RunQuiet("test", "-f", userHome(c.guest)+rootlessUnitFile) == nil
 }
 
-func (c kubernetesRuntime) isVersionInstalled(version string) bool {
+func (c kubernetesRuntime) isVersionInstalled(conf config.Kubernetes) bool {
 	// validate version change via cli flag/config.
-	out, err := c.guest.RunOutput("k3s", "--version")
+	out, err := c.guest.RunOutput(c.k3sBinary(conf), "--version")
 	if err != nil {
 		return false
 	}
-	return strings.Contains(out, version)
+	return strings.Contains(out, conf.Version)
+}
+
+// k3sBinary returns the k3s binary in the guest for conf.
+func (c kubernetesRuntime) k3sBinary(conf config.Kubernetes) string {
+	if conf.Rootless {
+		return userHome(c.guest) + rootlessBinDir + "/k3s"
+	}
+	return "k3s"
 }
 
 func (c kubernetesRuntime) Running(context.Context) bool {
-	return c.guest.RunQuiet("sudo", "service", "k3s", "status") == nil
+	conf := c.config()
+	if conf.Rootless {
+		return c.guest.RunQuiet("systemctl", "--user", "is-active", "--quiet", rootlessService) == nil
+	}
+	return c.guest.RunQuiet("sudo", "service", k3sService(conf), "status") == nil
 }
 
 func (c kubernetesRuntime) runtime() string {
@@ -93,6 +110,9 @@ func (c *kubernetesRuntime) Provision(ctx context.Context) error {
 		return nil
 	}
 
+	// k3s is not supervised until it is provisioned and started
+	a.Add(func() error { return c.guest.Set(StoppedKey, "true") })
+
 	appConf, ok := ctx.Value(config.CtxKey()).(config.Config)
 	runtime := appConf.Runtime
 	conf := appConf.Kubernetes
@@ -104,14 +124,25 @@ func (c *kubernetesRuntime) Provision(ctx context.Context) error {
 		conf = c.config()
 	}
 
-	if c.isVersionInstalled(conf.Version) {
+	if c.isVersionInstalled(conf) {
+		// the flags were accepted when installed, k3s is not failed for flags unknown since
+		if err := validateK3sArgs(conf); err != nil {
+			log.Warnln(err)
+		}
+		if !installK3sPrerequisites(c.host, c.guest, a, runtime, conf) {
+			return a.Exec()
+		}
+		downloads := &downloadGroup{limit: conf.ConcurrentDownloads}
+		a.Add(downloads.run)
 		// runtime has changed, ensure the required images are in the registry
 		if currentRuntime := c.runtime(); currentRuntime != "" && currentRuntime != runtime {
 			a.Stagef("changing runtime to %s", runtime)
-			installK3sCache(c.host, c.guest, a, log, runtime, conf.Version)
+			installK3sCache(c.host, c.guest, a, downloads, log, runtime, conf)
 		}
+		installImageTars(c.host, c.guest, a, downloads, log, runtime, conf)
 		// other settings may have changed e.g. ingress
-		installK3sCluster(c.host, c.guest, a, runtime, conf.Version, conf.K3sArgs)
+		installK3sCluster(c.host, c.guest, a, downloads, runtime, conf)
+		saveGuestCache(c.guest, a, conf, downloads)
 	} else {
 		if c.isInstalled() {
 			a.Stagef("version changed to %s, downloading and installing", conf.Version)
@@ -122,7 +153,7 @@ func (c *kubernetesRuntime) Provision(ctx context.Context) error {
 				a.Stage("installing")
 			}
 		}
-		installK3s(c.host, c.guest, a, log, runtime, conf.Version, conf.K3sArgs)
+		installK3s(c.host, c.guest, a, log, runtime, conf)
 	}
 
 	// this needs to happen on each startup
@@ -131,6 +162,16 @@ func (c *kubernetesRuntime) Provision(ctx context.Context) error {
 		installCniConfig(c.guest, a)
 	}
 
+	if conf.HelmVersion != "" {
+		a.Stage("installing helm")
+		installHelm(c.host, c.guest, a, conf)
+	}
+
+	verifyDNS(c.guest, a, conf)
+
+	// applied after the DNS check, the check pod runs in the default namespace
+	applyDefaultDeny(c.guest, a, conf)
+
 	// provision successful, now we can persist the version
 	a.Add(func() error { return c.setConfig(conf) })
 
@@ -142,25 +183,76 @@ func (c kubernetesRuntime) Start(ctx context.Context) error {
 	a := c.Init(ctx)
 	if c.Running(ctx) {
 		log.Println("already running")
-		return nil
+		// started by the install script during provisioning
+		return c.guest.Set(StoppedKey, "")
 	}
 
-	a.Add(func() error {
-		return c.guest.Run("sudo", "service", "k3s", "start")
-	})
-	a.Retry("", time.Second*2, 10, func(int) error {
-		return c.guest.RunQuiet("kubectl", "cluster-info")
+	conf := c.config()
+	if conf.Rootless {
+		a.Add(func() error {
+			return c.guest.Run("systemctl", "--user", "start", rootlessService)
+		})
+	} else {
+		a.Add(func() error {
+			return c.guest.Run("sudo", "service", k3sService(conf), "start")
+		})
+	}
+	a.RetryWithJitter("", time.Second*2, time.Second, 10, func(int) error {
+		return Ready(c.guest, conf)
 	})
 
+	a.Add(func() error { return c.guest.Set(StoppedKey, "") })
+
 	if err := a.Exec(); err != nil {
 		return err
 	}
 
-	return c.provisionKubeconfig(ctx)
+	// the agent has no api server, the kubeconfig is provided by the server
+	if !isAgent(conf) {
+		if err := c.provisionKubeconfig(ctx); err != nil {
+			return err
+		}
+	}
+
+	return c.postStart(ctx, conf)
+}
+
+// postStart pre-pulls the images and runs the post-start commands of conf.
+func (c kubernetesRuntime) postStart(ctx context.Context, conf config.Kubernetes) error {
+	if len(conf.PrePullImages) == 0 && len(conf.PostStart) == 0 {
+		return nil
+	}
+
+	a := c.Init(ctx)
+	if len(conf.PrePullImages) > 0 {
+		a.Stage("pre-pulling images")
+		prePullImages(c.guest, a, c.runtime(), conf)
+	}
+	if len(conf.PostStart) > 0 {
+		a.Stage("running post-start commands")
+		runPostStart(c.host, c.guest, a, conf)
+	}
+	return a.Exec()
+}
+
+// Ready returns nil if k3s is ready for conf, the API is checked from within the guest.
+func Ready(guest environment.GuestActions, conf config.Kubernetes) error {
+	if isAgent(conf) {
+		return guest.RunQuiet("sudo", "service", k3sService(conf), "status")
+	}
+	return guest.RunQuiet(guestKubectl(guest, conf, "cluster-info")...)
 }
 
 func (c kubernetesRuntime) Stop(ctx context.Context) error {
 	a := c.Init(ctx)
+	a.Add(func() error { return c.guest.Set(StoppedKey, "true") })
+	if c.config().Rootless {
+		a.Add(func() error {
+			return c.guest.Run("systemctl", "--user", "stop", rootlessService)
+		})
+		return a.Exec()
+	}
+
 	a.Add(func() error {
 		return c.guest.Run("k3s-killall.sh")
 	})
@@ -238,11 +330,7 @@ func (c kubernetesRuntime) runningContainerIDs() string {
 func (c kubernetesRuntime) Teardown(ctx context.Context) error {
 	a := c.Init(ctx)
 
-	if c.isInstalled() {
-		a.Add(func() error {
-			return c.guest.Run("k3s-uninstall.sh")
-		})
-	}
+	uninstallK3s(c.guest, a)
 
 	// k3s is buggy with external containerd for now
 	// cleanup is manual
@@ -260,6 +348,6 @@ func (c kubernetesRuntime) Dependencies() []string {
 }
 
 func (c kubernetesRuntime) Version(context.Context) string {
-	version, _ := c.host.RunOutput("kubectl", "--context", config.CurrentProfile().ID, "version", "--short")
+	version, _ := c.host.RunOutput(HostKubectl(c.host, c.config(), "version", "--short")...)
 	return version
 }
@@ -0,0 +1,56 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+)
+
+var (
+	labelNameRegex   = regexp.MustCompile(`^([A-Za-z0-9][-A-Za-z0-9_.]*)?[A-Za-z0-9]$`)
+	labelPrefixRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?(\.[a-z0-9]([-a-z0-9]*[a-z0-9])?)*$`)
+)
+
+// validateLabelKey validates a label key against the Kubernetes rules for label keys.
+// https://kubernetes.io/docs/concepts/overview/working-with-objects/labels/#syntax-and-character-set
+func validateLabelKey(key string) error {
+	name := key
+	if i := strings.LastIndex(key, "/"); i >= 0 {
+		prefix := key[:i]
+		name = key[i+1:]
+		if len(prefix) > 253 || !labelPrefixRegex.MatchString(prefix) {
+			return fmt.Errorf("invalid prefix '%s' for node label '%s': must be a DNS subdomain", prefix, key)
+		}
+	}
+	if len(name) > 63 || !labelNameRegex.MatchString(name) {
+		return fmt.Errorf("invalid name for node label '%s': must be 63 characters or less, begin and end with an alphanumeric character and contain only alphanumerics, '-', '_' or '.'", key)
+	}
+	return nil
+}
+
+// validateLabelValue validates a label value against the Kubernetes rules for label values.
+func validateLabelValue(key, value string) error {
+	if value == "" {
+		return nil
+	}
+	if len(value) > 63 || !labelNameRegex.MatchString(value) {
+		return fmt.Errorf("invalid value '%s' for node label '%s'", value, key)
+	}
+	return nil
+}
+
+// nodeLabelArgs returns the k3s args for the node labels.
+// An error is returned if any of the labels is invalid.
+func nodeLabelArgs(labels map[string]string) ([]string, error) {
+	var args []string
+	for _, key := range sortedKeys(labels) {
+		if err := validateLabelKey(key); err != nil {
+			return nil, err
+		}
+		if err := validateLabelValue(key, labels[key]); err != nil {
+			return nil, err
+		}
+		args = append(args, "--node-label", key+"="+labels[key])
+	}
+	return args, nil
+}
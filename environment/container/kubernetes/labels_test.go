@@ -0,0 +1,48 @@
+package kubernetes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+func Test_nodeLabelArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		labels  map[string]string
+		want    []string
+		wantErr string
+	}{
+		{name: "empty"},
+		{
+			name:   "valid",
+			labels: map[string]string{"tier": "dev", "example.com/team": "platform", "k8s.io/empty": ""},
+			want:   []string{"--node-label", "example.com/team=platform", "--node-label", "k8s.io/empty=", "--node-label", "tier=dev"},
+		},
+		{name: "invalid name", labels: map[string]string{"-tier": "dev"}, wantErr: "'-tier'"},
+		{name: "invalid prefix", labels: map[string]string{"Example.com/tier": "dev"}, wantErr: "'Example.com/tier'"},
+		{name: "empty name", labels: map[string]string{"example.com/": "dev"}, wantErr: "'example.com/'"},
+		{name: "name too long", labels: map[string]string{strings.Repeat("a", 64): "dev"}, wantErr: strings.Repeat("a", 64)},
+		{name: "invalid value", labels: map[string]string{"tier": "dev/prod"}, wantErr: "'tier'"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := nodeLabelArgs(tt.labels)
+			if tt.wantErr != "" {
+				if err == nil {
+					t.Fatalf("nodeLabelArgs() expected error for %v", tt.labels)
+				}
+				if !strings.Contains(err.Error(), tt.wantErr) {
+					t.Errorf("nodeLabelArgs() error = %v, want mention of %s", err, tt.wantErr)
+				}
+				return
+			}
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("nodeLabelArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
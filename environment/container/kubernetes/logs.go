@@ -0,0 +1,35 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// containerLogSizeRegex matches a quantity e.g. 10Mi.
+var containerLogSizeRegex = regexp.MustCompile(`^[0-9]+(Ki|Mi|Gi|K|M|G)?$`)
+
+// containerLogArgs returns the k3s args for the rotation of the container logs by the kubelet.
+// An error is returned if any of the values is invalid.
+func containerLogArgs(conf config.Kubernetes) ([]string, error) {
+	var args []string
+
+	if size := conf.ContainerLogMaxSize; size != "" {
+		if !containerLogSizeRegex.MatchString(size) {
+			return nil, fmt.Errorf("invalid container log max size '%s': must be a quantity e.g. 10Mi", size)
+		}
+		args = append(args, "--kubelet-arg", "container-log-max-size="+size)
+	}
+
+	if files := conf.ContainerLogMaxFiles; files != 0 {
+		// the kubelet requires at least the current and a rotated file
+		if files < 2 {
+			return nil, fmt.Errorf("invalid container log max files %d: must be at least 2", files)
+		}
+		args = append(args, "--kubelet-arg", "container-log-max-files="+strconv.Itoa(files))
+	}
+
+	return args, nil
+}
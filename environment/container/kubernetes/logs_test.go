@@ -0,0 +1,59 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_installK3s_containerLogs(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		want    []string
+		wantErr bool
+	}{
+		{name: "default", conf: config.Kubernetes{}},
+		{
+			name: "configured",
+			conf: config.Kubernetes{ContainerLogMaxSize: "10Mi", ContainerLogMaxFiles: 3},
+			want: []string{quoted("--kubelet-arg", "container-log-max-size=10Mi"), quoted("--kubelet-arg", "container-log-max-files=3")},
+		},
+		{name: "size only", conf: config.Kubernetes{ContainerLogMaxSize: "500K"}, want: []string{quoted("--kubelet-arg", "container-log-max-size=500K")}},
+		{name: "invalid size", conf: config.Kubernetes{ContainerLogMaxSize: "10 megabytes"}, wantErr: true},
+		{name: "too few files", conf: config.Kubernetes{ContainerLogMaxFiles: 1}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.Version = DefaultVersion
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+			err := a.Exec()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("installK3s() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			install, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true")
+			if !ok {
+				t.Fatalf("install command not found in %+v", guest.commands)
+			}
+			for _, want := range tt.want {
+				if !strings.Contains(install, want) {
+					t.Errorf("expected %s in install command: %s", want, install)
+				}
+			}
+			if len(tt.want) == 0 && strings.Contains(install, "container-log-max") {
+				t.Errorf("unexpected container log args in install command: %s", install)
+			}
+		})
+	}
+}
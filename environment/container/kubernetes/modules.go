@@ -0,0 +1,48 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+)
+
+// defaultFlannelBackend is the flannel backend used by k3s if none is specified.
+const defaultFlannelBackend = "vxlan"
+
+// flannelModules are the kernel modules required by each flannel backend.
+// Backends not listed require no kernel modules.
+var flannelModules = map[string][]string{
+	"vxlan":            {"vxlan"},
+	"wireguard-native": {"wireguard"},
+}
+
+// flannelBackend returns the flannel backend selected in the k3s args.
+func flannelBackend(conf config.Kubernetes) string {
+	if backend := k3sArgValue(conf, "--flannel-backend"); backend != "" {
+		return backend
+	}
+	return defaultFlannelBackend
+}
+
+// checkKernelModules verifies the kernel modules required by the flannel backend
+// are built in, loaded or loadable in the guest.
+func checkKernelModules(guest environment.GuestActions, conf config.Kubernetes) error {
+	backend := flannelBackend(conf)
+
+	var missing []string
+	for _, module := range flannelModules[backend] {
+		script := fmt.Sprintf("test -d /sys/module/%s || modprobe -n %s", module, module)
+		if err := guest.RunQuiet("sh", "-c", script); err != nil {
+			missing = append(missing, module)
+		}
+	}
+
+	if len(missing) > 0 {
+		return fmt.Errorf("kernel modules required by the flannel %s backend are not available in the VM: %s, "+
+			"use a VM image with the modules or select another backend with '--flannel-backend' in k3sArgs",
+			backend, strings.Join(missing, ", "))
+	}
+	return nil
+}
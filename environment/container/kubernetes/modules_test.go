@@ -0,0 +1,68 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_installK3s_kernelModules(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{Version: DefaultVersion, CheckKernelModules: true}
+	guest := &fakeGuest{errs: map[string]error{
+		"sh -c test -d /sys/module/vxlan": fmt.Errorf("exit status 1"),
+	}}
+	host := &fakeHost{}
+	a := newTestChain()
+	installK3s(host, guest, a, a.Logger(), containerd.Name, conf)
+
+	err := a.Exec()
+	if err == nil || !strings.Contains(err.Error(), "vxlan") {
+		t.Fatalf("expected missing vxlan module error, got %v", err)
+	}
+	if len(host.commands) != 0 {
+		t.Errorf("expected no downloads before the module check, got %+v", host.commands)
+	}
+	if _, ok := guest.hasCommand("k3s-install.sh"); ok {
+		t.Errorf("k3s must not be installed when modules are missing: %+v", guest.commands)
+	}
+}
+
+func Test_checkKernelModules(t *testing.T) {
+	tests := []struct {
+		name    string
+		args    []string
+		want    string
+		wantErr bool
+	}{
+		{name: "default", want: "vxlan", wantErr: true},
+		{name: "wireguard", args: []string{"--flannel-backend", "wireguard-native"}, want: "wireguard"},
+		{name: "host-gw", args: []string{"--flannel-backend=host-gw"}},
+		{name: "none", args: []string{"--flannel-backend=none"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &fakeGuest{errs: map[string]error{
+				"sh -c test -d /sys/module/vxlan": fmt.Errorf("exit status 1"),
+			}}
+			err := checkKernelModules(guest, config.Kubernetes{K3sArgs: tt.args})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("checkKernelModules() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			_, checked := guest.hasCommand("/sys/module/")
+			if checked != (tt.want != "") {
+				t.Errorf("module checked = %v, want %v: %+v", checked, tt.want != "", guest.commands)
+			}
+			if tt.want != "" {
+				if _, ok := guest.hasCommand("modprobe -n " + tt.want); !ok {
+					t.Errorf("module %s not checked: %+v", tt.want, guest.commands)
+				}
+			}
+		})
+	}
+}
@@ -0,0 +1,99 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/embedded"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util"
+)
+
+// defaultDenyFile is the manifest of the default deny NetworkPolicy applied to the namespaces.
+const defaultDenyFile = "/etc/colima/k3s/default-deny.yaml"
+
+// defaultDenyPolicy is the name of the default deny NetworkPolicy.
+const defaultDenyPolicy = "colima-default-deny"
+
+// defaultDenyNamespaces are the namespaces the default deny NetworkPolicy is applied to if unspecified.
+var defaultDenyNamespaces = []string{"default"}
+
+var namespaceRegex = regexp.MustCompile(`^[a-z0-9]([-a-z0-9]*[a-z0-9])?$`)
+
+func validateDefaultDeny(conf config.Kubernetes) error {
+	if !conf.DefaultDeny {
+		if len(conf.DefaultDenyNamespaces) > 0 {
+			return fmt.Errorf("default deny namespaces require the default deny network policy to be enabled")
+		}
+		return nil
+	}
+	if isAgent(conf) {
+		return fmt.Errorf("the default deny network policy is only supported for a k3s server")
+	}
+	for _, ns := range conf.DefaultDenyNamespaces {
+		if len(ns) > 63 || !namespaceRegex.MatchString(ns) {
+			return fmt.Errorf("invalid default deny namespace '%s'", ns)
+		}
+		if ns == "kube-system" {
+			return fmt.Errorf("the default deny network policy cannot be applied to kube-system, the components packaged with k3s would be isolated")
+		}
+	}
+	return nil
+}
+
+// networkPolicyWarning returns the warning if the NetworkPolicy may not be enforced for conf,
+// empty otherwise. k3s enforces NetworkPolicy with its embedded controller alongside flannel.
+func networkPolicyWarning(conf config.Kubernetes) string {
+	if hasK3sArg(conf, "--disable-network-policy") {
+		return "the network policy controller of k3s is disabled with '--disable-network-policy', the default deny network policy is not enforced"
+	}
+	if k3sArgValue(conf, "--flannel-backend") == "none" {
+		return "flannel is disabled, the default deny network policy is only enforced if the installed CNI supports NetworkPolicy"
+	}
+	return ""
+}
+
+// defaultDenyYAML renders the manifest of the default deny NetworkPolicy for the namespaces.
+func defaultDenyYAML(namespaces []string) ([]byte, error) {
+	if len(namespaces) == 0 {
+		namespaces = defaultDenyNamespaces
+	}
+	tpl, err := embedded.ReadString("k3s/default-deny.yaml")
+	if err != nil {
+		return nil, fmt.Errorf("error reading embedded default deny network policy: %w", err)
+	}
+	values := struct {
+		Name       string
+		Namespaces []string
+	}{Name: defaultDenyPolicy, Namespaces: namespaces}
+	return util.ParseTemplate(tpl, values)
+}
+
+// applyDefaultDeny applies the default deny NetworkPolicy to the configured namespaces.
+// The namespaces are created if missing.
+func applyDefaultDeny(guest environment.GuestActions, a *cli.ActiveCommandChain, conf config.Kubernetes) {
+	if !conf.DefaultDeny || isAgent(conf) {
+		return
+	}
+
+	if warning := networkPolicyWarning(conf); warning != "" {
+		a.Logger().Warnln(warning)
+	}
+
+	a.Stage("applying default deny network policy")
+	a.Add(func() error {
+		b, err := defaultDenyYAML(conf.DefaultDenyNamespaces)
+		if err != nil {
+			return err
+		}
+		return guest.Write(defaultDenyFile, b)
+	})
+	a.Add(func() error {
+		if err := guest.Run(guestKubectl(guest, conf, "apply", "-f", defaultDenyFile)...); err != nil {
+			return fmt.Errorf("error applying default deny network policy: %w", err)
+		}
+		return nil
+	})
+}
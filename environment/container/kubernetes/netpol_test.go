@@ -0,0 +1,165 @@
+package kubernetes
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"reflect"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"gopkg.in/yaml.v3"
+)
+
+type manifest struct {
+	Kind     string `yaml:"kind"`
+	Metadata struct {
+		Name      string `yaml:"name"`
+		Namespace string `yaml:"namespace"`
+	} `yaml:"metadata"`
+	Spec struct {
+		PodSelector map[string]any `yaml:"podSelector"`
+		PolicyTypes []string       `yaml:"policyTypes"`
+	} `yaml:"spec"`
+}
+
+func decodeManifests(t *testing.T, b []byte) (manifests []manifest) {
+	t.Helper()
+	dec := yaml.NewDecoder(bytes.NewReader(b))
+	for {
+		var m manifest
+		err := dec.Decode(&m)
+		if errors.Is(err, io.EOF) {
+			return
+		}
+		if err != nil {
+			t.Fatalf("invalid manifest: %v\n%s", err, b)
+		}
+		manifests = append(manifests, m)
+	}
+}
+
+func Test_defaultDenyYAML(t *testing.T) {
+	tests := []struct {
+		name       string
+		namespaces []string
+		want       []string
+	}{
+		{name: "default", want: []string{"default"}},
+		{name: "configured", namespaces: []string{"default", "apps"}, want: []string{"default", "apps"}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			b, err := defaultDenyYAML(tt.namespaces)
+			if err != nil {
+				t.Fatal(err)
+			}
+
+			var policies []string
+			for _, m := range decodeManifests(t, b) {
+				if m.Kind != "NetworkPolicy" {
+					continue
+				}
+				if m.Metadata.Name != defaultDenyPolicy {
+					t.Errorf("policy name = %s, want %s", m.Metadata.Name, defaultDenyPolicy)
+				}
+				if len(m.Spec.PodSelector) != 0 {
+					t.Errorf("expected the policy to select all pods, got %v", m.Spec.PodSelector)
+				}
+				if want := []string{"Ingress", "Egress"}; !reflect.DeepEqual(m.Spec.PolicyTypes, want) {
+					t.Errorf("policy types = %v, want %v", m.Spec.PolicyTypes, want)
+				}
+				policies = append(policies, m.Metadata.Namespace)
+			}
+			if !reflect.DeepEqual(policies, tt.want) {
+				t.Errorf("policy namespaces = %v, want %v", policies, tt.want)
+			}
+		})
+	}
+}
+
+func Test_applyDefaultDeny(t *testing.T) {
+	tests := []struct {
+		name  string
+		conf  config.Kubernetes
+		apply bool
+	}{
+		{name: "disabled", conf: config.Kubernetes{}},
+		{name: "enabled", conf: config.Kubernetes{DefaultDeny: true, DefaultDenyNamespaces: []string{"apps"}}, apply: true},
+		{name: "agent", conf: config.Kubernetes{Role: roleAgent, DefaultDeny: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &fakeGuest{}
+			a := newTestChain()
+			applyDefaultDeny(guest, a, tt.conf)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			_, applied := guest.hasCommand("kubectl apply -f " + defaultDenyFile)
+			if applied != tt.apply {
+				t.Errorf("applied = %v, want %v: %+v", applied, tt.apply, guest.commands)
+			}
+			content, written := guest.files[defaultDenyFile]
+			if written != tt.apply {
+				t.Fatalf("written = %v, want %v", written, tt.apply)
+			}
+			if !tt.apply {
+				return
+			}
+			var namespaces []string
+			for _, m := range decodeManifests(t, []byte(content)) {
+				if m.Kind == "NetworkPolicy" {
+					namespaces = append(namespaces, m.Metadata.Namespace)
+				}
+			}
+			if want := []string{"apps"}; !reflect.DeepEqual(namespaces, want) {
+				t.Errorf("policy namespaces = %v, want %v", namespaces, want)
+			}
+		})
+	}
+}
+
+func Test_networkPolicyWarning(t *testing.T) {
+	tests := []struct {
+		name string
+		args []string
+		warn bool
+	}{
+		{name: "flannel"},
+		{name: "host-gw", args: []string{"--flannel-backend=host-gw"}},
+		{name: "controller disabled", args: []string{"--disable-network-policy"}, warn: true},
+		{name: "custom cni", args: []string{"--flannel-backend", "none"}, warn: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := networkPolicyWarning(config.Kubernetes{K3sArgs: tt.args})
+			if (got != "") != tt.warn {
+				t.Errorf("networkPolicyWarning() = %q, want warning %v", got, tt.warn)
+			}
+		})
+	}
+}
+
+func Test_validateDefaultDeny(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		wantErr bool
+	}{
+		{name: "disabled"},
+		{name: "enabled", conf: config.Kubernetes{DefaultDeny: true, DefaultDenyNamespaces: []string{"default", "apps"}}},
+		{name: "namespaces only", conf: config.Kubernetes{DefaultDenyNamespaces: []string{"apps"}}, wantErr: true},
+		{name: "invalid namespace", conf: config.Kubernetes{DefaultDeny: true, DefaultDenyNamespaces: []string{"Apps"}}, wantErr: true},
+		{name: "kube-system", conf: config.Kubernetes{DefaultDeny: true, DefaultDenyNamespaces: []string{"kube-system"}}, wantErr: true},
+		{name: "agent", conf: config.Kubernetes{Role: roleAgent, DefaultDeny: true}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validateDefaultDeny(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("validateDefaultDeny() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,127 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+// k3sReleaseURL returns the download url for the file in the k3s release.
+func k3sReleaseURL(version, file string) string {
+	return "https://github.com/k3s-io/k3s/releases/download/" + version + "/" + file
+}
+
+// k3sBinaryURL returns the download url for the k3s binary.
+func k3sBinaryURL(version string, arch environment.Arch) string {
+	if arch.GoArch() == "arm64" {
+		return k3sReleaseURL(version, "k3s-arm64")
+	}
+	return k3sReleaseURL(version, "k3s")
+}
+
+// k3sAirgapImagesURL returns the download url for the compressed k3s airgap images.
+func k3sAirgapImagesURL(version string, arch environment.Arch) string {
+	return k3sReleaseURL(version, "k3s-airgap-images-"+arch.GoArch()+".tar.gz")
+}
+
+// airgapImagesURL returns the download url for the compressed airgap images of conf.
+// The configured url takes precedence, with %arch% replaced by the architecture.
+func airgapImagesURL(conf config.Kubernetes, arch environment.Arch) string {
+	if conf.AirgapImagesURL != "" {
+		return strings.ReplaceAll(conf.AirgapImagesURL, "%arch%", arch.GoArch())
+	}
+	return k3sAirgapImagesURL(conf.Version, arch)
+}
+
+// validateAirgapImagesURL validates the configured url of the airgap images.
+func validateAirgapImagesURL(conf config.Kubernetes) error {
+	if conf.AirgapImagesURL == "" {
+		return nil
+	}
+	// the token is not a valid url escape
+	u, err := url.Parse(strings.ReplaceAll(conf.AirgapImagesURL, "%arch%", "amd64"))
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid airgap images url '%s', expected an http or https url", conf.AirgapImagesURL)
+	}
+	return nil
+}
+
+// k3sShaURL returns the download url for the sha sums of the k3s release assets.
+func k3sShaURL(version string, arch environment.Arch) string {
+	return k3sReleaseURL(version, "sha256sum-"+arch.GoArch()+".txt")
+}
+
+// k3sInstallScriptURL returns the download url for the k3s install script.
+func k3sInstallScriptURL(version string) string {
+	return "https://raw.githubusercontent.com/k3s-io/k3s/" + version + "/install.sh"
+}
+
+// Download is a file downloaded during the installation of Kubernetes.
+type Download struct {
+	Asset string
+	URL   string
+	// Checksum is the key for pinning the checksum of the download, empty for checksum files.
+	Checksum string
+}
+
+// DownloadPlan returns the files downloaded when Kubernetes is installed with conf
+// in a VM with arch, without downloading or installing anything.
+// Image tars are excluded as they are copied from the host.
+func DownloadPlan(conf config.Kubernetes, arch environment.Arch) []Download {
+	goArch := arch.GoArch()
+	plan := []Download{
+		{Asset: "k3s", URL: k3sBinaryURL(conf.Version, arch), Checksum: checksumKey(assetK3s, conf.Version, goArch)},
+		{Asset: "airgap images", URL: airgapImagesURL(conf, arch), Checksum: checksumKey(assetAirgapImages, conf.Version, goArch)},
+		{Asset: "k3s sha sums", URL: k3sShaURL(conf.Version, arch)},
+	}
+
+	// the install script is not used for rootless k3s
+	if !conf.Rootless {
+		plan = append(plan, Download{
+			Asset:    "k3s install script",
+			URL:      k3sInstallScriptURL(conf.Version),
+			Checksum: checksumKey(assetInstallScript, conf.Version, ""),
+		})
+	}
+
+	if conf.HelmVersion != "" {
+		url := helmURL(conf.HelmVersion, arch)
+		plan = append(plan,
+			Download{Asset: "helm", URL: url, Checksum: checksumKey(assetHelm, conf.HelmVersion, goArch)},
+			Download{Asset: "helm sha sum", URL: url + ".sha256sum"},
+		)
+	}
+
+	return plan
+}
+
+// K3sArgs returns the args k3s is installed with for conf and the container runtime,
+// without running anything in the VM. ipAddress is the reachable address of the VM,
+// 127.0.0.1 if none. The defaults are used for the values otherwise resolved from the VM
+// i.e. the containerd socket when not configured, and $HOME for rootless k3s.
+// The install script environment is excluded as it may contain the token.
+func K3sArgs(conf config.Kubernetes, containerRuntime, ipAddress string) ([]string, error) {
+	if err := validateK3sConfig(conf); err != nil {
+		return nil, err
+	}
+	if err := validateK3sArgs(conf); err != nil {
+		return nil, err
+	}
+
+	env := k3sArgsEnv{ipAddress: ipAddress, dataDir: "$HOME" + rootlessDataDir}
+	if !conf.Rootless || conf.DataDir != "" || dataDirArg(conf) != "" {
+		// the guest is only required for the rootless default
+		env.dataDir = dataDir(nil, conf)
+	}
+	if conf.RuntimeEndpoint == "" && containerRuntime == containerd.Name && !conf.Rootless {
+		env.containerdSocket = containerd.DefaultSocket
+		if conf.ContainerdSocket != "" {
+			env.containerdSocket = strings.TrimPrefix(conf.ContainerdSocket, "unix://")
+		}
+	}
+	return k3sArgs(conf, containerRuntime, env), nil
+}
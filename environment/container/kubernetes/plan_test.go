@@ -0,0 +1,265 @@
+package kubernetes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/environment/container/docker"
+)
+
+func TestDownloadPlan(t *testing.T) {
+	const release = "https://github.com/k3s-io/k3s/releases/download/v1.28.3+k3s2/"
+	const script = "https://raw.githubusercontent.com/k3s-io/k3s/v1.28.3+k3s2/install.sh"
+
+	tests := []struct {
+		name string
+		conf config.Kubernetes
+		arch environment.Arch
+		want []string
+	}{
+		{
+			name: "amd64",
+			conf: config.Kubernetes{Version: "v1.28.3+k3s2"},
+			arch: environment.X8664,
+			want: []string{release + "k3s", release + "k3s-airgap-images-amd64.tar.gz", release + "sha256sum-amd64.txt", script},
+		},
+		{
+			name: "arm64",
+			conf: config.Kubernetes{Version: "v1.28.3+k3s2"},
+			arch: environment.AARCH64,
+			want: []string{release + "k3s-arm64", release + "k3s-airgap-images-arm64.tar.gz", release + "sha256sum-arm64.txt", script},
+		},
+		{
+			name: "rootless",
+			conf: config.Kubernetes{Version: "v1.28.3+k3s2", Rootless: true},
+			arch: environment.X8664,
+			want: []string{release + "k3s", release + "k3s-airgap-images-amd64.tar.gz", release + "sha256sum-amd64.txt"},
+		},
+		{
+			name: "helm",
+			conf: config.Kubernetes{Version: "v1.28.3+k3s2", HelmVersion: "v3.13.2"},
+			arch: environment.X8664,
+			want: []string{
+				release + "k3s", release + "k3s-airgap-images-amd64.tar.gz", release + "sha256sum-amd64.txt", script,
+				"https://get.helm.sh/helm-v3.13.2-linux-amd64.tar.gz",
+				"https://get.helm.sh/helm-v3.13.2-linux-amd64.tar.gz.sha256sum",
+			},
+		},
+		{
+			name: "airgap images url",
+			conf: config.Kubernetes{Version: "v1.28.3+k3s2", AirgapImagesURL: "https://mirror.example.com/k3s/images-%arch%.tgz"},
+			arch: environment.AARCH64,
+			want: []string{release + "k3s-arm64", "https://mirror.example.com/k3s/images-arm64.tgz", release + "sha256sum-arm64.txt", script},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			var got []string
+			for _, d := range DownloadPlan(tt.conf, tt.arch) {
+				got = append(got, d.URL)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("DownloadPlan() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownloadPlan_install(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{Version: DefaultVersion}
+	planned := map[string]bool{}
+	for _, d := range DownloadPlan(conf, environment.X8664) {
+		planned[d.URL] = true
+	}
+
+	host := &fakeHost{}
+	a := newTestChain()
+	installK3s(host, &fakeGuest{}, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	// every url fetched by the installation is in the plan
+	var downloads int
+	for _, cmd := range host.commands {
+		fields := strings.Fields(cmd)
+		if fields[0] != "curl" {
+			continue
+		}
+		downloads++
+		if url := fields[len(fields)-1]; !planned[url] {
+			t.Errorf("url %s downloaded but not in the plan", url)
+		}
+	}
+	if downloads == 0 {
+		t.Errorf("no downloads found in %+v", host.commands)
+	}
+}
+
+func Test_installK3s_airgapImagesURL(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	const mirror = "https://mirror.example.com/k3s/%arch%/images.tar.gz"
+	host := &fakeHost{}
+	guest := &fakeGuest{}
+	conf := config.Kubernetes{Version: DefaultVersion, AirgapImagesURL: mirror}
+	a := newTestChain()
+	installK3s(host, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	release := k3sAirgapImagesURL(DefaultVersion, guest.Arch())
+	var downloaded bool
+	for _, cmd := range host.commands {
+		if !strings.HasPrefix(cmd, "curl") {
+			continue
+		}
+		if strings.HasSuffix(cmd, release) {
+			t.Errorf("unexpected download of the release airgap images: %s", cmd)
+		}
+		downloaded = downloaded || strings.HasSuffix(cmd, "https://mirror.example.com/k3s/amd64/images.tar.gz")
+	}
+	if !downloaded {
+		t.Errorf("airgap images not downloaded from the mirror: %+v", host.commands)
+	}
+
+	// the published sha sums do not list the mirrored file name
+	for _, cmd := range host.commands {
+		if strings.Contains(cmd, "sha256sum") && strings.Contains(cmd, "images.tar.gz") {
+			t.Errorf("unexpected published checksum lookup for the mirrored images: %s", cmd)
+		}
+	}
+	if _, ok := guest.hasCommand("/tmp/k3s-airgap-images-amd64.tar.gz"); !ok {
+		t.Errorf("airgap images not copied to the VM: %+v", guest.commands)
+	}
+}
+
+func Test_validateAirgapImagesURL(t *testing.T) {
+	tests := []struct {
+		url     string
+		wantErr bool
+	}{
+		{url: ""},
+		{url: "https://mirror.example.com/k3s/images-%arch%.tar.gz"},
+		{url: "http://10.0.0.2:8080/images.tar.gz"},
+		{url: "/Users/user/images.tar.gz", wantErr: true},
+		{url: "ftp://mirror.example.com/images.tar.gz", wantErr: true},
+		{url: "https://", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.url, func(t *testing.T) {
+			if err := validateAirgapImagesURL(config.Kubernetes{AirgapImagesURL: tt.url}); (err != nil) != tt.wantErr {
+				t.Errorf("validateAirgapImagesURL() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestK3sArgs(t *testing.T) {
+	tests := []struct {
+		name      string
+		conf      config.Kubernetes
+		runtime   string
+		ipAddress string
+		want      []string
+	}{
+		{
+			name:      "containerd",
+			runtime:   containerd.Name,
+			ipAddress: "127.0.0.1",
+			want: []string{
+				"--write-kubeconfig-mode", "644",
+				"--flannel-iface", "eth0",
+				"--container-runtime-endpoint", "unix:///run/containerd/containerd.sock",
+			},
+		},
+		{
+			name:      "docker with reachable address",
+			conf:      config.Kubernetes{K3sArgs: []string{"--disable=traefik"}},
+			runtime:   docker.Name,
+			ipAddress: "192.168.106.2",
+			want: []string{
+				"--write-kubeconfig-mode", "644", "--disable=traefik",
+				"--flannel-iface", "col0",
+				"--bind-address", "192.168.106.2", "--advertise-address", "192.168.106.2",
+				"--docker",
+			},
+		},
+		{
+			name: "configured",
+			conf: config.Kubernetes{
+				DataDir:          "/data/k3s",
+				NodeIP:           "10.0.0.5",
+				KubeProxyMode:    "ipvs",
+				DNSUpstreams:     []string{"1.1.1.1"},
+				PodSecurity:      config.PodSecurity{Enforce: "baseline"},
+				ContainerdSocket: "unix:///run/k8s/containerd.sock",
+			},
+			runtime:   containerd.Name,
+			ipAddress: "127.0.0.1",
+			want: []string{
+				"--write-kubeconfig-mode", "644",
+				"--data-dir", "/data/k3s",
+				"--flannel-iface", "eth0",
+				"--node-ip", "10.0.0.5",
+				"--bind-address", "10.0.0.5", "--advertise-address", "10.0.0.5",
+				"--kube-proxy-arg", "proxy-mode=ipvs",
+				"--kube-apiserver-arg", "admission-control-config-file=/data/k3s" + podSecurityFile,
+				"--container-runtime-endpoint", "unix:///run/k8s/containerd.sock",
+			},
+		},
+		{
+			name:      "rootless",
+			conf:      config.Kubernetes{Rootless: true},
+			runtime:   containerd.Name,
+			ipAddress: "127.0.0.1",
+			want:      []string{"--write-kubeconfig-mode", "644", "--flannel-iface", "eth0"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := K3sArgs(tt.conf, tt.runtime, tt.ipAddress)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("K3sArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestK3sArgs_invalid(t *testing.T) {
+	if _, err := K3sArgs(config.Kubernetes{KubeProxyMode: "nftables"}, containerd.Name, "127.0.0.1"); err == nil {
+		t.Error("expected an error for an invalid config")
+	}
+}
+
+func TestK3sArgs_install(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{Version: DefaultVersion, K3sArgs: []string{"--disable=traefik"}, NodeLabels: map[string]string{"tier": "dev"}}
+	args, err := K3sArgs(conf, containerd.Name, "127.0.0.1")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	// the rendered args are the args of the install script
+	if _, ok := guest.hasCommand("k3s-install.sh " + quoted(args...)); !ok {
+		t.Errorf("rendered args %v not found in %+v", args, guest.commands)
+	}
+}
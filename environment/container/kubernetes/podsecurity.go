@@ -0,0 +1,147 @@
+package kubernetes
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"gopkg.in/yaml.v3"
+)
+
+// podSecurityFile is the PodSecurity admission config relative to the k3s data directory.
+// https://docs.k3s.io/security/hardening-guide#pod-security
+const podSecurityFile = "/server/psa.yaml"
+
+// podSecurityLevels are the valid PodSecurity levels.
+var podSecurityLevels = []string{"privileged", "baseline", "restricted"}
+
+// podSecurityExemptNamespaces are always exempt, the components packaged with k3s are privileged.
+var podSecurityExemptNamespaces = []string{"kube-system"}
+
+type admissionConfig struct {
+	APIVersion string            `yaml:"apiVersion"`
+	Kind       string            `yaml:"kind"`
+	Plugins    []admissionPlugin `yaml:"plugins"`
+}
+
+type admissionPlugin struct {
+	Name          string            `yaml:"name"`
+	Configuration podSecurityConfig `yaml:"configuration"`
+}
+
+type podSecurityConfig struct {
+	APIVersion string                `yaml:"apiVersion"`
+	Kind       string                `yaml:"kind"`
+	Defaults   map[string]string     `yaml:"defaults"`
+	Exemptions podSecurityExemptions `yaml:"exemptions"`
+}
+
+type podSecurityExemptions struct {
+	Usernames      []string `yaml:"usernames"`
+	RuntimeClasses []string `yaml:"runtimeClasses"`
+	Namespaces     []string `yaml:"namespaces"`
+}
+
+// podSecurityEnabled returns if the PodSecurity admission defaults are configured in conf.
+func podSecurityEnabled(conf config.Kubernetes) bool {
+	p := conf.PodSecurity
+	return p.Enforce != "" || p.Audit != "" || p.Warn != ""
+}
+
+// podSecurityK3sFile returns the path to the PodSecurity admission config in the guest for conf.
+func podSecurityK3sFile(guest environment.GuestActions, conf config.Kubernetes) string {
+	return dataDir(guest, conf) + podSecurityFile
+}
+
+func validatePodSecurity(conf config.Kubernetes) error {
+	if !podSecurityEnabled(conf) {
+		if len(conf.PodSecurity.ExemptNamespaces) > 0 {
+			return fmt.Errorf("pod security exempt namespaces require an enforce, audit or warn level")
+		}
+		return nil
+	}
+	if isAgent(conf) {
+		return fmt.Errorf("pod security is only supported for a k3s server")
+	}
+	if conf.Rootless {
+		return fmt.Errorf("pod security is not supported for rootless k3s")
+	}
+	for _, arg := range append(append([]string{}, conf.K3sArgs...), conf.ExtraArgs...) {
+		if strings.Contains(arg, "admission-control-config-file") {
+			return fmt.Errorf("pod security is configured and an admission config is also specified with k3s args")
+		}
+	}
+
+	for _, m := range podSecurityModes(conf.PodSecurity) {
+		if m.level != "" && !validPodSecurityLevel(m.level) {
+			return fmt.Errorf("invalid pod security %s level '%s', must be one of privileged, baseline or restricted", m.mode, m.level)
+		}
+	}
+	for _, ns := range conf.PodSecurity.ExemptNamespaces {
+		if ns == "" {
+			return fmt.Errorf("empty pod security exempt namespace")
+		}
+	}
+	return nil
+}
+
+// podSecurityModes returns the modes of the PodSecurity admission with the configured levels of p.
+func podSecurityModes(p config.PodSecurity) []struct{ mode, level string } {
+	return []struct{ mode, level string }{
+		{mode: "enforce", level: p.Enforce},
+		{mode: "audit", level: p.Audit},
+		{mode: "warn", level: p.Warn},
+	}
+}
+
+func validPodSecurityLevel(level string) bool {
+	for _, l := range podSecurityLevels {
+		if l == level {
+			return true
+		}
+	}
+	return false
+}
+
+// podSecurityYAML renders the PodSecurity admission config for the defaults of conf.
+// Unset levels default to privileged, the Kubernetes default.
+func podSecurityYAML(conf config.Kubernetes) ([]byte, error) {
+	p := conf.PodSecurity
+	defaults := map[string]string{}
+	for _, m := range podSecurityModes(p) {
+		level := m.level
+		if level == "" {
+			level = "privileged"
+		}
+		defaults[m.mode] = level
+		defaults[m.mode+"-version"] = "latest"
+	}
+
+	namespaces := append([]string{}, podSecurityExemptNamespaces...)
+	for _, ns := range p.ExemptNamespaces {
+		if ns != "kube-system" {
+			namespaces = append(namespaces, ns)
+		}
+	}
+
+	c := admissionConfig{
+		APIVersion: "apiserver.config.k8s.io/v1",
+		Kind:       "AdmissionConfiguration",
+		Plugins: []admissionPlugin{{
+			Name: "PodSecurity",
+			Configuration: podSecurityConfig{
+				APIVersion: "pod-security.admission.config.k8s.io/v1",
+				Kind:       "PodSecurityConfiguration",
+				Defaults:   defaults,
+				Exemptions: podSecurityExemptions{Usernames: []string{}, RuntimeClasses: []string{}, Namespaces: namespaces},
+			},
+		}},
+	}
+
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding pod security admission config: %w", err)
+	}
+	return append([]byte("# generated by colima\n"), b...), nil
+}
@@ -0,0 +1,113 @@
+package kubernetes
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_installK3s_podSecurity(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	tests := []struct {
+		name string
+		conf config.Kubernetes
+		file string
+	}{
+		{name: "default data dir", file: defaultDataDir + podSecurityFile},
+		{name: "data dir", conf: config.Kubernetes{DataDir: "/data/k3s"}, file: "/data/k3s" + podSecurityFile},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.Version = DefaultVersion
+			conf.PodSecurity = config.PodSecurity{Enforce: "baseline", Warn: "restricted", ExemptNamespaces: []string{"monitoring"}}
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			install, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true")
+			if !ok {
+				t.Fatalf("install command not found in %+v", guest.commands)
+			}
+			if flag := quoted("--kube-apiserver-arg", "admission-control-config-file="+tt.file); !strings.Contains(install, flag) {
+				t.Errorf("expected %s in %s", flag, install)
+			}
+
+			content, ok := guest.files[tt.file]
+			if !ok {
+				t.Fatalf("admission config not written to %s: %+v", tt.file, guest.files)
+			}
+			var c admissionConfig
+			if err := yaml.Unmarshal([]byte(content), &c); err != nil {
+				t.Fatal(err)
+			}
+			if c.Kind != "AdmissionConfiguration" || len(c.Plugins) != 1 || c.Plugins[0].Name != "PodSecurity" {
+				t.Fatalf("unexpected admission config: %s", content)
+			}
+			psa := c.Plugins[0].Configuration
+			want := map[string]string{
+				"enforce": "baseline", "enforce-version": "latest",
+				"audit": "privileged", "audit-version": "latest",
+				"warn": "restricted", "warn-version": "latest",
+			}
+			if !reflect.DeepEqual(psa.Defaults, want) {
+				t.Errorf("defaults = %v, want %v", psa.Defaults, want)
+			}
+			if want := []string{"kube-system", "monitoring"}; !reflect.DeepEqual(psa.Exemptions.Namespaces, want) {
+				t.Errorf("exempt namespaces = %v, want %v", psa.Exemptions.Namespaces, want)
+			}
+		})
+	}
+}
+
+func Test_installK3s_podSecurity_unset(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, config.Kubernetes{Version: DefaultVersion})
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := guest.hasCommand("admission-control-config-file"); ok {
+		t.Errorf("admission config not expected: %+v", guest.commands)
+	}
+	if _, ok := guest.files[defaultDataDir+podSecurityFile]; ok {
+		t.Error("admission config not expected to be written")
+	}
+}
+
+func Test_validatePodSecurity(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "valid", conf: config.Kubernetes{PodSecurity: config.PodSecurity{Enforce: "restricted", Audit: "baseline"}}},
+		{name: "invalid level", conf: config.Kubernetes{PodSecurity: config.PodSecurity{Enforce: "strict"}}, wantErr: true},
+		{name: "exemptions only", conf: config.Kubernetes{PodSecurity: config.PodSecurity{ExemptNamespaces: []string{"monitoring"}}}, wantErr: true},
+		{name: "rootless", conf: config.Kubernetes{Rootless: true, PodSecurity: config.PodSecurity{Enforce: "baseline"}}, wantErr: true},
+		{name: "agent", conf: config.Kubernetes{Role: roleAgent, PodSecurity: config.PodSecurity{Enforce: "baseline"}}, wantErr: true},
+		{
+			name:    "admission config in k3s args",
+			conf:    config.Kubernetes{K3sArgs: []string{"--kube-apiserver-arg=admission-control-config-file=/etc/psa.yaml"}, PodSecurity: config.PodSecurity{Enforce: "baseline"}},
+			wantErr: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePodSecurity(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("validatePodSecurity() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
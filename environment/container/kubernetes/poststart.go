@@ -0,0 +1,82 @@
+package kubernetes
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+)
+
+// postStartRetryInterval is the default interval between attempts of a post-start command.
+var postStartRetryInterval = 2 * time.Second
+
+func validatePostStart(commands []config.PostStartCommand) error {
+	for i, cmd := range commands {
+		if cmd.Command == "" {
+			return fmt.Errorf("post-start command %d is empty", i+1)
+		}
+		if cmd.Retries < 0 {
+			return fmt.Errorf("invalid retries %d for post-start command '%s', must not be negative", cmd.Retries, cmd.Command)
+		}
+		if cmd.RetryInterval < 0 {
+			return fmt.Errorf("invalid retry interval %d for post-start command '%s', must not be negative", cmd.RetryInterval, cmd.Command)
+		}
+	}
+	return nil
+}
+
+// runPostStart runs the post-start commands of conf in order once k3s is ready.
+// A failed command aborts the remaining commands unless its failure is ignored.
+func runPostStart(host environment.HostActions, guest environment.GuestActions, a *cli.ActiveCommandChain, conf config.Kubernetes) {
+	if len(conf.PostStart) == 0 {
+		return
+	}
+
+	log := a.Logger()
+
+	// readiness gate
+	a.RetryWithJitter("", postStartRetryInterval, time.Second, 10, func(int) error {
+		return Ready(guest, conf)
+	})
+
+	for _, cmd := range conf.PostStart {
+		cmd := cmd
+		a.Add(func() error {
+			err := runPostStartCommand(host, guest, cmd)
+			if err == nil {
+				return nil
+			}
+			err = fmt.Errorf("error running post-start command '%s': %w", cmd.Command, err)
+			if cmd.IgnoreFailure {
+				log.Warnln(err)
+				return nil
+			}
+			return err
+		})
+	}
+}
+
+// runPostStartCommand runs cmd on the host or in the guest, retried as configured.
+func runPostStartCommand(host environment.HostActions, guest environment.GuestActions, cmd config.PostStartCommand) (err error) {
+	interval := postStartRetryInterval
+	if cmd.RetryInterval > 0 {
+		interval = time.Duration(cmd.RetryInterval) * time.Second
+	}
+
+	for i := 0; i <= cmd.Retries; i++ {
+		if i > 0 {
+			time.Sleep(interval)
+		}
+		if cmd.Host {
+			err = host.Run("sh", "-c", cmd.Command)
+		} else {
+			err = guest.Run("sh", "-c", cmd.Command)
+		}
+		if err == nil {
+			return nil
+		}
+	}
+	return err
+}
@@ -0,0 +1,86 @@
+package kubernetes
+
+import (
+	"fmt"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+)
+
+func Test_runPostStart(t *testing.T) {
+	interval := postStartRetryInterval
+	postStartRetryInterval = time.Millisecond
+	defer func() { postStartRetryInterval = interval }()
+
+	conf := config.Kubernetes{PostStart: []config.PostStartCommand{
+		{Command: "kubectl create namespace dev"},
+		{Command: "kubectl apply -f /tmp/rbac.yaml"},
+		{Command: "kubectl --context colima get nodes", Host: true},
+	}}
+
+	guest := &fakeGuest{}
+	host := &fakeHost{}
+	a := newTestChain()
+	runPostStart(host, guest, a, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	want := []string{
+		"kubectl cluster-info",
+		"sh -c kubectl create namespace dev",
+		"sh -c kubectl apply -f /tmp/rbac.yaml",
+	}
+	if len(guest.commands) != len(want) {
+		t.Fatalf("expected commands %+v, got %+v", want, guest.commands)
+	}
+	for i := range want {
+		if guest.commands[i] != want[i] {
+			t.Errorf("expected command %d to be %q, got %q", i, want[i], guest.commands[i])
+		}
+	}
+	if len(host.commands) != 1 || host.commands[0] != "sh -c kubectl --context colima get nodes" {
+		t.Errorf("expected host command, got %+v", host.commands)
+	}
+}
+
+func Test_runPostStart_failure(t *testing.T) {
+	interval := postStartRetryInterval
+	postStartRetryInterval = time.Millisecond
+	defer func() { postStartRetryInterval = interval }()
+
+	const failing = "sh -c kubectl apply -f /tmp/missing.yaml"
+	tests := []struct {
+		name    string
+		cmd     config.PostStartCommand
+		wantErr bool
+	}{
+		{name: "fatal", cmd: config.PostStartCommand{Command: "kubectl apply -f /tmp/missing.yaml", Retries: 2}, wantErr: true},
+		{name: "ignored", cmd: config.PostStartCommand{Command: "kubectl apply -f /tmp/missing.yaml", Retries: 2, IgnoreFailure: true}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := config.Kubernetes{PostStart: []config.PostStartCommand{tt.cmd, {Command: "true"}}}
+			guest := &fakeGuest{errs: map[string]error{failing: fmt.Errorf("not found")}}
+			a := newTestChain()
+			runPostStart(&fakeHost{}, guest, a, conf)
+			if err := a.Exec(); (err != nil) != tt.wantErr {
+				t.Fatalf("runPostStart() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			attempts := 0
+			for _, cmd := range guest.commands {
+				if cmd == failing {
+					attempts++
+				}
+			}
+			if want := tt.cmd.Retries + 1; attempts != want {
+				t.Errorf("expected %d attempts, got %d", want, attempts)
+			}
+			if _, ran := guest.hasCommand("sh -c true"); ran == tt.wantErr {
+				t.Errorf("subsequent command ran = %v, want %v", ran, !tt.wantErr)
+			}
+		})
+	}
+}
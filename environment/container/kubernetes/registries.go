@@ -0,0 +1,102 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/url"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util/downloader"
+	"github.com/sirupsen/logrus"
+	"gopkg.in/yaml.v3"
+)
+
+// registriesFile is the k3s registries config of a rootful k3s.
+// https://docs.k3s.io/installation/private-registry
+const registriesFile = "/etc/rancher/k3s/registries.yaml"
+
+// defaultPullThroughRegistries are the registries mirrored through the pull-through cache if unspecified.
+var defaultPullThroughRegistries = []string{"docker.io"}
+
+// registriesConfig is the k3s registries config.
+type registriesConfig struct {
+	Mirrors map[string]registryMirror `yaml:"mirrors"`
+	Configs map[string]registryConfig `yaml:"configs,omitempty"`
+}
+
+type registryMirror struct {
+	Endpoint []string `yaml:"endpoint"`
+}
+
+type registryConfig struct {
+	Auth *downloader.RegistryAuth `yaml:"auth,omitempty"`
+}
+
+// registriesK3sFile returns the path to the k3s registries config in the guest for conf.
+func registriesK3sFile(guest environment.GuestActions, conf config.Kubernetes) string {
+	if conf.Rootless {
+		return userHome(guest) + rootlessDataDir + "/registries.yaml"
+	}
+	return registriesFile
+}
+
+// registryCredentials returns the credentials of the registries in the k3s registries config
+// in the guest, for the download of OCI artifacts from the same registries as the images.
+// A missing or invalid config has no credentials.
+func registryCredentials(guest environment.GuestActions, conf config.Kubernetes) map[string]downloader.RegistryAuth {
+	out, err := guest.Read(registriesK3sFile(guest, conf))
+	if err != nil {
+		return nil
+	}
+	var c registriesConfig
+	if err := yaml.Unmarshal([]byte(out), &c); err != nil {
+		logrus.Warnln(fmt.Errorf("error decoding registries config, registry credentials ignored: %w", err))
+		return nil
+	}
+
+	auths := map[string]downloader.RegistryAuth{}
+	for registry, rc := range c.Configs {
+		if rc.Auth != nil {
+			auths[registry] = *rc.Auth
+		}
+	}
+	return auths
+}
+
+func validatePullThroughCache(conf config.Kubernetes) error {
+	if conf.PullThroughCache == "" {
+		if len(conf.PullThroughRegistries) > 0 {
+			return fmt.Errorf("pull-through registries require a pull-through cache")
+		}
+		return nil
+	}
+	u, err := url.Parse(conf.PullThroughCache)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid pull-through cache '%s', expected http(s)://<host>[:<port>]", conf.PullThroughCache)
+	}
+	for _, registry := range conf.PullThroughRegistries {
+		if registry == "" {
+			return fmt.Errorf("empty pull-through registry")
+		}
+	}
+	return nil
+}
+
+// registriesYAML renders the k3s registries config mirroring the registries through the
+// pull-through cache at endpoint.
+func registriesYAML(endpoint string, registries []string) ([]byte, error) {
+	if len(registries) == 0 {
+		registries = defaultPullThroughRegistries
+	}
+
+	c := registriesConfig{Mirrors: map[string]registryMirror{}}
+	for _, registry := range registries {
+		c.Mirrors[registry] = registryMirror{Endpoint: []string{endpoint}}
+	}
+
+	b, err := yaml.Marshal(c)
+	if err != nil {
+		return nil, fmt.Errorf("error encoding registries config: %w", err)
+	}
+	return append([]byte("# generated by colima\n"), b...), nil
+}
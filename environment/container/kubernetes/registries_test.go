@@ -0,0 +1,141 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+	"github.com/abiosoft/colima/util/downloader"
+	"gopkg.in/yaml.v3"
+)
+
+func Test_installK3sCluster_pullThroughCache(t *testing.T) {
+	const cache = "http://registry-cache.internal:5000"
+
+	tests := []struct {
+		name       string
+		conf       config.Kubernetes
+		file       string
+		registries []string
+	}{
+		{
+			name:       "default registries",
+			conf:       config.Kubernetes{PullThroughCache: cache},
+			file:       registriesFile,
+			registries: []string{"docker.io"},
+		},
+		{
+			name:       "configured registries",
+			conf:       config.Kubernetes{PullThroughCache: cache, PullThroughRegistries: []string{"docker.io", "ghcr.io"}},
+			file:       registriesFile,
+			registries: []string{"docker.io", "ghcr.io"},
+		},
+		{
+			name:       "rootless",
+			conf:       config.Kubernetes{PullThroughCache: cache, Rootless: true},
+			file:       "/home/user.linux" + rootlessDataDir + "/registries.yaml",
+			registries: []string{"docker.io"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3sCluster(&fakeHost{}, guest, a, nil, containerd.Name, tt.conf)
+			if err := a.Exec(); err != nil {
+				t.Fatal(err)
+			}
+
+			content, ok := guest.files[tt.file]
+			if !ok {
+				t.Fatalf("registries config not written to %s: %+v", tt.file, guest.files)
+			}
+			var c registriesConfig
+			if err := yaml.Unmarshal([]byte(content), &c); err != nil {
+				t.Fatal(err)
+			}
+			if len(c.Mirrors) != len(tt.registries) {
+				t.Errorf("expected mirrors for %v, got %+v", tt.registries, c.Mirrors)
+			}
+			for _, registry := range tt.registries {
+				if endpoint := c.Mirrors[registry].Endpoint; len(endpoint) != 1 || endpoint[0] != cache {
+					t.Errorf("expected %s to be mirrored through %s, got %v", registry, cache, endpoint)
+				}
+			}
+		})
+	}
+}
+
+func Test_validatePullThroughCache(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		wantErr bool
+	}{
+		{name: "unset"},
+		{name: "https", conf: config.Kubernetes{PullThroughCache: "https://cache.example.com"}},
+		{name: "no scheme", conf: config.Kubernetes{PullThroughCache: "cache.example.com:5000"}, wantErr: true},
+		{name: "registries without cache", conf: config.Kubernetes{PullThroughRegistries: []string{"docker.io"}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := validatePullThroughCache(tt.conf); (err != nil) != tt.wantErr {
+				t.Errorf("validatePullThroughCache() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func Test_registryCredentials(t *testing.T) {
+	const registries = `
+mirrors:
+  docker.io:
+    endpoint: ["https://mirror.internal"]
+configs:
+  registry.internal:
+    auth:
+      username: user
+      password: pass
+  ghcr.io:
+    auth:
+      identity_token: token
+  insecure.internal:
+    tls:
+      insecure_skip_verify: true
+`
+	tests := []struct {
+		name  string
+		conf  config.Kubernetes
+		files map[string]string
+		want  map[string]downloader.RegistryAuth
+	}{
+		{
+			name:  "configured",
+			files: map[string]string{registriesFile: registries},
+			want: map[string]downloader.RegistryAuth{
+				"registry.internal": {Username: "user", Password: "pass"},
+				"ghcr.io":           {IdentityToken: "token"},
+			},
+		},
+		{
+			name:  "rootless",
+			conf:  config.Kubernetes{Rootless: true},
+			files: map[string]string{"/home/user.linux" + rootlessDataDir + "/registries.yaml": registries},
+			want: map[string]downloader.RegistryAuth{
+				"registry.internal": {Username: "user", Password: "pass"},
+				"ghcr.io":           {IdentityToken: "token"},
+			},
+		},
+		{name: "missing", want: map[string]downloader.RegistryAuth{}},
+		{name: "invalid", files: map[string]string{registriesFile: "configs: ["}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			guest := &fakeGuest{files: tt.files}
+			if got := registryCredentials(guest, tt.conf); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("registryCredentials() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
@@ -0,0 +1,60 @@
+package kubernetes
+
+import (
+	"fmt"
+	"regexp"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// reservedResources are the resources that can be reserved by the kubelet.
+// https://kubernetes.io/docs/tasks/administer-cluster/reserve-compute-resources/
+var reservedResources = map[string]struct{}{
+	"cpu":               {},
+	"memory":            {},
+	"ephemeral-storage": {},
+	"pid":               {},
+}
+
+// reservedQuantityRegex matches a quantity e.g. 500m, 0.5 or 256Mi.
+var reservedQuantityRegex = regexp.MustCompile(`^[0-9]+(\.[0-9]+)?(m|Ki|Mi|Gi|Ti|Pi|Ei|k|M|G|T|P|E)?$`)
+
+// reservation returns the kubelet flag value for the reserved resources e.g. cpu=500m,memory=256Mi.
+func reservation(flag string, reserved map[string]string) (string, error) {
+	var values []string
+	for _, resource := range sortedKeys(reserved) {
+		if _, ok := reservedResources[resource]; !ok {
+			return "", fmt.Errorf("invalid %s resource '%s', must be one of cpu, memory, ephemeral-storage or pid", flag, resource)
+		}
+		quantity := reserved[resource]
+		if !reservedQuantityRegex.MatchString(quantity) {
+			return "", fmt.Errorf("invalid %s quantity '%s' for '%s': must be a quantity e.g. 500m or 256Mi", flag, quantity, resource)
+		}
+		values = append(values, resource+"="+quantity)
+	}
+	return strings.Join(values, ","), nil
+}
+
+// reservedArgs returns the k3s args for the resources reserved by the kubelet for the
+// system daemons and the Kubernetes components in conf.
+// An error is returned if any of the reservations is invalid.
+func reservedArgs(conf config.Kubernetes) ([]string, error) {
+	var args []string
+	for _, r := range []struct {
+		flag     string
+		reserved map[string]string
+	}{
+		{flag: "system-reserved", reserved: conf.SystemReserved},
+		{flag: "kube-reserved", reserved: conf.KubeReserved},
+	} {
+		value, err := reservation(r.flag, r.reserved)
+		if err != nil {
+			return nil, err
+		}
+		if value != "" {
+			args = append(args, "--kubelet-arg", r.flag+"="+value)
+		}
+	}
+	return args, nil
+}
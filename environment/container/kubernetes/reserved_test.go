@@ -0,0 +1,74 @@
+package kubernetes
+
+import (
+	"reflect"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_reservedArgs(t *testing.T) {
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		want    []string
+		wantErr bool
+	}{
+		{name: "empty"},
+		{
+			name: "system",
+			conf: config.Kubernetes{SystemReserved: map[string]string{"memory": "256Mi", "cpu": "500m"}},
+			want: []string{"--kubelet-arg", "system-reserved=cpu=500m,memory=256Mi"},
+		},
+		{
+			name: "both",
+			conf: config.Kubernetes{
+				SystemReserved: map[string]string{"cpu": "0.25"},
+				KubeReserved:   map[string]string{"memory": "512Mi", "ephemeral-storage": "1Gi", "pid": "1000"},
+			},
+			want: []string{
+				"--kubelet-arg", "system-reserved=cpu=0.25",
+				"--kubelet-arg", "kube-reserved=ephemeral-storage=1Gi,memory=512Mi,pid=1000",
+			},
+		},
+		{name: "invalid resource", conf: config.Kubernetes{KubeReserved: map[string]string{"gpu": "1"}}, wantErr: true},
+		{name: "invalid quantity", conf: config.Kubernetes{SystemReserved: map[string]string{"memory": "256MB"}}, wantErr: true},
+		{name: "negative quantity", conf: config.Kubernetes{SystemReserved: map[string]string{"cpu": "-1"}}, wantErr: true},
+		{name: "empty quantity", conf: config.Kubernetes{KubeReserved: map[string]string{"memory": ""}}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := reservedArgs(tt.conf)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("reservedArgs() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("reservedArgs() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func Test_installK3s_reserved(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	conf := config.Kubernetes{
+		Version:        DefaultVersion,
+		SystemReserved: map[string]string{"cpu": "250m", "memory": "256Mi"},
+		KubeReserved:   map[string]string{"memory": "512Mi"},
+	}
+	guest := &fakeGuest{}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true",
+		quoted("--kubelet-arg", "system-reserved=cpu=250m,memory=256Mi"),
+		quoted("--kubelet-arg", "kube-reserved=memory=512Mi"),
+	); !ok {
+		t.Errorf("resource reservations not found in %+v", guest.commands)
+	}
+}
@@ -0,0 +1,141 @@
+package kubernetes
+
+import (
+	"fmt"
+	"net/url"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+)
+
+const (
+	roleServer = "server"
+	roleAgent  = "agent"
+)
+
+// isAgent returns if k3s is installed as an agent joining an existing server.
+func isAgent(conf config.Kubernetes) bool { return conf.Role == roleAgent }
+
+// k3sService returns the name of the k3s service for conf.
+func k3sService(conf config.Kubernetes) string {
+	if isAgent(conf) {
+		return "k3s-agent"
+	}
+	return "k3s"
+}
+
+// k3sUninstallScript returns the uninstall script of the k3s install for conf.
+func k3sUninstallScript(conf config.Kubernetes) string {
+	return k3sService(conf) + "-uninstall.sh"
+}
+
+func validateRole(conf config.Kubernetes) error {
+	switch conf.Role {
+	case "", roleServer:
+		return validateServer(conf)
+	case roleAgent:
+	default:
+		return fmt.Errorf("invalid k3s role '%s', must be one of %s or %s", conf.Role, roleServer, roleAgent)
+	}
+
+	if conf.Server == "" {
+		return fmt.Errorf("server url is required for k3s agent")
+	}
+	if !validServerURL(conf.Server) {
+		return fmt.Errorf("invalid server url '%s' for k3s agent, expected https://<server>:<port>", conf.Server)
+	}
+	if conf.Token == "" {
+		return fmt.Errorf("token is required for k3s agent")
+	}
+	if conf.DatastoreEndpoint != "" {
+		return fmt.Errorf("datastore endpoint is not supported for k3s agent")
+	}
+	if conf.Rootless {
+		return fmt.Errorf("rootless k3s is not supported for k3s agent")
+	}
+	return nil
+}
+
+// datastoreSchemes are the supported schemes of an external datastore endpoint.
+var datastoreSchemes = []string{"mysql", "postgres", "http", "https"}
+
+// validateServer validates the HA configuration of a k3s server.
+// A server either joins an existing server or uses an external datastore,
+// the embedded etcd is used otherwise.
+func validateServer(conf config.Kubernetes) error {
+	if conf.Server == "" && conf.DatastoreEndpoint == "" {
+		return nil
+	}
+	if conf.Server != "" && conf.DatastoreEndpoint != "" {
+		return fmt.Errorf("server url and datastore endpoint are mutually exclusive")
+	}
+	if hasK3sArg(conf, "--cluster-init") {
+		return fmt.Errorf("--cluster-init is not valid with a server url or datastore endpoint")
+	}
+
+	if conf.Server != "" {
+		if !validServerURL(conf.Server) {
+			return fmt.Errorf("invalid server url '%s', expected https://<server>:<port>", conf.Server)
+		}
+		if conf.Token == "" {
+			return fmt.Errorf("token is required to join the k3s server")
+		}
+		return nil
+	}
+
+	scheme, address, _ := strings.Cut(conf.DatastoreEndpoint, "://")
+	supported := false
+	for _, s := range datastoreSchemes {
+		supported = supported || s == scheme
+	}
+	if !supported || address == "" || strings.Contains(conf.DatastoreEndpoint, "'") {
+		return fmt.Errorf("invalid datastore endpoint '%s', expected <%s>://<address>", conf.DatastoreEndpoint, strings.Join(datastoreSchemes, "|"))
+	}
+	return nil
+}
+
+// validServerURL returns if s is a valid URL of a k3s server.
+func validServerURL(s string) bool {
+	u, err := url.Parse(s)
+	return err == nil && u.Scheme == "https" && u.Host != ""
+}
+
+// serverArgs returns the k3s args to join an existing server or use an external datastore.
+func serverArgs(conf config.Kubernetes) []string {
+	switch {
+	case isAgent(conf):
+		return nil
+	case conf.Server != "":
+		return []string{"--server", conf.Server}
+	case conf.DatastoreEndpoint != "":
+		return []string{"--datastore-endpoint", conf.DatastoreEndpoint}
+	}
+	return nil
+}
+
+// agentArgs returns args without the known k3s flags that are only valid for a server.
+func agentArgs(args []string) []string {
+	var filtered []string
+	skipValue := false
+	for _, arg := range args {
+		if !strings.HasPrefix(arg, "-") {
+			// value of the previous flag
+			if !skipValue {
+				filtered = append(filtered, arg)
+			}
+			skipValue = false
+			continue
+		}
+		skipValue = false
+
+		name, _, hasValue := strings.Cut(strings.TrimLeft(arg, "-"), "=")
+		_, server := k3sServerFlags[name]
+		_, agent := k3sAgentFlags[name]
+		if server && !agent {
+			skipValue = !hasValue
+			continue
+		}
+		filtered = append(filtered, arg)
+	}
+	return filtered
+}
@@ -0,0 +1,112 @@
+package kubernetes
+
+import (
+	"bytes"
+	"fmt"
+	"strings"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+)
+
+// paths for rootless k3s, relative to the user home directory.
+const (
+	rootlessBinDir     = "/.local/bin"
+	rootlessDataDir    = "/.rancher/k3s"
+	rootlessKubeconfig = "/.kube/k3s.yaml"
+	rootlessUnitFile   = "/.config/systemd/user/" + rootlessService + ".service"
+)
+
+// rootlessService is the systemd user service for rootless k3s.
+const rootlessService = "k3s-rootless"
+
+// userHome returns the home directory of the user in the guest.
+func userHome(guest environment.GuestActions) string {
+	home, _ := guest.Env("HOME")
+	return strings.TrimSuffix(home, "/")
+}
+
+// rootlessUnit returns the systemd user unit for running k3s rootless with args.
+// https://docs.k3s.io/advanced#running-servers-and-agents-with-rootless
+func rootlessUnit(home string, args []string) string {
+	return `[Unit]
+Description=k3s (Rootless)
+
+[Service]
+Environment=PATH=` + home + rootlessBinDir + `:/usr/local/sbin:/usr/local/bin:/usr/sbin:/usr/bin:/sbin:/bin
+ExecStart=` + home + rootlessBinDir + `/k3s server --rootless ` + unitArgs(args) + `
+ExecReload=/bin/kill -s HUP $MAINPID
+TimeoutSec=0
+RestartSec=2
+Restart=always
+StartLimitBurst=3
+StartLimitInterval=60s
+LimitNOFILE=infinity
+LimitNPROC=infinity
+LimitCORE=infinity
+TasksMax=infinity
+Delegate=yes
+Type=simple
+KillMode=mixed
+
+[Install]
+WantedBy=default.target
+`
+}
+
+// unitArgs returns args as the words of a systemd ExecStart line. The specifiers and variables
+// are escaped, and the args with whitespace or quotes are quoted.
+func unitArgs(args []string) string {
+	words := make([]string, len(args))
+	for i, arg := range args {
+		arg = strings.NewReplacer("%", "%%", "$", "$$").Replace(arg)
+		if strings.ContainsAny(arg, " \t\"'\\") {
+			arg = `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(arg) + `"`
+		}
+		words[i] = arg
+	}
+	return strings.Join(words, " ")
+}
+
+// installK3sRootlessCluster installs k3s as a systemd user service in place of the install script.
+func installK3sRootlessCluster(
+	guest environment.GuestActions,
+	a *cli.ActiveCommandChain,
+	conf config.Kubernetes,
+	args func() []string,
+) {
+	// rootless k3s requires the cgroup v2 controllers to be delegated to the user
+	a.Add(func() error {
+		controllers, err := guest.RunOutput("sh", "-c", "cat /sys/fs/cgroup/user.slice/user-$(id -u).slice/user@$(id -u).service/cgroup.controllers")
+		if err != nil || !strings.Contains(controllers, "cpu") {
+			return cli.ErrNonFatal(fmt.Errorf("cgroup controllers not delegated to the user, rootless k3s may not start: " +
+				"https://rootlesscontaine.rs/getting-started/common/cgroup2/"))
+		}
+		return nil
+	})
+
+	a.Add(func() error {
+		home := userHome(guest)
+		if home == "" {
+			return ErrClusterBootstrap{Err: fmt.Errorf("error retrieving home directory in the guest")}
+		}
+		unit := bytes.NewBufferString(rootlessUnit(home, args()))
+		unitFile := home + rootlessUnitFile
+		if err := guest.RunWith(unit, nil, "sh", "-c", "mkdir -p "+strings.TrimSuffix(unitFile, "/"+rootlessService+".service")+" && cat > "+unitFile); err != nil {
+			return ErrClusterBootstrap{Err: fmt.Errorf("error writing %s unit: %w", rootlessService, err)}
+		}
+		if err := guest.Run("systemctl", "--user", "daemon-reload"); err != nil {
+			return ErrClusterBootstrap{Err: err}
+		}
+		return nil
+	})
+}
+
+// kubeconfigFile returns the path to the k3s kubeconfig in the guest.
+func kubeconfigFile(guest environment.GuestActions, conf config.Kubernetes) string {
+	if conf.Rootless {
+		return userHome(guest) + rootlessKubeconfig
+	}
+	return kubeconfig
+}
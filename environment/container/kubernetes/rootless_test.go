@@ -0,0 +1,71 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_installK3s_rootless(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+	conf := config.Kubernetes{
+		Version:   DefaultVersion,
+		Rootless:  true,
+		ImageTars: []string{"/Users/user/images/app.tar"},
+	}
+
+	guest := &fakeGuest{outputs: map[string]string{"sh -c cat /sys/fs/cgroup": "cpuset cpu io memory pids"}}
+	a := newTestChain()
+	installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+	if err := a.Exec(); err != nil {
+		t.Fatal(err)
+	}
+
+	for _, cmd := range guest.commands {
+		if strings.HasPrefix(cmd, "sudo ") {
+			t.Errorf("unexpected sudo command for rootless install: %s", cmd)
+		}
+		if strings.Contains(cmd, "k3s-install.sh") {
+			t.Errorf("unexpected install script for rootless install: %s", cmd)
+		}
+	}
+
+	for _, want := range []string{
+		"install /tmp/k3s /home/user.linux/.local/bin/k3s",
+		"cp /tmp/k3s-airgap-images-amd64.tar /home/user.linux/.rancher/k3s/agent/images/",
+		"cp /tmp/app.tar /home/user.linux/.rancher/k3s/agent/images/",
+		"cat > /home/user.linux/.config/systemd/user/k3s-rootless.service",
+		"systemctl --user daemon-reload",
+	} {
+		if _, ok := guest.hasCommand(want); !ok {
+			t.Errorf("command %s not found in %+v", want, guest.commands)
+		}
+	}
+	if _, ok := guest.hasCommand("nerdctl"); ok {
+		t.Errorf("images must not be loaded in the external containerd for rootless: %+v", guest.commands)
+	}
+}
+
+func Test_rootlessUnit(t *testing.T) {
+	unit := rootlessUnit("/home/user.linux", []string{"--write-kubeconfig-mode", "644", "--disable=traefik"})
+	want := "ExecStart=/home/user.linux/.local/bin/k3s server --rootless --write-kubeconfig-mode 644 --disable=traefik\n"
+	if !strings.Contains(unit, want) {
+		t.Errorf("unit does not contain %q:\n%s", want, unit)
+	}
+	if !strings.Contains(unit, "Delegate=yes") {
+		t.Errorf("unit does not delegate cgroups:\n%s", unit)
+	}
+
+	// the args are stored unquoted
+	unit = rootlessUnit("/home/user.linux", []string{
+		"--etcd-snapshot-schedule-cron", "0 */6 * * *",
+		"--kubelet-arg", "eviction-hard=nodefs.available<5%",
+		"--kube-scheduler-arg", `config="x"`,
+	})
+	want = `--etcd-snapshot-schedule-cron "0 */6 * * *" --kubelet-arg eviction-hard=nodefs.available<5%% --kube-scheduler-arg "config=\"x\""` + "\n"
+	if !strings.Contains(unit, want) {
+		t.Errorf("unit does not contain %q:\n%s", want, unit)
+	}
+}
@@ -0,0 +1,37 @@
+package kubernetes
+
+import (
+	"fmt"
+	"path/filepath"
+	"strings"
+
+	"github.com/abiosoft/colima/config"
+)
+
+// validateLocalStoragePath validates the path of the volumes provisioned by the
+// local-path-provisioner bundled with k3s.
+//
+// The path is set with the k3s flag instead of patching the ConfigMap of the
+// provisioner, as k3s reverts changes to its bundled manifests on restart.
+func validateLocalStoragePath(conf config.Kubernetes) error {
+	if conf.LocalStoragePath == "" {
+		return nil
+	}
+	if !filepath.IsAbs(conf.LocalStoragePath) {
+		return fmt.Errorf("invalid local storage path '%s', must be an absolute path", conf.LocalStoragePath)
+	}
+	if isAgent(conf) {
+		return fmt.Errorf("local storage path is not supported for k3s agent")
+	}
+	if k3sArgValue(conf, "--default-local-storage-path") != "" {
+		return fmt.Errorf("local storage path cannot be set both in config and with --default-local-storage-path in k3sArgs")
+	}
+	for _, disabled := range k3sArgValues(conf, "--disable") {
+		for _, component := range strings.Split(disabled, ",") {
+			if component == "local-storage" {
+				return fmt.Errorf("local storage path cannot be set with local-storage disabled in k3sArgs")
+			}
+		}
+	}
+	return nil
+}
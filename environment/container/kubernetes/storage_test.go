@@ -0,0 +1,50 @@
+package kubernetes
+
+import (
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment/container/containerd"
+)
+
+func Test_installK3s_localStoragePath(t *testing.T) {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	tests := []struct {
+		name    string
+		conf    config.Kubernetes
+		wantErr bool
+	}{
+		{name: "absolute", conf: config.Kubernetes{LocalStoragePath: "/Users/user/k3s-volumes"}},
+		{name: "space", conf: config.Kubernetes{LocalStoragePath: "/Users/user/My Volumes"}},
+		{name: "relative", conf: config.Kubernetes{LocalStoragePath: "k3s-volumes"}, wantErr: true},
+		{name: "also in args", conf: config.Kubernetes{LocalStoragePath: "/Users/user/k3s-volumes", K3sArgs: []string{"--default-local-storage-path=/data"}}, wantErr: true},
+		{name: "disabled", conf: config.Kubernetes{LocalStoragePath: "/Users/user/k3s-volumes", K3sArgs: []string{"--disable=traefik,local-storage"}}, wantErr: true},
+		{name: "agent", conf: config.Kubernetes{LocalStoragePath: "/Users/user/k3s-volumes", Role: roleAgent, Server: "https://192.168.106.2:6443", Token: "secret"}, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			conf := tt.conf
+			conf.Version = DefaultVersion
+			guest := &fakeGuest{}
+			a := newTestChain()
+			installK3s(&fakeHost{}, guest, a, a.Logger(), containerd.Name, conf)
+			err := a.Exec()
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("installK3s() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr {
+				return
+			}
+
+			install, ok := guest.hasCommand("INSTALL_K3S_SKIP_DOWNLOAD=true")
+			if !ok {
+				t.Fatalf("install command not found in %+v", guest.commands)
+			}
+			if want := quoted("--default-local-storage-path", conf.LocalStoragePath); !strings.Contains(install, want) {
+				t.Errorf("expected %s in install command: %s", want, install)
+			}
+		})
+	}
+}
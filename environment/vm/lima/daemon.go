@@ -8,6 +8,7 @@ import (
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/daemon"
 	"github.com/abiosoft/colima/daemon/process/inotify"
+	"github.com/abiosoft/colima/daemon/process/k3s"
 	"github.com/abiosoft/colima/daemon/process/vmnet"
 	"github.com/abiosoft/colima/util"
 )
@@ -17,8 +18,8 @@ func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.C
 	isVZ := conf.VMType == VZ
 
 	// limited to macOS (with Qemu driver)
-	// or vz with inotify enabled
-	if !util.MacOS() || (isVZ && !conf.MountINotify) {
+	// or vz with inotify or k3s supervision enabled
+	if !util.MacOS() || (isVZ && !conf.MountINotify && !daemon.SupervisesK3s(conf)) {
 		return ctx, nil
 	}
 
@@ -90,6 +91,10 @@ func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.C
 				return fmt.Errorf("daemon is not running")
 			}
 			for _, p := range s.Processes {
+				// k3s is provisioned after the VM starts
+				if p.Name == k3s.Name {
+					continue
+				}
 				if !p.Running {
 					return p.Error
 				}
@@ -119,7 +124,7 @@ func (l *limaVM) startDaemon(ctx context.Context, conf config.Config) (context.C
 
 				for _, p := range status.Processes {
 					// TODO: handle inotify separate from network
-					if p.Name == inotify.Name {
+					if p.Name == inotify.ProcessName(config.CurrentProfile().ShortName) || p.Name == k3s.Name {
 						continue
 					}
 					if !p.Running {
@@ -2,6 +2,7 @@ package lima
 
 import (
 	"bytes"
+	"compress/gzip"
 	"fmt"
 	"io/fs"
 	"os"
@@ -21,13 +22,30 @@ func (l limaVM) Read(fileName string) (string, error) {
 	return s, err
 }
 
+// compressThreshold is the size in bytes above which the files written to the VM are
+// compressed in transit, swapped in tests.
+var compressThreshold = 64 * 1024
+
 func (l *limaVM) Write(fileName string, body []byte) error {
-	var stdin = bytes.NewReader(body)
 	dir := filepath.Dir(fileName)
 	if err := l.RunQuiet("sudo", "mkdir", "-p", dir); err != nil {
 		return fmt.Errorf("error creating directory '%s': %w", dir, err)
 	}
-	return l.RunWith(stdin, nil, "sudo", "sh", "-c", "cat > "+fileName)
+
+	// large files e.g. templated configs are slow to write uncompressed over ssh
+	if len(body) > compressThreshold {
+		var buf bytes.Buffer
+		w := gzip.NewWriter(&buf)
+		if _, err := w.Write(body); err != nil {
+			return fmt.Errorf("error compressing '%s': %w", fileName, err)
+		}
+		if err := w.Close(); err != nil {
+			return fmt.Errorf("error compressing '%s': %w", fileName, err)
+		}
+		return l.RunWith(&buf, nil, "sudo", "sh", "-c", "gunzip -c > "+fileName)
+	}
+
+	return l.RunWith(bytes.NewReader(body), nil, "sudo", "sh", "-c", "cat > "+fileName)
 }
 
 func (l *limaVM) Stat(fileName string) (os.FileInfo, error) {
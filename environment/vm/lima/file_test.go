@@ -0,0 +1,90 @@
+package lima
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"os"
+	"strings"
+	"testing"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+)
+
+var _ environment.HostActions = (*writeHost)(nil)
+
+// writeHost emulates the shell commands writing files in the VM.
+type writeHost struct {
+	files      map[string][]byte
+	compressed map[string]bool
+}
+
+func (w *writeHost) RunWith(stdin io.Reader, _ io.Writer, args ...string) error {
+	cmd := args[len(args)-1]
+	body, err := io.ReadAll(stdin)
+	if err != nil {
+		return err
+	}
+	if file, ok := strings.CutPrefix(cmd, "gunzip -c > "); ok {
+		r, err := gzip.NewReader(bytes.NewReader(body))
+		if err != nil {
+			return err
+		}
+		if body, err = io.ReadAll(r); err != nil {
+			return err
+		}
+		w.files[file] = body
+		w.compressed[file] = true
+		return nil
+	}
+	if file, ok := strings.CutPrefix(cmd, "cat > "); ok {
+		w.files[file] = body
+	}
+	return nil
+}
+
+func (w *writeHost) Run(...string) error                       { return nil }
+func (w *writeHost) RunQuiet(...string) error                  { return nil }
+func (w *writeHost) RunOutput(...string) (string, error)       { return "", nil }
+func (w *writeHost) RunInteractive(...string) error            { return nil }
+func (w *writeHost) Read(string) (string, error)               { return "", nil }
+func (w *writeHost) Write(string, []byte) error                { return nil }
+func (w *writeHost) Stat(string) (os.FileInfo, error)          { return nil, os.ErrNotExist }
+func (w *writeHost) WithEnv(...string) environment.HostActions { return w }
+func (w *writeHost) WithDir(string) environment.HostActions    { return w }
+func (w *writeHost) Env(string) string                         { return "" }
+
+func Test_limaVM_Write(t *testing.T) {
+	threshold := compressThreshold
+	compressThreshold = 1024
+	t.Cleanup(func() { compressThreshold = threshold })
+
+	mirrors := strings.Repeat("  registry.example.com:\n    endpoint: [\"http://cache:5000\"]\n", 100)
+	tests := []struct {
+		name       string
+		body       []byte
+		compressed bool
+	}{
+		{name: "small", body: []byte("mirrors: {}\n")},
+		{name: "threshold", body: bytes.Repeat([]byte("a"), 1024)},
+		{name: "large", body: []byte("mirrors:\n" + mirrors), compressed: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			host := &writeHost{files: map[string][]byte{}, compressed: map[string]bool{}}
+			l := &limaVM{host: host, CommandChain: cli.New("vm")}
+
+			const file = "/etc/rancher/k3s/registries.yaml"
+			if err := l.Write(file, tt.body); err != nil {
+				t.Fatal(err)
+			}
+			if got := host.files[file]; !bytes.Equal(got, tt.body) {
+				t.Errorf("written content does not match, got %d bytes, want %d bytes", len(got), len(tt.body))
+			}
+			if got := host.compressed[file]; got != tt.compressed {
+				t.Errorf("compressed = %v, want %v", got, tt.compressed)
+			}
+		})
+	}
+}
@@ -16,6 +16,7 @@ import (
 	"github.com/abiosoft/colima/environment/container/containerd"
 	"github.com/abiosoft/colima/environment/vm/lima/limautil"
 	"github.com/abiosoft/colima/util"
+	"github.com/abiosoft/colima/util/downloader"
 	"github.com/abiosoft/colima/util/osutil"
 	"github.com/abiosoft/colima/util/yamlutil"
 	"github.com/sirupsen/logrus"
@@ -79,6 +80,11 @@ func (l limaVM) Dependencies() []string {
 
 func (l *limaVM) Start(ctx context.Context, conf config.Config) error {
 	a := l.Init(ctx)
+	SetMaxSessions(conf.SSHMaxSessions)
+	downloader.SetMaxDownloads(conf.MaxDownloads)
+	if err := downloader.SetMode(conf.DownloadMode); err != nil {
+		return err
+	}
 
 	if l.Created() {
 		return l.resume(ctx, conf)
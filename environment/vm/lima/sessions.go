@@ -0,0 +1,53 @@
+package lima
+
+import "sync"
+
+// sessions limits the commands run concurrently in the VM by the process.
+//
+// Commands share the SSH connection to the VM and each command is a session.
+// The commands are not limited unless a limit is configured.
+var sessions = newSessionLimiter(0)
+
+// SetMaxSessions sets the maximum number of commands run concurrently in the VM
+// by the process. The commands are not limited if n is not positive.
+func SetMaxSessions(n int) { sessions.setLimit(n) }
+
+// sessionLimiter is a semaphore with a limit that can be changed while in use.
+// It is unlimited if the limit is not positive.
+type sessionLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+func newSessionLimiter(limit int) *sessionLimiter {
+	s := &sessionLimiter{limit: limit}
+	s.cond = sync.NewCond(&s.mu)
+	return s
+}
+
+func (s *sessionLimiter) setLimit(n int) {
+	s.mu.Lock()
+	s.limit = n
+	s.mu.Unlock()
+	s.cond.Broadcast()
+}
+
+// acquire blocks until a session is available.
+func (s *sessionLimiter) acquire() {
+	s.mu.Lock()
+	for s.limit > 0 && s.active >= s.limit {
+		s.cond.Wait()
+	}
+	s.active++
+	s.mu.Unlock()
+}
+
+// release releases a session acquired with acquire.
+func (s *sessionLimiter) release() {
+	s.mu.Lock()
+	s.active--
+	s.mu.Unlock()
+	s.cond.Signal()
+}
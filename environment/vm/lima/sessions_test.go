@@ -0,0 +1,91 @@
+package lima
+
+import (
+	"io"
+	"os"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/colima/cli"
+	"github.com/abiosoft/colima/environment"
+)
+
+var _ environment.HostActions = (*concurrentHost)(nil)
+
+// concurrentHost records the maximum number of commands run concurrently.
+type concurrentHost struct {
+	active atomic.Int32
+	max    atomic.Int32
+}
+
+func (c *concurrentHost) run() error {
+	n := c.active.Add(1)
+	defer c.active.Add(-1)
+	for {
+		max := c.max.Load()
+		if n <= max || c.max.CompareAndSwap(max, n) {
+			break
+		}
+	}
+	time.Sleep(time.Millisecond * 5)
+	return nil
+}
+
+func (c *concurrentHost) Run(...string) error                           { return c.run() }
+func (c *concurrentHost) RunQuiet(...string) error                      { return c.run() }
+func (c *concurrentHost) RunOutput(...string) (string, error)           { return "", c.run() }
+func (c *concurrentHost) RunInteractive(...string) error                { return c.run() }
+func (c *concurrentHost) RunWith(io.Reader, io.Writer, ...string) error { return c.run() }
+func (c *concurrentHost) Read(string) (string, error)                   { return "", nil }
+func (c *concurrentHost) Write(string, []byte) error                    { return nil }
+func (c *concurrentHost) Stat(string) (os.FileInfo, error)              { return nil, os.ErrNotExist }
+func (c *concurrentHost) WithEnv(...string) environment.HostActions     { return c }
+func (c *concurrentHost) WithDir(string) environment.HostActions        { return c }
+func (c *concurrentHost) Env(string) string                             { return "" }
+
+// runConcurrently runs commands concurrently in the VM with host, and returns the maximum run at once.
+func runConcurrently(host *concurrentHost) int {
+	l := limaVM{host: host, CommandChain: cli.New("vm")}
+
+	var wg sync.WaitGroup
+	for i := 0; i < 20; i++ {
+		wg.Add(4)
+		go func() { defer wg.Done(); _ = l.RunQuiet("stat", "/") }()
+		go func() { defer wg.Done(); _, _ = l.RunOutput("stat", "/") }()
+		go func() { defer wg.Done(); _ = l.Run("stat", "/") }()
+		go func() { defer wg.Done(); _ = l.RunInteractive("stat", "/") }()
+	}
+	wg.Wait()
+	return int(host.max.Load())
+}
+
+func Test_limaVM_maxSessions(t *testing.T) {
+	t.Cleanup(func() { SetMaxSessions(0) })
+
+	for _, limit := range []int{1, 3, 4} {
+		SetMaxSessions(limit)
+
+		got := runConcurrently(&concurrentHost{})
+		if got > limit {
+			t.Errorf("limit %d: %d commands run concurrently", limit, got)
+		}
+		if limit > 1 && got < 2 {
+			t.Errorf("limit %d: expected commands to run concurrently, got %d", limit, got)
+		}
+	}
+}
+
+func Test_limaVM_maxSessions_unlimited(t *testing.T) {
+	t.Cleanup(func() { SetMaxSessions(0) })
+
+	for _, limit := range []int{0, -1} {
+		SetMaxSessions(limit)
+
+		// more commands than any default limit are run concurrently
+		if got := runConcurrently(&concurrentHost{}); got <= 4 {
+			t.Errorf("limit %d: expected unlimited commands, got %d run concurrently", limit, got)
+		}
+	}
+}
@@ -13,6 +13,8 @@ func (l limaVM) Run(args ...string) error {
 	a := l.Init(context.Background())
 
 	a.Add(func() error {
+		sessions.acquire()
+		defer sessions.release()
 		return l.host.Run(args...)
 	})
 
@@ -37,6 +39,8 @@ func (l limaVM) RunInteractive(args ...string) error {
 	a := l.Init(context.Background())
 
 	a.Add(func() error {
+		sessions.acquire()
+		defer sessions.release()
 		return l.host.RunInteractive(args...)
 	})
 
@@ -49,6 +53,8 @@ func (l limaVM) RunWith(stdin io.Reader, stdout io.Writer, args ...string) error
 	a := l.Init(context.Background())
 
 	a.Add(func() error {
+		sessions.acquire()
+		defer sessions.release()
 		return l.host.RunWith(stdin, stdout, args...)
 	})
 
@@ -61,6 +67,8 @@ func (l limaVM) RunOutput(args ...string) (out string, err error) {
 	a := l.Init(context.Background())
 
 	a.Add(func() (err error) {
+		sessions.acquire()
+		defer sessions.release()
 		out, err = l.host.RunOutput(args...)
 		return
 	})
@@ -75,6 +83,8 @@ func (l limaVM) RunQuiet(args ...string) (err error) {
 	a := l.Init(context.Background())
 
 	a.Add(func() (err error) {
+		sessions.acquire()
+		defer sessions.release()
 		return l.host.RunQuiet(args...)
 	})
 
@@ -156,7 +156,7 @@ func newConf(ctx context.Context, conf config.Config) (l Config, err error) {
 
 			// disable ports 80 and 443 when k8s is enabled and there is a reachable IP address
 			// to prevent ingress (traefik) from occupying relevant host ports.
-			if reachableIPAddress && conf.Kubernetes.Enabled && !ingressDisabled(conf.Kubernetes.K3sArgs) {
+			if reachableIPAddress && conf.Kubernetes.Enabled && (!ingressDisabled(conf.Kubernetes.K3sArgs) || len(conf.Kubernetes.IngressControllers) > 0) {
 				l.PortForwards = append(l.PortForwards,
 					PortForward{
 						GuestIP:           net.ParseIP("0.0.0.0"),
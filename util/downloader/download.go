@@ -1,16 +1,24 @@
 package downloader
 
 import (
+	"errors"
 	"fmt"
+	"math"
+	"net/url"
 	"os"
+	"path"
 	"path/filepath"
+	"regexp"
 	"strconv"
 	"strings"
+	"time"
 
 	"github.com/abiosoft/colima/config"
 	"github.com/abiosoft/colima/environment"
+	"github.com/abiosoft/colima/util"
 	"github.com/abiosoft/colima/util/shautil"
 	"github.com/abiosoft/colima/util/terminal"
+	"github.com/sirupsen/logrus"
 )
 
 type (
@@ -18,69 +26,242 @@ type (
 	guestActions = environment.GuestActions
 )
 
+// runner runs the commands of a download, on the host or the guest.
+type runner interface {
+	Run(args ...string) error
+	RunQuiet(args ...string) error
+	RunOutput(args ...string) (string, error)
+	RunInteractive(args ...string) error
+}
+
 type SHA struct {
 	URL  string // url to download the shasum file
+	Sum  string // expected sha sum, URL is not downloaded if set
 	Size int    // one of 256 or 512
 }
 
-func (s SHA) validate(host hostActions, url, cacheFilename string) error {
-	filename := func() string {
-		if url == "" {
-			return ""
+// validate validates the sha sum of cacheFilename and returns the verified sum.
+func (s SHA) validate(host runner, userAgent, url, cacheFilename string) (string, error) {
+	sum, err := s.expected(host, userAgent, url)
+	if err != nil {
+		return "", err
+	}
+	return sum, s.check(host, sum, cacheFilename)
+}
+
+// expected returns the expected sha sum of the file downloaded from url,
+// retrieved from s.URL unless pinned with s.Sum.
+func (s SHA) expected(host runner, userAgent, url string) (string, error) {
+	sum := s.Sum
+	if sum == "" {
+		out, err := host.RunOutput("curl", "-sL", "-A", userAgent, s.URL)
+		if err != nil {
+			return "", fmt.Errorf("error retrieving sha sum: %w", err)
 		}
-		split := strings.Split(url, "/")
-		return split[len(split)-1]
-	}()
+		sum, err = shaSumFor(out, path.Base(url))
+		if err != nil {
+			return "", err
+		}
+	}
+	if !shaSumRegex.MatchString(sum) {
+		return "", fmt.Errorf("invalid sha sum '%s'", sum)
+	}
+	return sum, nil
+}
+
+// check verifies the sha sum of cacheFilename is sum.
+func (s SHA) check(host runner, sum, cacheFilename string) error {
 	dir, cacheFilename := filepath.Split(cacheFilename)
 
 	script := strings.NewReplacer(
-		"{dir}", dir,
-		"{url}", s.URL,
-		"{filename}", filename,
+		"{dir}", util.ShellQuote(dir),
+		"{sum}", sum,
 		"{size}", strconv.Itoa(s.Size),
 		"{cache_filename}", cacheFilename,
 	).Replace(
-		`cd {dir} && echo "$(curl -sL {url} | grep '  {filename}$' | awk -F' ' '{print $1}')  {cache_filename}" | shasum -a {size} --check --status`,
+		`cd {dir} && echo "{sum}  {cache_filename}" | shasum -a {size} --check --status`,
 	)
 
 	return host.Run("sh", "-c", script)
 }
 
+// shaSumRegex matches a hex encoded sha sum.
+var shaSumRegex = regexp.MustCompile(`^[0-9a-fA-F]+$`)
+
+// shaSumFor returns the sum for filename in the contents of a shasum file, with lines in
+// the form "<sum>  <filename>". Binary mode entries "<sum> *<filename>" are also matched.
+func shaSumFor(shaSums, filename string) (string, error) {
+	for _, line := range strings.Split(shaSums, "\n") {
+		fields := strings.Fields(line)
+		if len(fields) == 2 && strings.TrimPrefix(fields[1], "*") == filename {
+			return fields[0], nil
+		}
+	}
+	return "", fmt.Errorf("sha sum for '%s' not found", filename)
+}
+
 // Request is download request
 type Request struct {
-	URL      string // request URL
-	SHA      *SHA   // shasum url
-	Filename string // destination file name (absolute path)
+	URL       string        // request URL
+	SHA       *SHA          // shasum url
+	Filename  string        // destination file name (absolute path)
+	UserAgent string        // user agent for the requests, DefaultUserAgent if empty
+	Timeout   time.Duration // timeout for a stalled download attempt, DefaultTimeout if zero
+	// BufferSize is the size in bytes of the buffer copying the file to the guest.
+	// The copy uses cp with its default buffer if zero.
+	BufferSize int
+	// Mode is where the file is downloaded, the mode set with SetMode if empty.
+	Mode Mode
+	// Registries are the credentials of the registries of OCI artifacts by registry host.
+	Registries map[string]RegistryAuth
 }
 
+// DefaultTimeout is the default timeout for a stalled download attempt.
+// A transfer that receives no data for the timeout is aborted and resumed by the next attempt.
+// The total duration of a transfer is not limited, slow downloads of large assets complete.
+const DefaultTimeout = 5 * time.Minute
+
+// DefaultUserAgent returns the default user agent for download requests.
+func DefaultUserAgent() string { return "colima/" + config.AppVersion().Version }
+
 // Download downloads file at url and saves it in the destination.
 //
 // In the implementation, the file is downloaded (and cached) on the host, but copied to the desired
 // destination for the guest.
 // Request.Filename must be a directory on the guest that does not require root access.
+//
+// Request.URL can also be an OCI artifact reference in the form oci://registry/repository:tag.
 func Download(host hostActions, guest guestActions, r Request) error {
 	d := downloader{
-		host:  host,
-		guest: guest,
+		host:      host,
+		guest:     guest,
+		net:       host,
+		userAgent: r.UserAgent,
+		timeout:   r.Timeout,
+	}
+	if d.userAgent == "" {
+		d.userAgent = DefaultUserAgent()
+	}
+	if d.timeout <= 0 {
+		d.timeout = DefaultTimeout
+	}
+
+	if r.BufferSize < 0 {
+		return fmt.Errorf("invalid buffer size %d, must not be negative", r.BufferSize)
 	}
 
 	// if file is on the filesystem, no need for download. A copy suffices
 	if strings.HasPrefix(r.URL, "/") {
-		return guest.RunQuiet("cp", r.URL, r.Filename)
+		return copyFile(guest, r.URL, r.Filename, r.BufferSize)
+	}
+
+	mode, err := r.mode()
+	if err != nil {
+		return err
+	}
+	if mode == ModeGuest {
+		d.net = guest
+	}
+
+	// OCI artifacts are downloaded from the registry blob
+	if strings.HasPrefix(r.URL, ociScheme) {
+		resolved, authorization, err := d.resolveOCI(r)
+		if err != nil {
+			return fmt.Errorf("error resolving OCI artifact '%s': %w", r.URL, err)
+		}
+		r = resolved
+		d.authorization = authorization
+		d.authorizationHost = hostname(r.URL)
+	}
+
+	if mode == ModeGuest {
+		downloads.acquire()
+		err := d.downloadGuest(r)
+		downloads.release()
+		if err != nil {
+			return fmt.Errorf("error downloading '%s' in the guest: %w", r.URL, err)
+		}
+		return nil
+	}
+
+	if d.hasCache(r.URL) && r.SHA != nil {
+		if err := d.verifyCache(r); err != nil {
+			logrus.Warnln(fmt.Errorf("cached '%s' is invalid, downloading again: %w", filepath.Base(r.Filename), err))
+			if err := d.host.RunQuiet("rm", "-f", d.cacheFilename(r.URL), metaFilename(d.cacheFilename(r.URL))); err != nil {
+				return fmt.Errorf("error removing invalid cache: %w", err)
+			}
+		}
 	}
 
 	if !d.hasCache(r.URL) {
-		if err := d.downloadFile(r); err != nil {
+		downloads.acquire()
+		err := d.downloadFile(r)
+		downloads.release()
+		if err != nil {
 			return fmt.Errorf("error downloading '%s': %w", r.URL, err)
 		}
 	}
 
-	return guest.RunQuiet("cp", d.cacheFilename(r.URL), r.Filename)
+	return copyFile(guest, d.cacheFilename(r.URL), r.Filename, r.BufferSize)
+}
+
+// Verify verifies the checksum of the guest file r.Filename downloaded from r.URL against r.SHA.
+// The sha sum file of r.SHA is retrieved in the guest. It is a no-op if r.SHA is nil.
+func Verify(guest guestActions, r Request) error {
+	if r.SHA == nil {
+		return nil
+	}
+	userAgent := r.UserAgent
+	if userAgent == "" {
+		userAgent = DefaultUserAgent()
+	}
+	_, err := r.SHA.validate(guest, userAgent, r.URL, r.Filename)
+	return err
+}
+
+// copyFile copies the host file src mounted in the guest to dst in the guest.
+// dd is used for the copy with bufferSize if set, cp otherwise.
+func copyFile(guest guestActions, src, dst string, bufferSize int) error {
+	if bufferSize > 0 {
+		return guest.RunQuiet("dd", "if="+src, "of="+dst, "bs="+strconv.Itoa(bufferSize), "status=none")
+	}
+	return guest.RunQuiet("cp", src, dst)
 }
 
 type downloader struct {
 	host  hostActions
 	guest guestActions
+	// net runs the network requests, the host for ModeHost and the guest for ModeGuest.
+	net       runner
+	userAgent string
+	timeout   time.Duration
+	// authorization is the Authorization header for the requests to authorizationHost.
+	// It is not sent to other hosts e.g. the storage a registry redirects blob requests to.
+	authorization     string
+	authorizationHost string
+}
+
+// headerArgs returns the curl args for the headers of the requests to url.
+func (d downloader) headerArgs(url string) []string {
+	if d.authorization == "" || hostname(url) != d.authorizationHost {
+		return nil
+	}
+	return []string{"-H", "Authorization: " + d.authorization}
+}
+
+// hostname returns the host of rawURL, empty if invalid.
+func hostname(rawURL string) string {
+	u, err := url.Parse(rawURL)
+	if err != nil {
+		return ""
+	}
+	return u.Host
+}
+
+// stallArgs returns the curl args aborting a request that receives no data for the timeout.
+// curl aborts if the speed is below the limit of 1 byte/s for the duration.
+func (d downloader) stallArgs() []string {
+	return []string{"--speed-limit", "1", "--speed-time", strconv.Itoa(int(math.Ceil(d.timeout.Seconds())))}
 }
 
 func (d downloader) cacheFilename(url string) string {
@@ -99,22 +280,22 @@ func (d downloader) downloadFile(r Request) (err error) {
 		return fmt.Errorf("error preparing cache dir: %w", err)
 	}
 
-	// get rid of curl's initial progress bar by getting the redirect url directly.
-	downloadURL, err := d.host.RunOutput("curl", "-Ls", "-o", "/dev/null", "-w", "%{url_effective}", r.URL)
+	downloadURL, err := d.downloadURL(r.URL)
 	if err != nil {
-		return fmt.Errorf("error retrieving redirect url: %w", err)
+		return err
 	}
 
-	// ask curl to resume previous download if possible "-C -"
-	if err := d.host.RunInteractive("curl", "-L", "-#", "-C", "-", "-o", cacheDownloadingFilename, downloadURL); err != nil {
+	if err := d.transfer(cacheDownloadingFilename, downloadURL); err != nil {
 		return err
 	}
 	// clear curl progress line
 	terminal.ClearLine()
 
 	// validate download if sha is present
+	var sum string
 	if r.SHA != nil {
-		if err := r.SHA.validate(d.host, r.URL, cacheDownloadingFilename); err != nil {
+		sum, err = r.SHA.validate(d.host, d.userAgent, r.URL, cacheDownloadingFilename)
+		if err != nil {
 
 			// move file to allow subsequent re-download
 			// error discarded, would not be actioned anyways
@@ -124,7 +305,169 @@ func (d downloader) downloadFile(r Request) (err error) {
 		}
 	}
 
-	return d.host.RunQuiet("mv", cacheDownloadingFilename, d.cacheFilename(r.URL))
+	if err := d.host.RunQuiet("mv", cacheDownloadingFilename, d.cacheFilename(r.URL)); err != nil {
+		return err
+	}
+
+	if sum != "" {
+		// a missing metadata only results in re-verification
+		if err := writeCacheMeta(d.cacheFilename(r.URL), sum); err != nil {
+			logrus.Warnln(fmt.Errorf("error saving cache metadata: %w", err))
+		}
+	}
+	return nil
+}
+
+// downloadGuest downloads r directly to the destination in the guest.
+// The file is not cached on the host.
+func (d downloader) downloadGuest(r Request) error {
+	downloadingFilename := r.Filename + ".downloading"
+
+	downloadURL, err := d.downloadURL(r.URL)
+	if err != nil {
+		return err
+	}
+	if err := d.transfer(downloadingFilename, downloadURL); err != nil {
+		return err
+	}
+	// clear curl progress line
+	terminal.ClearLine()
+
+	if r.SHA != nil {
+		if _, err := r.SHA.validate(d.guest, d.userAgent, r.URL, downloadingFilename); err != nil {
+			_ = d.guest.RunQuiet("rm", "-f", downloadingFilename)
+			return fmt.Errorf("error validating SHA sum for '%s': %w", filepath.Base(r.Filename), err)
+		}
+	}
+
+	return d.guest.RunQuiet("mv", downloadingFilename, r.Filename)
+}
+
+// downloadURL returns the url url redirects to, to get rid of curl's initial progress bar.
+// Only retryable status codes are retried.
+func (d downloader) downloadURL(url string) (downloadURL string, err error) {
+	for attempt := 1; ; attempt++ {
+		downloadURL, err = d.redirectURL(url)
+		if err == nil {
+			return downloadURL, nil
+		}
+
+		var statusErr StatusError
+		if !errors.As(err, &statusErr) || !statusErr.Retryable() || attempt >= maxAttempts {
+			return "", err
+		}
+
+		interval := retryInterval
+		if statusErr.RetryAfter > 0 {
+			interval = statusErr.RetryAfter
+		}
+		logrus.Warnln(fmt.Errorf("%w, retrying in %v", statusErr, interval))
+		sleep(interval)
+	}
+}
+
+const (
+	// maxAttempts is the maximum number of attempts for retryable HTTP statuses.
+	maxAttempts = 3
+	// retryInterval is the interval between attempts if not specified by the server.
+	retryInterval = time.Second * 5
+)
+
+const (
+	// curlRangeError is the curl exit code when the server does not support ranges.
+	curlRangeError = 33
+	// curlTimeoutError is the curl exit code when the operation times out or stalls.
+	curlTimeoutError = 28
+)
+
+// transfer downloads url to filename.
+// Interrupted transfers are resumed from the partially downloaded file when
+// the server supports it, otherwise the download is restarted.
+func (d downloader) transfer(filename, url string) (err error) {
+	for attempt := 1; attempt <= maxAttempts; attempt++ {
+		// ask curl to resume previous download if possible "-C -"
+		// a stalled attempt is aborted by curl, stalled connections do not error otherwise
+		args := append([]string{"curl", "-L", "--fail", "-#", "-C", "-", "-A", d.userAgent}, d.stallArgs()...)
+		args = append(args, d.headerArgs(url)...)
+		err = d.net.RunInteractive(append(args, "-o", filename, url)...)
+		if err == nil {
+			return nil
+		}
+
+		var exitErr interface{ ExitCode() int }
+		isExit := errors.As(err, &exitErr)
+		if isExit && exitErr.ExitCode() == curlTimeoutError {
+			err = fmt.Errorf("download timed out, no data received for %v: %w", d.timeout, err)
+			if attempt < maxAttempts {
+				logrus.Warnf("download stalled for %v, resuming in %v", d.timeout, retryInterval)
+				sleep(retryInterval)
+			}
+			continue
+		}
+		if isExit && exitErr.ExitCode() == curlRangeError {
+			logrus.Warnln("server does not support resuming downloads, restarting download")
+			if err := d.net.RunQuiet("rm", "-f", filename); err != nil {
+				return fmt.Errorf("error removing partial download: %w", err)
+			}
+			continue
+		}
+
+		if attempt < maxAttempts {
+			logrus.Warnln(fmt.Errorf("download interrupted, resuming in %v: %w", retryInterval, err))
+			sleep(retryInterval)
+		}
+	}
+	return err
+}
+
+// sleep is swapped in tests.
+var sleep = time.Sleep
+
+// redirectURL returns the url that url redirects to.
+// StatusError is returned for unsuccessful HTTP statuses.
+func (d downloader) redirectURL(url string) (string, error) {
+	args := append([]string{"curl", "-Ls", "-A", d.userAgent}, d.stallArgs()...)
+	args = append(args, d.headerArgs(url)...)
+	out, err := d.net.RunOutput(append(args, "-o", "/dev/null", "-D", "-", "-w", "%{http_code} %{url_effective}", url)...)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving redirect url: %w", err)
+	}
+	return parseResponse(url, out)
+}
+
+// verifyCache verifies the sha sum of the cache file for r.
+// The verification is skipped if the file is unchanged since it was last verified
+// against the expected sum. If the expected sum cannot be retrieved e.g. offline,
+// an unchanged file is not verified again.
+func (d downloader) verifyCache(r Request) error {
+	cacheFilename := d.cacheFilename(r.URL)
+	info, err := os.Stat(cacheFilename)
+	if err != nil {
+		return err
+	}
+
+	meta, metaErr := readCacheMeta(cacheFilename)
+	if metaErr == nil && meta.Size != info.Size() {
+		return fmt.Errorf("size changed from %d to %d", meta.Size, info.Size())
+	}
+	unchanged := metaErr == nil && meta.ModTime.Equal(info.ModTime())
+
+	sum, err := r.SHA.expected(d.host, d.userAgent, r.URL)
+	if err != nil {
+		if unchanged {
+			logrus.Warnln(fmt.Errorf("using cached '%s' verified previously: %w", filepath.Base(r.Filename), err))
+			return nil
+		}
+		return fmt.Errorf("error validating SHA sum: %w", err)
+	}
+	if unchanged && strings.EqualFold(meta.SHA, sum) {
+		return nil
+	}
+
+	if err := r.SHA.check(d.host, sum, cacheFilename); err != nil {
+		return fmt.Errorf("error validating SHA sum: %w", err)
+	}
+	return writeCacheMeta(cacheFilename, sum)
 }
 
 func (d downloader) hasCache(url string) bool {
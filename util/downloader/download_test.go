@@ -0,0 +1,633 @@
+package downloader
+
+import (
+	"context"
+	"errors"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"github.com/abiosoft/colima/config"
+	"github.com/abiosoft/colima/environment"
+)
+
+var _ environment.HostActions = (*fakeHost)(nil)
+
+type fakeHost struct {
+	commands []string
+	// responses are the successive outputs of curl requests for the redirect url.
+	responses []string
+	// transferErrs are the successive errors for the curl file transfers.
+	transferErrs []error
+	// onTransfer is called for each curl file transfer, if set.
+	onTransfer func()
+	// checkErrs are the successive errors for the sha sum checks.
+	checkErrs []error
+}
+
+func (f *fakeHost) run(args ...string) error {
+	cmd := strings.Join(args, " ")
+	f.commands = append(f.commands, cmd)
+	if strings.HasPrefix(cmd, "sh -c ") && strings.Contains(cmd, "shasum") && len(f.checkErrs) > 0 {
+		err := f.checkErrs[0]
+		f.checkErrs = f.checkErrs[1:]
+		return err
+	}
+	return nil
+}
+
+func (f *fakeHost) Run(args ...string) error      { return f.run(args...) }
+func (f *fakeHost) RunQuiet(args ...string) error { return f.run(args...) }
+func (f *fakeHost) RunOutput(args ...string) (string, error) {
+	if err := f.run(args...); err != nil {
+		return "", err
+	}
+	if len(f.responses) == 0 {
+		return "", errors.New("no response")
+	}
+	resp := f.responses[0]
+	f.responses = f.responses[1:]
+	return resp, nil
+}
+func (f *fakeHost) RunInteractive(args ...string) error {
+	if err := f.run(args...); err != nil {
+		return err
+	}
+	if f.onTransfer != nil {
+		f.onTransfer()
+	}
+	if len(f.transferErrs) == 0 {
+		return nil
+	}
+	err := f.transferErrs[0]
+	f.transferErrs = f.transferErrs[1:]
+	return err
+}
+func (f *fakeHost) RunWith(stdin io.Reader, stdout io.Writer, args ...string) error {
+	return f.run(args...)
+}
+func (f *fakeHost) Read(string) (string, error)               { return "", nil }
+func (f *fakeHost) Write(string, []byte) error                { return nil }
+func (f *fakeHost) Stat(string) (os.FileInfo, error)          { return nil, os.ErrNotExist }
+func (f *fakeHost) WithEnv(...string) environment.HostActions { return f }
+func (f *fakeHost) WithDir(string) environment.HostActions    { return f }
+func (f *fakeHost) Env(string) string                         { return "" }
+
+// count returns the number of commands with prefix.
+func (f *fakeHost) count(prefix string) (n int) {
+	for _, cmd := range f.commands {
+		if strings.HasPrefix(cmd, prefix) {
+			n++
+		}
+	}
+	return
+}
+
+var _ environment.GuestActions = (*fakeGuest)(nil)
+
+type fakeGuest struct {
+	commands []string
+	// responses are the successive outputs of the commands with output.
+	responses []string
+}
+
+func (f *fakeGuest) run(args ...string) error {
+	f.commands = append(f.commands, strings.Join(args, " "))
+	return nil
+}
+
+func (f *fakeGuest) Run(args ...string) error      { return f.run(args...) }
+func (f *fakeGuest) RunQuiet(args ...string) error { return f.run(args...) }
+func (f *fakeGuest) RunOutput(args ...string) (string, error) {
+	if err := f.run(args...); err != nil || len(f.responses) == 0 {
+		return "", err
+	}
+	resp := f.responses[0]
+	f.responses = f.responses[1:]
+	return resp, nil
+}
+func (f *fakeGuest) RunInteractive(args ...string) error { return f.run(args...) }
+func (f *fakeGuest) RunWith(stdin io.Reader, stdout io.Writer, args ...string) error {
+	return f.run(args...)
+}
+func (f *fakeGuest) Read(string) (string, error)                { return "", nil }
+func (f *fakeGuest) Write(string, []byte) error                 { return nil }
+func (f *fakeGuest) Stat(string) (os.FileInfo, error)           { return nil, os.ErrNotExist }
+func (f *fakeGuest) Start(context.Context, config.Config) error { return nil }
+func (f *fakeGuest) Stop(context.Context, bool) error           { return nil }
+func (f *fakeGuest) Restart(context.Context) error              { return nil }
+func (f *fakeGuest) SSH(string, ...string) error                { return nil }
+func (f *fakeGuest) Created() bool                              { return true }
+func (f *fakeGuest) Running(context.Context) bool               { return true }
+func (f *fakeGuest) Env(string) (string, error)                 { return "", nil }
+func (f *fakeGuest) Get(string) string                          { return "" }
+func (f *fakeGuest) Set(string, string) error                   { return nil }
+func (f *fakeGuest) User() (string, error)                      { return "user", nil }
+func (f *fakeGuest) Arch() environment.Arch                     { return environment.X8664 }
+
+// setup sets a temporary cache dir and records sleep durations.
+func setup(t *testing.T) *[]time.Duration {
+	t.Setenv("XDG_CACHE_HOME", t.TempDir())
+
+	var sleeps []time.Duration
+	sleep = func(d time.Duration) { sleeps = append(sleeps, d) }
+	t.Cleanup(func() { sleep = time.Sleep })
+	return &sleeps
+}
+
+func TestDownload_status(t *testing.T) {
+	const url = "https://example.com/k3s"
+
+	tests := []struct {
+		name      string
+		responses []string
+		wantErr   bool
+		wantCode  int
+		attempts  int
+		sleeps    []time.Duration
+	}{
+		{
+			name:      "success",
+			responses: []string{"HTTP/2 302\nlocation: https://cdn.example.com/k3s\n\nHTTP/2 200\n\n200 https://cdn.example.com/k3s"},
+			attempts:  1,
+		},
+		{
+			name:      "not found",
+			responses: []string{"HTTP/2 404\n\n404 " + url},
+			wantErr:   true,
+			wantCode:  404,
+			attempts:  1,
+		},
+		{
+			name:      "service unavailable",
+			responses: []string{"HTTP/2 503\n\n503 " + url, "HTTP/2 200\n\n200 " + url},
+			attempts:  2,
+			sleeps:    []time.Duration{retryInterval},
+		},
+		{
+			name:      "too many requests",
+			responses: []string{"HTTP/2 429\nretry-after: 2\n\n429 " + url, "HTTP/2 200\n\n200 " + url},
+			attempts:  2,
+			sleeps:    []time.Duration{time.Second * 2},
+		},
+		{
+			name:      "exhausted",
+			responses: []string{"HTTP/2 502\n\n502 " + url, "HTTP/2 502\n\n502 " + url, "HTTP/2 502\n\n502 " + url},
+			wantErr:   true,
+			wantCode:  502,
+			attempts:  maxAttempts,
+			sleeps:    []time.Duration{retryInterval, retryInterval},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sleeps := setup(t)
+			host := &fakeHost{responses: tt.responses}
+
+			err := Download(host, &fakeGuest{}, Request{URL: url, Filename: "/tmp/k3s"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantCode != 0 {
+				var statusErr StatusError
+				if !errors.As(err, &statusErr) || statusErr.Code != tt.wantCode {
+					t.Errorf("Download() error = %v, want status %d", err, tt.wantCode)
+				}
+			}
+			if got := host.count("curl -Ls"); got != tt.attempts {
+				t.Errorf("attempts = %d, want %d", got, tt.attempts)
+			}
+			if len(*sleeps) != len(tt.sleeps) {
+				t.Fatalf("sleeps = %v, want %v", *sleeps, tt.sleeps)
+			}
+			for i := range tt.sleeps {
+				if (*sleeps)[i] != tt.sleeps[i] {
+					t.Errorf("sleeps = %v, want %v", *sleeps, tt.sleeps)
+				}
+			}
+		})
+	}
+}
+
+type exitError int
+
+func (e exitError) Error() string { return "exit status " + strconv.Itoa(int(e)) }
+func (e exitError) ExitCode() int { return int(e) }
+
+func TestDownload_resume(t *testing.T) {
+	const url = "https://example.com/k3s-airgap-images-amd64.tar.gz"
+
+	tests := []struct {
+		name         string
+		transferErrs []error
+		wantErr      bool
+		transfers    int
+		restarted    bool
+	}{
+		{name: "uninterrupted", transfers: 1},
+		{name: "resumed", transferErrs: []error{exitError(18)}, transfers: 2},
+		{name: "range not supported", transferErrs: []error{exitError(18), exitError(curlRangeError)}, transfers: 3, restarted: true},
+		{name: "failed", transferErrs: []error{exitError(56), exitError(56), exitError(56)}, transfers: maxAttempts, wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			host := &fakeHost{responses: []string{"200 " + url}, transferErrs: tt.transferErrs}
+
+			err := Download(host, &fakeGuest{}, Request{URL: url, Filename: "/tmp/k3s-airgap-images-amd64.tar.gz"})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+
+			// every transfer resumes the partial download
+			if got := host.count("curl -L --fail -# -C -"); got != tt.transfers {
+				t.Errorf("transfers = %d, want %d", got, tt.transfers)
+			}
+			if restarted := host.count("rm -f") > 0; restarted != tt.restarted {
+				t.Errorf("restarted = %v, want %v", restarted, tt.restarted)
+			}
+		})
+	}
+}
+
+func TestDownload_timeout(t *testing.T) {
+	const url = "https://example.com/k3s-airgap-images-amd64.tar.gz"
+
+	tests := []struct {
+		name         string
+		timeout      time.Duration
+		speedTime    string
+		transferErrs []error
+		wantErr      bool
+		transfers    int
+	}{
+		{name: "default", speedTime: "300", transfers: 1},
+		{name: "configured", timeout: 90 * time.Second, speedTime: "90", transfers: 1},
+		{name: "stalled", speedTime: "300", transferErrs: []error{exitError(curlTimeoutError)}, transfers: 2},
+		{
+			name:         "always stalled",
+			speedTime:    "300",
+			transferErrs: []error{exitError(curlTimeoutError), exitError(curlTimeoutError), exitError(curlTimeoutError)},
+			transfers:    maxAttempts,
+			wantErr:      true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			host := &fakeHost{responses: []string{"200 " + url}, transferErrs: tt.transferErrs}
+
+			err := Download(host, &fakeGuest{}, Request{URL: url, Filename: "/tmp/k3s-airgap-images-amd64.tar.gz", Timeout: tt.timeout})
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if tt.wantErr && !strings.Contains(err.Error(), "timed out") {
+				t.Errorf("expected timeout error, got %v", err)
+			}
+
+			// the stalled attempt is aborted by curl and the next attempt resumes it
+			if got := host.count("curl -L --fail -# -C -"); got != tt.transfers {
+				t.Errorf("transfers = %d, want %d", got, tt.transfers)
+			}
+			for _, cmd := range host.commands {
+				if !strings.HasPrefix(cmd, "curl") {
+					continue
+				}
+				if !strings.Contains(cmd, " --speed-limit 1 --speed-time "+tt.speedTime+" ") {
+					t.Errorf("curl without stall timeout of %ss: %s", tt.speedTime, cmd)
+				}
+				// the total duration is not limited
+				if strings.Contains(cmd, "--max-time") {
+					t.Errorf("curl with a limited duration: %s", cmd)
+				}
+			}
+		})
+	}
+}
+
+func TestDownload_cacheMeta(t *testing.T) {
+	const url = "https://example.com/k3s"
+
+	tests := []struct {
+		name      string
+		modify    func(t *testing.T, file string)
+		sum       string // pinned sum
+		responses []string
+		checkErrs []error
+		verified  bool
+		removed   bool
+	}{
+		{name: "unchanged", responses: []string{"abc  k3s"}},
+		{name: "unchanged pinned", sum: "abc"},
+		// the sum of the sha sum file is unavailable
+		{name: "unchanged offline"},
+		{
+			// verified against a different sum e.g. a new pin or an updated sha sum file
+			name:      "sum changed",
+			sum:       "def",
+			checkErrs: []error{errors.New("mismatch")},
+			verified:  true,
+			removed:   true,
+		},
+		{
+			name:      "sum changed upstream",
+			responses: []string{"def  k3s", "200 " + url, "def  k3s"},
+			checkErrs: []error{errors.New("mismatch")},
+			verified:  true,
+			removed:   true,
+		},
+		{
+			name: "modified",
+			modify: func(t *testing.T, file string) {
+				mtime := time.Now().Add(time.Hour)
+				if err := os.Chtimes(file, mtime, mtime); err != nil {
+					t.Fatal(err)
+				}
+			},
+			responses: []string{"abc  k3s"},
+			verified:  true,
+		},
+		{
+			name: "size changed",
+			modify: func(t *testing.T, file string) {
+				if err := os.WriteFile(file, []byte("corrupt"), 0644); err != nil {
+					t.Fatal(err)
+				}
+			},
+			removed: true,
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			host := &fakeHost{responses: tt.responses, checkErrs: tt.checkErrs}
+
+			cacheFile := downloader{host: host}.cacheFilename(url)
+			if err := os.MkdirAll(filepath.Dir(cacheFile), 0755); err != nil {
+				t.Fatal(err)
+			}
+			if err := os.WriteFile(cacheFile, []byte("k3s"), 0644); err != nil {
+				t.Fatal(err)
+			}
+			if err := writeCacheMeta(cacheFile, "abc"); err != nil {
+				t.Fatal(err)
+			}
+			if tt.modify != nil {
+				tt.modify(t, cacheFile)
+			}
+
+			r := Request{URL: url, Filename: "/tmp/k3s", SHA: &SHA{Size: 256, URL: url + ".sha256sum", Sum: tt.sum}}
+			if err := Download(host, &fakeGuest{}, r); err != nil {
+				t.Fatal(err)
+			}
+
+			if verified := host.count("sh -c") > 0; verified != tt.verified {
+				t.Errorf("verified = %v, want %v", verified, tt.verified)
+			}
+			if removed := host.count("rm -f "+cacheFile) > 0; removed != tt.removed {
+				t.Errorf("removed = %v, want %v", removed, tt.removed)
+			}
+		})
+	}
+}
+
+func TestDownload_userAgent(t *testing.T) {
+	const url = "https://example.com/k3s"
+
+	tests := []struct {
+		name      string
+		userAgent string
+		want      string
+	}{
+		{name: "default", want: "colima/" + config.AppVersion().Version},
+		{name: "configured", userAgent: "mirror-client/1.0", want: "mirror-client/1.0"},
+		// passed as an argument, not interpreted by a shell
+		{name: "quoted", userAgent: "mirror's client $(id)", want: "mirror's client $(id)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			host := &fakeHost{responses: []string{"200 " + url, "abc  k3s"}}
+
+			r := Request{URL: url, Filename: "/tmp/k3s", UserAgent: tt.userAgent, SHA: &SHA{Size: 256, URL: url + ".sha256sum"}}
+			if err := Download(host, &fakeGuest{}, r); err != nil {
+				t.Fatal(err)
+			}
+
+			for _, prefix := range []string{
+				"curl -Ls -A " + tt.want + " ",
+				"curl -L --fail -# -C - -A " + tt.want + " ",
+				"curl -sL -A " + tt.want + " " + url + ".sha256sum",
+			} {
+				if got := host.count(prefix); got != 1 {
+					t.Errorf("requests with user agent %s = %d, want 1 in %+v", tt.want, got, host.commands)
+				}
+			}
+		})
+	}
+}
+
+func Test_shaSumFor(t *testing.T) {
+	const sums = `aaa  k3s
+bbb  k3s-airgap-images-amd64.tar.gz
+ccc *k3s-arm64
+ddd  k3s.sig
+`
+	tests := []struct {
+		filename string
+		want     string
+		wantErr  bool
+	}{
+		{filename: "k3s", want: "aaa"},
+		{filename: "k3s-airgap-images-amd64.tar.gz", want: "bbb"},
+		{filename: "k3s-arm64", want: "ccc"},
+		{filename: "k3s-airgap-images-arm64.tar.gz", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.filename, func(t *testing.T) {
+			got, err := shaSumFor(sums, tt.filename)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("shaSumFor() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("shaSumFor() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownload_invalidSum(t *testing.T) {
+	const url = "https://example.com/k3s"
+	setup(t)
+
+	// the sum is not substituted into the verification script
+	host := &fakeHost{responses: []string{"200 " + url, `abc";touch${IFS}/tmp/pwned;"  k3s`}}
+	r := Request{URL: url, Filename: "/tmp/k3s", SHA: &SHA{Size: 256, URL: url + ".sha256sum"}}
+	if err := Download(host, &fakeGuest{}, r); err == nil {
+		t.Fatal("expected an error for an invalid sha sum")
+	}
+	if got := host.count("sh -c"); got != 0 {
+		t.Errorf("unexpected verification with an invalid sum in %+v", host.commands)
+	}
+}
+
+func TestDownload_bufferSize(t *testing.T) {
+	const url = "https://example.com/k3s"
+
+	tests := []struct {
+		name       string
+		url        string
+		bufferSize int
+		want       string
+	}{
+		{name: "default", url: url, want: "cp {cache} /tmp/k3s"},
+		{name: "configured", url: url, bufferSize: 1 << 20, want: "dd if={cache} of=/tmp/k3s bs=1048576 status=none"},
+		{name: "local file", url: "/Users/user/k3s", bufferSize: 4096, want: "dd if=/Users/user/k3s of=/tmp/k3s bs=4096 status=none"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			host := &fakeHost{responses: []string{"200 " + url}}
+			guest := &fakeGuest{}
+
+			r := Request{URL: tt.url, Filename: "/tmp/k3s", BufferSize: tt.bufferSize}
+			if err := Download(host, guest, r); err != nil {
+				t.Fatal(err)
+			}
+
+			want := strings.ReplaceAll(tt.want, "{cache}", downloader{}.cacheFilename(url))
+			if len(guest.commands) != 1 || guest.commands[0] != want {
+				t.Errorf("copy = %+v, want %s", guest.commands, want)
+			}
+		})
+	}
+
+	t.Run("negative", func(t *testing.T) {
+		setup(t)
+		if err := Download(&fakeHost{}, &fakeGuest{}, Request{URL: url, Filename: "/tmp/k3s", BufferSize: -1}); err == nil {
+			t.Error("expected error for a negative buffer size")
+		}
+	})
+}
+
+func TestVerify(t *testing.T) {
+	const url = "https://example.com/k3s"
+
+	guest := &fakeGuest{responses: []string{"abc  k3s"}}
+	r := Request{URL: url, Filename: "/var/cache/colima/k3s/v1/k3s", SHA: &SHA{Size: 256, URL: url + ".sha256sum"}}
+	if err := Verify(guest, r); err != nil {
+		t.Fatal(err)
+	}
+	// the sum of the url is retrieved and checked in the guest for the file
+	for _, prefix := range []string{
+		"curl -sL -A colima/",
+		`sh -c cd '/var/cache/colima/k3s/v1/' && echo "abc  k3s" | shasum -a 256 --check`,
+	} {
+		if !hasPrefix(guest.commands, prefix) {
+			t.Errorf("guest command with prefix %q not found in %+v", prefix, guest.commands)
+		}
+	}
+
+	guest = &fakeGuest{}
+	r.SHA = nil
+	if err := Verify(guest, r); err != nil || len(guest.commands) != 0 {
+		t.Errorf("Verify() without a sha = %v, commands %+v", err, guest.commands)
+	}
+}
+
+// execHost is a fakeHost running the commands on the host, for transfers from a test server.
+type execHost struct{ fakeHost }
+
+func (e *execHost) exec(args ...string) *exec.Cmd {
+	e.commands = append(e.commands, strings.Join(args, " "))
+	return exec.Command(args[0], args[1:]...)
+}
+
+func (e *execHost) Run(args ...string) error            { return e.exec(args...).Run() }
+func (e *execHost) RunQuiet(args ...string) error       { return e.exec(args...).Run() }
+func (e *execHost) RunInteractive(args ...string) error { return e.exec(args...).Run() }
+func (e *execHost) RunOutput(args ...string) (string, error) {
+	out, err := e.exec(args...).Output()
+	return strings.TrimSpace(string(out)), err
+}
+
+func TestDownload_stalled(t *testing.T) {
+	if _, err := exec.LookPath("curl"); err != nil {
+		t.Skip("curl not found")
+	}
+	const body = "0123456789"
+
+	// slow sends a byte at an interval, taking longer than the timeout in total.
+	slow := func(w http.ResponseWriter, r *http.Request) {
+		for i := range body {
+			if _, err := w.Write([]byte{body[i]}); err != nil {
+				return
+			}
+			w.(http.Flusher).Flush()
+			time.Sleep(time.Millisecond * 200)
+		}
+	}
+
+	// stalled stops sending after the first bytes for the first transfer, following the
+	// redirect lookup. The next transfer resumes it.
+	var requests atomic.Int32
+	stalled := func(w http.ResponseWriter, r *http.Request) {
+		if requests.Add(1) != 2 {
+			http.ServeContent(w, r, "", time.Time{}, strings.NewReader(body))
+			return
+		}
+		w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+		_, _ = w.Write([]byte(body[:3]))
+		w.(http.Flusher).Flush()
+		select {
+		case <-r.Context().Done():
+		case <-time.After(time.Second * 10):
+		}
+	}
+
+	tests := []struct {
+		name      string
+		handler   http.HandlerFunc
+		transfers int
+	}{
+		{name: "slow", handler: slow, transfers: 1},
+		{name: "stalled", handler: stalled, transfers: 2},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			server := httptest.NewServer(tt.handler)
+			defer server.Close()
+			url := server.URL + "/k3s"
+
+			host := &execHost{}
+			start := time.Now()
+			if err := Download(host, &fakeGuest{}, Request{URL: url, Filename: "/tmp/k3s", Timeout: time.Second}); err != nil {
+				t.Fatal(err)
+			}
+
+			if got := host.count("curl -L --fail -# -C -"); got != tt.transfers {
+				t.Errorf("transfers = %d, want %d", got, tt.transfers)
+			}
+			// the stalled attempt is aborted long before the server gives up
+			if elapsed := time.Since(start); elapsed > time.Second*8 {
+				t.Errorf("download took %v, stalled attempt not aborted", elapsed)
+			}
+			b, err := os.ReadFile(downloader{}.cacheFilename(url))
+			if err != nil {
+				t.Fatal(err)
+			}
+			if string(b) != body {
+				t.Errorf("downloaded %q, want %q", b, body)
+			}
+		})
+	}
+}
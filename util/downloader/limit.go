@@ -0,0 +1,54 @@
+package downloader
+
+import "sync"
+
+// downloads limits the files downloaded concurrently by the process, across all callers.
+var downloads = newDownloadLimiter(0)
+
+// SetMaxDownloads sets the maximum number of files downloaded concurrently by the process
+// regardless of the caller. Downloads are not limited if n is not positive.
+// Cached files and local copies are not downloads and are not limited.
+func SetMaxDownloads(n int) { downloads.setLimit(n) }
+
+// downloadLimiter is a semaphore with a limit that can be changed while in use.
+// A limit of zero is unlimited.
+type downloadLimiter struct {
+	mu     sync.Mutex
+	cond   *sync.Cond
+	limit  int
+	active int
+}
+
+func newDownloadLimiter(limit int) *downloadLimiter {
+	l := &downloadLimiter{limit: limit}
+	l.cond = sync.NewCond(&l.mu)
+	return l
+}
+
+func (l *downloadLimiter) setLimit(n int) {
+	if n < 0 {
+		n = 0
+	}
+	l.mu.Lock()
+	l.limit = n
+	l.mu.Unlock()
+	l.cond.Broadcast()
+}
+
+// acquire blocks until a download is allowed.
+func (l *downloadLimiter) acquire() {
+	l.mu.Lock()
+	for l.limit > 0 && l.active >= l.limit {
+		l.cond.Wait()
+	}
+	l.active++
+	l.mu.Unlock()
+}
+
+// release releases a download acquired with acquire.
+func (l *downloadLimiter) release() {
+	l.mu.Lock()
+	l.active--
+	l.mu.Unlock()
+	l.cond.Signal()
+}
@@ -0,0 +1,92 @@
+package downloader
+
+import (
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestDownload_maxDownloads(t *testing.T) {
+	setup(t)
+
+	tests := []struct {
+		limit int
+		want  int
+	}{
+		{limit: 1, want: 1},
+		{limit: 2, want: 2},
+		{limit: 0, want: 4}, // unlimited
+	}
+	for _, tt := range tests {
+		t.Run(strconv.Itoa(tt.limit), func(t *testing.T) {
+			SetMaxDownloads(tt.limit)
+			t.Cleanup(func() { SetMaxDownloads(0) })
+
+			var mu sync.Mutex
+			var active, max int
+			transfer := func() {
+				mu.Lock()
+				active++
+				if active > max {
+					max = active
+				}
+				mu.Unlock()
+
+				time.Sleep(time.Millisecond * 50)
+
+				mu.Lock()
+				active--
+				mu.Unlock()
+			}
+
+			// the downloads are from separate callers, each with its own host
+			var wg sync.WaitGroup
+			errs := make([]error, 4)
+			for i := range errs {
+				url := "https://example.com/" + t.Name() + "/asset-" + strconv.Itoa(i)
+				host := &fakeHost{responses: []string{"200 " + url}, onTransfer: transfer}
+				wg.Add(1)
+				go func(i int) {
+					defer wg.Done()
+					errs[i] = Download(host, &fakeGuest{}, Request{URL: url, Filename: "/tmp/asset"})
+				}(i)
+			}
+			wg.Wait()
+
+			for _, err := range errs {
+				if err != nil {
+					t.Fatal(err)
+				}
+			}
+			if max != tt.want {
+				t.Errorf("concurrent downloads = %d, want %d", max, tt.want)
+			}
+		})
+	}
+}
+
+func Test_downloadLimiter_setLimit(t *testing.T) {
+	l := newDownloadLimiter(1)
+	l.acquire()
+
+	acquired := make(chan struct{})
+	go func() {
+		l.acquire()
+		close(acquired)
+	}()
+
+	select {
+	case <-acquired:
+		t.Fatal("expected the download to wait for the limit")
+	case <-time.After(time.Millisecond * 50):
+	}
+
+	// raising the limit unblocks the waiting download
+	l.setLimit(2)
+	select {
+	case <-acquired:
+	case <-time.After(time.Second):
+		t.Fatal("expected the download to proceed after raising the limit")
+	}
+}
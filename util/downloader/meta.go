@@ -0,0 +1,41 @@
+package downloader
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"time"
+)
+
+// cacheMeta is the metadata of a verified cache file.
+// It is stored alongside the cache file to skip re-verifying an unchanged file.
+type cacheMeta struct {
+	SHA     string    `json:"sha"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"modTime"`
+}
+
+func metaFilename(cacheFilename string) string { return cacheFilename + ".meta" }
+
+func readCacheMeta(cacheFilename string) (meta cacheMeta, err error) {
+	b, err := os.ReadFile(metaFilename(cacheFilename))
+	if err != nil {
+		return meta, err
+	}
+	if err := json.Unmarshal(b, &meta); err != nil {
+		return meta, fmt.Errorf("invalid cache metadata: %w", err)
+	}
+	return meta, nil
+}
+
+func writeCacheMeta(cacheFilename, sha string) error {
+	info, err := os.Stat(cacheFilename)
+	if err != nil {
+		return err
+	}
+	b, err := json.Marshal(cacheMeta{SHA: sha, Size: info.Size(), ModTime: info.ModTime()})
+	if err != nil {
+		return fmt.Errorf("error encoding cache metadata: %w", err)
+	}
+	return os.WriteFile(metaFilename(cacheFilename), b, 0644)
+}
@@ -0,0 +1,48 @@
+package downloader
+
+import "fmt"
+
+// Mode is where files are downloaded, for network topologies where only one of the
+// host and the guest has connectivity.
+type Mode string
+
+const (
+	// ModeHost downloads files on the host and copies them to the guest, the default.
+	// The downloads are cached on the host.
+	ModeHost Mode = "host"
+	// ModeGuest downloads files directly in the guest, the downloads are not cached.
+	ModeGuest Mode = "guest"
+)
+
+// defaultMode is the mode of the requests without a mode.
+var defaultMode = ModeHost
+
+// ParseMode parses the download mode, ModeHost if empty.
+func ParseMode(mode string) (Mode, error) {
+	switch Mode(mode) {
+	case "":
+		return ModeHost, nil
+	case ModeHost, ModeGuest:
+		return Mode(mode), nil
+	}
+	return "", fmt.Errorf("invalid download mode '%s', must be one of %s or %s", mode, ModeHost, ModeGuest)
+}
+
+// SetMode sets the mode of the requests without a mode, for the process.
+// An error is returned if mode is invalid.
+func SetMode(mode string) error {
+	m, err := ParseMode(mode)
+	if err != nil {
+		return err
+	}
+	defaultMode = m
+	return nil
+}
+
+// mode returns the mode of r.
+func (r Request) mode() (Mode, error) {
+	if r.Mode == "" {
+		return defaultMode, nil
+	}
+	return ParseMode(string(r.Mode))
+}
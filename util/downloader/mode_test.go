@@ -0,0 +1,112 @@
+package downloader
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestDownload_mode(t *testing.T) {
+	const url = "https://example.com/k3s"
+
+	t.Run("host", func(t *testing.T) {
+		setup(t)
+		host := &fakeHost{responses: []string{"200 " + url, "abc  k3s"}}
+		guest := &fakeGuest{}
+
+		r := Request{URL: url, Filename: "/tmp/k3s", Mode: ModeHost, SHA: &SHA{Size: 256, URL: url + ".sha256sum"}}
+		if err := Download(host, guest, r); err != nil {
+			t.Fatal(err)
+		}
+
+		// downloaded on the host, copied from the host cache to the guest
+		if got := host.count("curl -L --fail"); got != 1 {
+			t.Errorf("host transfers = %d, want 1 in %+v", got, host.commands)
+		}
+		want := "cp " + downloader{}.cacheFilename(url) + " /tmp/k3s"
+		if len(guest.commands) != 1 || guest.commands[0] != want {
+			t.Errorf("guest commands = %+v, want %s", guest.commands, want)
+		}
+	})
+
+	t.Run("guest", func(t *testing.T) {
+		setup(t)
+		host := &fakeHost{}
+		guest := &fakeGuest{responses: []string{"200 " + url, "abc  k3s"}}
+
+		r := Request{URL: url, Filename: "/tmp/k3s", Mode: ModeGuest, SHA: &SHA{Size: 256, URL: url + ".sha256sum"}}
+		if err := Download(host, guest, r); err != nil {
+			t.Fatal(err)
+		}
+
+		// nothing is run on the host, the file is downloaded and verified in the guest
+		if len(host.commands) != 0 {
+			t.Errorf("unexpected host commands %+v", host.commands)
+		}
+		for _, prefix := range []string{
+			"curl -Ls ",
+			"curl -L --fail -# -C - -A colima/",
+			"curl -sL -A colima/",
+			"sh -c cd '/tmp/' && echo \"abc  k3s.downloading\" | shasum -a 256",
+		} {
+			if !hasPrefix(guest.commands, prefix) {
+				t.Errorf("guest command with prefix %q not found in %+v", prefix, guest.commands)
+			}
+		}
+		if last := guest.commands[len(guest.commands)-1]; last != "mv /tmp/k3s.downloading /tmp/k3s" {
+			t.Errorf("expected the download to be moved to the destination, got %s", last)
+		}
+		if (downloader{}).hasCache(url) {
+			t.Error("unexpected host cache for a guest download")
+		}
+	})
+
+	t.Run("default", func(t *testing.T) {
+		setup(t)
+		if err := SetMode(string(ModeGuest)); err != nil {
+			t.Fatal(err)
+		}
+		t.Cleanup(func() { _ = SetMode("") })
+
+		host := &fakeHost{}
+		guest := &fakeGuest{responses: []string{"200 " + url}}
+		if err := Download(host, guest, Request{URL: url, Filename: "/tmp/k3s"}); err != nil {
+			t.Fatal(err)
+		}
+		if len(host.commands) != 0 || !hasPrefix(guest.commands, "curl -L --fail") {
+			t.Errorf("expected the download in the guest, got host %+v, guest %+v", host.commands, guest.commands)
+		}
+	})
+}
+
+func TestParseMode(t *testing.T) {
+	tests := []struct {
+		mode    string
+		want    Mode
+		wantErr bool
+	}{
+		{mode: "", want: ModeHost},
+		{mode: "host", want: ModeHost},
+		{mode: "guest", want: ModeGuest},
+		{mode: "vm", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.mode, func(t *testing.T) {
+			got, err := ParseMode(tt.mode)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseMode() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("ParseMode() = %v, want %v", got, tt.want)
+			}
+		})
+	}
+}
+
+func hasPrefix(commands []string, prefix string) bool {
+	for _, cmd := range commands {
+		if strings.HasPrefix(cmd, prefix) {
+			return true
+		}
+	}
+	return false
+}
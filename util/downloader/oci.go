@@ -0,0 +1,271 @@
+package downloader
+
+import (
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"path/filepath"
+	"strings"
+)
+
+// ociScheme is the URL scheme of OCI artifact references e.g. oci://registry/repo:tag.
+const ociScheme = "oci://"
+
+const (
+	ociManifestType = "application/vnd.oci.image.manifest.v1+json"
+	ociTitle        = "org.opencontainers.image.title"
+)
+
+// ociReference is a reference to an OCI artifact.
+type ociReference struct {
+	registry   string
+	repository string
+	reference  string // tag or digest
+}
+
+// parseOCIReference parses ref in the form oci://registry/repository[:tag|@digest].
+// The tag defaults to latest.
+func parseOCIReference(ref string) (o ociReference, err error) {
+	s := strings.TrimPrefix(ref, ociScheme)
+	registry, repository, ok := strings.Cut(s, "/")
+	if !ok || registry == "" || repository == "" {
+		return o, fmt.Errorf("invalid OCI reference '%s', expected oci://registry/repository:tag", ref)
+	}
+
+	reference := "latest"
+	if repo, digest, ok := strings.Cut(repository, "@"); ok {
+		repository, reference = repo, digest
+	} else if i := strings.LastIndex(repository, ":"); i >= 0 {
+		repository, reference = repository[:i], repository[i+1:]
+	}
+	if repository == "" || reference == "" {
+		return o, fmt.Errorf("invalid OCI reference '%s', expected oci://registry/repository:tag", ref)
+	}
+
+	return ociReference{registry: registry, repository: repository, reference: reference}, nil
+}
+
+func (o ociReference) manifestURL() string {
+	return "https://" + o.registry + "/v2/" + o.repository + "/manifests/" + o.reference
+}
+
+func (o ociReference) blobURL(digest string) string {
+	return "https://" + o.registry + "/v2/" + o.repository + "/blobs/" + digest
+}
+
+type ociManifest struct {
+	MediaType string `json:"mediaType"`
+	Layers    []struct {
+		MediaType   string            `json:"mediaType"`
+		Digest      string            `json:"digest"`
+		Annotations map[string]string `json:"annotations"`
+	} `json:"layers"`
+}
+
+// RegistryAuth is the credentials of a registry, in the form of the auth of the
+// configs in the k3s registries.yaml. https://docs.k3s.io/installation/private-registry
+type RegistryAuth struct {
+	Username      string `yaml:"username,omitempty"`
+	Password      string `yaml:"password,omitempty"`
+	Auth          string `yaml:"auth,omitempty"` // base64 encoded username:password
+	IdentityToken string `yaml:"identity_token,omitempty"`
+}
+
+// basic returns the value of the basic Authorization header, empty if a is without a password.
+func (a RegistryAuth) basic() string {
+	if a.Auth != "" {
+		return "Basic " + a.Auth
+	}
+	if a.Username == "" && a.Password == "" {
+		return ""
+	}
+	return "Basic " + base64.StdEncoding.EncodeToString([]byte(a.Username+":"+a.Password))
+}
+
+// resolveOCI resolves the OCI artifact referenced by r to the request for its blob, and
+// returns the Authorization header for the requests to the registry (if any).
+// The blob is verified against its digest.
+//
+// The blob titled as the base name of r.Filename is used for artifacts with multiple blobs.
+// The credentials of the registry in r.Registries are used for authentication, registries
+// requiring a token are authenticated anonymously without credentials.
+func (d downloader) resolveOCI(r Request) (Request, string, error) {
+	ref, err := parseOCIReference(r.URL)
+	if err != nil {
+		return r, "", err
+	}
+
+	authorization, err := d.ociAuthorization(ref, r.Registries[ref.registry])
+	if err != nil {
+		return r, "", fmt.Errorf("error authenticating with registry '%s': %w", ref.registry, err)
+	}
+
+	args := []string{"curl", "-sL", "--fail", "-A", d.userAgent, "-H", "Accept: " + ociManifestType}
+	if authorization != "" {
+		args = append(args, "-H", "Authorization: "+authorization)
+	}
+	out, err := d.net.RunOutput(append(args, ref.manifestURL())...)
+	if err != nil {
+		return r, "", fmt.Errorf("error retrieving manifest: %w", err)
+	}
+	var manifest ociManifest
+	if err := json.Unmarshal([]byte(out), &manifest); err != nil {
+		return r, "", fmt.Errorf("error decoding manifest: %w", err)
+	}
+
+	var digest string
+	for _, layer := range manifest.Layers {
+		if len(manifest.Layers) == 1 || layer.Annotations[ociTitle] == filepath.Base(r.Filename) {
+			digest = layer.Digest
+			break
+		}
+	}
+	if digest == "" {
+		return r, "", fmt.Errorf("no blob found for '%s' in manifest", filepath.Base(r.Filename))
+	}
+
+	algorithm, sum, _ := strings.Cut(digest, ":")
+	if algorithm != "sha256" && algorithm != "sha512" {
+		return r, "", fmt.Errorf("unsupported digest '%s'", digest)
+	}
+	size := 256
+	if algorithm == "sha512" {
+		size = 512
+	}
+
+	resolved := r
+	resolved.URL = ref.blobURL(digest)
+	resolved.SHA = &SHA{Sum: sum, Size: size}
+	return resolved, authorization, nil
+}
+
+// ociAuthorization returns the Authorization header for the requests to the registry of ref,
+// empty if the registry permits unauthenticated requests.
+//
+// The registry is challenged with an unauthenticated manifest request. A bearer token is
+// retrieved from the token server of the challenge, with the credentials in auth if set.
+// https://distribution.github.io/distribution/spec/auth/token/
+func (d downloader) ociAuthorization(ref ociReference, auth RegistryAuth) (string, error) {
+	out, err := d.net.RunOutput("curl", "-s", "-A", d.userAgent, "-H", "Accept: "+ociManifestType,
+		"-o", "/dev/null", "-D", "-", "-w", "%{http_code} %{url_effective}", ref.manifestURL())
+	if err != nil {
+		return "", fmt.Errorf("error challenging registry: %w", err)
+	}
+	_, err = parseResponse(ref.manifestURL(), out)
+	var statusErr StatusError
+	if err == nil {
+		return "", nil
+	}
+	if !errors.As(err, &statusErr) || statusErr.Code != http.StatusUnauthorized {
+		return "", err
+	}
+
+	scheme, params := parseChallenge(responseHeader(out, "WWW-Authenticate"))
+	switch {
+	case strings.EqualFold(scheme, "basic"):
+		if header := auth.basic(); header != "" {
+			return header, nil
+		}
+		return "", fmt.Errorf("credentials required, none configured for the registry")
+	case !strings.EqualFold(scheme, "bearer") || params["realm"] == "":
+		return "", fmt.Errorf("unsupported authentication challenge '%s'", responseHeader(out, "WWW-Authenticate"))
+	}
+
+	token, err := d.ociToken(ref, params, auth)
+	if err != nil {
+		return "", fmt.Errorf("error retrieving token: %w", err)
+	}
+	return "Bearer " + token, nil
+}
+
+// ociToken retrieves a pull token for ref from the token server of the bearer challenge params.
+func (d downloader) ociToken(ref ociReference, params map[string]string, auth RegistryAuth) (string, error) {
+	scope := params["scope"]
+	if scope == "" {
+		scope = "repository:" + ref.repository + ":pull"
+	}
+
+	args := []string{"curl", "-sL", "--fail", "-A", d.userAgent}
+	if auth.IdentityToken != "" {
+		// the identity token is exchanged with the oauth2 refresh token flow
+		form := url.Values{
+			"grant_type":    {"refresh_token"},
+			"refresh_token": {auth.IdentityToken},
+			"service":       {params["service"]},
+			"scope":         {scope},
+			"client_id":     {"colima"},
+		}
+		args = append(args, "--data", form.Encode(), params["realm"])
+	} else {
+		query := url.Values{"scope": {scope}}
+		if service := params["service"]; service != "" {
+			query.Set("service", service)
+		}
+		if header := auth.basic(); header != "" {
+			args = append(args, "-H", "Authorization: "+header)
+		}
+		sep := "?"
+		if strings.Contains(params["realm"], "?") {
+			sep = "&"
+		}
+		args = append(args, params["realm"]+sep+query.Encode())
+	}
+
+	out, err := d.net.RunOutput(args...)
+	if err != nil {
+		return "", err
+	}
+	var resp struct {
+		Token       string `json:"token"`
+		AccessToken string `json:"access_token"`
+	}
+	if err := json.Unmarshal([]byte(out), &resp); err != nil {
+		return "", fmt.Errorf("error decoding token response: %w", err)
+	}
+	if resp.Token != "" {
+		return resp.Token, nil
+	}
+	if resp.AccessToken != "" {
+		return resp.AccessToken, nil
+	}
+	return "", fmt.Errorf("no token in token response")
+}
+
+// responseHeader returns the value of the last occurrence of the header key in the
+// output of curl with the response headers dumped to stdout.
+func responseHeader(output, key string) (val string) {
+	for _, line := range strings.Split(output, "\n") {
+		if k, v, ok := strings.Cut(strings.TrimSpace(line), ":"); ok && strings.EqualFold(k, key) {
+			val = strings.TrimSpace(v)
+		}
+	}
+	return val
+}
+
+// parseChallenge parses the WWW-Authenticate header value e.g.
+// Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull".
+func parseChallenge(header string) (scheme string, params map[string]string) {
+	scheme, rest, _ := strings.Cut(strings.TrimSpace(header), " ")
+	params = map[string]string{}
+	for rest = strings.TrimSpace(rest); rest != ""; {
+		key, val, ok := strings.Cut(rest, "=")
+		if !ok {
+			break
+		}
+		key = strings.ToLower(strings.TrimSpace(key))
+		// quoted values may contain commas e.g. multiple scopes
+		if strings.HasPrefix(val, `"`) {
+			val = val[1:]
+			v, r, _ := strings.Cut(val, `"`)
+			params[key], rest = v, r
+		} else {
+			v, r, _ := strings.Cut(val, ",")
+			params[key], rest = strings.TrimSpace(v), r
+		}
+		rest = strings.TrimSpace(strings.TrimLeft(strings.TrimSpace(rest), ","))
+	}
+	return scheme, params
+}
@@ -0,0 +1,198 @@
+package downloader
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func Test_parseOCIReference(t *testing.T) {
+	tests := []struct {
+		ref     string
+		want    ociReference
+		wantErr bool
+	}{
+		{ref: "oci://registry.local/k3s/airgap:v1.28.3", want: ociReference{registry: "registry.local", repository: "k3s/airgap", reference: "v1.28.3"}},
+		{ref: "oci://registry.local:5000/k3s", want: ociReference{registry: "registry.local:5000", repository: "k3s", reference: "latest"}},
+		{ref: "oci://registry.local/k3s@sha256:abc", want: ociReference{registry: "registry.local", repository: "k3s", reference: "sha256:abc"}},
+		{ref: "oci://registry.local", wantErr: true},
+		{ref: "oci://registry.local/k3s:", wantErr: true},
+	}
+	for _, tt := range tests {
+		t.Run(tt.ref, func(t *testing.T) {
+			got, err := parseOCIReference(tt.ref)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("parseOCIReference() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if got != tt.want {
+				t.Errorf("parseOCIReference() = %+v, want %+v", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestDownload_oci(t *testing.T) {
+	const manifest = `{
+  "mediaType": "application/vnd.oci.image.manifest.v1+json",
+  "layers": [
+    {"digest": "sha256:aaa", "annotations": {"org.opencontainers.image.title": "k3s"}},
+    {"digest": "sha256:bbb", "annotations": {"org.opencontainers.image.title": "k3s-airgap-images-amd64.tar.gz"}}
+  ]
+}`
+	const blobURL = "https://registry.local/v2/k3s/blobs/sha256:bbb"
+
+	setup(t)
+	host := &fakeHost{responses: []string{"HTTP/2 200\n\n200 https://registry.local/v2/k3s/manifests/v1.28.3", manifest, "HTTP/2 307\nlocation: https://cdn.local/bbb\n\nHTTP/2 200\n\n200 https://cdn.local/bbb"}}
+	guest := &fakeGuest{}
+
+	r := Request{URL: "oci://registry.local/k3s:v1.28.3", Filename: "/tmp/k3s-airgap-images-amd64.tar.gz"}
+	if err := Download(host, guest, r); err != nil {
+		t.Fatal(err)
+	}
+
+	if got := host.count("curl -sL --fail -A " + DefaultUserAgent() + " -H Accept: " + ociManifestType + " https://registry.local/v2/k3s/manifests/v1.28.3"); got != 1 {
+		t.Errorf("manifest requests = %d, want 1 in %+v", got, host.commands)
+	}
+	if got := host.count("curl -Ls -A " + DefaultUserAgent() + " --speed-limit 1 --speed-time 300 -o /dev/null -D - -w %{http_code} %{url_effective} " + blobURL); got != 1 {
+		t.Errorf("blob requests = %d, want 1 in %+v", got, host.commands)
+	}
+	if got := host.count("curl -L --fail -# -C -"); got != 1 {
+		t.Errorf("transfers = %d, want 1", got)
+	}
+	// verified against the digest without a shasum file
+	if got := host.count(`sh -c cd `); got != 1 {
+		t.Errorf("verifications = %d, want 1 in %+v", got, host.commands)
+	}
+	if got := host.count("sh -c curl"); got != 0 {
+		t.Errorf("unexpected shasum downloads in %+v", host.commands)
+	}
+	cacheFile := downloader{host: host}.cacheFilename(blobURL)
+	if got := len(guest.commands); got != 1 || guest.commands[0] != "cp "+cacheFile+" "+r.Filename {
+		t.Errorf("guest commands = %+v, want copy of %s", guest.commands, cacheFile)
+	}
+}
+
+func TestDownload_ociAuth(t *testing.T) {
+	const manifest = `{"layers": [{"digest": "sha256:aaa"}]}`
+	const manifestURL = "https://registry.local/v2/org/k3s/manifests/v1.28.3"
+	const blobURL = "https://registry.local/v2/org/k3s/blobs/sha256:aaa"
+	const challenge = "HTTP/2 401\nwww-authenticate: Bearer realm=\"https://auth.local/token\",service=\"registry.local\",scope=\"repository:org/k3s:pull\"\n\n401 " + manifestURL
+	const tokenURL = "https://auth.local/token?scope=repository%3Aorg%2Fk3s%3Apull&service=registry.local"
+
+	tests := []struct {
+		name       string
+		registries map[string]RegistryAuth
+		responses  []string
+		want       []string
+		wantErr    bool
+	}{
+		{
+			name:      "anonymous token",
+			responses: []string{challenge, `{"token": "anon"}`, manifest, "HTTP/2 200\n\n200 " + blobURL},
+			want: []string{
+				"curl -sL --fail -A " + DefaultUserAgent() + " " + tokenURL,
+				"curl -sL --fail -A " + DefaultUserAgent() + " -H Accept: " + ociManifestType + " -H Authorization: Bearer anon " + manifestURL,
+				"curl -Ls -A " + DefaultUserAgent() + " --speed-limit 1 --speed-time 300 -H Authorization: Bearer anon -o /dev/null",
+				"curl -L --fail -# -C - -A " + DefaultUserAgent() + " --speed-limit 1 --speed-time 300 -H Authorization: Bearer anon -o",
+			},
+		},
+		{
+			name:       "credentials token",
+			registries: map[string]RegistryAuth{"registry.local": {Username: "user", Password: "pass"}},
+			responses:  []string{challenge, `{"access_token": "secret"}`, manifest, "HTTP/2 200\n\n200 " + blobURL},
+			want: []string{
+				"curl -sL --fail -A " + DefaultUserAgent() + " -H Authorization: Basic dXNlcjpwYXNz " + tokenURL,
+				"curl -sL --fail -A " + DefaultUserAgent() + " -H Accept: " + ociManifestType + " -H Authorization: Bearer secret " + manifestURL,
+			},
+		},
+		{
+			name:       "basic",
+			registries: map[string]RegistryAuth{"registry.local": {Auth: "dXNlcjpwYXNz"}},
+			responses:  []string{"HTTP/2 401\nwww-authenticate: Basic realm=\"registry\"\n\n401 " + manifestURL, manifest, "HTTP/2 200\n\n200 " + blobURL},
+			want: []string{
+				"curl -sL --fail -A " + DefaultUserAgent() + " -H Accept: " + ociManifestType + " -H Authorization: Basic dXNlcjpwYXNz " + manifestURL,
+			},
+		},
+		{
+			name:      "basic without credentials",
+			responses: []string{"HTTP/2 401\nwww-authenticate: Basic realm=\"registry\"\n\n401 " + manifestURL},
+			wantErr:   true,
+		},
+		{
+			name:      "redirected blob",
+			responses: []string{challenge, `{"token": "anon"}`, manifest, "HTTP/2 307\nlocation: https://cdn.local/aaa\n\nHTTP/2 200\n\n200 https://cdn.local/aaa"},
+			// the token is not sent to the storage the registry redirects to
+			want: []string{"curl -L --fail -# -C - -A " + DefaultUserAgent() + " --speed-limit 1 --speed-time 300 -o"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			setup(t)
+			host := &fakeHost{responses: tt.responses}
+
+			r := Request{URL: "oci://registry.local/org/k3s:v1.28.3", Filename: "/tmp/k3s", Registries: tt.registries}
+			err := Download(host, &fakeGuest{}, r)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("Download() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			for _, prefix := range tt.want {
+				if got := host.count(prefix); got != 1 {
+					t.Errorf("requests with prefix %q = %d, want 1 in %+v", prefix, got, host.commands)
+				}
+			}
+		})
+	}
+}
+
+func TestDownload_ociRequest(t *testing.T) {
+	const manifestURL = "https://registry.local/v2/k3s/manifests/latest"
+	const blobURL = "https://registry.local/v2/k3s/blobs/sha256:aaa"
+
+	setup(t)
+	host := &fakeHost{}
+	guest := &fakeGuest{responses: []string{"HTTP/2 200\n\n200 " + manifestURL, `{"layers": [{"digest": "sha256:aaa"}]}`, "HTTP/2 200\n\n200 " + blobURL}}
+
+	// the fields of the request apply to the download of the blob
+	r := Request{URL: "oci://registry.local/k3s", Filename: "/tmp/k3s", Mode: ModeGuest, Timeout: 90 * time.Second, UserAgent: "mirror-client/1.0"}
+	if err := Download(host, guest, r); err != nil {
+		t.Fatal(err)
+	}
+	if len(host.commands) != 0 {
+		t.Errorf("unexpected host commands %+v", host.commands)
+	}
+	if !hasPrefix(guest.commands, "curl -L --fail -# -C - -A mirror-client/1.0 --speed-limit 1 --speed-time 90 -o /tmp/k3s.downloading "+blobURL) {
+		t.Errorf("blob not downloaded in the guest with the request fields: %+v", guest.commands)
+	}
+	if last := guest.commands[len(guest.commands)-1]; last != "mv /tmp/k3s.downloading /tmp/k3s" {
+		t.Errorf("expected the download to be moved to the destination, got %s", last)
+	}
+}
+
+func Test_parseChallenge(t *testing.T) {
+	tests := []struct {
+		header     string
+		wantScheme string
+		want       map[string]string
+	}{
+		{
+			header:     `Bearer realm="https://auth.docker.io/token",service="registry.docker.io",scope="repository:library/alpine:pull"`,
+			wantScheme: "Bearer",
+			want:       map[string]string{"realm": "https://auth.docker.io/token", "service": "registry.docker.io", "scope": "repository:library/alpine:pull"},
+		},
+		{
+			header:     `Bearer realm="https://ghcr.io/token", scope="repository:org/k3s:pull,push", service=ghcr.io`,
+			wantScheme: "Bearer",
+			want:       map[string]string{"realm": "https://ghcr.io/token", "scope": "repository:org/k3s:pull,push", "service": "ghcr.io"},
+		},
+		{header: `Basic realm="registry"`, wantScheme: "Basic", want: map[string]string{"realm": "registry"}},
+	}
+	for _, tt := range tests {
+		t.Run(strings.Fields(tt.header)[0], func(t *testing.T) {
+			scheme, params := parseChallenge(tt.header)
+			if scheme != tt.wantScheme || !reflect.DeepEqual(params, tt.want) {
+				t.Errorf("parseChallenge() = %s %v, want %s %v", scheme, params, tt.wantScheme, tt.want)
+			}
+		})
+	}
+}
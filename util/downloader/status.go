@@ -0,0 +1,84 @@
+package downloader
+
+import (
+	"bufio"
+	"fmt"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// StatusError is the error for an unsuccessful HTTP response to a download request.
+type StatusError struct {
+	URL        string
+	Code       int
+	RetryAfter time.Duration // the value of the Retry-After header (if any)
+}
+
+// Error implements error
+func (s StatusError) Error() string {
+	return fmt.Sprintf("server responded with status %d (%s) for '%s'", s.Code, http.StatusText(s.Code), s.URL)
+}
+
+// Retryable returns if the download should be retried for the status.
+func (s StatusError) Retryable() bool {
+	switch s.Code {
+	case http.StatusTooManyRequests,
+		http.StatusInternalServerError,
+		http.StatusBadGateway,
+		http.StatusServiceUnavailable,
+		http.StatusGatewayTimeout:
+		return true
+	}
+	return false
+}
+
+// parseResponse parses the output of curl with the response headers dumped to stdout
+// followed by "%{http_code} %{url_effective}".
+func parseResponse(url, output string) (effectiveURL string, err error) {
+	var lastLine string
+	var retryAfter time.Duration
+
+	scanner := bufio.NewScanner(strings.NewReader(output))
+	for scanner.Scan() {
+		line := strings.TrimSpace(scanner.Text())
+		if line == "" {
+			continue
+		}
+		lastLine = line
+
+		// headers of redirects are also present, the last occurrence applies
+		if key, val, ok := strings.Cut(line, ":"); ok && strings.EqualFold(key, "Retry-After") {
+			retryAfter = parseRetryAfter(strings.TrimSpace(val))
+		}
+	}
+
+	code, effectiveURL, ok := strings.Cut(lastLine, " ")
+	if !ok {
+		return "", fmt.Errorf("unexpected response for '%s': %s", url, strconv.Quote(lastLine))
+	}
+	status, err := strconv.Atoi(code)
+	if err != nil {
+		return "", fmt.Errorf("invalid status code '%s' for '%s'", code, url)
+	}
+
+	if status >= 400 {
+		return "", StatusError{URL: url, Code: status, RetryAfter: retryAfter}
+	}
+
+	return effectiveURL, nil
+}
+
+// parseRetryAfter parses the Retry-After header value in seconds or HTTP date.
+func parseRetryAfter(val string) time.Duration {
+	if seconds, err := strconv.Atoi(val); err == nil && seconds > 0 {
+		return time.Duration(seconds) * time.Second
+	}
+	if t, err := http.ParseTime(val); err == nil {
+		if d := time.Until(t); d > 0 {
+			return d
+		}
+	}
+	return 0
+}
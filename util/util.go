@@ -47,6 +47,12 @@ func ShellSplit(cmd string) []string {
 	return split
 }
 
+// ShellQuote quotes s as a single word for a POSIX shell. The value is not expanded by
+// the shell, single quotes in s are escaped.
+func ShellQuote(s string) string {
+	return "'" + strings.ReplaceAll(s, "'", `'\''`) + "'"
+}
+
 // CleanPath returns the absolute path to the mount location.
 // If location is an empty string, nothing is done.
 func CleanPath(location string) (string, error) {